@@ -1,10 +1,14 @@
 package cache
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 	"wiki2book/config"
@@ -15,17 +19,23 @@ import (
 )
 
 const (
-	TempDirName          = ".tmp"
-	ArticleCacheDirName  = "articles"
-	HtmlCacheDirName     = "html"
-	StatsCacheDirName    = "stats"
-	ImageCacheDirName    = "images"
-	MathCacheDirName     = "math"
-	TemplateCacheDirName = "templates"
+	TempDirName           = ".tmp"
+	ArticleCacheDirName   = "articles"
+	HtmlCacheDirName      = "html"
+	StatsCacheDirName     = "stats"
+	MarkdownCacheDirName  = "markdown"
+	ImageCacheDirName     = "images"
+	MathCacheDirName      = "math"
+	TemplateCacheDirName  = "templates"
+	DumpIndexCacheDirName = "dump-index"
 )
 
 var (
 	cacheWriteMutex = &sync.Mutex{}
+
+	// persistentCacheDirNames are the cache folders whose files are neither outdated nor evicted. Their files are
+	// expensive to create and stay valid as long as their source doesn't change, like the index of a dump file.
+	persistentCacheDirNames = []string{DumpIndexCacheDirName}
 )
 
 func GetFilePathInCache(cacheFolderName string, filename string) string {
@@ -46,84 +56,112 @@ func GetDirPathInCache(cacheFolderName string) string {
 	return filepath.Join(config.Current.CacheDir, cacheFolderName)
 }
 
-func GetTempPath() string {
-	return filepath.Join(config.Current.CacheDir, TempDirName)
-}
-
 // CacheToFile writes the data from the reader into a file within the app cache. The cacheFolderName is the name of the
 // folder within the cache, not a whole path. The filename is the name of the file in the cache. The full path is always
 // returned. The error is only set when an error occurred.
 func CacheToFile(cacheFolderName string, filename string, reader io.Reader) (string, error) {
-	cacheWriteMutex.Lock()
-	defer cacheWriteMutex.Unlock()
+	// Reading the data (e.g. downloading a file) might take a while, so the cache is only locked afterward.
+	tempFilepath, tempFileSizeInBytes, err := writeTempFile(filename, reader)
+	if tempFilepath != "" {
+		defer util.CurrentFilesystem.Remove(tempFilepath)
+	}
+	if err != nil {
+		return GetFilePathInCache(cacheFolderName, filename), err
+	}
 
-	sanitizedFilename := util.SanitizeFilename(filename)
+	unlock, err := lockCache()
+	if err != nil {
+		return GetFilePathInCache(cacheFolderName, filename), err
+	}
 
-	outputFilepath := GetFilePathInCache(cacheFolderName, filename)
-	sigolo.Debugf("Write data to cache file '%s'", outputFilepath)
+	outputFilepath, err := moveTempFileIntoCache(getIndex(), cacheFolderName, filename, tempFilepath, tempFileSizeInBytes)
+	unlock()
+	if err != nil {
+		return outputFilepath, err
+	}
 
-	// Create the output folder
-	outputFolderPath := GetDirPathInCache(cacheFolderName)
-	sigolo.Tracef("Ensure cache folder '%s'", outputFolderPath)
-	err := util.CurrentFilesystem.MkdirAll(outputFolderPath)
-	if err != nil && !os.IsExist(err) {
-		return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable to create output folder '%s'", outputFolderPath))
+	saveInStore(indexPath(cacheFolderName, filename))
+	return outputFilepath, nil
+}
+
+// cacheToFile works like CacheToFile but expects the caller to hold the cache lock (s. lockCache). The file is not
+// saved in the cache store.
+func cacheToFile(index *cacheIndex, cacheFolderName string, filename string, reader io.Reader) (string, error) {
+	tempFilepath, tempFileSizeInBytes, err := writeTempFile(filename, reader)
+	if tempFilepath != "" {
+		defer util.CurrentFilesystem.Remove(tempFilepath)
+	}
+	if err != nil {
+		return GetFilePathInCache(cacheFolderName, filename), err
 	}
 
-	//
-	// 1. Write to temporary file. This prevents broken files on disk in case the application exits during writing.
-	//
+	return moveTempFileIntoCache(index, cacheFolderName, filename, tempFilepath, tempFileSizeInBytes)
+}
+
+// writeTempFile writes the data from the reader into a new file within the temp folder of this process. This prevents
+// broken files on disk in case the application exits during writing. The path and size of the temp file are returned.
+// The path is empty when the temp file couldn't be created.
+func writeTempFile(filename string, reader io.Reader) (string, int64, error) {
+	sanitizedFilename := util.SanitizeFilename(filename)
+
+	tempPath := GetTempPath()
+	err := util.CurrentFilesystem.MkdirAll(tempPath)
+	if err != nil && !os.IsExist(err) {
+		return "", 0, errors.Wrap(err, fmt.Sprintf("Unable to create temp folder '%s'", tempPath))
+	}
 
 	// Create the output file
-	tempFile, err := util.CurrentFilesystem.CreateTemp(GetTempPath(), sanitizedFilename)
+	tempFile, err := util.CurrentFilesystem.CreateTemp(tempPath, sanitizedFilename)
 	if err != nil {
-		return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable to create temporary file '%s'", filepath.Join(GetTempPath(), filename)))
+		return "", 0, errors.Wrap(err, fmt.Sprintf("Unable to create temporary file '%s'", filepath.Join(tempPath, filename)))
 	}
 	defer tempFile.Close()
 	tempFilepath := tempFile.Name()
-	defer util.CurrentFilesystem.Remove(tempFilepath)
 	sigolo.Tracef("Create temp file '%s'", tempFilepath)
 
 	// Write the body to file
 	sigolo.Trace("Copy data to temp file")
 	_, err = io.Copy(tempFile, reader)
 	if err != nil {
-		return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable copy downloaded content to temp file '%s'", tempFilepath))
+		return tempFilepath, 0, errors.Wrap(err, fmt.Sprintf("Unable copy downloaded content to temp file '%s'", tempFilepath))
 	}
 
-	//
-	// 2. Evict files from cache in case it's overflowing when the new file is added.
-	//
-	sigolo.Tracef("Caching strategy is '%s'", config.Current.CacheEvictionStrategy)
-	if config.Current.CacheEvictionStrategy != config.CacheEvictionStrategyNone {
-		var cacheSizeInBytes int64
-		err, cacheSizeInBytes = util.CurrentFilesystem.DirSizeInBytes(config.Current.CacheDir)
-		if err != nil {
-			return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable to determine size of cache folder '%s'", config.Current.CacheDir))
-		}
-
-		var tempFileStat os.FileInfo
-		tempFileStat, err = tempFile.Stat()
-		if err != nil {
-			return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable to determine size of file '%s' to cache (tmp file '%s')", sanitizedFilename, tempFilepath))
-		}
-
-		tempFileSizeInBytes := tempFileStat.Size()
-		err = deleteFilesFromCacheIfNeeded(cacheFolderName, filename, tempFileSizeInBytes, cacheSizeInBytes)
-		if err != nil {
-			return outputFilepath, err
-		}
+	tempFileStat, err := tempFile.Stat()
+	if err != nil {
+		return tempFilepath, 0, errors.Wrap(err, fmt.Sprintf("Unable to determine size of file '%s' to cache (tmp file '%s')", sanitizedFilename, tempFilepath))
 	}
 
 	// Close file as it's not needed anymore. Without closing it, Windows has problems moving the file.
 	err = tempFile.Close()
 	if err != nil {
-		return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable to close temporary file '%s'", filepath.Join(GetTempPath(), filename)))
+		return tempFilepath, 0, errors.Wrap(err, fmt.Sprintf("Unable to close temporary file '%s'", tempFilepath))
+	}
+
+	return tempFilepath, tempFileStat.Size(), nil
+}
+
+// moveTempFileIntoCache moves the given temp file to its location within the cache and adds it to the index. Files are
+// evicted from the cache in case it's overflowing when the new file is added. The caller must hold the cache lock (s.
+// lockCache).
+func moveTempFileIntoCache(index *cacheIndex, cacheFolderName string, filename string, tempFilepath string, tempFileSizeInBytes int64) (string, error) {
+	outputFilepath := GetFilePathInCache(cacheFolderName, filename)
+	sigolo.Debugf("Write data to cache file '%s'", outputFilepath)
+
+	// Create the output folder
+	outputFolderPath := GetDirPathInCache(cacheFolderName)
+	sigolo.Tracef("Ensure cache folder '%s'", outputFolderPath)
+	err := util.CurrentFilesystem.MkdirAll(outputFolderPath)
+	if err != nil && !os.IsExist(err) {
+		return outputFilepath, errors.Wrap(err, fmt.Sprintf("Unable to create output folder '%s'", outputFolderPath))
 	}
 
-	//
-	// 3. Move file to actual location
-	//
+	sigolo.Tracef("Caching strategy is '%s'", config.Current.CacheEvictionStrategy)
+	if config.Current.CacheEvictionStrategy != config.CacheEvictionStrategyNone {
+		err = deleteFilesFromCacheIfNeeded(index, cacheFolderName, filename, tempFileSizeInBytes)
+		if err != nil {
+			return outputFilepath, err
+		}
+	}
 
 	sigolo.Tracef("Move temp file '%s' to '%s'", tempFilepath, outputFilepath)
 	err = util.CurrentFilesystem.Rename(tempFilepath, outputFilepath)
@@ -131,114 +169,448 @@ func CacheToFile(cacheFolderName string, filename string, reader io.Reader) (str
 		return outputFilepath, errors.Wrap(err, fmt.Sprintf("Error moving temp file '%s' to '%s'", tempFilepath, outputFilepath))
 	}
 
+	index.addFile(cacheFolderName, filename, tempFileSizeInBytes, time.Now())
+
 	sigolo.Tracef("Cached file '%s' to '%s'", filename, outputFilepath)
 	return outputFilepath, nil
 }
 
+// saveInStore saves the given file of the cache dir in the cache store. Errors are only logged, since the file is
+// usable from the cache dir anyway. The cache must not be locked meanwhile, since the store might be slow.
+func saveInStore(path string) {
+	err := getStore().save(path)
+	if err != nil {
+		sigolo.Warnf("Unable to save file '%s' in cache store: %s", path, err.Error())
+	}
+}
+
+// loadFromStore writes the given file from the cache store into the cache dir. The returned boolean is false when the
+// store doesn't contain the file.
+func loadFromStore(index *cacheIndex, cacheFolderName string, filename string) (bool, error) {
+	content, modTime, found, err := getStore().load(indexPath(cacheFolderName, filename))
+	if err != nil || !found {
+		return false, err
+	}
+
+	filePath, err := cacheToFile(index, cacheFolderName, filename, bytes.NewReader(content))
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to write file '%s' from cache store into cache", filename)
+	}
+
+	// Files from the store keep their age, so that they become outdated like any other cached file.
+	err = util.CurrentFilesystem.Chtimes(filePath, modTime, modTime)
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to set modification time of file '%s' from cache store", filePath)
+	}
+
+	return true, nil
+}
+
 // deleteFilesFromCacheIfNeeded deletes files from the cache based on the configured cache eviction strategy. When the
-// cache is small enough for the new file, no (further) files will be deleted.
-func deleteFilesFromCacheIfNeeded(cacheFolderName string, newFileName string, newFileSizeInBytes int64, cacheSizeInBytes int64) error {
+// cache is small enough for the new file, no (further) files will be deleted. The same applies to the cache folder of
+// the new file, when its policy restricts the share of the cache this folder can take (s. config.CachePolicy).
+func deleteFilesFromCacheIfNeeded(index *cacheIndex, cacheFolderName string, newFileName string, newFileSizeInBytes int64) error {
 	// The new file might already exist in an older state (and thus with different size). The file will, therefore, not
 	// just be added to the cache, but instead the old file will be replaced. The cache then grows much less in size or
 	// might even shrink (in case the new file is smaller than the old one).
 	var netCacheSizeChangeInBytes = newFileSizeInBytes
-	existingFileSizeInBytes, err := util.CurrentFilesystem.GetSizeInBytes(GetFilePathInCache(cacheFolderName, newFileName))
-	if err == nil {
+	existingFileSizeInBytes := int64(math.MinInt64)
+	newFilePath := indexPath(cacheFolderName, newFileName)
+	existingEntry, exists := index.entries[newFilePath]
+	if exists {
+		existingFileSizeInBytes = existingEntry.Size
 		netCacheSizeChangeInBytes = newFileSizeInBytes - existingFileSizeInBytes
 	}
 
-	sigolo.Debugf("Max cache size: %f MB; current size: %f MB; new file size: %f MB; existing file size: %f MB (NaN means there's no existing file); net cache size change: %f MB", util.ToMB(config.Current.CacheMaxSize), util.ToMB(cacheSizeInBytes), util.ToMB(newFileSizeInBytes), util.ToMB(existingFileSizeInBytes), util.ToMB(netCacheSizeChangeInBytes))
-	for config.Current.CacheMaxSize <= cacheSizeInBytes+netCacheSizeChangeInBytes {
-		sigolo.Debugf("New file (%s ; %f MB) would exceed max cache size: Max cache size of %f MB < current size of %f MB + net size change of %f MB = new size of %f MB. Remove largest files until cache is small enough.", newFileName, util.ToMB(newFileSizeInBytes), util.ToMB(config.Current.CacheMaxSize), util.ToMB(cacheSizeInBytes), util.ToMB(netCacheSizeChangeInBytes), util.ToMB(cacheSizeInBytes+netCacheSizeChangeInBytes))
+	// deleteFile returns false when no file was deleted because all files to consider are in use by other processes.
+	deleteFile := func(categoryNames ...string) (bool, error) {
+		deletedEntry, err := deleteFileByEvictionStrategy(index, categoryNames...)
+		if err != nil || deletedEntry == nil {
+			return false, err
+		}
 
-		if config.Current.CacheEvictionStrategy == config.CacheEvictionStrategyLargest {
-			err, cacheSizeInBytes = deleteLargestFileFromCache(cacheSizeInBytes)
-		} else if config.Current.CacheEvictionStrategy == config.CacheEvictionStrategyLru {
-			err, cacheSizeInBytes = deleteLruFileFromCache(cacheSizeInBytes)
-		} else {
-			sigolo.Fatalf("Unsupported cache eviction strategy '%s'. This is a Bug.", config.Current.CacheEvictionStrategy)
+		if deletedEntry == existingEntry {
+			// The existing file was removed, so the new file is simply added to the cache.
+			netCacheSizeChangeInBytes = newFileSizeInBytes
+			existingEntry = nil
+		}
+		return true, nil
+	}
+
+	category := categoryOfPath(newFilePath)
+	policy := config.Current.CachePolicy(category)
+	if policy.MaxSizeShare > 0 {
+		maxCategorySize := int64(policy.MaxSizeShare * float64(config.Current.CacheMaxSize))
+		for maxCategorySize <= index.categorySize(category)+netCacheSizeChangeInBytes {
+			sigolo.Debugf("New file (%s ; %f MB) would exceed max size of cache folder '%s' of %f MB (current size: %f MB). Remove files of this folder until it's small enough.", newFileName, util.ToMB(newFileSizeInBytes), category, util.ToMB(maxCategorySize), util.ToMB(index.categorySize(category)))
+
+			deleted, err := deleteFile(category)
+			if err != nil {
+				return err
+			}
+			if !deleted {
+				break
+			}
 		}
+	}
+
+	sigolo.Debugf("Max cache size: %f MB; current size: %f MB; new file size: %f MB; existing file size: %f MB (NaN means there's no existing file); net cache size change: %f MB", util.ToMB(config.Current.CacheMaxSize), util.ToMB(index.totalSize), util.ToMB(newFileSizeInBytes), util.ToMB(existingFileSizeInBytes), util.ToMB(netCacheSizeChangeInBytes))
+	for config.Current.CacheMaxSize <= index.totalSize+netCacheSizeChangeInBytes {
+		sigolo.Debugf("New file (%s ; %f MB) would exceed max cache size: Max cache size of %f MB < current size of %f MB + net size change of %f MB = new size of %f MB. Remove largest files until cache is small enough.", newFileName, util.ToMB(newFileSizeInBytes), util.ToMB(config.Current.CacheMaxSize), util.ToMB(index.totalSize), util.ToMB(netCacheSizeChangeInBytes), util.ToMB(index.totalSize+netCacheSizeChangeInBytes))
+
+		deleted, err := deleteFile()
 		if err != nil {
 			return err
 		}
+		if !deleted {
+			break
+		}
 	}
 
 	return nil
 }
 
-func deleteLargestFileFromCache(cacheSizeInBytes int64) (error, int64) {
-	var err error
-	var largestFilePath string
-	var largestFileSizeInBytes int64
-	err, largestFileSizeInBytes, largestFilePath = util.CurrentFilesystem.FindLargestFile(config.Current.CacheDir, TempDirName)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to determine largest file in cache '%s'", config.Current.CacheDir)), cacheSizeInBytes
+// deleteFileByEvictionStrategy deletes the file that should be removed first according to the configured cache
+// eviction strategy. Only files of the given categories (i.e. cache folders) are considered. Without given categories,
+// the files of the categories with the highest eviction priority (s. config.CachePolicy) are considered. Files, which
+// might be in use by other running processes, are not deleted (s. getEvictionProtectionTime). The index entry of the
+// deleted file is returned. The entry is nil when all files to consider are in use.
+func deleteFileByEvictionStrategy(index *cacheIndex, categoryNames ...string) (*IndexEntry, error) {
+	if len(categoryNames) == 0 {
+		categoryNames = categoriesWithHighestEvictionPriority(index)
+		if len(categoryNames) == 0 && len(index.entries) > 0 {
+			sigolo.Warnf("Cache '%s' only contains files that are never deleted. The cache might therefore exceed its max size.", config.Current.CacheDir)
+			return nil, nil
+		}
 	}
 
-	sigolo.Debugf("Delete largest file from cache: '%s' (%f MB)", largestFilePath, util.ToMB(largestFileSizeInBytes))
-	err = util.CurrentFilesystem.Remove(largestFilePath)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to remove largest file '%s'", largestFilePath)), cacheSizeInBytes
+	var findEntry func(categoryNames ...string) *IndexEntry
+	var findEntryAccessedBefore func(accessTime time.Time, categoryNames ...string) *IndexEntry
+	if config.Current.CacheEvictionStrategy == config.CacheEvictionStrategyLargest {
+		findEntry = index.largestEntry
+		findEntryAccessedBefore = index.largestEntryAccessedBefore
+	} else if config.Current.CacheEvictionStrategy == config.CacheEvictionStrategyLru {
+		findEntry = index.lruEntry
+		findEntryAccessedBefore = index.lruEntryAccessedBefore
+	} else {
+		sigolo.Fatalf("Unsupported cache eviction strategy '%s'. This is a Bug.", config.Current.CacheEvictionStrategy)
+	}
+
+	entryToDelete := findEntry(categoryNames...)
+	if entryToDelete != nil {
+		protectionTime := getEvictionProtectionTime()
+		if !protectionTime.IsZero() && !entryToDelete.LastAccess.Before(protectionTime) {
+			sigolo.Tracef("File '%s' might be in use by another process, look for other files to delete", entryToDelete.Path)
+			entryToDelete = findEntryAccessedBefore(protectionTime, categoryNames...)
+			if entryToDelete == nil {
+				sigolo.Warnf("All files in cache '%s' that could be deleted might be in use by other processes. The cache might therefore exceed its max size.", config.Current.CacheDir)
+				return nil, nil
+			}
+		}
+
+		sigolo.Debugf("Delete file from cache according to eviction strategy '%s': '%s' (%f MB)", config.Current.CacheEvictionStrategy, entryToDelete.Path, util.ToMB(entryToDelete.Size))
 	}
 
-	return err, cacheSizeInBytes - largestFileSizeInBytes
+	return entryToDelete, deleteFileFromCache(index, entryToDelete)
 }
 
-func deleteLruFileFromCache(cacheSizeInBytes int64) (error, int64) {
-	var err error
-	var lruFilePath string
-	var lruFileSizeInBytes int64
-	err, lruFileSizeInBytes, lruFilePath = util.CurrentFilesystem.FindLruFile(config.Current.CacheDir, TempDirName)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to determine least recently used file in cache '%s'", config.Current.CacheDir)), cacheSizeInBytes
+// categoriesWithHighestEvictionPriority returns all non-empty categories of the index, whose cache policy has the
+// highest eviction priority. Persistent categories are never part of the result.
+func categoriesWithHighestEvictionPriority(index *cacheIndex) []string {
+	var result []string
+	highestPriority := math.MinInt
+	for _, categoryName := range index.categoryNames() {
+		if isPersistentCategory(categoryName) {
+			continue
+		}
+		priority := config.Current.CachePolicy(categoryName).EvictionPriority
+		if priority > highestPriority {
+			highestPriority = priority
+			result = []string{categoryName}
+		} else if priority == highestPriority {
+			result = append(result, categoryName)
+		}
 	}
+	return result
+}
 
-	sigolo.Debugf("Delete least recently used file from cache: '%s' (%f MB)", lruFilePath, util.ToMB(lruFileSizeInBytes))
-	err = util.CurrentFilesystem.Remove(lruFilePath)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Unable to remove least recently used file '%s'", lruFilePath)), cacheSizeInBytes
+// deleteFileFromCache removes the file of the given index entry from the cache and the index. Files that don't exist
+// anymore are just removed from the index.
+func deleteFileFromCache(index *cacheIndex, entry *IndexEntry) error {
+	if entry == nil {
+		return errors.Errorf("Unable to delete files from cache '%s' since it is empty", config.Current.CacheDir)
 	}
 
-	return err, cacheSizeInBytes - lruFileSizeInBytes
+	filePath := filepath.Join(config.Current.CacheDir, filepath.FromSlash(entry.Path))
+	err := util.CurrentFilesystem.Remove(filePath)
+	if os.IsNotExist(err) {
+		sigolo.Debugf("File '%s' from cache index does not exist anymore", filePath)
+	} else if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Unable to remove file '%s'", filePath))
+	}
+
+	index.removeFile(entry.Path)
+	return nil
 }
 
 // GetFile determines whether the file is caches or not. It already returns the full file path, a boolean and an error.
 // The boolean only has a meaning when the error is nil. In such cases "true" means the file exists and can be used,
 // "false" means the file doesn't exist. In case of an error, the boolean is always "false".
 func GetFile(cacheFolderName string, filename string) (string, bool, error) {
-	cacheWriteMutex.Lock()
-	defer cacheWriteMutex.Unlock()
+	filePath, fileIsUsable, _, err := getFile(cacheFolderName, filename, false)
+	return filePath, fileIsUsable, err
+}
+
+// GetFileWithValidators works like GetFile, but outdated files with validators (s. SetValidators) are not removed.
+// Instead, their validators are returned, so that the caller can check whether the file is still up-to-date. The
+// validators are nil for usable, not existing and removed files.
+func GetFileWithValidators(cacheFolderName string, filename string) (string, bool, *Validators, error) {
+	return getFile(cacheFolderName, filename, true)
+}
+
+func getFile(cacheFolderName string, filename string, keepFilesWithValidators bool) (string, bool, *Validators, error) {
+	unlock, err := lockCache()
+	if err != nil {
+		return GetFilePathInCache(cacheFolderName, filename), false, nil, err
+	}
+	defer unlock()
 
 	filePath := GetFilePathInCache(cacheFolderName, filename)
 
 	fileIsOutdated, fileExists, err := isOutdated(cacheFolderName, filename)
 	if err != nil {
-		return filePath, false, errors.Wrapf(err, "Unable to determine if file '%s' is outdated", filename)
+		return filePath, false, nil, errors.Wrapf(err, "Unable to determine if file '%s' is outdated", filename)
+	}
+	index := getIndex()
+	if !fileExists {
+		fileExists, err = loadFromStore(index, cacheFolderName, filename)
+		if err != nil {
+			return filePath, false, nil, err
+		}
+		if fileExists {
+			fileIsOutdated, fileExists, err = isOutdated(cacheFolderName, filename)
+			if err != nil {
+				return filePath, false, nil, errors.Wrapf(err, "Unable to determine if file '%s' is outdated", filename)
+			}
+		}
 	}
 	if !fileExists {
 		// A "file not found" situation is not unusual and not considered an error. Simply return that the file doesn't exist.
-		return filePath, false, nil
+		index.removeFile(indexPath(cacheFolderName, filename))
+		return filePath, false, nil, nil
 	}
 
 	if fileIsOutdated {
+		if keepFilesWithValidators {
+			validators := getValidators(cacheFolderName, filename)
+			if validators != nil {
+				sigolo.Debugf("File '%s' is outdated but has validators, so I'll keep it to check if it's still up-to-date", filename)
+				return filePath, false, validators, nil
+			}
+		}
+
 		sigolo.Debugf("File '%s' is outdated, I'll try to remove it", filename)
 		err = util.CurrentFilesystem.Remove(filePath)
 		if err != nil {
-			return filePath, false, errors.Wrap(err, fmt.Sprintf("Unable to remove oudated file '%s'", filePath))
+			return filePath, false, nil, errors.Wrap(err, fmt.Sprintf("Unable to remove oudated file '%s'", filePath))
 		}
+		index.removeFile(indexPath(cacheFolderName, filename))
+		return filePath, false, nil, nil
+	}
+
+	markAccessed(index, cacheFolderName, filename)
+
+	return filePath, true, nil, nil
+}
+
+// MarkAccessed updates the last access of the given cached file without checking whether it's outdated. This protects
+// files used by this process from being evicted by other processes (s. getEvictionProtectionTime), even when they're
+// not read via GetFile, e.g. images referenced by reused HTML files. Nothing happens when the file doesn't exist.
+func MarkAccessed(cacheFolderName string, filename string) error {
+	unlock, err := lockCache()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = util.CurrentFilesystem.Stat(GetFilePathInCache(cacheFolderName, filename))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "Unable to determine file stats of file '%s'", filename)
 	}
 
+	markAccessed(getIndex(), cacheFolderName, filename)
+	return nil
+}
+
+// markAccessed updates the last access of the given existing file. The cache lock must be held when calling this
+// function.
+func markAccessed(index *cacheIndex, cacheFolderName string, filename string) {
+	now := time.Now()
 	if config.Current.CacheEvictionStrategy == config.CacheEvictionStrategyLru {
 		// When using the LRU cache, update access and modification time (both, since linux usually only knows the
 		// latter) to correctly determine the least recently used file.
-		now := time.Now()
-		err = util.CurrentFilesystem.Chtimes(filePath, now, now)
+		err := util.CurrentFilesystem.Chtimes(GetFilePathInCache(cacheFolderName, filename), now, now)
 		if err != nil {
 			sigolo.Warnf("Unable to update access-time of file '%s': %s. This has no direct negative effect on the further execution.", filename, err.Error())
 		}
 	}
+	updateLastAccess(index, cacheFolderName, filename, now)
+}
+
+// updateLastAccess sets the last access of the given file in the index. Files unknown to the index (e.g. because they
+// were added by other tools) are added to the index.
+func updateLastAccess(index *cacheIndex, cacheFolderName string, filename string, lastAccess time.Time) {
+	if _, exists := index.entries[indexPath(cacheFolderName, filename)]; exists {
+		index.updateEntry(cacheFolderName, filename, func(entry *IndexEntry) {
+			entry.LastAccess = lastAccess
+		})
+		return
+	}
+
+	filePath := GetFilePathInCache(cacheFolderName, filename)
+	fileStat, err := util.CurrentFilesystem.Stat(filePath)
+	if err != nil {
+		sigolo.Warnf("Unable to add file '%s' to cache index: %s", filePath, err.Error())
+		return
+	}
+	index.addFile(cacheFolderName, filename, fileStat.Size(), lastAccess)
+}
+
+// RegisterFile updates the index entry of the given file within the cache. This is needed for files created or
+// changed without CacheToFile, e.g. by external tools, so that their size is considered by the cache eviction.
+func RegisterFile(filePath string) error {
+	relativePath, err := registerFile(filePath)
+	if err != nil {
+		return err
+	}
 
-	return filePath, !fileIsOutdated, nil
+	saveInStore(relativePath)
+	return nil
+}
+
+// registerFile adds the given file to the cache index and returns its path relative to the cache dir.
+func registerFile(filePath string) (string, error) {
+	unlock, err := lockCache()
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to register file '%s' in cache index", filePath)
+	}
+	defer unlock()
+
+	relativePath, err := GetPathRelativeToCache(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to register file '%s' in cache index", filePath)
+	}
+	relativePath = filepath.ToSlash(relativePath)
+	if strings.HasPrefix(relativePath, "../") {
+		return "", errors.Errorf("Unable to register file '%s' in cache index since it's not within the cache '%s'", filePath, config.Current.CacheDir)
+	}
+
+	fileStat, err := util.CurrentFilesystem.Stat(filePath)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to determine size of file '%s' to register in cache index", filePath)
+	}
+
+	getIndex().addPath(relativePath, fileStat.Size(), time.Now())
+	return relativePath, nil
+}
+
+// SetOrigin stores the URL from which the given cached file was downloaded and the hash of the downloaded content in
+// the cache index.
+func SetOrigin(cacheFolderName string, filename string, url string, contentHash string) {
+	unlock, err := lockCache()
+	if err != nil {
+		sigolo.Warnf("Unable to store URL and hash of file '%s' in cache index: %s", filename, err.Error())
+		return
+	}
+	defer unlock()
+
+	getIndex().updateEntry(cacheFolderName, filename, func(entry *IndexEntry) {
+		entry.Url = url
+		entry.Sha256 = contentHash
+	})
+}
+
+// GetContentHash returns the hash of the downloaded content of the given cached file (s. SetOrigin). An empty string
+// is returned when the hash is unknown, e.g. because the file hasn't been downloaded.
+func GetContentHash(cacheFolderName string, filename string) string {
+	unlock, err := lockCache()
+	if err != nil {
+		sigolo.Warnf("Unable to read hash of file '%s' from cache index: %s", filename, err.Error())
+		return ""
+	}
+	defer unlock()
+
+	entry, exists := getIndex().entries[indexPath(cacheFolderName, filename)]
+	if !exists {
+		return ""
+	}
+	return entry.Sha256
+}
+
+// Validators of a cached file are the values of the "ETag" and "Last-Modified" response headers of the request that
+// downloaded the file or the revision of the downloaded article. They are used to check whether an outdated file is
+// still up-to-date without downloading it.
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last-modified,omitempty"`
+	Revision     int    `json:"revision,omitempty"`
+}
+
+// SetValidators stores the given validators of the cached file in the cache index. Existing validators are removed
+// when the given validators are empty.
+func SetValidators(cacheFolderName string, filename string, validators Validators) error {
+	unlock, err := lockCache()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	getIndex().updateEntry(cacheFolderName, filename, func(entry *IndexEntry) {
+		if validators == (Validators{}) {
+			entry.Validators = nil
+		} else {
+			entry.Validators = &validators
+		}
+	})
+	return nil
+}
+
+// getValidators returns the validators of the cached file or nil, when there are no validators. The cache lock must be
+// held when calling this function.
+func getValidators(cacheFolderName string, filename string) *Validators {
+	entry, exists := getIndex().entries[indexPath(cacheFolderName, filename)]
+	if !exists {
+		return nil
+	}
+	return entry.Validators
+}
+
+// Touch marks the cached file as up-to-date by updating its modification time. This is used when the server confirmed
+// that an outdated file is still up-to-date. The full file path is returned.
+func Touch(cacheFolderName string, filename string) (string, error) {
+	unlock, err := lockCache()
+	if err != nil {
+		return GetFilePathInCache(cacheFolderName, filename), err
+	}
+	defer unlock()
+
+	filePath := GetFilePathInCache(cacheFolderName, filename)
+
+	now := time.Now()
+	err = util.CurrentFilesystem.Chtimes(filePath, now, now)
+	if err != nil {
+		return filePath, errors.Wrapf(err, "Unable to update modification time of file '%s'", filePath)
+	}
+	updateLastAccess(getIndex(), cacheFolderName, filename, now)
+
+	err = getStore().touch(indexPath(cacheFolderName, filename), now)
+	if err != nil {
+		sigolo.Warnf("Unable to update modification time of file '%s' in cache store: %s", filePath, err.Error())
+	}
+
+	return filePath, nil
 }
 
 // isOutdated returns whether the file is outdated and if the file even exists. When an error is returned, both boolean
@@ -255,10 +627,26 @@ func isOutdated(cacheFolderName string, filename string) (bool, bool, error) {
 		return false, false, errors.Wrapf(err, "Unable to determine file stats of tile '%s'", filePath)
 	}
 
-	fileAgeDuration := time.Now().Sub(fileStat.ModTime())
-	fileAgeInMinutes := int64(fileAgeDuration.Minutes())
-	fileIsOutdated := fileAgeInMinutes > config.Current.CacheMaxAge
-	sigolo.Tracef("File '%s' is outdated (age: %s, max age for files: %s)", filePath, fileAgeDuration, time.Duration(config.Current.CacheMaxAge)*time.Minute)
+	category := categoryOfPath(indexPath(cacheFolderName, filename))
+	if isPersistentCategory(category) {
+		return false, true, nil
+	}
+
+	maxAge := config.Current.CachePolicy(category).MaxAge
+	fileIsOutdated := isFileOutdated(fileStat, maxAge)
+	sigolo.Tracef("File '%s' is outdated: %t (age: %s, max age for files: %s)", filePath, fileIsOutdated, time.Now().Sub(fileStat.ModTime()), time.Duration(maxAge)*time.Minute)
 
 	return fileIsOutdated, true, nil
 }
+
+// isPersistentCategory returns whether the files of the given category (i.e. cache folder) are neither outdated nor
+// evicted (s. persistentCacheDirNames).
+func isPersistentCategory(categoryName string) bool {
+	return slices.Contains(persistentCacheDirNames, categoryName)
+}
+
+// isFileOutdated returns whether the modification time of the file is older than the given max age in minutes.
+func isFileOutdated(fileStat os.FileInfo, maxAge int64) bool {
+	fileAgeInMinutes := int64(time.Now().Sub(fileStat.ModTime()).Minutes())
+	return fileAgeInMinutes > maxAge
+}
@@ -70,295 +70,371 @@ func TestGetPathRelativeToCache(t *testing.T) {
 	test.AssertNil(t, err)
 }
 
-func TestDeleteLargestFileFromCache(t *testing.T) {
+func newTestIndex(entries ...*IndexEntry) *cacheIndex {
+	index := newCacheIndex(config.Current.CacheDir)
+	for _, entry := range entries {
+		if entry.Category == "" {
+			entry.Category = categoryOfPath(entry.Path)
+		}
+		index.put(entry)
+	}
+	return index
+}
+
+func TestDeleteFileFromCache(t *testing.T) {
 	// Arrange
-	expectedPath := "some/path/to/file.txt"
+	config.Current.CacheDir = "cache-dir"
+	entry := &IndexEntry{Path: "images/file.png", Size: 120_000}
+	index := newTestIndex(entry, &IndexEntry{Path: "images/other.png", Size: 1_110_000})
+
 	actualPath := ""
-	fsMock := &util.MockFilesystem{
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, 120_000, expectedPath
-		},
-		RemoveFunc: func(path string) error {
-			actualPath = path
-			return nil
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		actualPath = path
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err, newCacheSize := deleteLargestFileFromCache(1_230_000)
+	err := deleteFileFromCache(index, entry)
 
 	// Assert
 	test.AssertNil(t, err)
-	test.AssertEqual(t, 1_110_000, newCacheSize)
-	test.AssertEqual(t, expectedPath, actualPath)
+	test.AssertEqual(t, int64(1_110_000), index.totalSize)
+	test.AssertEqual(t, filepath.Join("cache-dir", "images", "file.png"), actualPath)
+	test.AssertEqual(t, 1, len(index.entries))
 }
 
-func TestDeleteLargestFileFromCache_errorFindingFile(t *testing.T) {
+func TestDeleteFileFromCache_notExistingFile(t *testing.T) {
 	// Arrange
-	expectedError := errors.New("test error")
-	fsMock := &util.MockFilesystem{
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return expectedError, -1, ""
-		},
+	config.Current.CacheDir = "cache-dir"
+	entry := &IndexEntry{Path: "images/file.png", Size: 120_000}
+	index := newTestIndex(entry)
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		return os.ErrNotExist
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err, newCacheSize := deleteLargestFileFromCache(1_230_000)
+	err := deleteFileFromCache(index, entry)
 
 	// Assert
-	test.AssertNotNil(t, err)
-	test.AssertTrue(t, strings.Contains(err.Error(), expectedError.Error()))
-	test.AssertEqual(t, 1_230_000, newCacheSize)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, int64(0), index.totalSize)
+	test.AssertEqual(t, 0, len(index.entries))
 }
 
-func TestDeleteLargestFileFromCache_errorRemovingFile(t *testing.T) {
+func TestDeleteFileFromCache_errorRemovingFile(t *testing.T) {
 	// Arrange
-	expectedPath := "some/path/to/file.txt"
+	config.Current.CacheDir = "cache-dir"
+	entry := &IndexEntry{Path: "images/file.png", Size: 120_000}
+	index := newTestIndex(entry)
+
 	expectedError := errors.New("test error")
-	fsMock := &util.MockFilesystem{
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, 120_000, expectedPath
-		},
-		RemoveFunc: func(path string) error {
-			return expectedError
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		return expectedError
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err, newCacheSize := deleteLargestFileFromCache(1_230_000)
+	err := deleteFileFromCache(index, entry)
 
 	// Assert
 	test.AssertNotNil(t, err)
 	test.AssertTrue(t, strings.Contains(err.Error(), expectedError.Error()))
-	test.AssertEqual(t, 1_230_000, newCacheSize)
+	test.AssertEqual(t, int64(120_000), index.totalSize)
 }
 
-func TestDeleteLruFromCache(t *testing.T) {
+func TestDeleteFileFromCache_emptyCache(t *testing.T) {
 	// Arrange
-	expectedPath := "some/path/to/file.txt"
-	actualPath := ""
-	fsMock := &util.MockFilesystem{
-		FindLruFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, 120_000, expectedPath
-		},
-		RemoveFunc: func(path string) error {
-			actualPath = path
-			return nil
-		},
-	}
-	util.CurrentFilesystem = fsMock
+	config.Current.CacheDir = "cache-dir"
+	index := newTestIndex()
 
 	// Act
-	err, newCacheSize := deleteLruFileFromCache(1_230_000)
+	err := deleteFileFromCache(index, index.largestEntry())
 
 	// Assert
-	test.AssertNil(t, err)
-	test.AssertEqual(t, 1_110_000, newCacheSize)
-	test.AssertEqual(t, expectedPath, actualPath)
+	test.AssertNotNil(t, err)
 }
 
-func TestDeleteLruFromCache_errorFindingFile(t *testing.T) {
+func TestDeleteFilesFromCacheIfNeeded_largest(t *testing.T) {
 	// Arrange
-	expectedError := errors.New("test error")
-	fsMock := &util.MockFilesystem{
-		FindLruFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return expectedError, -1, ""
-		},
+	config.Current.CacheDir = "cache-dir"
+	config.Current.CacheMaxSize = 5_000_000
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+
+	index := newTestIndex(
+		&IndexEntry{Path: "a/1", Size: 1_000_000},
+		&IndexEntry{Path: "a/4", Size: 4_000_000},
+		&IndexEntry{Path: "a/2", Size: 2_000_000},
+		&IndexEntry{Path: "a/3", Size: 3_000_000},
+	)
+
+	var removedFiles []string
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removedFiles = append(removedFiles, filepath.Base(path))
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err, newCacheSize := deleteLruFileFromCache(1_230_000)
+	err := deleteFilesFromCacheIfNeeded(index, "cache/folder", "filename.txt", 3_000_000)
 
 	// Assert
-	test.AssertNotNil(t, err)
-	test.AssertTrue(t, strings.Contains(err.Error(), expectedError.Error()))
-	test.AssertEqual(t, 1_230_000, newCacheSize)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, int64(1_000_000), index.totalSize)
+	test.AssertEqual(t, []string{"4", "3", "2"}, removedFiles)
 }
 
-func TestDeleteLruFromCache_errorRemovingFile(t *testing.T) {
+func TestDeleteFilesFromCacheIfNeeded_persistentFilesAreKept(t *testing.T) {
 	// Arrange
-	expectedPath := "some/path/to/file.txt"
-	expectedError := errors.New("test error")
-	fsMock := &util.MockFilesystem{
-		FindLruFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, 120_000, expectedPath
-		},
-		RemoveFunc: func(path string) error {
-			return expectedError
-		},
+	config.Current.CacheDir = "cache-dir"
+	config.Current.CacheMaxSize = 5_000_000
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+
+	index := newTestIndex(
+		&IndexEntry{Path: "a/1", Size: 1_000_000},
+		&IndexEntry{Path: DumpIndexCacheDirName + "/4", Size: 4_000_000},
+	)
+
+	var removedFiles []string
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removedFiles = append(removedFiles, filepath.Base(path))
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err, newCacheSize := deleteLruFileFromCache(1_230_000)
+	err := deleteFilesFromCacheIfNeeded(index, "a", "filename.txt", 1_000_000)
 
 	// Assert
-	test.AssertNotNil(t, err)
-	test.AssertTrue(t, strings.Contains(err.Error(), expectedError.Error()))
-	test.AssertEqual(t, 1_230_000, newCacheSize)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, int64(4_000_000), index.totalSize)
+	test.AssertEqual(t, []string{"1"}, removedFiles)
 }
 
-func TestDeleteFilesFromCacheIfNeeded_largest(t *testing.T) {
+func TestDeleteFilesFromCacheIfNeeded_withExistingFileIncreasingCacheSize(t *testing.T) {
 	// Arrange
+	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxSize = 5_000_000
 	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
 
-	currentCacheSize := int64(10_000_000)
-	fileSize := int64(3_000_000)
-
-	fsMock := &util.MockFilesystem{
-		GetSizeInBytesFunc: func(path string) (int64, error) {
-			return 0, errors.New("test error: no existing file")
-		},
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, fileSize, "path/to/file.txt"
-		},
-		RemoveFunc: func(path string) error {
-			currentCacheSize -= fileSize
-			return nil
-		},
+	index := newTestIndex(
+		&IndexEntry{Path: "cache/folder/filename.txt", Size: 1_500_000},
+		&IndexEntry{Path: "a/1", Size: 1_000_000},
+		&IndexEntry{Path: "a/2", Size: 2_500_000},
+		&IndexEntry{Path: "a/3", Size: 1_600_000},
+	)
+
+	removeCalls := 0
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removeCalls++
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err := deleteFilesFromCacheIfNeeded("cache/folder", "filename.txt", fileSize, currentCacheSize)
+	err := deleteFilesFromCacheIfNeeded(index, "cache/folder", "filename.txt", 2_000_000)
 
 	// Assert
 	test.AssertNil(t, err)
-	test.AssertEqual(t, 1_000_000, currentCacheSize)
+	test.AssertEqual(t, int64(4_100_000), index.totalSize)
+	test.AssertEqual(t, 1, removeCalls)
 }
 
-func TestDeleteFilesFromCacheIfNeeded_withExistingFileIncreasingCacheSize(t *testing.T) {
+func TestDeleteFilesFromCacheIfNeeded_withExistingFileReducingCacheSize(t *testing.T) {
 	// Arrange
+	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxSize = 5_000_000
 	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
 
-	currentCacheSize := int64(6_600_000)
-	existingFileSize := int64(1_500_000)
-	fileSize := int64(2_000_000)
-	removeCalls := 0
+	index := newTestIndex(
+		&IndexEntry{Path: "cache/folder/filename.txt", Size: 3_000_000},
+		&IndexEntry{Path: "a/1", Size: 1_500_000},
+		&IndexEntry{Path: "a/2", Size: 1_000_000},
+	)
 
-	fsMock := &util.MockFilesystem{
-		GetSizeInBytesFunc: func(path string) (int64, error) {
-			return existingFileSize, nil
-		},
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, fileSize, "path/to/file.txt"
-		},
-		RemoveFunc: func(path string) error {
-			removeCalls++
-			currentCacheSize -= fileSize
-			return nil
-		},
+	removeCalls := 0
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removeCalls++
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err := deleteFilesFromCacheIfNeeded("cache/folder", "filename.txt", fileSize, currentCacheSize)
+	err := deleteFilesFromCacheIfNeeded(index, "cache/folder", "filename.txt", 2_000_000)
 
 	// Assert
 	test.AssertNil(t, err)
-	test.AssertEqual(t, 2_600_000, currentCacheSize)
-	test.AssertEqual(t, 2, removeCalls)
+	test.AssertEqual(t, int64(5_500_000), index.totalSize)
+	test.AssertEqual(t, 0, removeCalls)
 }
 
-func TestDeleteFilesFromCacheIfNeeded_withExistingFileReducingCacheSize(t *testing.T) {
+func TestDeleteFilesFromCacheIfNeeded_removingExistingFile(t *testing.T) {
 	// Arrange
+	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxSize = 5_000_000
 	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
 
-	currentCacheSize := int64(6_900_000)
-	existingFileSize := int64(3_000_000)
-	fileSize := int64(2_000_000)
-	removeCalls := 0
+	index := newTestIndex(
+		&IndexEntry{Path: "cache/folder/filename.txt", Size: 3_000_000},
+		&IndexEntry{Path: "a/1", Size: 1_000_000},
+		&IndexEntry{Path: "a/2", Size: 500_000},
+	)
 
-	fsMock := &util.MockFilesystem{
-		GetSizeInBytesFunc: func(path string) (int64, error) {
-			return existingFileSize, nil
-		},
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, fileSize, "path/to/file.txt"
-		},
-		RemoveFunc: func(path string) error {
-			removeCalls++
-			currentCacheSize -= fileSize
-			return nil
-		},
+	var removedFiles []string
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removedFiles = append(removedFiles, filepath.Base(path))
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err := deleteFilesFromCacheIfNeeded("cache/folder", "filename.txt", fileSize, currentCacheSize)
+	err := deleteFilesFromCacheIfNeeded(index, "cache/folder", "filename.txt", 4_000_000)
 
 	// Assert
+	// Without the existing file, the new file increases the cache by its whole size, so another file is removed.
 	test.AssertNil(t, err)
-	test.AssertEqual(t, 4_900_000, currentCacheSize)
-	test.AssertEqual(t, 1, removeCalls)
+	test.AssertEqual(t, int64(500_000), index.totalSize)
+	test.AssertEqual(t, []string{"filename.txt", "1"}, removedFiles)
 }
 
 func TestDeleteFilesFromCacheIfNeeded_errorDeletingFile(t *testing.T) {
 	// Arrange
+	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxSize = 5_000_000
 	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
 
-	currentCacheSize := int64(6_900_000)
-	existingFileSize := int64(3_000_000)
-	fileSize := int64(2_000_000)
+	index := newTestIndex(
+		&IndexEntry{Path: "a/1", Size: 3_000_000},
+		&IndexEntry{Path: "a/2", Size: 3_900_000},
+	)
 	expectedError := errors.New("test error")
 
-	fsMock := &util.MockFilesystem{
-		GetSizeInBytesFunc: func(path string) (int64, error) {
-			return existingFileSize, nil
-		},
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, fileSize, "path/to/file.txt"
-		},
-		RemoveFunc: func(path string) error {
-			return expectedError
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		return expectedError
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err := deleteFilesFromCacheIfNeeded("cache/folder", "filename.txt", fileSize, currentCacheSize)
+	err := deleteFilesFromCacheIfNeeded(index, "cache/folder", "filename.txt", 2_000_000)
 
 	// Assert
 	test.AssertTrue(t, strings.Contains(err.Error(), expectedError.Error()))
-	test.AssertEqual(t, 6_900_000, currentCacheSize)
+	test.AssertEqual(t, int64(6_900_000), index.totalSize)
 }
 
 func TestDeleteFilesFromCacheIfNeeded_lru(t *testing.T) {
 	// Arrange
+	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxSize = 5_000_000
 	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLru
 
-	currentCacheSize := int64(10_000_000)
-	fileSize := int64(3_000_000)
-
-	fsMock := &util.MockFilesystem{
-		GetSizeInBytesFunc: func(path string) (int64, error) {
-			return 0, errors.New("test error: no existing file")
-		},
-		FindLruFileFunc: func(path string, exceptDir string) (error, int64, string) {
-			return nil, fileSize, "path/to/file.txt"
-		},
-		RemoveFunc: func(path string) error {
-			currentCacheSize -= fileSize
-			return nil
-		},
+	now := time.Now()
+	index := newTestIndex(
+		&IndexEntry{Path: "a/1", Size: 3_500_000, LastAccess: now},
+		&IndexEntry{Path: "a/2", Size: 3_000_000, LastAccess: now.Add(-time.Hour)},
+		&IndexEntry{Path: "a/3", Size: 1_000_000, LastAccess: now.Add(-2 * time.Hour)},
+		&IndexEntry{Path: "a/4", Size: 2_000_000, LastAccess: now.Add(-time.Minute)},
+	)
+
+	var removedFiles []string
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removedFiles = append(removedFiles, filepath.Base(path))
+		return nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	// Act
+	err := deleteFilesFromCacheIfNeeded(index, "cache/folder", "filename.txt", 1_000_000)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, int64(3_500_000), index.totalSize)
+	test.AssertEqual(t, []string{"3", "2", "4"}, removedFiles)
+}
+
+func TestDeleteFilesFromCacheIfNeeded_evictionPriority(t *testing.T) {
+	// Arrange
+	config.Current.CacheDir = "cache-dir"
+	config.Current.CacheMaxSize = 5_000_000
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+	setCachePolicies(t, map[string]config.CachePolicy{
+		ArticleCacheDirName: {EvictionPriority: 1},
+	})
+
+	index := newTestIndex(
+		&IndexEntry{Path: "images/1", Size: 3_000_000},
+		&IndexEntry{Path: "articles/2", Size: 500_000},
+		&IndexEntry{Path: "articles/3", Size: 1_000_000},
+	)
+
+	var removedFiles []string
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removedFiles = append(removedFiles, filepath.Base(path))
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
 	// Act
-	err := deleteFilesFromCacheIfNeeded("cache/folder", "filename.txt", fileSize, currentCacheSize)
+	err := deleteFilesFromCacheIfNeeded(index, ImageCacheDirName, "new.jpg", 1_600_000)
 
 	// Assert
 	test.AssertNil(t, err)
-	test.AssertEqual(t, 1_000_000, currentCacheSize)
+	test.AssertEqual(t, int64(3_000_000), index.totalSize)
+	test.AssertEqual(t, []string{"3", "2"}, removedFiles)
+}
+
+func TestDeleteFilesFromCacheIfNeeded_maxSizeShare(t *testing.T) {
+	// Arrange
+	config.Current.CacheDir = "cache-dir"
+	config.Current.CacheMaxSize = 10_000_000
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+	setCachePolicies(t, map[string]config.CachePolicy{
+		ImageCacheDirName: {MaxSizeShare: 0.5},
+	})
+
+	index := newTestIndex(
+		&IndexEntry{Path: "articles/1", Size: 4_000_000},
+		&IndexEntry{Path: "images/2", Size: 1_000_000},
+		&IndexEntry{Path: "images/3", Size: 2_000_000},
+		&IndexEntry{Path: "images/4", Size: 1_500_000},
+	)
+
+	var removedFiles []string
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.RemoveFunc = func(path string) error {
+		removedFiles = append(removedFiles, filepath.Base(path))
+		return nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	// Act
+	err := deleteFilesFromCacheIfNeeded(index, ImageCacheDirName, "new.jpg", 1_000_000)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, int64(2_500_000), index.categorySize(ImageCacheDirName))
+	test.AssertEqual(t, int64(6_500_000), index.totalSize)
+	test.AssertEqual(t, []string{"3"}, removedFiles)
+}
+
+func setCachePolicies(t *testing.T, policies map[string]config.CachePolicy) {
+	config.Current.CachePolicies = policies
+	t.Cleanup(func() {
+		config.Current.CachePolicies = map[string]config.CachePolicy{}
+	})
 }
 
 func TestGetFile(t *testing.T) {
@@ -413,15 +489,14 @@ func TestGetFile_outdatedAndRmovalFailed(t *testing.T) {
 	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxAge = 10
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			fileInfoTime := time.Now().Add(-20 * time.Minute)
-			fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
-			return fileInfo, nil
-		},
-		RemoveFunc: func(name string) error {
-			return errors.New("test error")
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
+	}
+	fsMock.RemoveFunc = func(name string) error {
+		return errors.New("test error")
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -439,10 +514,9 @@ func TestGetFile_fileNotExists(t *testing.T) {
 	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxAge = 10
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			return nil, os.ErrNotExist
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		return nil, os.ErrNotExist
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -460,10 +534,9 @@ func TestGetFile_errorGettingStats(t *testing.T) {
 	config.Current.CacheDir = "cache-dir"
 	config.Current.CacheMaxAge = 10
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			return nil, errors.New("test error")
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		return nil, errors.New("test error")
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -483,17 +556,16 @@ func TestGetFile_updatingModTimeWhenUsingLruCache(t *testing.T) {
 
 	chtimesCalls := 0
 	chTimesCallNameParam := ""
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			fileInfoTime := time.Now().Add(-20 * time.Minute)
-			fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
-			return fileInfo, nil
-		},
-		ChtimesFunc: func(name string, atime time.Time, mtime time.Time) error {
-			chtimesCalls++
-			chTimesCallNameParam = name
-			return nil
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
+	}
+	fsMock.ChtimesFunc = func(name string, atime time.Time, mtime time.Time) error {
+		chtimesCalls++
+		chTimesCallNameParam = name
+		return nil
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -514,15 +586,14 @@ func TestGetFile_updatingModTimeWhenUsingLruCache_errorUpdatingTime(t *testing.T
 	config.Current.CacheMaxAge = 99999
 	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLru
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			fileInfoTime := time.Now().Add(-20 * time.Minute)
-			fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
-			return fileInfo, nil
-		},
-		ChtimesFunc: func(name string, atime time.Time, mtime time.Time) error {
-			return errors.New("test error")
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
+	}
+	fsMock.ChtimesFunc = func(name string, atime time.Time, mtime time.Time) error {
+		return errors.New("test error")
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -539,12 +610,11 @@ func TestIsOutdated_outdated(t *testing.T) {
 	// Arrange
 	config.Current.CacheMaxAge = 10
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			fileInfoTime := time.Now().Add(-20 * time.Minute)
-			fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
-			return fileInfo, nil
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -561,12 +631,11 @@ func TestIsOutdated_notOutdated(t *testing.T) {
 	// Arrange
 	config.Current.CacheMaxAge = 100
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			fileInfoTime := time.Now().Add(-20 * time.Minute)
-			fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
-			return fileInfo, nil
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -579,14 +648,60 @@ func TestIsOutdated_notOutdated(t *testing.T) {
 	test.AssertTrue(t, exists)
 }
 
+func TestIsOutdated_persistentCacheFolder(t *testing.T) {
+	// Arrange
+	config.Current.CacheMaxAge = 10
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	// Act
+	outdated, exists, err := isOutdated(DumpIndexCacheDirName, "file")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, outdated)
+	test.AssertTrue(t, exists)
+}
+
+func TestIsOutdated_maxAgeOfCachePolicy(t *testing.T) {
+	// Arrange
+	config.Current.CacheMaxAge = 100
+	setCachePolicies(t, map[string]config.CachePolicy{
+		ArticleCacheDirName: {MaxAge: 10},
+	})
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		fileInfoTime := time.Now().Add(-20 * time.Minute)
+		fileInfo := util.NewMockFileInfoWithTime("file", fileInfoTime)
+		return fileInfo, nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	// Act
+	articleOutdated, _, err := isOutdated(ArticleCacheDirName, "file")
+	test.AssertNil(t, err)
+	imageOutdated, _, err := isOutdated(ImageCacheDirName, "file")
+	test.AssertNil(t, err)
+
+	// Assert
+	test.AssertTrue(t, articleOutdated)
+	test.AssertFalse(t, imageOutdated)
+}
+
 func TestIsOutdated_notExistingFile(t *testing.T) {
 	// Arrange
 	config.Current.CacheMaxAge = 100
 
-	fsMock := &util.MockFilesystem{
-		StatFunc: func(path string) (os.FileInfo, error) {
-			return nil, os.ErrNotExist
-		},
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.StatFunc = func(path string) (os.FileInfo, error) {
+		return nil, os.ErrNotExist
 	}
 	util.CurrentFilesystem = fsMock
 
@@ -626,3 +741,122 @@ func TestCacheToFile(t *testing.T) {
 	test.AssertEqual(t, "cache-dir/"+ImageCacheDirName+"/"+expectedOutputFilename, filePath)
 	test.AssertEqual(t, expectedOutputFilename, mockTempFile.Name())
 }
+
+func TestGetFileWithValidators_outdatedWithValidators(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current.CacheDir = t.TempDir()
+	config.Current.CacheMaxAge = 10
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyNone
+	test.AssertNil(t, os.MkdirAll(GetTempPath(), os.ModePerm))
+
+	filePath, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	err = SetValidators(ImageCacheDirName, "foo.jpg", Validators{ETag: `"123"`})
+	test.AssertNil(t, err)
+	outdatedTime := time.Now().Add(-20 * time.Minute)
+	test.AssertNil(t, os.Chtimes(filePath, outdatedTime, outdatedTime))
+
+	// Act
+	_, fileIsUsable, validators, err := GetFileWithValidators(ImageCacheDirName, "foo.jpg")
+	_, fileIsUsableWithoutValidators, err2 := GetFile(ImageCacheDirName, "foo.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, fileIsUsable)
+	test.AssertEqual(t, &Validators{ETag: `"123"`}, validators)
+	test.AssertNil(t, err2)
+	test.AssertFalse(t, fileIsUsableWithoutValidators)
+	_, err = os.Stat(filePath)
+	test.AssertTrue(t, os.IsNotExist(err))
+}
+
+func TestSetValidators_emptyValidatorsRemoveExistingOnes(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current.CacheDir = t.TempDir()
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyNone
+	test.AssertNil(t, os.MkdirAll(GetTempPath(), os.ModePerm))
+
+	_, err := CacheToFile(ArticleCacheDirName, "foo.json", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	err = SetValidators(ArticleCacheDirName, "foo.json", Validators{LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"})
+	test.AssertNil(t, err)
+
+	// Act
+	validators := getValidators(ArticleCacheDirName, "foo.json")
+	err = SetValidators(ArticleCacheDirName, "foo.json", Validators{})
+	removedValidators := getValidators(ArticleCacheDirName, "foo.json")
+
+	// Assert
+	test.AssertEqual(t, &Validators{LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}, validators)
+	test.AssertNil(t, err)
+	test.AssertNil(t, removedValidators)
+	_, err = os.Stat(GetFilePathInCache("validators", ArticleCacheDirName))
+	test.AssertTrue(t, os.IsNotExist(err))
+}
+
+func TestSetValidators_keptWhenFileIsChanged(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	err = SetValidators(ImageCacheDirName, "foo.jpg", Validators{ETag: `"123"`})
+	test.AssertNil(t, err)
+
+	// Act
+	_, err = CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("processed foo"))
+	currentIndex = nil
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, &Validators{ETag: `"123"`}, getValidators(ImageCacheDirName, "foo.jpg"))
+}
+
+func TestGetContentHash_keptWhenFileIsChanged(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	filePath, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	SetOrigin(ImageCacheDirName, "foo.jpg", "https://upload.wikimedia.org/foo.jpg", "some-hash")
+	test.AssertNil(t, os.WriteFile(filePath, []byte("processed foo"), 0644))
+	test.AssertNil(t, RegisterFile(filePath))
+
+	// Act
+	contentHash := GetContentHash(ImageCacheDirName, "foo.jpg")
+	unknownContentHash := GetContentHash(ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertEqual(t, "some-hash", contentHash)
+	test.AssertEqual(t, "", unknownContentHash)
+}
+
+func TestMarkAccessed(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	config.Current.CacheMaxAge = 10
+
+	filePath, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	oldAccess := time.Now().Add(-time.Hour)
+	getIndex().updateEntry(ImageCacheDirName, "foo.jpg", func(entry *IndexEntry) {
+		entry.LastAccess = oldAccess
+	})
+	outdatedTime := time.Now().Add(-20 * time.Minute)
+	test.AssertNil(t, os.Chtimes(filePath, outdatedTime, outdatedTime))
+
+	// Act
+	err = MarkAccessed(ImageCacheDirName, "foo.jpg")
+	missingErr := MarkAccessed(ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertNil(t, missingErr)
+	test.AssertTrue(t, getIndex().entries["images/foo.jpg"].LastAccess.After(oldAccess))
+	_, exists := getIndex().entries["images/bar.jpg"]
+	test.AssertFalse(t, exists)
+	// Outdated files are kept, since they might be in use.
+	test.AssertTrue(t, util.PathExists(filePath))
+}
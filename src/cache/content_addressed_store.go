@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	storeObjectsDirName = "objects"
+	storeNamesDirName   = "names"
+	storeTempDirName    = ".tmp"
+	storeNameFileSuffix = ".json"
+)
+
+// storeNameDto is the content of a name file, which maps a cached file to the object containing its content.
+type storeNameDto struct {
+	Hash     string    `json:"sha256"`
+	Modified time.Time `json:"modified"`
+}
+
+// contentAddressedStore keeps the content of cached files as objects named by the SHA-256 hash of their content. Files
+// with equal content therefore share one object. For each cached file, a name file (the name→hash index) points to the
+// object containing its content:
+//
+//	<store-dir>/objects/ab/abcdef…          content of one or more cached files
+//	<store-dir>/names/images/Foo.jpg.json   hash and modification time of the cached file "images/Foo.jpg"
+//
+// The store can be used by multiple processes at the same time, e.g. on a network path: Objects and name files are
+// written to temp files first and then renamed, so readers never see partially written files. Name files are only
+// changed while holding their lock file (s. acquireLock), so concurrent writers don't overwrite each other's changes.
+type contentAddressedStore struct {
+	storeDir string
+}
+
+func newContentAddressedStore(storeDir string) *contentAddressedStore {
+	return &contentAddressedStore{
+		storeDir: storeDir,
+	}
+}
+
+func (s *contentAddressedStore) save(path string) error {
+	filePath := filepath.Join(config.Current.CacheDir, filepath.FromSlash(path))
+	fileStat, err := util.CurrentFilesystem.Stat(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to determine file stats of file '%s' to store", filePath)
+	}
+	content, err := util.CurrentFilesystem.ReadFile(filePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read file '%s' to store", filePath)
+	}
+
+	hash := util.Sha256(content)
+	err = s.writeObject(hash, content)
+	if err != nil {
+		return err
+	}
+
+	return s.updateName(path, func(name *storeNameDto) bool {
+		name.Hash = hash
+		name.Modified = fileStat.ModTime()
+		return true
+	})
+}
+
+func (s *contentAddressedStore) load(path string) ([]byte, time.Time, bool, error) {
+	name, err := s.readName(path)
+	if err != nil || name == nil {
+		return nil, time.Time{}, false, err
+	}
+
+	objectPath := s.objectPath(name.Hash)
+	content, err := util.CurrentFilesystem.ReadFile(objectPath)
+	if os.IsNotExist(err) {
+		sigolo.Warnf("Object '%s' of file '%s' does not exist in cache store", objectPath, path)
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, errors.Wrapf(err, "Unable to read object '%s' of file '%s' from cache store", objectPath, path)
+	}
+
+	if util.Sha256(content) != name.Hash {
+		sigolo.Warnf("Object '%s' of file '%s' in cache store is broken, its content doesn't match its hash", objectPath, path)
+		return nil, time.Time{}, false, nil
+	}
+
+	sigolo.Debugf("Loaded file '%s' from cache store", path)
+	return content, name.Modified, true, nil
+}
+
+func (s *contentAddressedStore) touch(path string, modTime time.Time) error {
+	return s.updateName(path, func(name *storeNameDto) bool {
+		if name.Hash == "" {
+			return false
+		}
+		name.Modified = modTime
+		return true
+	})
+}
+
+// writeObject stores the given content as object, unless the object already exists.
+func (s *contentAddressedStore) writeObject(hash string, content []byte) error {
+	objectPath := s.objectPath(hash)
+
+	_, err := util.CurrentFilesystem.Stat(objectPath)
+	if err == nil {
+		sigolo.Tracef("Object '%s' already exists in cache store", objectPath)
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Unable to determine file stats of object '%s'", objectPath)
+	}
+
+	return s.writeFile(objectPath, content)
+}
+
+// readName returns the content of the name file of the given cached file or nil when there's no such name file.
+func (s *contentAddressedStore) readName(path string) (*storeNameDto, error) {
+	nameFilePath := s.nameFilePath(path)
+
+	nameBytes, err := util.CurrentFilesystem.ReadFile(nameFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read name file '%s'", nameFilePath)
+	}
+
+	name := &storeNameDto{}
+	err = json.Unmarshal(nameBytes, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse name file '%s'", nameFilePath)
+	}
+	if len(name.Hash) != 2*sha256.Size {
+		return nil, errors.Errorf("Name file '%s' contains invalid hash '%s'", nameFilePath, name.Hash)
+	}
+
+	return name, nil
+}
+
+// updateName changes the name file of the given cached file while holding its lock. The update function gets the
+// current content of the name file, which is empty when there's no name file yet. The name file is only written when
+// the update function returns true.
+func (s *contentAddressedStore) updateName(path string, update func(name *storeNameDto) bool) error {
+	nameFilePath := s.nameFilePath(path)
+
+	err := util.CurrentFilesystem.MkdirAll(filepath.Dir(nameFilePath))
+	if err != nil && !os.IsExist(err) {
+		return errors.Wrapf(err, "Unable to create folder of name file '%s'", nameFilePath)
+	}
+
+	unlock, err := acquireLock(nameFilePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	name, err := s.readName(path)
+	if err != nil {
+		sigolo.Warnf("Replace broken name file of '%s': %s", path, err.Error())
+		name = nil
+	}
+	if name == nil {
+		name = &storeNameDto{}
+	}
+
+	if !update(name) {
+		return nil
+	}
+
+	nameBytes, err := json.Marshal(name)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to serialize name file '%s'", nameFilePath)
+	}
+
+	return s.writeFile(nameFilePath, nameBytes)
+}
+
+// writeFile writes the content to a temp file within the store, which is then renamed to the given file. Readers
+// therefore either see the old or the new content, but never a partially written file.
+func (s *contentAddressedStore) writeFile(filePath string, content []byte) error {
+	tempDirPath := filepath.Join(s.storeDir, storeTempDirName)
+	for _, dirPath := range []string{tempDirPath, filepath.Dir(filePath)} {
+		err := util.CurrentFilesystem.MkdirAll(dirPath)
+		if err != nil && !os.IsExist(err) {
+			return errors.Wrapf(err, "Unable to create folder '%s' in cache store", dirPath)
+		}
+	}
+
+	tempFile, err := util.CurrentFilesystem.CreateTemp(tempDirPath, filepath.Base(filePath))
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create temp file for '%s' in cache store", filePath)
+	}
+	tempFilePath := tempFile.Name()
+	defer util.CurrentFilesystem.Remove(tempFilePath)
+
+	_, err = tempFile.Write(content)
+	if err != nil {
+		tempFile.Close()
+		return errors.Wrapf(err, "Unable to write temp file '%s' in cache store", tempFilePath)
+	}
+
+	// Without closing it, Windows has problems moving the file.
+	err = tempFile.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to close temp file '%s' in cache store", tempFilePath)
+	}
+
+	err = util.CurrentFilesystem.Rename(tempFilePath, filePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to move temp file '%s' to '%s' in cache store", tempFilePath, filePath)
+	}
+
+	return nil
+}
+
+func (s *contentAddressedStore) objectPath(hash string) string {
+	return filepath.Join(s.storeDir, storeObjectsDirName, hash[:2], hash)
+}
+
+func (s *contentAddressedStore) nameFilePath(path string) string {
+	return filepath.Join(s.storeDir, storeNamesDirName, filepath.FromSlash(path)+storeNameFileSuffix)
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wiki2book/config"
+	"wiki2book/test"
+	"wiki2book/util"
+)
+
+func prepareStoreTest(t *testing.T) string {
+	prepareIndexTest(t)
+	storeDir := t.TempDir()
+	config.Current.CacheStore = config.CacheStoreContentAddressed
+	config.Current.CacheStoreDir = storeDir
+	config.Current.CacheMaxAge = 100
+	t.Cleanup(func() {
+		config.Current.CacheStore = config.CacheStoreFilesystem
+		config.Current.CacheStoreDir = ""
+	})
+	return storeDir
+}
+
+// useNewCacheDir switches to a new and empty cache dir, like a different process would use.
+func useNewCacheDir(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	test.AssertNil(t, os.MkdirAll(GetTempPath(), os.ModePerm))
+}
+
+func TestContentAddressedStore_shareFilesBetweenCacheDirs(t *testing.T) {
+	// Arrange
+	prepareStoreTest(t)
+
+	filePath, err := CacheToFile(ImageCacheDirName, "File:Foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	test.AssertNil(t, os.Chtimes(filePath, modTime, modTime))
+	_, err = Touch(ImageCacheDirName, "File:Foo.jpg")
+	test.AssertNil(t, err)
+	fileStat, err := os.Stat(filePath)
+	test.AssertNil(t, err)
+
+	useNewCacheDir(t)
+
+	// Act
+	otherFilePath, exists, err := GetFile(ImageCacheDirName, "File:Foo.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertTrue(t, exists)
+	test.AssertTrue(t, filePath != otherFilePath)
+
+	content, err := os.ReadFile(otherFilePath)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "foo", string(content))
+
+	otherFileStat, err := os.Stat(otherFilePath)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, fileStat.ModTime().Equal(otherFileStat.ModTime()))
+
+	test.AssertEqual(t, int64(3), getIndex().entries["images/File%3AFoo.jpg"].Size)
+}
+
+func TestContentAddressedStore_outdatedFilesAreNotUsed(t *testing.T) {
+	// Arrange
+	prepareStoreTest(t)
+
+	filePath, err := CacheToFile(ArticleCacheDirName, "Foo", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	modTime := time.Now().Add(-time.Hour)
+	test.AssertNil(t, os.Chtimes(filePath, modTime, modTime))
+	_, err = CacheToFile(ArticleCacheDirName, "Foo", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+
+	useNewCacheDir(t)
+	config.Current.CacheMaxAge = 10
+	test.AssertNil(t, getStore().touch("articles/Foo", modTime))
+
+	// Act
+	_, exists, err := GetFile(ArticleCacheDirName, "Foo")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, exists)
+}
+
+func TestContentAddressedStore_deduplicatesObjects(t *testing.T) {
+	// Arrange
+	storeDir := prepareStoreTest(t)
+
+	// Act
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("same content"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ImageCacheDirName, "bar.jpg", strings.NewReader("same content"))
+	test.AssertNil(t, err)
+
+	// Assert
+	var objectFiles []string
+	err = filepath.Walk(filepath.Join(storeDir, storeObjectsDirName), func(path string, file os.FileInfo, err error) error {
+		if !file.IsDir() {
+			objectFiles = append(objectFiles, filepath.Base(path))
+		}
+		return err
+	})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []string{util.Sha256([]byte("same content"))}, objectFiles)
+
+	for _, path := range []string{"images/foo.jpg", "images/bar.jpg"} {
+		name, err := newContentAddressedStore(storeDir).readName(path)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, objectFiles[0], name.Hash)
+	}
+}
+
+func TestContentAddressedStore_brokenObjectIsNotUsed(t *testing.T) {
+	// Arrange
+	storeDir := prepareStoreTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	objectPath := newContentAddressedStore(storeDir).objectPath(util.Sha256([]byte("foo")))
+	test.AssertNil(t, os.WriteFile(objectPath, []byte("fo"), 0644))
+
+	useNewCacheDir(t)
+
+	// Act
+	_, exists, err := GetFile(ImageCacheDirName, "foo.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, exists)
+}
+
+func TestContentAddressedStore_concurrentWriters(t *testing.T) {
+	// Arrange
+	storeDir := prepareStoreTest(t)
+	numberOfWriters := 20
+	hash := util.Sha256([]byte("foo"))
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Act
+	wg := sync.WaitGroup{}
+	for i := 0; i < numberOfWriters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each writer uses its own store, like different processes do.
+			err := newContentAddressedStore(storeDir).updateName("images/foo.jpg", func(name *storeNameDto) bool {
+				if name.Hash == "" {
+					name.Hash = hash
+					name.Modified = start
+				}
+				name.Modified = name.Modified.Add(time.Second)
+				return true
+			})
+			test.AssertNil(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	name, err := newContentAddressedStore(storeDir).readName("images/foo.jpg")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, hash, name.Hash)
+	test.AssertTrue(t, start.Add(time.Duration(numberOfWriters)*time.Second).Equal(name.Modified))
+}
@@ -0,0 +1,691 @@
+package cache
+
+import (
+	"container/heap"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	IndexFileName        = "index.json"
+	IndexJournalFileName = "index-journal.jsonl"
+
+	// indexVersion is stored in the index file. Index files of other versions are not used but rebuilt.
+	indexVersion = 1
+	// minJournalRecordsForCompaction is the minimum number of journal records before the journal is merged into the
+	// index file. Independent of this, the journal is only merged when it has more records than the index has entries.
+	minJournalRecordsForCompaction = 1000
+)
+
+var (
+	// currentIndex is the index of the current cache dir. Use getIndex to access it, which (re)loads the index in case
+	// it doesn't exist yet or the cache dir changed. The index must only be used while holding the cache lock (s. lockCache).
+	currentIndex *cacheIndex
+)
+
+// IndexEntry contains the information about a cached file, which are needed to manage the cache without reading the
+// whole cache directory.
+type IndexEntry struct {
+	// Path of the file relative to the cache dir with forward slashes, e.g. "images/Foo.jpg".
+	Path string `json:"path"`
+	// Category is the name of the cache folder containing the file, e.g. "images".
+	Category   string    `json:"category"`
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"last-access"`
+	// Url is the origin of downloaded files and empty for all other files.
+	Url string `json:"url,omitempty"`
+	// Sha256 is the hash of the downloaded content of downloaded files and empty for all other files. It's kept when the
+	// file is changed after the download, e.g. by the image processing.
+	Sha256 string `json:"sha256,omitempty"`
+	// Validators of downloaded files (s. SetValidators), nil for all other files.
+	Validators *Validators `json:"validators,omitempty"`
+
+	sizeHeapIndex   int
+	accessHeapIndex int
+}
+
+type indexFileDto struct {
+	Version int           `json:"version"`
+	Entries []*IndexEntry `json:"entries"`
+}
+
+// indexJournalRecordDto is one line of the journal. Either an entry is added/updated or the entry of a path is removed.
+type indexJournalRecordDto struct {
+	Put    *IndexEntry `json:"put,omitempty"`
+	Remove string      `json:"remove,omitempty"`
+}
+
+// cacheIndex keeps track of all files in the cache. It's persisted in an index file, which is only written
+// occasionally, and a journal file, to which every change is appended. The largest and least recently used entries
+// of each category are determined using heaps, so that finding, adding and removing entries is done in O(log n).
+type cacheIndex struct {
+	cacheDir       string
+	entries        map[string]*IndexEntry
+	categories     map[string]*indexCategory
+	totalSize      int64
+	journalRecords int
+
+	// indexFileState and journalFileState are the states of the index files after the last change by this process.
+	// They are used to detect changes by other processes using the same cache dir (s. refreshIndex).
+	indexFileState   fileState
+	journalFileState fileState
+}
+
+// fileState contains the properties of a file, which change whenever the file is written.
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// indexCategory contains the entries of one category, i.e. of one cache folder.
+type indexCategory struct {
+	// largestEntries is a max-heap of the entries by size.
+	largestEntries *entryHeap
+	// lruEntries is a min-heap of the entries by last access.
+	lruEntries *entryHeap
+	totalSize  int64
+}
+
+func newCacheIndex(cacheDir string) *cacheIndex {
+	return &cacheIndex{
+		cacheDir:   cacheDir,
+		entries:    map[string]*IndexEntry{},
+		categories: map[string]*indexCategory{},
+	}
+}
+
+func newIndexCategory() *indexCategory {
+	return &indexCategory{
+		largestEntries: &entryHeap{
+			less:      func(a, b *IndexEntry) bool { return a.Size > b.Size },
+			heapIndex: func(e *IndexEntry) *int { return &e.sizeHeapIndex },
+		},
+		lruEntries: &entryHeap{
+			less:      func(a, b *IndexEntry) bool { return a.LastAccess.Before(b.LastAccess) },
+			heapIndex: func(e *IndexEntry) *int { return &e.accessHeapIndex },
+		},
+	}
+}
+
+// getIndex returns the index of the current cache dir. It's loaded from disk when needed and rebuilt in case it's
+// missing or inconsistent.
+func getIndex() *cacheIndex {
+	if currentIndex == nil || currentIndex.cacheDir != config.Current.CacheDir {
+		currentIndex = loadIndex(config.Current.CacheDir)
+	}
+	return currentIndex
+}
+
+// refreshIndex applies the changes, which other processes made to the index files since the last change by this
+// process. Usually, only the new journal records are applied. The whole index is reloaded when the index file has
+// changed, e.g. because another process merged the journal into it.
+func refreshIndex() {
+	if currentIndex == nil || currentIndex.cacheDir != config.Current.CacheDir {
+		return
+	}
+
+	indexFileState, journalFileState, err := currentIndex.getFileStates()
+	if err != nil {
+		sigolo.Debugf("Unable to determine whether the cache index was changed by other processes: %s", err.Error())
+		return
+	}
+	if indexFileState.equal(currentIndex.indexFileState) && journalFileState.equal(currentIndex.journalFileState) {
+		return
+	}
+
+	if !indexFileState.equal(currentIndex.indexFileState) || journalFileState.size < currentIndex.journalFileState.size {
+		sigolo.Debugf("Cache index of '%s' was changed by another process, reload it", currentIndex.cacheDir)
+		currentIndex = loadIndex(currentIndex.cacheDir)
+		return
+	}
+
+	journalFilePath := filepath.Join(currentIndex.cacheDir, IndexJournalFileName)
+	journalBytes, err := util.CurrentFilesystem.ReadFile(journalFilePath)
+	if err == nil && int64(len(journalBytes)) >= currentIndex.journalFileState.size {
+		err = currentIndex.applyJournal(journalBytes[currentIndex.journalFileState.size:], journalFilePath)
+	} else if err == nil {
+		err = errors.Errorf("Index journal file '%s' is smaller than expected", journalFilePath)
+	}
+	if err != nil {
+		sigolo.Warnf("Unable to apply changes of other processes to cache index of '%s', reload it: %s", currentIndex.cacheDir, err.Error())
+		currentIndex = loadIndex(currentIndex.cacheDir)
+		return
+	}
+
+	sigolo.Tracef("Applied changes of other processes to cache index of '%s'", currentIndex.cacheDir)
+	currentIndex.updateFileStates()
+}
+
+// loadIndex reads the index file and applies the journal. The index is rebuilt from the files in the cache dir when
+// the index file is missing or the index or journal files are broken.
+func loadIndex(cacheDir string) *cacheIndex {
+	index := newCacheIndex(cacheDir)
+
+	err := index.read()
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			sigolo.Debugf("Create cache index of '%s'", cacheDir)
+		} else {
+			sigolo.Warnf("Rebuild cache index of '%s': %s", cacheDir, err.Error())
+		}
+		index, err = rebuildIndex(cacheDir)
+		if err != nil {
+			// Without index, all files are unknown. Files in the cache are then not considered for eviction and
+			// their size is not counted. Since this isn't more than an inconvenience, there's no need to abort here.
+			sigolo.Errorf("Unable to rebuild cache index, the cache might exceed its max size: %+v", err)
+			return newCacheIndex(cacheDir)
+		}
+		index.compact()
+	}
+	index.updateFileStates()
+
+	sigolo.Debugf("Loaded cache index with %d entries and %f MB", len(index.entries), util.ToMB(index.totalSize))
+	return index
+}
+
+func (c *cacheIndex) read() error {
+	indexFilePath := filepath.Join(c.cacheDir, IndexFileName)
+	indexBytes, err := util.CurrentFilesystem.ReadFile(indexFilePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read index file '%s'", indexFilePath)
+	}
+
+	indexDto := &indexFileDto{}
+	err = json.Unmarshal(indexBytes, indexDto)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse index file '%s'", indexFilePath)
+	}
+	if indexDto.Version != indexVersion {
+		return errors.Errorf("Index file '%s' has version %d but version %d is needed", indexFilePath, indexDto.Version, indexVersion)
+	}
+
+	for _, entry := range indexDto.Entries {
+		c.put(entry)
+	}
+
+	journalFilePath := filepath.Join(c.cacheDir, IndexJournalFileName)
+	journalBytes, err := util.CurrentFilesystem.ReadFile(journalFilePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read index journal file '%s'", journalFilePath)
+	}
+
+	return c.applyJournal(journalBytes, journalFilePath)
+}
+
+// applyJournal applies all records of the given journal content to the index.
+func (c *cacheIndex) applyJournal(journalBytes []byte, journalFilePath string) error {
+	for _, line := range strings.Split(string(journalBytes), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		record := &indexJournalRecordDto{}
+		err := json.Unmarshal([]byte(line), record)
+		if err != nil {
+			// This happens, for example, when the application exited while writing to the journal.
+			return errors.Wrapf(err, "Unable to parse record '%s' of index journal file '%s'", line, journalFilePath)
+		}
+
+		if record.Put != nil {
+			c.put(record.Put)
+		} else if record.Remove != "" {
+			c.remove(record.Remove)
+		}
+		c.journalRecords++
+	}
+
+	return nil
+}
+
+// rebuildIndex creates a new index containing all files within the given cache dir. The last access of each file is
+// its modification time.
+func rebuildIndex(cacheDir string) (*cacheIndex, error) {
+	index := newCacheIndex(cacheDir)
+
+	err := util.CurrentFilesystem.Walk(cacheDir, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// It might happen, that files are deleted during file walk (concurrency etc.)
+				return nil
+			}
+			return err
+		}
+
+		if file.IsDir() {
+			if file.Name() == TempDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(cacheDir, path)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if relativePath == IndexFileName || relativePath == IndexJournalFileName {
+			return nil
+		}
+
+		index.put(&IndexEntry{
+			Path:       relativePath,
+			Category:   categoryOfPath(relativePath),
+			Size:       file.Size(),
+			LastAccess: file.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read files in cache folder '%s'", cacheDir)
+	}
+
+	return index, nil
+}
+
+// categoryOfPath returns the cache folder of the given path relative to the cache dir.
+func categoryOfPath(relativePath string) string {
+	category, _, found := strings.Cut(relativePath, "/")
+	if !found {
+		return ""
+	}
+	return category
+}
+
+// indexPath returns the path of the given file within the cache as it's used in the index.
+func indexPath(cacheFolderName string, filename string) string {
+	return filepath.ToSlash(filepath.Join(cacheFolderName, util.SanitizeFilename(filename)))
+}
+
+// put adds the given entry or replaces the existing entry with the same path. The journal is not updated.
+func (c *cacheIndex) put(entry *IndexEntry) {
+	existingEntry, exists := c.entries[entry.Path]
+	if exists && existingEntry.Category != entry.Category {
+		c.remove(entry.Path)
+		exists = false
+	}
+
+	if !exists {
+		category, categoryExists := c.categories[entry.Category]
+		if !categoryExists {
+			category = newIndexCategory()
+			c.categories[entry.Category] = category
+		}
+
+		c.entries[entry.Path] = entry
+		c.totalSize += entry.Size
+		category.totalSize += entry.Size
+		heap.Push(category.largestEntries, entry)
+		heap.Push(category.lruEntries, entry)
+		return
+	}
+
+	category := c.categories[existingEntry.Category]
+	c.totalSize += entry.Size - existingEntry.Size
+	category.totalSize += entry.Size - existingEntry.Size
+	existingEntry.Size = entry.Size
+	existingEntry.LastAccess = entry.LastAccess
+	existingEntry.Url = entry.Url
+	existingEntry.Sha256 = entry.Sha256
+	existingEntry.Validators = entry.Validators
+	heap.Fix(category.largestEntries, existingEntry.sizeHeapIndex)
+	heap.Fix(category.lruEntries, existingEntry.accessHeapIndex)
+}
+
+// remove removes the entry of the given path, if it exists. The journal is not updated.
+func (c *cacheIndex) remove(path string) {
+	entry, exists := c.entries[path]
+	if !exists {
+		return
+	}
+
+	category := c.categories[entry.Category]
+	delete(c.entries, path)
+	c.totalSize -= entry.Size
+	category.totalSize -= entry.Size
+	heap.Remove(category.largestEntries, entry.sizeHeapIndex)
+	heap.Remove(category.lruEntries, entry.accessHeapIndex)
+	if category.largestEntries.Len() == 0 {
+		delete(c.categories, entry.Category)
+	}
+}
+
+// addFile adds or updates the entry of the given file and writes the change to the journal. The URL, hash and
+// validators of an existing entry are kept.
+func (c *cacheIndex) addFile(cacheFolderName string, filename string, size int64, lastAccess time.Time) {
+	c.addPath(indexPath(cacheFolderName, filename), size, lastAccess)
+}
+
+// addPath works like addFile but expects the path of the file relative to the cache dir.
+func (c *cacheIndex) addPath(path string, size int64, lastAccess time.Time) {
+	entry := &IndexEntry{
+		Path:       path,
+		Category:   categoryOfPath(path),
+		Size:       size,
+		LastAccess: lastAccess,
+	}
+	if existingEntry, exists := c.entries[entry.Path]; exists {
+		entry.Url = existingEntry.Url
+		entry.Sha256 = existingEntry.Sha256
+		entry.Validators = existingEntry.Validators
+	}
+
+	c.put(entry)
+	c.appendToJournal(&indexJournalRecordDto{Put: entry})
+}
+
+// updateEntry changes the existing entry of the given file and writes the change to the journal. Nothing happens when
+// the file has no entry.
+func (c *cacheIndex) updateEntry(cacheFolderName string, filename string, update func(entry *IndexEntry)) {
+	existingEntry, exists := c.entries[indexPath(cacheFolderName, filename)]
+	if !exists {
+		return
+	}
+
+	entry := *existingEntry
+	update(&entry)
+	c.put(&entry)
+	c.appendToJournal(&indexJournalRecordDto{Put: &entry})
+}
+
+// removeFile removes the entry of the given path relative to the cache dir and writes the change to the journal.
+func (c *cacheIndex) removeFile(path string) {
+	if _, exists := c.entries[path]; !exists {
+		return
+	}
+
+	c.remove(path)
+	c.appendToJournal(&indexJournalRecordDto{Remove: path})
+}
+
+// categorySize returns the total size of all files of the given category.
+func (c *cacheIndex) categorySize(categoryName string) int64 {
+	category, exists := c.categories[categoryName]
+	if !exists {
+		return 0
+	}
+	return category.totalSize
+}
+
+// categoryNames returns the names of all categories containing at least one entry.
+func (c *cacheIndex) categoryNames() []string {
+	var categoryNames []string
+	for categoryName := range c.categories {
+		categoryNames = append(categoryNames, categoryName)
+	}
+	return categoryNames
+}
+
+// largestEntry returns the entry of the largest file within the given categories or nil if there's no such entry. All
+// categories are considered when no category is given.
+func (c *cacheIndex) largestEntry(categoryNames ...string) *IndexEntry {
+	return c.findEntry(categoryNames, func(category *indexCategory) *entryHeap { return category.largestEntries })
+}
+
+// lruEntry returns the entry of the least recently used file within the given categories or nil if there's no such
+// entry. All categories are considered when no category is given.
+func (c *cacheIndex) lruEntry(categoryNames ...string) *IndexEntry {
+	return c.findEntry(categoryNames, func(category *indexCategory) *entryHeap { return category.lruEntries })
+}
+
+// largestEntryAccessedBefore works like largestEntry but only considers entries, whose last access was before the
+// given time. In contrast to largestEntry, this takes O(n).
+func (c *cacheIndex) largestEntryAccessedBefore(accessTime time.Time, categoryNames ...string) *IndexEntry {
+	return c.findEntryAccessedBefore(accessTime, categoryNames, func(category *indexCategory) *entryHeap { return category.largestEntries })
+}
+
+// lruEntryAccessedBefore works like lruEntry but only considers entries, whose last access was before the given time.
+func (c *cacheIndex) lruEntryAccessedBefore(accessTime time.Time, categoryNames ...string) *IndexEntry {
+	return c.findEntryAccessedBefore(accessTime, categoryNames, func(category *indexCategory) *entryHeap { return category.lruEntries })
+}
+
+// findEntryAccessedBefore returns the entry of the given categories, which would be the top-most entry of their heaps
+// when only entries with a last access before the given time would exist.
+func (c *cacheIndex) findEntryAccessedBefore(accessTime time.Time, categoryNames []string, heapOf func(category *indexCategory) *entryHeap) *IndexEntry {
+	if len(categoryNames) == 0 {
+		categoryNames = c.categoryNames()
+	}
+
+	var result *IndexEntry
+	for _, categoryName := range categoryNames {
+		category, exists := c.categories[categoryName]
+		if !exists {
+			continue
+		}
+
+		categoryHeap := heapOf(category)
+		for _, entry := range categoryHeap.entries {
+			if entry.LastAccess.Before(accessTime) && (result == nil || categoryHeap.less(entry, result)) {
+				result = entry
+			}
+		}
+	}
+
+	return result
+}
+
+// findEntry returns the top-most entry of the heaps of the given categories.
+func (c *cacheIndex) findEntry(categoryNames []string, heapOf func(category *indexCategory) *entryHeap) *IndexEntry {
+	if len(categoryNames) == 0 {
+		categoryNames = c.categoryNames()
+	}
+
+	var result *IndexEntry
+	for _, categoryName := range categoryNames {
+		category, exists := c.categories[categoryName]
+		if !exists {
+			continue
+		}
+
+		categoryHeap := heapOf(category)
+		entry := categoryHeap.peek()
+		if entry != nil && (result == nil || categoryHeap.less(entry, result)) {
+			result = entry
+		}
+	}
+
+	return result
+}
+
+// appendToJournal persists the given change. The journal is merged into the index file once it gets too large.
+func (c *cacheIndex) appendToJournal(record *indexJournalRecordDto) {
+	if c.journalRecords >= max(minJournalRecordsForCompaction, len(c.entries)) {
+		// The index file contains the current state, so this record doesn't need to be written to the journal.
+		c.compact()
+		return
+	}
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		sigolo.Errorf("Unable to serialize cache index journal record: %+v", err)
+		return
+	}
+
+	journalFilePath := filepath.Join(c.cacheDir, IndexJournalFileName)
+	err = util.CurrentFilesystem.AppendFile(journalFilePath, append(recordBytes, '\n'))
+	if err != nil {
+		sigolo.Warnf("Unable to write to cache index journal '%s', the index will be rebuilt on next start: %s", journalFilePath, err.Error())
+		c.invalidate()
+		return
+	}
+	c.journalRecords++
+	c.updateFileStates()
+}
+
+// compact writes all entries into the index file and removes the journal.
+func (c *cacheIndex) compact() {
+	indexDto := &indexFileDto{
+		Version: indexVersion,
+		Entries: make([]*IndexEntry, 0, len(c.entries)),
+	}
+	for _, entry := range c.entries {
+		indexDto.Entries = append(indexDto.Entries, entry)
+	}
+
+	indexBytes, err := json.Marshal(indexDto)
+	if err != nil {
+		sigolo.Errorf("Unable to serialize cache index: %+v", err)
+		return
+	}
+
+	err = c.writeIndexFile(indexBytes)
+	if err != nil {
+		sigolo.Warnf("Unable to write cache index, the index will be rebuilt on next start: %s", err.Error())
+		c.invalidate()
+		return
+	}
+
+	journalFilePath := filepath.Join(c.cacheDir, IndexJournalFileName)
+	err = util.CurrentFilesystem.Remove(journalFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		sigolo.Warnf("Unable to remove cache index journal '%s', the index will be rebuilt on next start: %s", journalFilePath, err.Error())
+		c.invalidate()
+		return
+	}
+	c.journalRecords = 0
+	c.updateFileStates()
+}
+
+// writeIndexFile writes the index file via a temporary file, so that the index file is never broken.
+func (c *cacheIndex) writeIndexFile(indexBytes []byte) error {
+	tempDirPath := filepath.Join(c.cacheDir, TempDirName, processTempDirName)
+	err := util.CurrentFilesystem.MkdirAll(tempDirPath)
+	if err != nil && !os.IsExist(err) {
+		return errors.Wrapf(err, "Unable to create temp folder in cache dir '%s'", c.cacheDir)
+	}
+
+	// Only one index file is written at a time (s. lockCache), so there's no need for a random file name.
+	tempFilepath := filepath.Join(tempDirPath, IndexFileName)
+	tempFile, err := util.CurrentFilesystem.Create(tempFilepath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to create temporary index file '%s'", tempFilepath)
+	}
+	defer tempFile.Close()
+	defer util.CurrentFilesystem.Remove(tempFilepath)
+
+	_, err = tempFile.Write(indexBytes)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write temporary index file '%s'", tempFilepath)
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to close temporary index file '%s'", tempFilepath)
+	}
+
+	indexFilePath := filepath.Join(c.cacheDir, IndexFileName)
+	err = util.CurrentFilesystem.Rename(tempFilepath, indexFilePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to move temporary index file '%s' to '%s'", tempFilepath, indexFilePath)
+	}
+
+	return nil
+}
+
+// invalidate removes the index file, so that the index is rebuilt on next start. This is used when the index on disk
+// might not reflect the actual state of the cache.
+func (c *cacheIndex) invalidate() {
+	indexFilePath := filepath.Join(c.cacheDir, IndexFileName)
+	err := util.CurrentFilesystem.Remove(indexFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		sigolo.Errorf("Unable to remove possibly inconsistent cache index '%s'. Please remove it manually. Error: %+v", indexFilePath, err)
+	}
+}
+
+// updateFileStates remembers the current states of the index files. This must be called after each change of these
+// files, so that refreshIndex only considers changes by other processes.
+func (c *cacheIndex) updateFileStates() {
+	indexFileState, journalFileState, err := c.getFileStates()
+	if err != nil {
+		sigolo.Debugf("Unable to determine state of cache index files: %s", err.Error())
+		return
+	}
+	c.indexFileState = indexFileState
+	c.journalFileState = journalFileState
+}
+
+// getFileStates returns the current states of the index file and the journal file.
+func (c *cacheIndex) getFileStates() (fileState, fileState, error) {
+	indexFileState, err := getFileState(filepath.Join(c.cacheDir, IndexFileName))
+	if err != nil {
+		return fileState{}, fileState{}, err
+	}
+	journalFileState, err := getFileState(filepath.Join(c.cacheDir, IndexJournalFileName))
+	if err != nil {
+		return fileState{}, fileState{}, err
+	}
+	return indexFileState, journalFileState, nil
+}
+
+func getFileState(filePath string) (fileState, error) {
+	fileStat, err := util.CurrentFilesystem.Stat(filePath)
+	if os.IsNotExist(err) {
+		return fileState{}, nil
+	}
+	if err != nil {
+		return fileState{}, errors.Wrapf(err, "Unable to determine file stats of '%s'", filePath)
+	}
+	return fileState{
+		exists:  true,
+		size:    fileStat.Size(),
+		modTime: fileStat.ModTime(),
+	}, nil
+}
+
+func (s fileState) equal(other fileState) bool {
+	return s.exists == other.exists && s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+// entryHeap implements heap.Interface for index entries. Each entry knows its position in the heap, which is needed
+// to update or remove the entry in O(log n).
+type entryHeap struct {
+	entries   []*IndexEntry
+	less      func(a, b *IndexEntry) bool
+	heapIndex func(e *IndexEntry) *int
+}
+
+func (h *entryHeap) Len() int {
+	return len(h.entries)
+}
+
+func (h *entryHeap) Less(i, j int) bool {
+	return h.less(h.entries[i], h.entries[j])
+}
+
+func (h *entryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	*h.heapIndex(h.entries[i]) = i
+	*h.heapIndex(h.entries[j]) = j
+}
+
+func (h *entryHeap) Push(x any) {
+	entry := x.(*IndexEntry)
+	*h.heapIndex(entry) = len(h.entries)
+	h.entries = append(h.entries, entry)
+}
+
+func (h *entryHeap) Pop() any {
+	lastIndex := len(h.entries) - 1
+	entry := h.entries[lastIndex]
+	h.entries[lastIndex] = nil
+	h.entries = h.entries[:lastIndex]
+	return entry
+}
+
+func (h *entryHeap) peek() *IndexEntry {
+	if len(h.entries) == 0 {
+		return nil
+	}
+	return h.entries[0]
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wiki2book/config"
+	"wiki2book/test"
+	"wiki2book/util"
+)
+
+func prepareIndexTest(t *testing.T) {
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current.CacheDir = t.TempDir()
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyNone
+	currentIndex = nil
+	test.AssertNil(t, os.MkdirAll(GetTempPath(), os.ModePerm))
+}
+
+func TestCacheIndex_putAndRemove(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	index := newCacheIndex("cache-dir")
+
+	// Act
+	index.put(&IndexEntry{Path: "a/1", Size: 10, LastAccess: now})
+	index.put(&IndexEntry{Path: "a/2", Size: 30, LastAccess: now.Add(-time.Hour)})
+	index.put(&IndexEntry{Path: "a/3", Size: 20, LastAccess: now.Add(-time.Minute)})
+	index.put(&IndexEntry{Path: "a/2", Size: 5, LastAccess: now.Add(time.Hour)})
+	index.remove("a/1")
+
+	// Assert
+	test.AssertEqual(t, int64(25), index.totalSize)
+	test.AssertEqual(t, 2, len(index.entries))
+	test.AssertEqual(t, "a/3", index.largestEntry().Path)
+	test.AssertEqual(t, "a/3", index.lruEntry().Path)
+}
+
+func TestCacheIndex_isPersisted(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "File:Foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ArticleCacheDirName, "Bar", strings.NewReader("some article"))
+	test.AssertNil(t, err)
+	SetOrigin(ImageCacheDirName, "File:Foo.jpg", "https://upload.wikimedia.org/Foo.jpg", "some-hash")
+
+	// Act
+	currentIndex = nil
+	index := getIndex()
+
+	// Assert
+	test.AssertEqual(t, int64(15), index.totalSize)
+	test.AssertEqual(t, 2, len(index.entries))
+
+	imageEntry := index.entries[indexPath(ImageCacheDirName, "File:Foo.jpg")]
+	test.AssertEqual(t, "images/File%3AFoo.jpg", imageEntry.Path)
+	test.AssertEqual(t, ImageCacheDirName, imageEntry.Category)
+	test.AssertEqual(t, int64(3), imageEntry.Size)
+	test.AssertEqual(t, "https://upload.wikimedia.org/Foo.jpg", imageEntry.Url)
+	test.AssertEqual(t, "some-hash", imageEntry.Sha256)
+}
+
+func TestCacheIndex_compact(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ImageCacheDirName, "bar.jpg", strings.NewReader("bar"))
+	test.AssertNil(t, err)
+
+	// Act
+	getIndex().compact()
+
+	// Assert
+	_, err = os.Stat(filepath.Join(config.Current.CacheDir, IndexJournalFileName))
+	test.AssertTrue(t, os.IsNotExist(err))
+
+	currentIndex = nil
+	test.AssertEqual(t, 2, len(getIndex().entries))
+}
+
+func TestRefreshIndex_appliesJournalOfOtherProcess(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+
+	// The index of another process using the same cache dir.
+	otherIndex := loadIndex(config.Current.CacheDir)
+	otherIndex.addFile(ImageCacheDirName, "bar.jpg", 7, time.Now())
+	otherIndex.removeFile("images/foo.jpg")
+
+	// Act
+	refreshIndex()
+
+	// Assert
+	test.AssertEqual(t, 1, len(getIndex().entries))
+	test.AssertEqual(t, int64(7), getIndex().entries["images/bar.jpg"].Size)
+	test.AssertEqual(t, int64(7), getIndex().totalSize)
+}
+
+func TestRefreshIndex_reloadsCompactedIndexOfOtherProcess(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+
+	otherIndex := loadIndex(config.Current.CacheDir)
+	otherIndex.addFile(ImageCacheDirName, "bar.jpg", 7, time.Now())
+	otherIndex.compact()
+
+	// Act
+	refreshIndex()
+
+	// Assert
+	test.AssertEqual(t, 2, len(getIndex().entries))
+	test.AssertEqual(t, int64(10), getIndex().totalSize)
+}
+
+func TestCacheIndex_rebuildWhenMissing(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	test.AssertNil(t, os.MkdirAll(GetDirPathInCache(MathCacheDirName), os.ModePerm))
+	test.AssertNil(t, os.WriteFile(GetFilePathInCache(MathCacheDirName, "foo"), []byte("foo"), 0644))
+	test.AssertNil(t, os.WriteFile(filepath.Join(GetTempPath(), "bar"), []byte("bar"), 0644))
+
+	// Act
+	index := getIndex()
+
+	// Assert
+	test.AssertEqual(t, 1, len(index.entries))
+	test.AssertEqual(t, MathCacheDirName, index.entries["math/foo"].Category)
+	test.AssertEqual(t, int64(3), index.totalSize)
+
+	_, err := os.Stat(filepath.Join(config.Current.CacheDir, IndexFileName))
+	test.AssertNil(t, err)
+}
+
+func TestCacheIndex_rebuildWhenJournalIsBroken(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	test.AssertNil(t, os.WriteFile(GetFilePathInCache(ImageCacheDirName, "bar.jpg"), []byte("bar"), 0644))
+	test.AssertNil(t, util.CurrentFilesystem.AppendFile(filepath.Join(config.Current.CacheDir, IndexJournalFileName), []byte(`{"put":{"pa`)))
+
+	// Act
+	currentIndex = nil
+	index := getIndex()
+
+	// Assert
+	test.AssertEqual(t, 2, len(index.entries))
+	test.AssertEqual(t, int64(6), index.totalSize)
+}
+
+func TestGetFile_removesMissingFileFromIndex(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	config.Current.CacheMaxAge = 100
+
+	filePath, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	test.AssertNil(t, os.Remove(filePath))
+
+	// Act
+	_, exists, err := GetFile(ImageCacheDirName, "foo.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, exists)
+	test.AssertEqual(t, 0, len(getIndex().entries))
+	test.AssertEqual(t, int64(0), getIndex().totalSize)
+}
+
+func TestRegisterFile(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	filePath, err := CacheToFile(ImageCacheDirName, "foo.svg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	pngFilePath := GetFilePathInCache(ImageCacheDirName, "File:foo.png")
+	test.AssertNil(t, os.WriteFile(filePath, []byte("longer foo"), 0644))
+	test.AssertNil(t, os.WriteFile(pngFilePath, []byte("png"), 0644))
+
+	// Act
+	err = RegisterFile(filePath)
+	test.AssertNil(t, err)
+	err = RegisterFile(pngFilePath)
+	test.AssertNil(t, err)
+	outsideErr := RegisterFile(filepath.Join(t.TempDir(), "other.png"))
+
+	// Assert
+	test.AssertNotNil(t, outsideErr)
+	test.AssertEqual(t, 2, len(getIndex().entries))
+	test.AssertEqual(t, int64(13), getIndex().totalSize)
+	test.AssertEqual(t, ImageCacheDirName, getIndex().entries["images/File%3Afoo.png"].Category)
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	lockFileSuffix = ".lock"
+	// staleLockFileSuffix is appended to stale lock files before removing them (s. breakStaleLock).
+	staleLockFileSuffix = ".stale"
+	// cacheLockName is the name of the lock (without lockFileSuffix) within the temp folder of the cache, which
+	// protects the whole cache dir.
+	cacheLockName = "cache"
+)
+
+var (
+	// lockRetryDelay is the time to wait before trying again to acquire a lock held by someone else.
+	lockRetryDelay = 20 * time.Millisecond
+	// lockTimeout is the maximum time to wait for a lock.
+	lockTimeout = 30 * time.Second
+	// staleLockAge is the age after which a lock file is considered to be a leftover of a crashed process.
+	staleLockAge = time.Minute
+	// tempDirUpdateInterval is the minimum time between two updates of the modification time of the temp folder of
+	// this process.
+	tempDirUpdateInterval = time.Minute
+	// lastTempDirUpdate is the last time the modification time of the temp folder of this process was updated. The
+	// folder is created on start, so there's no need to update it right away.
+	lastTempDirUpdate = time.Now()
+)
+
+// acquireLock locks the given file by creating a lock file next to it. The returned function releases the lock. Since
+// the lock file is created exclusively (s. util.Filesystem.CreateExclusive), this works across multiple processes and
+// also on network filesystems. While the lock is held, the modification time of the lock file is regularly updated, so
+// that other processes don't consider it to be stale.
+func acquireLock(filePath string) (func(), error) {
+	lockFilePath := filePath + lockFileSuffix
+	start := time.Now()
+
+	for {
+		lockFile, err := util.CurrentFilesystem.CreateExclusive(lockFilePath)
+		if err == nil {
+			// The token identifies this lock, so that a lock taken over by someone else isn't released by accident.
+			token := newLockToken()
+			_, err = lockFile.Write([]byte(token))
+			closeErr := lockFile.Close()
+			if err != nil || closeErr != nil {
+				_ = util.CurrentFilesystem.Remove(lockFilePath)
+				return nil, errors.Errorf("Unable to write lock file '%s': %v %v", lockFilePath, err, closeErr)
+			}
+
+			stopRefresh := refreshLockWhileHeld(lockFilePath)
+			return func() {
+				stopRefresh()
+				releaseLock(lockFilePath, token)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrapf(err, "Unable to create lock file '%s'", lockFilePath)
+		}
+
+		lockFileStat, err := util.CurrentFilesystem.Stat(lockFilePath)
+		if err == nil && time.Since(lockFileStat.ModTime()) > staleLockAge {
+			err = breakStaleLock(lockFilePath)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if time.Since(start) > lockTimeout {
+			return nil, errors.Errorf("Unable to acquire lock file '%s' within %s", lockFilePath, lockTimeout)
+		}
+
+		// No logging here: Waiting goroutines would log concurrently every few milliseconds and the sigolo package
+		// functions aren't safe for concurrent use.
+		time.Sleep(lockRetryDelay)
+	}
+}
+
+// newLockToken returns a unique token for a lock. Besides some random bytes, it contains the host and process ID of the
+// owner for debugging purposes.
+func newLockToken() string {
+	randomBytes := make([]byte, 16)
+	_, _ = rand.Read(randomBytes)
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s %s %d", hex.EncodeToString(randomBytes), hostname, os.Getpid())
+}
+
+// refreshLockWhileHeld regularly updates the modification time of the lock file until the returned function is called.
+// This allows holding a lock longer than the staleLockAge, e.g. when writing to a slow network filesystem. The returned
+// function waits until the refresh has stopped.
+func refreshLockWhileHeld(lockFilePath string) func() {
+	// The refresh runs in the background, so it must not use the global settings that might change in the meantime.
+	filesystem := util.CurrentFilesystem
+	refreshInterval := staleLockAge / 4
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				err := filesystem.Chtimes(lockFilePath, now, now)
+				if err != nil {
+					sigolo.Warnf("Unable to refresh lock file '%s': %s", lockFilePath, err.Error())
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// releaseLock removes the lock file, but only if it still contains the given token. Otherwise, the lock was considered
+// to be stale and has been taken over by someone else, who still holds it.
+func releaseLock(lockFilePath string, token string) {
+	content, err := util.CurrentFilesystem.ReadFile(lockFilePath)
+	if err != nil {
+		sigolo.Warnf("Unable to read lock file '%s' to release it: %s", lockFilePath, err.Error())
+		return
+	}
+	if string(content) != token {
+		sigolo.Warnf("Lock file '%s' was taken over by someone else, so it's not removed", lockFilePath)
+		return
+	}
+
+	err = util.CurrentFilesystem.Remove(lockFilePath)
+	if err != nil {
+		sigolo.Warnf("Unable to remove lock file '%s': %s", lockFilePath, err.Error())
+	}
+}
+
+// breakStaleLock removes the given stale lock file. Other processes might try to break the same lock at the same time
+// or might even have acquired a new lock in the meantime. The lock file is therefore first renamed to a unique name,
+// which only succeeds for one process. The renamed file is only removed when it's still stale, otherwise it's a fresh
+// lock, which is moved back.
+func breakStaleLock(lockFilePath string) error {
+	staleLockFilePath := lockFilePath + "." + newLockToken()[:32] + staleLockFileSuffix
+	err := util.CurrentFilesystem.Rename(lockFilePath, staleLockFilePath)
+	if os.IsNotExist(err) {
+		// Someone else removed the stale lock already.
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Unable to move stale lock file '%s'", lockFilePath)
+	}
+
+	staleLockFileStat, err := util.CurrentFilesystem.Stat(staleLockFilePath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to determine file stats of stale lock file '%s'", staleLockFilePath)
+	}
+	if time.Since(staleLockFileStat.ModTime()) <= staleLockAge {
+		sigolo.Debugf("Lock file '%s' was refreshed or acquired in the meantime, move it back", lockFilePath)
+		err = util.CurrentFilesystem.Rename(staleLockFilePath, lockFilePath)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to move lock file '%s' back", staleLockFilePath)
+		}
+		return nil
+	}
+
+	sigolo.Warnf("Remove stale lock file '%s' older than %s", lockFilePath, staleLockAge)
+	err = util.CurrentFilesystem.Remove(staleLockFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Unable to remove stale lock file '%s'", staleLockFilePath)
+	}
+	return nil
+}
+
+// lockCache locks the cache against changes by other goroutines (s. cacheWriteMutex) and other processes using the
+// same cache dir. The cache index is updated with changes made by other processes. The returned function releases the
+// lock.
+func lockCache() (func(), error) {
+	cacheWriteMutex.Lock()
+
+	unlockFile, err := acquireCacheLockFile()
+	if err != nil {
+		cacheWriteMutex.Unlock()
+		return nil, err
+	}
+
+	refreshIndex()
+
+	return func() {
+		unlockFile()
+		cacheWriteMutex.Unlock()
+	}, nil
+}
+
+// acquireCacheLockFile acquires the lock file of the cache dir. The temp folder of this process is created if needed
+// and marked as in use, so that other processes don't consider it to be a leftover (s. staleTempDirAge).
+func acquireCacheLockFile() (func(), error) {
+	tempPath := GetTempPath()
+	err := util.CurrentFilesystem.MkdirAll(tempPath)
+	if err != nil && !os.IsExist(err) {
+		return nil, errors.Wrapf(err, "Unable to create temp folder '%s'", tempPath)
+	}
+
+	if time.Since(lastTempDirUpdate) > tempDirUpdateInterval {
+		now := time.Now()
+		err = util.CurrentFilesystem.Chtimes(tempPath, now, now)
+		if err != nil {
+			sigolo.Warnf("Unable to update modification time of temp folder '%s': %s", tempPath, err.Error())
+		}
+		lastTempDirUpdate = now
+	}
+
+	return acquireLock(filepath.Join(config.Current.CacheDir, TempDirName, cacheLockName))
+}
@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wiki2book/config"
+	"wiki2book/test"
+	"wiki2book/util"
+)
+
+const (
+	// writerProcessCacheDirEnv contains the cache dir of the writer processes of TestCacheToFile_concurrentProcesses.
+	writerProcessCacheDirEnv = "WIKI2BOOK_TEST_WRITER_PROCESS_CACHE_DIR"
+	writerProcessFiles       = 20
+	writerProcessFileSize    = 100
+	writerProcessCacheSize   = 10_000
+)
+
+func TestAcquireLock(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	filePath := filepath.Join(t.TempDir(), "foo")
+
+	// Act
+	unlock, err := acquireLock(filePath)
+
+	// Assert
+	test.AssertNil(t, err)
+	_, err = os.Stat(filePath + lockFileSuffix)
+	test.AssertNil(t, err)
+
+	unlock()
+	_, err = os.Stat(filePath + lockFileSuffix)
+	test.AssertTrue(t, os.IsNotExist(err))
+}
+
+func TestAcquireLock_timeout(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	filePath := filepath.Join(t.TempDir(), "foo")
+	test.AssertNil(t, os.WriteFile(filePath+lockFileSuffix, []byte{}, 0644))
+
+	originalLockTimeout := lockTimeout
+	lockTimeout = 50 * time.Millisecond
+	defer func() { lockTimeout = originalLockTimeout }()
+
+	// Act
+	_, err := acquireLock(filePath)
+
+	// Assert
+	test.AssertNotNil(t, err)
+}
+
+func TestAcquireLock_staleLock(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	filePath := filepath.Join(t.TempDir(), "foo")
+	test.AssertNil(t, os.WriteFile(filePath+lockFileSuffix, []byte{}, 0644))
+	oldTime := time.Now().Add(-2 * staleLockAge)
+	test.AssertNil(t, os.Chtimes(filePath+lockFileSuffix, oldTime, oldTime))
+
+	// Act
+	unlock, err := acquireLock(filePath)
+
+	// Assert
+	test.AssertNil(t, err)
+	unlock()
+}
+
+func TestAcquireLock_concurrentWaitersOnStaleLock(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	filePath := filepath.Join(t.TempDir(), "foo")
+	test.AssertNil(t, os.WriteFile(filePath+lockFileSuffix, []byte("stale"), 0644))
+	oldTime := time.Now().Add(-2 * staleLockAge)
+	test.AssertNil(t, os.Chtimes(filePath+lockFileSuffix, oldTime, oldTime))
+
+	numberOfWaiters := 10
+	holders := atomic.Int32{}
+	maxHolders := atomic.Int32{}
+
+	// Act
+	wg := sync.WaitGroup{}
+	for i := 0; i < numberOfWaiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := acquireLock(filePath)
+			test.AssertNil(t, err)
+
+			currentHolders := holders.Add(1)
+			if currentHolders > maxHolders.Load() {
+				maxHolders.Store(currentHolders)
+			}
+			time.Sleep(time.Millisecond)
+			holders.Add(-1)
+
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	test.AssertEqual(t, int32(1), maxHolders.Load())
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 0, len(entries))
+}
+
+func TestAcquireLock_releaseKeepsLockTakenOverBySomeoneElse(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	filePath := filepath.Join(t.TempDir(), "foo")
+	unlock, err := acquireLock(filePath)
+	test.AssertNil(t, err)
+	test.AssertNil(t, os.WriteFile(filePath+lockFileSuffix, []byte("other owner"), 0644))
+
+	// Act
+	unlock()
+
+	// Assert
+	content, err := os.ReadFile(filePath + lockFileSuffix)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "other owner", string(content))
+}
+
+func TestAcquireLock_heldLockIsRefreshed(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	filePath := filepath.Join(t.TempDir(), "foo")
+
+	originalStaleLockAge := staleLockAge
+	originalLockTimeout := lockTimeout
+	staleLockAge = 100 * time.Millisecond
+	lockTimeout = 50 * time.Millisecond
+
+	unlock, err := acquireLock(filePath)
+	test.AssertNil(t, err)
+
+	// Act
+	time.Sleep(3 * staleLockAge)
+	_, err = acquireLock(filePath)
+	unlock()
+	staleLockAge = originalStaleLockAge
+	lockTimeout = originalLockTimeout
+
+	// Assert
+	test.AssertNotNil(t, err)
+}
+
+func TestBreakStaleLock_freshLockIsMovedBack(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	lockFilePath := filepath.Join(t.TempDir(), "foo"+lockFileSuffix)
+	test.AssertNil(t, os.WriteFile(lockFilePath, []byte("fresh"), 0644))
+
+	// Act
+	err := breakStaleLock(lockFilePath)
+
+	// Assert
+	test.AssertNil(t, err)
+	content, err := os.ReadFile(lockFilePath)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "fresh", string(content))
+	entries, err := os.ReadDir(filepath.Dir(lockFilePath))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 1, len(entries))
+}
+
+// TestWriterProcess is not a test by itself but the writer process started by TestCacheToFile_concurrentProcesses.
+func TestWriterProcess(t *testing.T) {
+	cacheDir := os.Getenv(writerProcessCacheDirEnv)
+	if cacheDir == "" {
+		t.Skip("Only used as writer process of other tests")
+	}
+
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current.CacheDir = cacheDir
+	config.Current.CacheMaxAge = 100
+	config.Current.CacheMaxSize = writerProcessCacheSize
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+	currentIndex = nil
+
+	for i := 0; i < writerProcessFiles; i++ {
+		filename := fmt.Sprintf("writer-%d-%d.jpg", os.Getpid(), i)
+		_, err := CacheToFile(ImageCacheDirName, filename, strings.NewReader(strings.Repeat("x", writerProcessFileSize)))
+		test.AssertNil(t, err)
+	}
+
+	test.AssertNil(t, os.RemoveAll(GetTempPath()))
+}
+
+func TestCacheToFile_concurrentProcesses(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	config.Current.CacheMaxAge = 100
+	config.Current.CacheMaxSize = writerProcessCacheSize
+	numberOfWriters := 4
+
+	// Files of previous runs filling half of the cache. They are larger than the new files and therefore evicted first
+	// by the writers. Each writer alone would fit into the cache without evicting files.
+	oldFileSize := 2 * writerProcessFileSize
+	for i := 0; i < writerProcessCacheSize/2/oldFileSize; i++ {
+		_, err := CacheToFile(ImageCacheDirName, fmt.Sprintf("old-%d.jpg", i), strings.NewReader(strings.Repeat("x", oldFileSize)))
+		test.AssertNil(t, err)
+	}
+	// Otherwise, the writers would consider the files of this process to be in use.
+	test.AssertNil(t, os.RemoveAll(GetTempPath()))
+
+	// Act
+	var writers []*exec.Cmd
+	var outputs []*strings.Builder
+	for i := 0; i < numberOfWriters; i++ {
+		output := &strings.Builder{}
+		writer := exec.Command(os.Args[0], "-test.run=^TestWriterProcess$", "-test.count=1")
+		writer.Env = append(os.Environ(), writerProcessCacheDirEnv+"="+config.Current.CacheDir)
+		writer.Stdout = output
+		writer.Stderr = output
+		test.AssertNil(t, writer.Start())
+		writers = append(writers, writer)
+		outputs = append(outputs, output)
+	}
+	for i, writer := range writers {
+		err := writer.Wait()
+		if err != nil {
+			t.Fatalf("Writer process failed: %v\n%s", err, outputs[i].String())
+		}
+	}
+
+	// Assert
+	currentIndex = nil
+	index := getIndex()
+	relativeFilePaths, fileSizes, err := findCachedFiles(config.Current.CacheDir)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(relativeFilePaths), len(index.entries))
+	totalFileSize := int64(0)
+	writtenFiles := 0
+	for i, relativeFilePath := range relativeFilePaths {
+		entry, exists := index.entries[relativeFilePath]
+		test.AssertTrue(t, exists)
+		test.AssertEqual(t, fileSizes[i], entry.Size)
+		totalFileSize += fileSizes[i]
+		if strings.HasPrefix(relativeFilePath, "images/writer-") {
+			writtenFiles++
+		}
+	}
+	test.AssertEqual(t, totalFileSize, index.totalSize)
+	test.AssertEqual(t, numberOfWriters*writerProcessFiles, writtenFiles)
+
+	// Each writer considered the files of the other writers, so the cache didn't exceed its max size.
+	test.AssertTrue(t, index.totalSize < writerProcessCacheSize)
+
+	result, err := Verify()
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 0, result.NumberOfProblems())
+}
@@ -0,0 +1,333 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+// FolderStats contains the number and size of the files in one cache folder, e.g. "images".
+type FolderStats struct {
+	Folder      string
+	Files       int
+	SizeInBytes int64
+}
+
+// Stats is an overview of the whole cache based on the cache index.
+type Stats struct {
+	Folders       []FolderStats
+	Files         int
+	SizeInBytes   int64
+	OldestEntries []IndexEntry
+}
+
+// VerificationResult contains all problematic files found by Verify. All paths are relative to the cache dir.
+type VerificationResult struct {
+	// EmptyFiles are files with zero bytes, which are usually the result of failed downloads or conversions.
+	EmptyFiles []string
+	// ModifiedFiles are files whose size differs from the size stored in the cache index, e.g. because they were
+	// truncated.
+	ModifiedFiles []string
+	// TempFiles are leftovers in the temp folder of the cache, e.g. from aborted runs. Files of other running processes
+	// are not considered to be leftovers.
+	TempFiles []string
+}
+
+// NumberOfProblems returns the number of all problematic files.
+func (v *VerificationResult) NumberOfProblems() int {
+	return len(v.EmptyFiles) + len(v.ModifiedFiles) + len(v.TempFiles)
+}
+
+// GetStats returns the number of files and their size per cache folder. The given number of least recently used
+// entries are returned as well, the least recently used entry first.
+func GetStats(numberOfOldestEntries int) (*Stats, error) {
+	unlock, err := lockCache()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	index := getIndex()
+
+	folderStats := map[string]*FolderStats{}
+	for _, folder := range []string{ArticleCacheDirName, HtmlCacheDirName, ImageCacheDirName, MathCacheDirName, TemplateCacheDirName} {
+		folderStats[folder] = &FolderStats{Folder: folder}
+	}
+
+	var entries []IndexEntry
+	for _, entry := range index.entries {
+		stats, ok := folderStats[entry.Category]
+		if !ok {
+			stats = &FolderStats{Folder: entry.Category}
+			folderStats[entry.Category] = stats
+		}
+		stats.Files++
+		stats.SizeInBytes += entry.Size
+
+		entries = append(entries, *entry)
+	}
+
+	result := &Stats{
+		Files:       len(index.entries),
+		SizeInBytes: index.totalSize,
+	}
+
+	for _, stats := range folderStats {
+		result.Folders = append(result.Folders, *stats)
+	}
+	slices.SortFunc(result.Folders, func(a, b FolderStats) int {
+		return strings.Compare(a.Folder, b.Folder)
+	})
+
+	slices.SortFunc(entries, func(a, b IndexEntry) int {
+		return a.LastAccess.Compare(b.LastAccess)
+	})
+	result.OldestEntries = entries[:min(max(numberOfOldestEntries, 0), len(entries))]
+
+	return result, nil
+}
+
+// Prune removes all outdated files (s. config.Configuration.CacheMaxAge and config.CachePolicy) from the cache. Files of
+// persistent cache folders (s. persistentCacheDirNames) are kept.
+// Afterward, files are removed according to the eviction strategy until neither the cache folders nor the whole cache
+// exceed their max size anymore. Files, which might be in use by other running processes, are kept. The number of
+// removed files and their total size is returned.
+func Prune() (int, int64, error) {
+	unlock, err := lockCache()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	index := getIndex()
+	removedFiles := 0
+	removedBytes := int64(0)
+
+	var entries []*IndexEntry
+	for _, entry := range index.entries {
+		entries = append(entries, entry)
+	}
+	protectionTime := getEvictionProtectionTime()
+
+	for _, entry := range entries {
+		filePath := filepath.Join(config.Current.CacheDir, filepath.FromSlash(entry.Path))
+		fileStat, err := util.CurrentFilesystem.Stat(filePath)
+		if os.IsNotExist(err) {
+			sigolo.Debugf("File '%s' from cache index does not exist anymore", filePath)
+			index.removeFile(entry.Path)
+			continue
+		}
+		if err != nil {
+			return removedFiles, removedBytes, errors.Wrapf(err, "Unable to determine file stats of file '%s'", filePath)
+		}
+
+		if isPersistentCategory(entry.Category) || !isFileOutdated(fileStat, config.Current.CachePolicy(entry.Category).MaxAge) {
+			continue
+		}
+		if !protectionTime.IsZero() && !entry.LastAccess.Before(protectionTime) {
+			sigolo.Debugf("Keep outdated file '%s' since it might be in use by another process", filePath)
+			continue
+		}
+
+		sigolo.Debugf("Remove outdated file '%s'", filePath)
+		err = deleteFileFromCache(index, entry)
+		if err != nil {
+			return removedFiles, removedBytes, err
+		}
+		removedFiles++
+		removedBytes += fileStat.Size()
+	}
+
+	if config.Current.CacheEvictionStrategy == config.CacheEvictionStrategyNone {
+		return removedFiles, removedBytes, nil
+	}
+
+	for _, categoryName := range index.categoryNames() {
+		policy := config.Current.CachePolicy(categoryName)
+		if policy.MaxSizeShare <= 0 {
+			continue
+		}
+
+		maxCategorySize := int64(policy.MaxSizeShare * float64(config.Current.CacheMaxSize))
+		for maxCategorySize < index.categorySize(categoryName) {
+			deletedEntry, err := deleteFileByEvictionStrategy(index, categoryName)
+			if err != nil {
+				return removedFiles, removedBytes, err
+			}
+			if deletedEntry == nil {
+				break
+			}
+			removedFiles++
+			removedBytes += deletedEntry.Size
+		}
+	}
+
+	for config.Current.CacheMaxSize < index.totalSize {
+		deletedEntry, err := deleteFileByEvictionStrategy(index)
+		if err != nil {
+			return removedFiles, removedBytes, err
+		}
+		if deletedEntry == nil {
+			break
+		}
+		removedFiles++
+		removedBytes += deletedEntry.Size
+	}
+
+	return removedFiles, removedBytes, nil
+}
+
+// Clear removes all files of the given cache folder (e.g. "images") or of the whole cache, when no folder is given.
+// The number of removed files and their total size is returned.
+func Clear(cacheFolderName string) (int, int64, error) {
+	if cacheFolderName != "" && (cacheFolderName == "." || cacheFolderName == ".." || cacheFolderName == TempDirName || strings.ContainsAny(cacheFolderName, `/\`)) {
+		return 0, 0, errors.Errorf("Invalid cache folder '%s'", cacheFolderName)
+	}
+
+	unlock, err := lockCache()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	index := getIndex()
+	removedFiles := 0
+	removedBytes := int64(0)
+
+	relativeFilePaths, fileSizes, err := findCachedFiles(GetDirPathInCache(cacheFolderName))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i, relativeFilePath := range relativeFilePaths {
+		filePath := filepath.Join(config.Current.CacheDir, filepath.FromSlash(relativeFilePath))
+		err = util.CurrentFilesystem.Remove(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return removedFiles, removedBytes, errors.Wrapf(err, "Unable to remove file '%s'", filePath)
+		}
+		index.removeFile(relativeFilePath)
+
+		removedFiles++
+		removedBytes += fileSizes[i]
+	}
+
+	return removedFiles, removedBytes, nil
+}
+
+// Verify checks all files in the cache for problems like empty or truncated files and leftovers in the temp folder.
+func Verify() (*VerificationResult, error) {
+	unlock, err := lockCache()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	index := getIndex()
+	result := &VerificationResult{}
+
+	relativeFilePaths, fileSizes, err := findCachedFiles(config.Current.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, relativeFilePath := range relativeFilePaths {
+		if fileSizes[i] == 0 {
+			result.EmptyFiles = append(result.EmptyFiles, relativeFilePath)
+		} else if entry, ok := index.entries[relativeFilePath]; ok && entry.Size != fileSizes[i] {
+			sigolo.Debugf("File '%s' has size of %d bytes but cache index expects %d bytes", relativeFilePath, fileSizes[i], entry.Size)
+			result.ModifiedFiles = append(result.ModifiedFiles, relativeFilePath)
+		}
+	}
+
+	// Temp files of running processes are no leftovers, even though they might be older, e.g. when a process converts
+	// a large book.
+	runningProcessTempDirs := map[string]bool{GetTempPath(): true}
+	otherProcessTempDirs, err := findOtherProcessTempDirs()
+	if err != nil {
+		return nil, err
+	}
+	for _, tempDir := range otherProcessTempDirs {
+		if tempDir.running {
+			runningProcessTempDirs[tempDir.path] = true
+		}
+	}
+
+	tempPath := filepath.Join(config.Current.CacheDir, TempDirName)
+	cacheLockFilePath := filepath.Join(tempPath, cacheLockName+lockFileSuffix)
+	err = util.CurrentFilesystem.Walk(tempPath, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if file.IsDir() {
+			if runningProcessTempDirs[path] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == cacheLockFilePath {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(config.Current.CacheDir, path)
+		if err != nil {
+			return err
+		}
+		result.TempFiles = append(result.TempFiles, filepath.ToSlash(relativePath))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read files in temp folder '%s'", tempPath)
+	}
+
+	return result, nil
+}
+
+// findCachedFiles returns the paths (relative to the cache dir) and sizes of all cached files within the given folder.
+// Files within the temp folder and the index files are ignored. A non-existing folder contains no files.
+func findCachedFiles(folderPath string) ([]string, []int64, error) {
+	var relativeFilePaths []string
+	var fileSizes []int64
+
+	err := util.CurrentFilesystem.Walk(folderPath, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if file.IsDir() {
+			if file.Name() == TempDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(config.Current.CacheDir, path)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if relativePath == IndexFileName || relativePath == IndexJournalFileName {
+			return nil
+		}
+
+		relativeFilePaths = append(relativeFilePaths, relativePath)
+		fileSizes = append(fileSizes, file.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Unable to read files in cache folder '%s'", folderPath)
+	}
+
+	return relativeFilePaths, fileSizes, nil
+}
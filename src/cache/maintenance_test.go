@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+func TestGetStats(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ImageCacheDirName, "bar.jpg", strings.NewReader("some bar"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ArticleCacheDirName, "Foo", strings.NewReader("article"))
+	test.AssertNil(t, err)
+	getIndex().updateEntry(ImageCacheDirName, "bar.jpg", func(entry *IndexEntry) {
+		entry.LastAccess = time.Now().Add(-time.Hour)
+	})
+
+	// Act
+	stats, err := GetStats(2)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 3, stats.Files)
+	test.AssertEqual(t, int64(18), stats.SizeInBytes)
+	test.AssertEqual(t, []FolderStats{
+		{Folder: ArticleCacheDirName, Files: 1, SizeInBytes: 7},
+		{Folder: HtmlCacheDirName},
+		{Folder: ImageCacheDirName, Files: 2, SizeInBytes: 11},
+		{Folder: MathCacheDirName},
+		{Folder: TemplateCacheDirName},
+	}, stats.Folders)
+	test.AssertEqual(t, 2, len(stats.OldestEntries))
+	test.AssertEqual(t, "images/bar.jpg", stats.OldestEntries[0].Path)
+}
+
+func TestPrune(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	config.Current.CacheMaxAge = 10
+
+	outdatedFilePath, err := CacheToFile(ImageCacheDirName, "outdated.jpg", strings.NewReader("outdated"))
+	test.AssertNil(t, err)
+	oldTime := time.Now().Add(-time.Hour)
+	test.AssertNil(t, os.Chtimes(outdatedFilePath, oldTime, oldTime))
+	_, err = CacheToFile(ImageCacheDirName, "large.jpg", strings.NewReader("large file"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ImageCacheDirName, "small.jpg", strings.NewReader("small"))
+	test.AssertNil(t, err)
+
+	config.Current.CacheMaxSize = 10
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+
+	// Act
+	removedFiles, removedBytes, err := Prune()
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 2, removedFiles)
+	test.AssertEqual(t, int64(18), removedBytes)
+	test.AssertEqual(t, 1, len(getIndex().entries))
+	test.AssertEqual(t, int64(5), getIndex().totalSize)
+
+	_, err = os.Stat(outdatedFilePath)
+	test.AssertTrue(t, os.IsNotExist(err))
+	_, err = os.Stat(GetFilePathInCache(ImageCacheDirName, "small.jpg"))
+	test.AssertNil(t, err)
+}
+
+func TestClear(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	_, err = CacheToFile(ArticleCacheDirName, "Foo", strings.NewReader("article"))
+	test.AssertNil(t, err)
+	tempFilePath := filepath.Join(GetTempPath(), "foo")
+	test.AssertNil(t, os.WriteFile(tempFilePath, []byte("foo"), 0644))
+
+	// Act & Assert
+	removedFiles, removedBytes, err := Clear(ImageCacheDirName)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 1, removedFiles)
+	test.AssertEqual(t, int64(3), removedBytes)
+	test.AssertEqual(t, 1, len(getIndex().entries))
+
+	removedFiles, removedBytes, err = Clear("")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 1, removedFiles)
+	test.AssertEqual(t, int64(7), removedBytes)
+	test.AssertEqual(t, 0, len(getIndex().entries))
+
+	_, err = os.Stat(tempFilePath)
+	test.AssertNil(t, err)
+	_, err = os.Stat(filepath.Join(config.Current.CacheDir, IndexFileName))
+	test.AssertNil(t, err)
+
+	_, _, err = Clear("../foo")
+	test.AssertNotNil(t, err)
+	_, _, err = Clear(TempDirName)
+	test.AssertNotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	_, err := CacheToFile(ImageCacheDirName, "fine.jpg", strings.NewReader("fine"))
+	test.AssertNil(t, err)
+	truncatedFilePath, err := CacheToFile(ImageCacheDirName, "truncated.jpg", strings.NewReader("truncated"))
+	test.AssertNil(t, err)
+	test.AssertNil(t, os.Truncate(truncatedFilePath, 3))
+	_, err = CacheToFile(MathCacheDirName, "empty.svg", strings.NewReader(""))
+	test.AssertNil(t, err)
+	abortedProcessTempDir := createProcessTempDir(t, "host-1-1000", time.Now().Add(-2*staleTempDirAge), "leftover")
+	createProcessTempDir(t, fmt.Sprintf("host-2-%d", time.Now().UnixNano()), time.Now(), "in-use")
+
+	// Act
+	result, err := Verify()
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 3, result.NumberOfProblems())
+	test.AssertEqual(t, []string{"math/empty.svg"}, result.EmptyFiles)
+	test.AssertEqual(t, []string{"images/truncated.jpg"}, result.ModifiedFiles)
+	test.AssertEqual(t, []string{".tmp/" + filepath.Base(abortedProcessTempDir) + "/leftover"}, result.TempFiles)
+}
+
+func TestPrune_cachePolicies(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	config.Current.CacheMaxAge = 100
+
+	articleFilePath, err := CacheToFile(ArticleCacheDirName, "Foo", strings.NewReader("article"))
+	test.AssertNil(t, err)
+	imageFilePath, err := CacheToFile(ImageCacheDirName, "foo.jpg", strings.NewReader("foo"))
+	test.AssertNil(t, err)
+	oldTime := time.Now().Add(-time.Hour)
+	test.AssertNil(t, os.Chtimes(articleFilePath, oldTime, oldTime))
+	test.AssertNil(t, os.Chtimes(imageFilePath, oldTime, oldTime))
+	_, err = CacheToFile(ImageCacheDirName, "bar.jpg", strings.NewReader("bar"))
+	test.AssertNil(t, err)
+
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLru
+	setCachePolicies(t, map[string]config.CachePolicy{
+		ArticleCacheDirName: {MaxAge: 10},
+		ImageCacheDirName:   {MaxSizeShare: 0.5},
+	})
+	config.Current.CacheMaxSize = 8
+
+	// Act
+	removedFiles, removedBytes, err := Prune()
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 2, removedFiles)
+	test.AssertEqual(t, int64(10), removedBytes)
+	test.AssertEqual(t, 1, len(getIndex().entries))
+	_, err = os.Stat(GetFilePathInCache(ImageCacheDirName, "bar.jpg"))
+	test.AssertNil(t, err)
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"time"
+	"wiki2book/config"
+)
+
+// store keeps the content of cached files in addition to the cache dir, e.g. to share them with other processes. The
+// cache dir always contains the files used by wiki2book, the store is only used to save files written to the cache
+// dir and to load files missing in the cache dir. All paths are relative to the cache dir with forward slashes, like
+// the paths of the cache index.
+type store interface {
+	// save persists the content and modification time of the given file within the cache dir.
+	save(path string) error
+	// load returns the content and modification time of the given file. The boolean is false when the store doesn't
+	// contain the file.
+	load(path string) ([]byte, time.Time, bool, error)
+	// touch sets the modification time of the given file, if the store contains it.
+	touch(path string, modTime time.Time) error
+}
+
+// getStore returns the store configured by config.Configuration.CacheStore.
+func getStore() store {
+	if config.Current.CacheStore == config.CacheStoreContentAddressed {
+		return newContentAddressedStore(config.Current.CacheStoreDir)
+	}
+	return &filesystemStore{}
+}
+
+// filesystemStore is the default store, which keeps cached files only in the cache dir. Since all functions of this
+// package already manage the files within the cache dir, there's nothing left to do for this store.
+type filesystemStore struct{}
+
+func (s *filesystemStore) save(path string) error {
+	return nil
+}
+
+func (s *filesystemStore) load(path string) ([]byte, time.Time, bool, error) {
+	return nil, time.Time{}, false, nil
+}
+
+func (s *filesystemStore) touch(path string, modTime time.Time) error {
+	return nil
+}
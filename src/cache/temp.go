@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+var (
+	// processStartTime is used to protect files used by this process from being evicted by other processes.
+	processStartTime = time.Now()
+	// processTempDirName is the name of the temp folder of this process within the temp folder of the cache. It ends
+	// with the start time of the process, so that other processes know which files this process might use.
+	processTempDirName = newProcessTempDirName()
+	// staleTempDirAge is the age after which the temp folder of a process is considered to be a leftover of a crashed
+	// or aborted process. Running processes regularly update the modification time of their temp folder (s. lockCache).
+	staleTempDirAge = time.Hour
+)
+
+// processTempDir is the temp folder of a process within the temp folder of the cache.
+type processTempDir struct {
+	path      string
+	startTime time.Time
+	running   bool
+}
+
+func newProcessTempDirName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return util.SanitizeFilename(fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), processStartTime.UnixNano()))
+}
+
+// GetTempPath returns the temp folder of this process. Each process has its own temp folder, so that multiple processes
+// using the same cache dir don't remove each other's temporary files.
+func GetTempPath() string {
+	return filepath.Join(config.Current.CacheDir, TempDirName, processTempDirName)
+}
+
+// ClearTempDirs removes the temp folder of this process as well as all leftovers of crashed or aborted processes. The
+// temp folders of other running processes are kept.
+func ClearTempDirs() error {
+	tempPath := GetTempPath()
+	err := util.CurrentFilesystem.RemoveAll(tempPath)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to remove temp folder '%s'", tempPath)
+	}
+
+	staleTempPaths, err := findStaleTempPaths()
+	if err != nil {
+		return err
+	}
+
+	for _, staleTempPath := range staleTempPaths {
+		sigolo.Debugf("Remove leftover '%s' of crashed or aborted process from temp folder", staleTempPath)
+		err = util.CurrentFilesystem.RemoveAll(staleTempPath)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to remove leftover '%s' from temp folder", staleTempPath)
+		}
+	}
+
+	return nil
+}
+
+// findStaleTempPaths returns all files and folders directly within the temp folder of the cache, which haven't been
+// modified for the staleTempDirAge. The temp folder of this process is never considered to be stale.
+func findStaleTempPaths() ([]string, error) {
+	var result []string
+	err := walkTempDir(func(path string, file os.FileInfo) {
+		if path != GetTempPath() && time.Since(file.ModTime()) > staleTempDirAge {
+			result = append(result, path)
+		}
+	})
+	return result, err
+}
+
+// findOtherProcessTempDirs returns the temp folders of all other processes, which use or used the same cache dir.
+// Folders with an unknown name format are ignored.
+func findOtherProcessTempDirs() ([]processTempDir, error) {
+	var result []processTempDir
+	err := walkTempDir(func(path string, file os.FileInfo) {
+		if !file.IsDir() || path == GetTempPath() {
+			return
+		}
+
+		startTime, ok := parseProcessStartTime(file.Name())
+		if !ok {
+			sigolo.Tracef("Ignore folder '%s' with unknown name format in temp folder", path)
+			return
+		}
+
+		result = append(result, processTempDir{
+			path:      path,
+			startTime: startTime,
+			running:   time.Since(file.ModTime()) <= staleTempDirAge,
+		})
+	})
+	return result, err
+}
+
+// walkTempDir calls the given function for all files and folders directly within the temp folder of the cache. A
+// non-existing temp folder contains no files.
+func walkTempDir(walkFunc func(path string, file os.FileInfo)) error {
+	tempDirPath := filepath.Join(config.Current.CacheDir, TempDirName)
+
+	err := util.CurrentFilesystem.Walk(tempDirPath, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == tempDirPath {
+			return nil
+		}
+
+		walkFunc(path, file)
+
+		if file.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Unable to read temp folder '%s'", tempDirPath)
+	}
+
+	return nil
+}
+
+// parseProcessStartTime returns the start time of the process from the name of its temp folder.
+func parseProcessStartTime(tempDirName string) (time.Time, bool) {
+	index := strings.LastIndex(tempDirName, "-")
+	if index == -1 {
+		return time.Time{}, false
+	}
+
+	startTimeNanos, err := strconv.ParseInt(tempDirName[index+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, startTimeNanos), true
+}
+
+// getEvictionProtectionTime returns the start time of the oldest other running process. Files accessed since then might
+// be in use by that process and must therefore not be evicted. The zero time is returned when there's no other running
+// process.
+func getEvictionProtectionTime() time.Time {
+	otherProcessTempDirs, err := findOtherProcessTempDirs()
+	if err != nil {
+		// Without knowing other processes, their files might be evicted. This doesn't break this process, so there's
+		// no need to abort here.
+		sigolo.Warnf("Unable to determine other processes using the cache, their files might be evicted: %s", err.Error())
+		return time.Time{}
+	}
+
+	var result time.Time
+	for _, tempDir := range otherProcessTempDirs {
+		if tempDir.running && (result.IsZero() || tempDir.startTime.Before(result)) {
+			result = tempDir.startTime
+		}
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+// createProcessTempDir creates the temp folder of another process with the given modification time. The folder
+// contains a file with the given name, unless the name is empty.
+func createProcessTempDir(t *testing.T, name string, modTime time.Time, filename string) string {
+	tempDirPath := filepath.Join(config.Current.CacheDir, TempDirName, name)
+	test.AssertNil(t, os.MkdirAll(tempDirPath, os.ModePerm))
+	if filename != "" {
+		test.AssertNil(t, os.WriteFile(filepath.Join(tempDirPath, filename), []byte("foo"), 0644))
+	}
+	test.AssertNil(t, os.Chtimes(tempDirPath, modTime, modTime))
+	return tempDirPath
+}
+
+func TestClearTempDirs(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	test.AssertNil(t, os.WriteFile(filepath.Join(GetTempPath(), "foo"), []byte("foo"), 0644))
+	abortedProcessTempDir := createProcessTempDir(t, "host-1-1000", time.Now().Add(-2*staleTempDirAge), "leftover")
+	runningProcessTempDir := createProcessTempDir(t, fmt.Sprintf("host-2-%d", time.Now().UnixNano()), time.Now(), "in-use")
+
+	// Act
+	err := ClearTempDirs()
+
+	// Assert
+	test.AssertNil(t, err)
+	_, err = os.Stat(GetTempPath())
+	test.AssertTrue(t, os.IsNotExist(err))
+	_, err = os.Stat(abortedProcessTempDir)
+	test.AssertTrue(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(runningProcessTempDir, "in-use"))
+	test.AssertNil(t, err)
+}
+
+func TestGetTempPath_isUniquePerProcess(t *testing.T) {
+	// Arrange
+	config.Current.CacheDir = "cache-dir"
+
+	// Act
+	tempPath := GetTempPath()
+
+	// Assert
+	test.AssertTrue(t, strings.HasPrefix(tempPath, filepath.Join("cache-dir", TempDirName)+string(filepath.Separator)))
+	test.AssertTrue(t, strings.Contains(filepath.Base(tempPath), fmt.Sprintf("-%d-", os.Getpid())))
+	startTime, ok := parseProcessStartTime(filepath.Base(tempPath))
+	test.AssertTrue(t, ok)
+	test.AssertTrue(t, processStartTime.Equal(startTime))
+}
+
+func TestGetEvictionProtectionTime(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	now := time.Now()
+	startTime := now.Add(-time.Minute)
+	createProcessTempDir(t, fmt.Sprintf("host-1-%d", now.Add(-2*staleTempDirAge).UnixNano()), now.Add(-2*staleTempDirAge), "")
+	createProcessTempDir(t, fmt.Sprintf("host-2-%d", startTime.UnixNano()), now, "")
+	createProcessTempDir(t, fmt.Sprintf("host-3-%d", now.UnixNano()), now, "")
+	createProcessTempDir(t, "unknown-format", now, "")
+
+	// Act
+	protectionTime := getEvictionProtectionTime()
+
+	// Assert
+	test.AssertTrue(t, startTime.Equal(protectionTime))
+}
+
+func TestGetEvictionProtectionTime_noOtherProcesses(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+
+	// Act
+	protectionTime := getEvictionProtectionTime()
+
+	// Assert
+	test.AssertTrue(t, protectionTime.IsZero())
+}
+
+func TestDeleteFileByEvictionStrategy_filesInUseByOtherProcesses(t *testing.T) {
+	// Arrange
+	prepareIndexTest(t)
+	config.Current.CacheMaxAge = 100
+
+	oldFilePath, err := CacheToFile(ImageCacheDirName, "old.jpg", strings.NewReader("old"))
+	test.AssertNil(t, err)
+	newFilePath, err := CacheToFile(ImageCacheDirName, "new.jpg", strings.NewReader("new and larger"))
+	test.AssertNil(t, err)
+	getIndex().updateEntry(ImageCacheDirName, "old.jpg", func(entry *IndexEntry) {
+		entry.LastAccess = time.Now().Add(-time.Hour)
+	})
+	createProcessTempDir(t, fmt.Sprintf("host-1-%d", time.Now().Add(-time.Minute).UnixNano()), time.Now(), "")
+	config.Current.CacheEvictionStrategy = config.CacheEvictionStrategyLargest
+
+	// Act
+	deletedEntry, err := deleteFileByEvictionStrategy(getIndex())
+	secondDeletedEntry, secondErr := deleteFileByEvictionStrategy(getIndex())
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "images/old.jpg", deletedEntry.Path)
+	_, err = os.Stat(oldFilePath)
+	test.AssertTrue(t, os.IsNotExist(err))
+
+	test.AssertNil(t, secondErr)
+	test.AssertNil(t, secondDeletedEntry)
+	_, err = os.Stat(newFilePath)
+	test.AssertNil(t, err)
+}
@@ -3,9 +3,11 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"wiki2book/util"
 
@@ -22,29 +24,54 @@ const (
 	OutputTypeEpub3     = "epub3"
 	OutputTypeStatsJson = "stats-json"
 	OutputTypeStatsTxt  = "stats-txt"
+	OutputTypePdf       = "pdf"
+	OutputTypeAzw3      = "azw3"
+	OutputTypeMarkdown  = "markdown"
+	OutputTypeHtmlSite  = "html-site"
 
 	OutputDriverPandoc   = "pandoc"
 	OutputDriverInternal = "internal"
 
+	ArticleSourceApi  = "api"
+	ArticleSourceDump = "dump"
+
 	linuxDefaultRsvgMathStyleFile = "/usr/share/wiki2book/rsvg-math.css"
 	linuxDefaultStyleFile         = "/usr/share/wiki2book/style.css"
 
 	InputPlaceholder  = "{INPUT}"
 	OutputPlaceholder = "{OUTPUT}"
 
+	AuthorPlaceholder  = "{{AUTHOR}}"
+	LicensePlaceholder = "{{LICENSE}}"
+
+	// ImageCreditTemplateDefaultKey is the key of the image credit template used for all licenses without own template.
+	ImageCreditTemplateDefaultKey = "default"
+	imageCreditTemplateDefault    = AuthorPlaceholder + ", " + LicensePlaceholder
+
 	CacheEvictionStrategyLargest = "largest"
 	CacheEvictionStrategyLru     = "lru"
 	CacheEvictionStrategyNone    = "none"
 
+	CacheStoreFilesystem       = "filesystem"
+	CacheStoreContentAddressed = "content-addressed"
+
 	defaultCommandTemplateSvgToPng                   = "rsvg-convert -o " + OutputPlaceholder + " " + InputPlaceholder
 	defaultCommandTemplateLinuxMathSvgToPngWithStyle = "rsvg-convert -s " + linuxDefaultRsvgMathStyleFile + " -o " + OutputPlaceholder + " " + InputPlaceholder
 	defaultCommandTemplateImageProcessing            = "magick " + InputPlaceholder + " -resize 600x600> -quality 75 -define PNG:compression-level=9 -define PNG:compression-filter=0 -colorspace gray " + OutputPlaceholder
 	defaultCommandTemplatePdfToPng                   = "magick -density 300 " + InputPlaceholder + " " + OutputPlaceholder
 	defaultCommandTemplateWebpToPng                  = "magick " + InputPlaceholder + " " + OutputPlaceholder
+	defaultCommandTemplateEpubToKindle               = "ebook-convert " + InputPlaceholder + " " + OutputPlaceholder
 )
 
 var tocDepthDefault = 2
 var workerThreadsDefault = 5
+var imageWorkerThreadsDefault = 3
+var httpRequestsPerSecondDefault = 10
+var httpMaxRetriesDefault = 10
+var httpMaxlagDefault = 5
+
+// cachePolicyFolderNames are the names of the cache folders (s. cache package) for which a cache policy can be defined.
+var cachePolicyFolderNames = []string{"articles", "html", "images", "math", "templates"}
 
 // Current config initialized with default values, which allows wiki2book to run without any specified config file.
 var Current = NewDefaultConfig()
@@ -64,6 +91,9 @@ func NewDefaultConfig() *Configuration {
 		CacheMaxSize:                   100_000_000,
 		CacheMaxAge:                    40_320,
 		CacheEvictionStrategy:          CacheEvictionStrategyLru,
+		CachePolicies:                  map[string]CachePolicy{},
+		CacheStore:                     CacheStoreFilesystem,
+		CacheStoreDir:                  "",
 		StyleFile:                      getDefaultStyleFile(),
 		IgnoredTemplates:               []string{},
 		TrailingTemplates:              []string{},
@@ -71,24 +101,36 @@ func NewDefaultConfig() *Configuration {
 		IgnoredMediaTypes:              []string{"gif", "mp3", "mp4", "pdf", "oga", "ogg", "ogv", "wav", "webm"},
 		WikipediaInstance:              "en",
 		WikipediaHost:                  "wikipedia.org",
+		ArticleSource:                  ArticleSourceApi,
+		ArticleDumpFile:                "",
 		WikipediaImageHost:             "upload.wikimedia.org",
 		WikipediaImageArticleHosts:     []string{"commons.wikimedia.org", "en.wikipedia.org"},
 		WikipediaMathRestApi:           "https://wikimedia.org/api/rest_v1/media/math",
 		FilePrefixes:                   []string{"file", "image", "media"},
 		AllowedLinkPrefixes:            []string{"arxiv", "doi"},
 		CategoryPrefixes:               []string{"category"},
+		TemplatePrefixes:               []string{"template"},
 		MathConverter:                  "wikimedia",
 		CommandTemplateSvgToPng:        defaultCommandTemplateSvgToPng,
 		CommandTemplateMathSvgToPng:    getDefaultMathSvgToPngCommandTemplate(),
 		CommandTemplateImageProcessing: defaultCommandTemplateImageProcessing,
 		CommandTemplatePdfToPng:        defaultCommandTemplatePdfToPng,
 		CommandTemplateWebpToPng:       defaultCommandTemplateWebpToPng,
+		CommandTemplateEpubToKindle:    defaultCommandTemplateEpubToKindle,
 		PandocExecutable:               "pandoc",
 		PandocDataDir:                  "",
+		PdfEngine:                      "weasyprint",
 		FontFiles:                      []string{},
 		TocDepth:                       tocDepthDefault,
+		AttributionAppendix:            false,
+		ImageCredits:                   false,
+		ImageCreditTemplates:           map[string]string{ImageCreditTemplateDefaultKey: imageCreditTemplateDefault},
 		WorkerThreads:                  workerThreadsDefault,
+		ImageWorkerThreads:             imageWorkerThreadsDefault,
 		UserAgentTemplate:              "wiki2book {{VERSION}} (https://github.com/hauke96/wiki2book)",
+		HttpRequestsPerSecond:          httpRequestsPerSecondDefault,
+		HttpMaxRetries:                 httpMaxRetriesDefault,
+		HttpMaxlag:                     httpMaxlagDefault,
 	}
 }
 
@@ -117,6 +159,13 @@ func getDefaultMathSvgToPngCommandTemplate() string {
 See test file for a script to generate the documentation for this struct.
 */
 
+// CachePolicy contains the settings of one cache folder, s. Configuration.CachePolicies.
+type CachePolicy struct {
+	MaxAge           int64   `json:"max-age,omitempty"`
+	MaxSizeShare     float64 `json:"max-size-share,omitempty"`
+	EvictionPriority int     `json:"eviction-priority,omitempty"`
+}
+
 // Configuration is a struct with application-wide configurations and language-specific strings (e.g. templates to
 // ignore). Some configurations are mandatory, which means that wiki2book will definitely crash if the config entry is
 // not given. Entries marked as non-mandatory may also cause a crash.
@@ -140,16 +189,18 @@ type Configuration struct {
 	SvgSizeToViewbox bool `json:"svg-size-to-viewbox"`
 
 	/*
-		The type of the final result.
+		The type of the final result. Kindle files ("azw3") are converted from an intermediate EPUB file, which requires
+		calibre by default (s. CommandTemplateEpubToKindle).
 
 		Default: `epub2`
-		Allowed values: `epub2`, `epub3`
+		Allowed values: `epub2`, `epub3`, `pdf`, `azw3`, `markdown`, `html-site`
 		JSON example: `"output-type": "epub2"`
 	*/
 	OutputType string `json:"output-type"`
 
 	/*
-		The way the final output is created.
+		The way the final output is created. The `internal` driver creates EPUB3 files without the need of pandoc,
+		including a nested table of content, all images and fonts.
 
 		Default: `pandoc`
 		Allowed values: `pandoc`, `internal`
@@ -159,7 +210,9 @@ type Configuration struct {
 
 	/*
 		The directory where all intermediate files are stored. Relative paths are relative to the config file. The
-		default value is the default cache directory returned by the golang function os.UserCacheDir().
+		default value is the default cache directory returned by the golang function os.UserCacheDir(). Multiple
+		wiki2book processes can use the same cache directory at the same time. Files used by one process are then not
+		removed by the other processes, even if the cache exceeds the CacheMaxSize.
 
 		Default: `"<user-cache-dir>/wiki2book"`
 		JSON example: `"cache-dir": "/path/to/cache"`
@@ -167,7 +220,9 @@ type Configuration struct {
 	CacheDir string `json:"cache-dir"`
 
 	/*
-		The maximum size of the file cache in bytes.
+		The maximum size of the file cache in bytes. The size of all cached files is tracked in an index within the cache
+		directory (files "index.json" and "index-journal.jsonl"), which is rebuilt automatically when it's missing or
+		broken.
 
 		Default: `100000000` (100 MiB)
 	*/
@@ -175,6 +230,9 @@ type Configuration struct {
 
 	/*
 		The maximum age in minutes of files in the cache. All files older than this, will be downloaded/recreated again.
+		Downloaded files whose server sent an "ETag" or "Last-Modified" header are only downloaded again when they have
+		changed, otherwise just their age is reset. The same applies to articles, which are only downloaded again when
+		there's a newer revision.
 		Note that setting CacheEvictionStrategy to "lru" stays in conflict with this setting, because the LRU cache
 		constantly updates timestamps on files.
 
@@ -199,6 +257,53 @@ type Configuration struct {
 	*/
 	CacheEvictionStrategy string `json:"cache-eviction-strategy"`
 
+	/*
+		Policies for single cache folders, which override the general cache settings for the files in these folders. The
+		key is the name of the cache folder and each policy can have the following optional properties:
+		<ul>
+			<li>`max-age` - The maximum age in minutes of files in this folder. The CacheMaxAge setting is used when
+			                this is not set or 0.</li>
+			<li>`max-size-share` - The maximum share (between 0 and 1) of the CacheMaxSize, which the files in this
+			                       folder can take. Files of this folder are removed according to the
+			                       CacheEvictionStrategy when a new file would exceed this share. There's no limit when
+			                       this is not set or 0.</li>
+			<li>`eviction-priority` - Files of folders with higher priority are removed first when the cache is full.
+			                          Files of folders with the same priority are removed according to the
+			                          CacheEvictionStrategy. Default is 0.</li>
+		</ul>
+
+		Default: `{}`
+		Allowed values: Keys `"articles"`, `"html"`, `"images"`, `"math"` and `"templates"`.
+		JSON example: `"cache-policies": { "articles": { "max-age": 1440, "eviction-priority": 1 }, "images": { "max-age": 525600, "max-size-share": 0.8 } }`
+	*/
+	CachePolicies map[string]CachePolicy `json:"cache-policies"`
+
+	/*
+		The store in which cached files are kept in addition to the CacheDir.
+
+		Default: `"filesystem"`
+		Allowed values:
+		<ul>
+			<li>`"filesystem"`        - Cached files are only kept in the CacheDir.</li>
+			<li>`"content-addressed"` - Cached files are additionally stored by the SHA-256 hash of their content in the
+			                            CacheStoreDir, which can be shared by multiple wiki2book processes, e.g. on a
+			                            network path. Files missing in the CacheDir are then taken from the store
+			                            instead of downloading or creating them again. Concurrent writers are
+			                            synchronized using lock files. Files in the store are not removed
+			                            automatically, i.e. CacheMaxSize and CacheEvictionStrategy only apply to the
+			                            CacheDir.</li>
+		</ul>
+	*/
+	CacheStore string `json:"cache-store"`
+
+	/*
+		The directory of the content-addressed store (s. CacheStore). It must not be within the CacheDir. Relative paths
+		are relative to the config file.
+
+		Default: `""`
+	*/
+	CacheStoreDir string `json:"cache-store-dir"`
+
 	/*
 		The CSS style file that should be embedded into the eBook. Relative paths are relative to the config file.
 
@@ -302,6 +407,23 @@ type Configuration struct {
 	*/
 	CommandTemplateWebpToPng string `json:"command-template-webp-to-png"`
 
+	/*
+		Specifies the template for the command that should be used to convert the intermediate EPUB file into the
+		Kindle file. This is only used for the output type "azw3". The default command is part of calibre and determines
+		the target format by the file extension of the output file.
+
+		This template must contain the following placeholders that will be replaced by the actual values before
+		executing the command:
+		<ul>
+			<li>`{INPUT}` : The input EPUB file.</li>
+			<li>`{OUTPUT}` : The output Kindle file.</li>
+		</ul>
+
+		Default: `"ebook-convert {INPUT} {OUTPUT}"`
+		JSON example: `"command-template-epub-to-kindle": "my-command --some-arg -i {INPUT} -o {OUTPUT}"`
+	*/
+	CommandTemplateEpubToKindle string `json:"command-template-epub-to-kindle"`
+
 	/*
 		The executable name or file for pandoc.
 
@@ -318,6 +440,17 @@ type Configuration struct {
 	*/
 	PandocDataDir string `json:"pandoc-data-dir"`
 
+	/*
+		The PDF engine used by pandoc to create PDF files. This is only used for the output type "pdf". Since wiki2book
+		passes HTML files to pandoc, only HTML-based engines are supported. Page numbers and the page numbers in the
+		table of content are created using CSS paged media, which is not supported by every engine (e.g. not by
+		wkhtmltopdf).
+
+		Default: `"weasyprint"`
+		JSON example: `"pdf-engine": "/path/to/weasyprint"`
+	*/
+	PdfEngine string `json:"pdf-engine"`
+
 	/*
 		A list of font files that should be used. They then can be referenced from the style CSS file. Relative paths are relative to the config file.
 
@@ -379,7 +512,33 @@ type Configuration struct {
 	WikipediaHost string `json:"wikipedia-host"`
 
 	/*
-		The domain of the Wikipedia image instance, which should be used to download the actual image files.
+		The source of the wikitext of the articles. The source "api" downloads the articles from the configured
+		Wikipedia instance. The source "dump" reads the articles from the MediaWiki XML dump specified by
+		ArticleDumpFile, which allows to create large books without downloading each article. Redirects are resolved
+		using the dump as well. Images, templates and math are still downloaded from the Wikipedia instance.
+
+		Default: `"api"`
+		Allowed values: `api`, `dump`
+		JSON example: `"article-source": "dump"`
+	*/
+	ArticleSource string `json:"article-source"`
+
+	/*
+		The bzip2 compressed multistream MediaWiki XML dump used for the article source "dump", e.g. a
+		"dewiki-latest-pages-articles-multistream.xml.bz2" file. Other dumps are not supported, because reading an
+		article would require decompressing everything in front of it. An index of all articles and redirects is created
+		once and stored in the cache, where it's neither outdated nor evicted. Relative paths are relative to the config
+		file.
+
+		Default: `""`
+		JSON example: `"article-dump-file": "./dewiki-latest-pages-articles-multistream.xml.bz2"`
+	*/
+	ArticleDumpFile string `json:"article-dump-file"`
+
+	/*
+		The domain of the Wikipedia image instance, which should be used to download the actual image files. The URLs of
+		the image files are determined by the image article hosts (s. WikipediaImageArticleHosts) and their domain is
+		replaced by this value. Use an empty string to use the URLs unchanged.
 
 		Default: `"upload.wikimedia.org"`
 		JSON example: `"wikipedia-image-host": "my-image-server.com"`
@@ -388,7 +547,8 @@ type Configuration struct {
 
 	/*
 		Domains used to search for image articles (not the image files themselves, s. WikipediaImageHost). The given
-		values are tried in the configured order until a request was successful or the last host has been tried.
+		values are tried in the configured order until a host knows the image or the last host has been tried. The
+		images are requested in batches of up to 50 images per request.
 
 		Default: `[ "commons.wikimedia.org", "en.wikipedia.org" ]`
 		JSON example: `"wikipedia-image-article-hosts": [ "commons.wikimedia.org" ]`
@@ -430,6 +590,16 @@ type Configuration struct {
 	*/
 	CategoryPrefixes []string `json:"category-prefixes"`
 
+	/*
+		A list of prefixes of template pages, e.g. in "Template:Foo" the substring "Template" is the template prefix. When
+		evaluating templates locally, the wikitext of a template is loaded from the page with the first prefix for which
+		such a page exists. The list must be in lower case.
+
+		Default: `[ "template" ]`
+		JSON example: `"template-prefixes": [ "vorlage", "template" ]`
+	*/
+	TemplatePrefixes []string `json:"template-prefixes"`
+
 	/*
 		Sets the converter to turn math SVGs into PNGs. This can be one of the following values:
 		<ul>
@@ -457,6 +627,42 @@ type Configuration struct {
 	*/
 	TocDepth int `json:"toc-depth"`
 
+	/*
+		When set to true, a "Sources and licenses" chapter is appended to the book. It lists all articles with their URL
+		(including the used revision) and their authors as well as all images with their authors, licenses and sources.
+		The data is fetched from the Wikipedia API. Contributors of articles are not available when using a dump as
+		article source. This is only supported by the output types "epub2", "epub3", "pdf" and "azw3".
+
+		Default: `false`
+		JSON example: `"attribution-appendix": true`
+	*/
+	AttributionAppendix bool `json:"attribution-appendix"`
+
+	/*
+		When set to true, the author and license of each image are added below its caption. Inline images have no
+		caption and therefore no credits. The author and license are taken from the file description page of the image
+		and the format is defined by "image-credit-templates".
+
+		Default: `false`
+		JSON example: `"image-credits": true`
+	*/
+	ImageCredits bool `json:"image-credits"`
+
+	/*
+		Templates of the image credits (s. "image-credits") by license. The key is the short name of the license as
+		shown on the file description page (e.g. "CC BY-SA 4.0" or "Public domain"), which is compared
+		case-insensitively. The template with the key "default" is used for all other licenses. An empty template
+		hides the credits of images with this license. The following placeholders are replaced by actual values:
+		<ul>
+			<li>`{{AUTHOR}}` - The author of the image.</li>
+			<li>`{{LICENSE}}` - The short name of the license of the image.</li>
+		</ul>
+
+		Default: `{ "default": "{{AUTHOR}}, {{LICENSE}}" }`
+		JSON example: `"image-credit-templates": { "default": "Image: {{AUTHOR}} ({{LICENSE}})", "Public domain": "" }`
+	*/
+	ImageCreditTemplates map[string]string `json:"image-credit-templates"`
+
 	/*
 		Number of threads to process the articles. Only affects projects but not single articles or the standalone mode.
 		A higher number of threads might increase performance, but it also puts more stress on the Wikipedia API, which
@@ -468,6 +674,18 @@ type Configuration struct {
 	*/
 	WorkerThreads int `json:"worker-threads"`
 
+	/*
+		Number of threads downloading and processing the images of an article (or of a part or chapter introduction).
+		This includes the conversion and resizing of images with the configured commands. Each article worker thread
+		(s. "worker-threads") uses its own image worker threads, so the total number of concurrent image downloads is
+		up to the product of both values. All threads wait when the Wikipedia API responds with "too many requests".
+		Use a value of 1 to download images one after another.
+
+		Default: `3`
+		Allowed values: `1` to unlimited
+	*/
+	ImageWorkerThreads int `json:"image-worker-threads"`
+
 	/*
 		Template string for the user agent used in HTTP requests. There are some placeholders within this template
 		string, which are replaced by actual values:
@@ -478,6 +696,38 @@ type Configuration struct {
 		Default: `"wiki2book {{VERSION}} (https://github.com/hauke96/wiki2book)"`
 	*/
 	UserAgentTemplate string `json:"user-agent-template"`
+
+	/*
+		Maximum number of HTTP requests per second to each host. All worker threads share this limit, which allows
+		short bursts of up to this number of requests. Use a value of 0 to disable the limit.
+
+		Default: `10`
+		Allowed values: `0` to unlimited
+	*/
+	HttpRequestsPerSecond int `json:"http-requests-per-second"`
+
+	/*
+		Maximum number of retries of an HTTP request. Requests are retried after "too many requests" responses, server
+		errors (status codes 5xx), network errors and when the MediaWiki API is lagging (s. "http-maxlag"). The wait
+		time between retries of failed requests grows exponentially with each retry. Use a value of 0 to disable
+		retries.
+		Additionally, all requests share a retry budget, so that only a small share of all requests is retried in case
+		the server keeps failing. Retries due to the lagging MediaWiki API are not limited by this budget.
+
+		Default: `10`
+		Allowed values: `0` to unlimited
+	*/
+	HttpMaxRetries int `json:"http-max-retries"`
+
+	/*
+		Value of the "maxlag" parameter added to all requests to the MediaWiki API. The API refuses requests while its
+		database replication lag exceeds this number of seconds, so that wiki2book waits instead of adding load to busy
+		servers. Use a value of 0 to not send this parameter.
+
+		Default: `5`
+		Allowed values: `0` to unlimited
+	*/
+	HttpMaxlag int `json:"http-maxlag"`
 }
 
 // MergeIntoCurrentConfig goes through all the properties of the given configuration and overwrites the respective field
@@ -517,6 +767,20 @@ func MergeIntoCurrentConfig(c *Configuration) {
 		sigolo.Tracef("Override CacheEvictionStrategy with %s", c.CacheEvictionStrategy)
 		Current.CacheEvictionStrategy = c.CacheEvictionStrategy
 	}
+	if !maps.Equal(c.CachePolicies, defaultConfig.CachePolicies) {
+		sigolo.Tracef("Override CachePolicies with %v", c.CachePolicies)
+		Current.CachePolicies = c.CachePolicies
+	}
+	if c.CacheStore != defaultConfig.CacheStore {
+		sigolo.Tracef("Override CacheStore with %s", c.CacheStore)
+		Current.CacheStore = c.CacheStore
+	}
+	if c.CacheStoreDir != defaultConfig.CacheStoreDir {
+		absolutePath, err := util.ToAbsolutePath(c.CacheStoreDir)
+		sigolo.FatalCheck(err)
+		sigolo.Tracef("Override CacheStoreDir with %s", absolutePath)
+		Current.CacheStoreDir = absolutePath
+	}
 	if c.StyleFile != defaultConfig.StyleFile {
 		absolutePath, err := util.ToAbsolutePath(c.StyleFile)
 		sigolo.FatalCheck(err)
@@ -549,6 +813,10 @@ func MergeIntoCurrentConfig(c *Configuration) {
 		sigolo.Tracef("Override CommandTemplateWebpToPng with %s", c.CommandTemplateWebpToPng)
 		Current.CommandTemplateWebpToPng = c.CommandTemplateWebpToPng
 	}
+	if c.CommandTemplateEpubToKindle != defaultConfig.CommandTemplateEpubToKindle {
+		sigolo.Tracef("Override CommandTemplateEpubToKindle with %s", c.CommandTemplateEpubToKindle)
+		Current.CommandTemplateEpubToKindle = c.CommandTemplateEpubToKindle
+	}
 	if c.PandocExecutable != defaultConfig.PandocExecutable {
 		var err error
 		newPath := c.PandocExecutable
@@ -567,6 +835,17 @@ func MergeIntoCurrentConfig(c *Configuration) {
 		sigolo.Tracef("Override PandocDataDir with %s", absolutePath)
 		Current.PandocDataDir = absolutePath
 	}
+	if c.PdfEngine != defaultConfig.PdfEngine {
+		var err error
+		newPath := c.PdfEngine
+		if strings.Contains(c.PdfEngine, "/") {
+			// Same as for the pandoc executable: Only convert actual paths into absolute paths.
+			newPath, err = util.ToAbsolutePath(c.PdfEngine)
+			sigolo.FatalCheck(err)
+		}
+		sigolo.Tracef("Override PdfEngine with %s", c.PdfEngine)
+		Current.PdfEngine = newPath
+	}
 	if !util.EqualsInAnyOrder(c.FontFiles, defaultConfig.FontFiles) {
 		absolutePaths, err := util.ToAbsolutePaths(c.FontFiles...)
 		sigolo.FatalCheck(err)
@@ -597,6 +876,16 @@ func MergeIntoCurrentConfig(c *Configuration) {
 		sigolo.Tracef("Override WikipediaHost with %s", c.WikipediaHost)
 		Current.WikipediaHost = c.WikipediaHost
 	}
+	if c.ArticleSource != defaultConfig.ArticleSource {
+		sigolo.Tracef("Override ArticleSource with %s", c.ArticleSource)
+		Current.ArticleSource = c.ArticleSource
+	}
+	if c.ArticleDumpFile != defaultConfig.ArticleDumpFile {
+		absolutePath, err := util.ToAbsolutePath(c.ArticleDumpFile)
+		sigolo.FatalCheck(err)
+		sigolo.Tracef("Override ArticleDumpFile with %s", absolutePath)
+		Current.ArticleDumpFile = absolutePath
+	}
 	if c.WikipediaImageHost != defaultConfig.WikipediaImageHost {
 		sigolo.Tracef("Override WikipediaImageHost with %s", c.WikipediaImageHost)
 		Current.WikipediaImageHost = c.WikipediaImageHost
@@ -621,6 +910,10 @@ func MergeIntoCurrentConfig(c *Configuration) {
 		sigolo.Tracef("Override CategoryPrefixes with %v", c.CategoryPrefixes)
 		Current.CategoryPrefixes = c.CategoryPrefixes
 	}
+	if !util.EqualsInAnyOrder(c.TemplatePrefixes, defaultConfig.TemplatePrefixes) {
+		sigolo.Tracef("Override TemplatePrefixes with %v", c.TemplatePrefixes)
+		Current.TemplatePrefixes = c.TemplatePrefixes
+	}
 	if c.MathConverter != defaultConfig.MathConverter {
 		sigolo.Tracef("Override MathConverter with %s", c.MathConverter)
 		Current.MathConverter = c.MathConverter
@@ -629,14 +922,42 @@ func MergeIntoCurrentConfig(c *Configuration) {
 		sigolo.Tracef("Override TocDepth with %d", c.TocDepth)
 		Current.TocDepth = c.TocDepth
 	}
+	if c.AttributionAppendix != defaultConfig.AttributionAppendix {
+		sigolo.Tracef("Override AttributionAppendix with %v", c.AttributionAppendix)
+		Current.AttributionAppendix = c.AttributionAppendix
+	}
+	if c.ImageCredits != defaultConfig.ImageCredits {
+		sigolo.Tracef("Override ImageCredits with %v", c.ImageCredits)
+		Current.ImageCredits = c.ImageCredits
+	}
+	if !maps.Equal(c.ImageCreditTemplates, defaultConfig.ImageCreditTemplates) {
+		sigolo.Tracef("Override ImageCreditTemplates with %v", c.ImageCreditTemplates)
+		Current.ImageCreditTemplates = c.ImageCreditTemplates
+	}
 	if c.WorkerThreads != defaultConfig.WorkerThreads {
 		sigolo.Tracef("Override WorkerThreads with %d", c.WorkerThreads)
 		Current.WorkerThreads = c.WorkerThreads
 	}
+	if c.ImageWorkerThreads != defaultConfig.ImageWorkerThreads {
+		sigolo.Tracef("Override ImageWorkerThreads with %d", c.ImageWorkerThreads)
+		Current.ImageWorkerThreads = c.ImageWorkerThreads
+	}
 	if c.UserAgentTemplate != defaultConfig.UserAgentTemplate {
 		sigolo.Tracef("Override UserAgentTemplate with %s", c.UserAgentTemplate)
 		Current.UserAgentTemplate = c.UserAgentTemplate
 	}
+	if c.HttpRequestsPerSecond != defaultConfig.HttpRequestsPerSecond {
+		sigolo.Tracef("Override HttpRequestsPerSecond with %d", c.HttpRequestsPerSecond)
+		Current.HttpRequestsPerSecond = c.HttpRequestsPerSecond
+	}
+	if c.HttpMaxRetries != defaultConfig.HttpMaxRetries {
+		sigolo.Tracef("Override HttpMaxRetries with %d", c.HttpMaxRetries)
+		Current.HttpMaxRetries = c.HttpMaxRetries
+	}
+	if c.HttpMaxlag != defaultConfig.HttpMaxlag {
+		sigolo.Tracef("Override HttpMaxlag with %d", c.HttpMaxlag)
+		Current.HttpMaxlag = c.HttpMaxlag
+	}
 
 	Current.MakePathsAbsoluteToWorkingDir()
 
@@ -652,6 +973,9 @@ func (c *Configuration) makePathsAbsolute(file string) {
 	c.CacheDir, err = util.ToAbsolutePathWithBasedir(absoluteConfigDir, c.CacheDir)
 	sigolo.FatalCheck(err)
 
+	c.CacheStoreDir, err = util.ToAbsolutePathWithBasedir(absoluteConfigDir, c.CacheStoreDir)
+	sigolo.FatalCheck(err)
+
 	c.StyleFile, err = util.ToAbsolutePathWithBasedir(absoluteConfigDir, c.StyleFile)
 	sigolo.FatalCheck(err)
 
@@ -661,6 +985,9 @@ func (c *Configuration) makePathsAbsolute(file string) {
 	c.PandocDataDir, err = util.ToAbsolutePathWithBasedir(absoluteConfigDir, c.PandocDataDir)
 	sigolo.FatalCheck(err)
 
+	c.ArticleDumpFile, err = util.ToAbsolutePathWithBasedir(absoluteConfigDir, c.ArticleDumpFile)
+	sigolo.FatalCheck(err)
+
 	for i, f := range c.FontFiles {
 		absoluteFile := filepath.Join(absoluteConfigDir, f)
 		sigolo.FatalCheck(err)
@@ -674,6 +1001,9 @@ func (c *Configuration) MakePathsAbsoluteToWorkingDir() {
 	c.CacheDir, err = util.ToAbsolutePath(c.CacheDir)
 	sigolo.FatalCheck(err)
 
+	c.CacheStoreDir, err = util.ToAbsolutePath(c.CacheStoreDir)
+	sigolo.FatalCheck(err)
+
 	c.StyleFile, err = util.ToAbsolutePath(c.StyleFile)
 	sigolo.FatalCheck(err)
 
@@ -683,6 +1013,9 @@ func (c *Configuration) MakePathsAbsoluteToWorkingDir() {
 	c.PandocDataDir, err = util.ToAbsolutePath(c.PandocDataDir)
 	sigolo.FatalCheck(err)
 
+	c.ArticleDumpFile, err = util.ToAbsolutePath(c.ArticleDumpFile)
+	sigolo.FatalCheck(err)
+
 	for i, f := range c.FontFiles {
 		absoluteFile, err := util.ToAbsolutePath(f)
 		sigolo.FatalCheck(err)
@@ -695,6 +1028,7 @@ func (c *Configuration) AssertFilesAndPathsExists() {
 	util.AssertPathExists(c.StyleFile)
 	util.AssertPathExists(c.CoverImage)
 	util.AssertPathExists(c.PandocDataDir)
+	util.AssertPathExists(c.ArticleDumpFile)
 	for _, f := range c.FontFiles {
 		util.AssertPathExists(f)
 	}
@@ -702,7 +1036,7 @@ func (c *Configuration) AssertFilesAndPathsExists() {
 
 func (c *Configuration) AssertValidity() {
 	isOutputTypeValid := true
-	if c.OutputType != OutputTypeEpub2 && c.OutputType != OutputTypeEpub3 && c.OutputType != OutputTypeStatsJson && c.OutputType != OutputTypeStatsTxt {
+	if c.OutputType != OutputTypeEpub2 && c.OutputType != OutputTypeEpub3 && c.OutputType != OutputTypeStatsJson && c.OutputType != OutputTypeStatsTxt && c.OutputType != OutputTypePdf && c.OutputType != OutputTypeAzw3 && c.OutputType != OutputTypeMarkdown && c.OutputType != OutputTypeHtmlSite {
 		isOutputTypeValid = false
 		defaultValidationErrorHandler(errors.Errorf("Invalid output type '%s'", c.OutputType))
 	}
@@ -718,15 +1052,37 @@ func (c *Configuration) AssertValidity() {
 		}
 	}
 
+	if c.ArticleSource != ArticleSourceApi && c.ArticleSource != ArticleSourceDump {
+		defaultValidationErrorHandler(errors.Errorf("Invalid article source '%s'", c.ArticleSource))
+	}
+	if c.ArticleSource == ArticleSourceDump && c.ArticleDumpFile == "" {
+		defaultValidationErrorHandler(errors.Errorf("ArticleDumpFile must not be empty when using the article source '%s'", ArticleSourceDump))
+	}
+
 	if c.MathConverter != MathConverterNone && c.MathConverter != MathConverterWikimedia && c.MathConverter != MathConverterTemplate {
 		defaultValidationErrorHandler(errors.Errorf("Invalid math converter '%s'", c.MathConverter))
 	}
+	if c.OutputType == OutputTypePdf && c.PdfEngine == "" {
+		defaultValidationErrorHandler(errors.Errorf("PdfEngine must not be empty when creating PDF files"))
+	}
 	if c.TocDepth < 0 || c.TocDepth > 6 {
 		defaultValidationErrorHandler(errors.Errorf("Invalid toc-depth '%d'", c.TocDepth))
 	}
 	if c.WorkerThreads < 1 {
 		defaultValidationErrorHandler(errors.Errorf("Invalid number of worker threads '%d'", c.WorkerThreads))
 	}
+	if c.ImageWorkerThreads < 1 {
+		defaultValidationErrorHandler(errors.Errorf("Invalid number of image worker threads '%d'", c.ImageWorkerThreads))
+	}
+	if c.HttpRequestsPerSecond < 0 {
+		defaultValidationErrorHandler(errors.Errorf("Invalid number of HTTP requests per second '%d'", c.HttpRequestsPerSecond))
+	}
+	if c.HttpMaxRetries < 0 {
+		defaultValidationErrorHandler(errors.Errorf("Invalid number of HTTP retries '%d'", c.HttpMaxRetries))
+	}
+	if c.HttpMaxlag < 0 {
+		defaultValidationErrorHandler(errors.Errorf("Invalid HTTP maxlag '%d'", c.HttpMaxlag))
+	}
 
 	if c.CommandTemplateSvgToPng != "" {
 		if !strings.Contains(c.CommandTemplateSvgToPng, InputPlaceholder) {
@@ -774,6 +1130,18 @@ func (c *Configuration) AssertValidity() {
 		}
 	}
 
+	if c.OutputType == OutputTypeAzw3 && c.CommandTemplateEpubToKindle == "" {
+		defaultValidationErrorHandler(errors.Errorf("CommandTemplateEpubToKindle must not be empty when creating Kindle files"))
+	}
+	if c.CommandTemplateEpubToKindle != "" {
+		if !strings.Contains(c.CommandTemplateEpubToKindle, InputPlaceholder) {
+			defaultValidationErrorHandler(errors.Errorf("CommandTemplateEpubToKindle must contain the '" + InputPlaceholder + "' placeholder"))
+		}
+		if !strings.Contains(c.CommandTemplateEpubToKindle, OutputPlaceholder) {
+			defaultValidationErrorHandler(errors.Errorf("CommandTemplateEpubToKindle must contain the '" + OutputPlaceholder + "' placeholder"))
+		}
+	}
+
 	if c.CacheMaxSize <= 0 {
 		defaultValidationErrorHandler(errors.Errorf("CacheMaxSize must be larger than 0 but was %d", c.CacheMaxSize))
 	}
@@ -783,6 +1151,29 @@ func (c *Configuration) AssertValidity() {
 	if c.CacheEvictionStrategy != CacheEvictionStrategyNone && c.CacheEvictionStrategy != CacheEvictionStrategyLru && c.CacheEvictionStrategy != CacheEvictionStrategyLargest {
 		defaultValidationErrorHandler(errors.Errorf("CacheEvictionStrategy '%s' is invalid", c.CacheEvictionStrategy))
 	}
+	if c.CacheStore != CacheStoreFilesystem && c.CacheStore != CacheStoreContentAddressed {
+		defaultValidationErrorHandler(errors.Errorf("CacheStore '%s' is invalid", c.CacheStore))
+	}
+	if c.CacheStore == CacheStoreContentAddressed && c.CacheStoreDir == "" {
+		defaultValidationErrorHandler(errors.Errorf("CacheStoreDir must be set when using the CacheStore '%s'", CacheStoreContentAddressed))
+	}
+	if c.CacheStoreDir != "" {
+		relativeStoreDir, err := filepath.Rel(c.CacheDir, c.CacheStoreDir)
+		if err == nil && relativeStoreDir != ".." && !strings.HasPrefix(relativeStoreDir, ".."+string(filepath.Separator)) {
+			defaultValidationErrorHandler(errors.Errorf("CacheStoreDir '%s' must not be within the CacheDir '%s'", c.CacheStoreDir, c.CacheDir))
+		}
+	}
+	for cacheFolderName, policy := range c.CachePolicies {
+		if !slices.Contains(cachePolicyFolderNames, cacheFolderName) {
+			defaultValidationErrorHandler(errors.Errorf("CachePolicies contains policy for unknown cache folder '%s', allowed are: %v", cacheFolderName, cachePolicyFolderNames))
+		}
+		if policy.MaxAge < 0 {
+			defaultValidationErrorHandler(errors.Errorf("Max age of cache policy for folder '%s' must not be negative but was %d", cacheFolderName, policy.MaxAge))
+		}
+		if policy.MaxSizeShare < 0 || policy.MaxSizeShare > 1 {
+			defaultValidationErrorHandler(errors.Errorf("Max size share of cache policy for folder '%s' must be between 0 and 1 but was %f", cacheFolderName, policy.MaxSizeShare))
+		}
+	}
 }
 
 // VerifyOutputAndDriver returns an error if the output type and driver are not compatible and returns nil if they are.
@@ -811,6 +1202,21 @@ func VerifyOutputAndDriver(outputType string, outputDriver string) error {
 			return nil
 		}
 		return errors.Errorf("Incompatible output type '%s' with output driver '%s'", outputType, outputDriver)
+	case OutputTypeMarkdown:
+		fallthrough
+	case OutputTypeHtmlSite:
+		if outputDriver == OutputDriverInternal {
+			return nil
+		}
+		return errors.Errorf("Incompatible output type '%s' with output driver '%s'", outputType, outputDriver)
+	case OutputTypeAzw3:
+		// The intermediate EPUB file can be created by all drivers.
+		return nil
+	case OutputTypePdf:
+		if outputDriver == OutputDriverPandoc {
+			return nil
+		}
+		return errors.Errorf("Incompatible output type '%s' with output driver '%s'", outputType, outputDriver)
 	}
 
 	return errors.Errorf("Unknown output type '%s'", outputType)
@@ -826,6 +1232,31 @@ func (c *Configuration) ShouldConvertSvgToPng() bool {
 	return c.CommandTemplateSvgToPng != ""
 }
 
+// ImageCreditTemplate returns the template of the image credits for images with the given license. The default template
+// is used for licenses without own template.
+func (c *Configuration) ImageCreditTemplate(license string) string {
+	for templateLicense, template := range c.ImageCreditTemplates {
+		if strings.EqualFold(templateLicense, license) {
+			return template
+		}
+	}
+
+	if template, ok := c.ImageCreditTemplates[ImageCreditTemplateDefaultKey]; ok {
+		return template
+	}
+	return imageCreditTemplateDefault
+}
+
+// CachePolicy returns the policy of the given cache folder. The general cache settings are used for all values not
+// set by the policy, so the returned policy always contains the max age of files in this folder.
+func (c *Configuration) CachePolicy(cacheFolderName string) CachePolicy {
+	policy := c.CachePolicies[cacheFolderName]
+	if policy.MaxAge == 0 {
+		policy.MaxAge = c.CacheMaxAge
+	}
+	return policy
+}
+
 func (c *Configuration) ShouldConvertPdfToPng() bool {
 	return c.CommandTemplatePdfToPng != ""
 }
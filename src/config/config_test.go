@@ -37,6 +37,9 @@ func TestMergeIntoCurrentConfig(t *testing.T) {
 		CacheMaxSize:                   123,
 		CacheMaxAge:                    234,
 		CacheEvictionStrategy:          CacheEvictionStrategyNone,
+		CachePolicies:                  map[string]CachePolicy{"images": {MaxAge: 345, MaxSizeShare: 0.5, EvictionPriority: 1}},
+		CacheStore:                     CacheStoreContentAddressed,
+		CacheStoreDir:                  "/cache-store-dir",
 		StyleFile:                      "/style-file",
 		CoverImage:                     "/cover-image",
 		CommandTemplateSvgToPng:        "command-template-svg-to-png" + InputPlaceholder + OutputPlaceholder,
@@ -44,8 +47,10 @@ func TestMergeIntoCurrentConfig(t *testing.T) {
 		CommandTemplateImageProcessing: "command-template-image-processing" + InputPlaceholder + OutputPlaceholder,
 		CommandTemplatePdfToPng:        "command-template-pdf-to-png" + InputPlaceholder + OutputPlaceholder,
 		CommandTemplateWebpToPng:       "command-template-webp-to-png" + InputPlaceholder + OutputPlaceholder,
+		CommandTemplateEpubToKindle:    "command-template-epub-to-kindle" + InputPlaceholder + OutputPlaceholder,
 		PandocExecutable:               "pandoc-executable",
 		PandocDataDir:                  "/pandoc-data-dir",
+		PdfEngine:                      "pdf-engine",
 		FontFiles:                      []string{"font-files"},
 		IgnoredTemplates:               []string{"ignored-templates"},
 		TrailingTemplates:              []string{"trailing-templates"},
@@ -53,16 +58,26 @@ func TestMergeIntoCurrentConfig(t *testing.T) {
 		IgnoredMediaTypes:              []string{"ignored-media-types"},
 		WikipediaInstance:              "wikipedia-instance",
 		WikipediaHost:                  "wikipedia-host",
+		ArticleSource:                  ArticleSourceDump,
+		ArticleDumpFile:                "/article-dump-file",
 		WikipediaImageHost:             "wikipedia-image-host",
 		WikipediaMathRestApi:           "wikipedia-math-rest-api",
 		WikipediaImageArticleHosts:     []string{"wikipedia-image-article-hosts"},
 		FilePrefixes:                   []string{"file-prefixes"},
 		AllowedLinkPrefixes:            []string{"allowed-link-prefixes"},
 		CategoryPrefixes:               []string{"category-prefixes"},
+		TemplatePrefixes:               []string{"template-prefixes"},
 		MathConverter:                  MathConverterWikimedia,
 		TocDepth:                       3,
+		AttributionAppendix:            true,
+		ImageCredits:                   true,
+		ImageCreditTemplates:           map[string]string{"image-credit-templates": "image-credit-templates"},
 		WorkerThreads:                  234,
+		ImageWorkerThreads:             345,
 		UserAgentTemplate:              "user-agent-template",
+		HttpRequestsPerSecond:          456,
+		HttpMaxRetries:                 567,
+		HttpMaxlag:                     678,
 	}
 
 	MergeIntoCurrentConfig(expectedConfig)
@@ -94,6 +109,7 @@ func TestMergeIntoCurrentConfig_validEmptyValues(t *testing.T) {
 	expectedConfig.FilePrefixes = []string{}
 	expectedConfig.AllowedLinkPrefixes = []string{}
 	expectedConfig.CategoryPrefixes = []string{}
+	expectedConfig.TemplatePrefixes = []string{}
 
 	MergeIntoCurrentConfig(expectedConfig)
 
@@ -107,6 +123,7 @@ func TestMergeIntoCurrentConfig_validEmptyValues(t *testing.T) {
 	test.AssertEqual(t, []string{}, Current.FilePrefixes)
 	test.AssertEqual(t, []string{}, Current.AllowedLinkPrefixes)
 	test.AssertEqual(t, []string{}, Current.CategoryPrefixes)
+	test.AssertEqual(t, []string{}, Current.TemplatePrefixes)
 }
 
 func TestMergeIntoCurrentConfig_invalidMathConverter(t *testing.T) {
@@ -126,25 +143,45 @@ func TestMergeIntoCurrentConfig_invalidMathConverter(t *testing.T) {
 
 func TestMakePathsAbsolute(t *testing.T) {
 	actualConfig := &Configuration{
-		CacheDir:      "cache-dir",
-		StyleFile:     "style-file",
-		CoverImage:    "cover-image",
-		PandocDataDir: "pandoc-data-dir",
-		FontFiles:     []string{"fontA", "fontB"},
+		CacheDir:        "cache-dir",
+		StyleFile:       "style-file",
+		CoverImage:      "cover-image",
+		PandocDataDir:   "pandoc-data-dir",
+		ArticleDumpFile: "article-dump-file",
+		FontFiles:       []string{"fontA", "fontB"},
 	}
 
 	actualConfig.makePathsAbsolute("/foo/file")
 
 	expectedConfig := &Configuration{
-		CacheDir:      "/foo/cache-dir",
-		StyleFile:     "/foo/style-file",
-		CoverImage:    "/foo/cover-image",
-		PandocDataDir: "/foo/pandoc-data-dir",
-		FontFiles:     []string{"/foo/fontA", "/foo/fontB"},
+		CacheDir:        "/foo/cache-dir",
+		StyleFile:       "/foo/style-file",
+		CoverImage:      "/foo/cover-image",
+		PandocDataDir:   "/foo/pandoc-data-dir",
+		ArticleDumpFile: "/foo/article-dump-file",
+		FontFiles:       []string{"/foo/fontA", "/foo/fontB"},
 	}
 	test.AssertEqual(t, *expectedConfig, *actualConfig)
 }
 
+func TestAssertValidity_articleSource(t *testing.T) {
+	config := NewDefaultConfig()
+
+	config.ArticleSource = "foobar"
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.ArticleSource = ArticleSourceDump
+	config.ArticleDumpFile = ""
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.ArticleDumpFile = "/foo/dump.xml.bz2"
+	config.AssertValidity()
+
+	config.ArticleSource = ArticleSourceApi
+	config.ArticleDumpFile = ""
+	config.AssertValidity()
+}
+
 func TestAssertValidity_outputType(t *testing.T) {
 	config := NewDefaultConfig()
 
@@ -163,6 +200,9 @@ func TestAssertValidity_outputType(t *testing.T) {
 	config.OutputType = OutputTypeEpub3
 	config.AssertValidity()
 
+	config.OutputType = OutputTypeAzw3
+	config.AssertValidity()
+
 	config.OutputDriver = OutputDriverInternal // Needed by the "stats" output types
 
 	config.OutputType = OutputTypeStatsJson
@@ -170,6 +210,12 @@ func TestAssertValidity_outputType(t *testing.T) {
 
 	config.OutputType = OutputTypeStatsTxt
 	config.AssertValidity()
+
+	config.OutputType = OutputTypeMarkdown
+	config.AssertValidity()
+
+	config.OutputType = OutputTypeHtmlSite
+	config.AssertValidity()
 }
 
 func TestAssertValidity_outputDriver(t *testing.T) {
@@ -213,6 +259,33 @@ func TestAssertValidity_combinationOfOutputTypeAndDriver(t *testing.T) {
 	config.OutputDriver = OutputDriverPandoc
 	config.AssertValidity()
 
+	// OutputTypeAzw3
+	config.OutputType = OutputTypeAzw3
+
+	config.OutputDriver = OutputDriverInternal
+	config.AssertValidity()
+
+	config.OutputDriver = OutputDriverPandoc
+	config.AssertValidity()
+
+	// OutputTypeMarkdown
+	config.OutputType = OutputTypeMarkdown
+
+	config.OutputDriver = OutputDriverInternal
+	config.AssertValidity()
+
+	config.OutputDriver = OutputDriverPandoc
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	// OutputTypeHtmlSite
+	config.OutputType = OutputTypeHtmlSite
+
+	config.OutputDriver = OutputDriverInternal
+	config.AssertValidity()
+
+	config.OutputDriver = OutputDriverPandoc
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
 	// OutputTypeStatsJson
 	config.OutputType = OutputTypeStatsJson
 
@@ -304,6 +377,41 @@ func TestAssertValidity_workerThreads(t *testing.T) {
 	config.AssertValidity()
 }
 
+func TestAssertValidity_httpSettings(t *testing.T) {
+	config := NewDefaultConfig()
+
+	config.HttpRequestsPerSecond = -1
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+	config.HttpRequestsPerSecond = 0
+	config.AssertValidity()
+
+	config.HttpMaxRetries = -1
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+	config.HttpMaxRetries = 0
+	config.AssertValidity()
+
+	config.HttpMaxlag = -1
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+	config.HttpMaxlag = 0
+	config.AssertValidity()
+}
+
+func TestAssertValidity_imageWorkerThreads(t *testing.T) {
+	config := NewDefaultConfig()
+
+	config.ImageWorkerThreads = -1
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.ImageWorkerThreads = 0
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.ImageWorkerThreads = 1
+	config.AssertValidity()
+
+	config.ImageWorkerThreads = 10
+	config.AssertValidity()
+}
+
 func TestAssertValidity_commandTemplateSvgToPng(t *testing.T) {
 	config := NewDefaultConfig()
 
@@ -383,6 +491,25 @@ func TestAssertValidity_commandTemplatePdfToPng(t *testing.T) {
 	config.AssertValidity()
 }
 
+func TestAssertValidity_commandTemplateEpubToKindle(t *testing.T) {
+	config := NewDefaultConfig()
+
+	config.CommandTemplateEpubToKindle = "foobar"
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CommandTemplateEpubToKindle = "foo" + InputPlaceholder + "bar"
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CommandTemplateEpubToKindle = "foo" + InputPlaceholder + OutputPlaceholder + "bar"
+	config.AssertValidity()
+
+	config.CommandTemplateEpubToKindle = ""
+	config.AssertValidity()
+
+	config.OutputType = OutputTypeAzw3
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+}
+
 func TestAssertValidity_commandTemplateWebpToPng(t *testing.T) {
 	config := NewDefaultConfig()
 
@@ -462,6 +589,81 @@ func TestAssertValidity_cacheEvictionStrategy(t *testing.T) {
 	config.AssertValidity()
 }
 
+func TestAssertValidity_cacheStore(t *testing.T) {
+	config := NewDefaultConfig()
+
+	config.CacheStore = "foobar"
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CacheStore = CacheStoreContentAddressed
+	config.CacheStoreDir = ""
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CacheDir = "/some/cache/dir"
+	config.CacheStoreDir = "/some/cache/dir/store"
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CacheStoreDir = "/some/cache/dir"
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CacheStoreDir = "/some/shared/dir"
+	config.AssertValidity()
+
+	config.CacheStore = CacheStoreFilesystem
+	config.CacheStoreDir = ""
+	config.AssertValidity()
+}
+
+func TestAssertValidity_cachePolicies(t *testing.T) {
+	config := NewDefaultConfig()
+
+	config.CachePolicies = map[string]CachePolicy{"foobar": {}}
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CachePolicies = map[string]CachePolicy{"images": {MaxAge: -1}}
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CachePolicies = map[string]CachePolicy{"images": {MaxSizeShare: -0.1}}
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CachePolicies = map[string]CachePolicy{"images": {MaxSizeShare: 1.1}}
+	testCallExpectingPanic(t, func() { config.AssertValidity() })
+
+	config.CachePolicies = map[string]CachePolicy{}
+	config.AssertValidity()
+
+	config.CachePolicies = map[string]CachePolicy{"articles": {MaxAge: 60, EvictionPriority: 1}, "images": {MaxSizeShare: 1}}
+	config.AssertValidity()
+}
+
+func TestCachePolicy(t *testing.T) {
+	config := NewDefaultConfig()
+	config.CacheMaxAge = 100
+	config.CachePolicies = map[string]CachePolicy{
+		"articles": {MaxAge: 10, EvictionPriority: 1},
+		"images":   {MaxSizeShare: 0.5},
+	}
+
+	test.AssertEqual(t, CachePolicy{MaxAge: 10, EvictionPriority: 1}, config.CachePolicy("articles"))
+	test.AssertEqual(t, CachePolicy{MaxAge: 100, MaxSizeShare: 0.5}, config.CachePolicy("images"))
+	test.AssertEqual(t, CachePolicy{MaxAge: 100}, config.CachePolicy("math"))
+}
+
+func TestImageCreditTemplate(t *testing.T) {
+	config := NewDefaultConfig()
+	test.AssertEqual(t, "{{AUTHOR}}, {{LICENSE}}", config.ImageCreditTemplate("CC BY-SA 4.0"))
+
+	config.ImageCreditTemplates = map[string]string{
+		"default":       "Image: {{AUTHOR}}",
+		"Public domain": "",
+	}
+	test.AssertEqual(t, "Image: {{AUTHOR}}", config.ImageCreditTemplate("CC BY-SA 4.0"))
+	test.AssertEqual(t, "", config.ImageCreditTemplate("public domain"))
+
+	config.ImageCreditTemplates = map[string]string{}
+	test.AssertEqual(t, "{{AUTHOR}}, {{LICENSE}}", config.ImageCreditTemplate("CC BY-SA 4.0"))
+}
+
 // ---------- Script to generate markdown doc ----------
 
 type configEntry struct {
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+// LockFile contains the revisions of all articles used when a book was generated. Generating the book again with the
+// lock file results in exactly the same article texts, even when the articles have changed on Wikipedia in the
+// meantime.
+type LockFile struct {
+	Articles map[string]LockedArticle `json:"articles"`
+	// Files contains all downloaded files (articles, templates, images, math renderings, etc.) used to generate the
+	// book. The key is the path of the file within the cache.
+	Files map[string]LockedFile `json:"files,omitempty"`
+}
+
+type LockedArticle struct {
+	Revision int `json:"revision"`
+}
+
+type LockedFile struct {
+	Url    string `json:"url"`
+	Sha256 string `json:"sha256"`
+}
+
+func NewLockFile() *LockFile {
+	return &LockFile{
+		Articles: map[string]LockedArticle{},
+		Files:    map[string]LockedFile{},
+	}
+}
+
+// LockFilePath returns the path of the lock file belonging to the given project file, e.g. "foo/project.lock.json" for
+// "foo/project.json".
+func LockFilePath(projectFile string) string {
+	return strings.TrimSuffix(projectFile, filepath.Ext(projectFile)) + ".lock.json"
+}
+
+// LoadLockFile reads the given lock file. An empty lock file is returned when the file does not exist.
+func LoadLockFile(file string) (*LockFile, error) {
+	lockFileBytes, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		sigolo.Debugf("Lock file %s does not exist, use empty lock file", file)
+		return NewLockFile(), nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error reading lock file %s", file)
+	}
+
+	lockFile := NewLockFile()
+	err = json.Unmarshal(lockFileBytes, lockFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing lock file %s", file)
+	}
+	if lockFile.Articles == nil {
+		lockFile.Articles = map[string]LockedArticle{}
+	}
+	if lockFile.Files == nil {
+		lockFile.Files = map[string]LockedFile{}
+	}
+
+	return lockFile, nil
+}
+
+// Save writes the lock file to the given file. Existing files are overwritten.
+func (l *LockFile) Save(file string) error {
+	lockFileBytes, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Error serializing lock file %s", file)
+	}
+
+	err = os.WriteFile(file, append(lockFileBytes, '\n'), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing lock file %s", file)
+	}
+
+	return nil
+}
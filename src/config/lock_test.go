@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"wiki2book/test"
+)
+
+func TestLockFilePath(t *testing.T) {
+	test.AssertEqual(t, "project.lock.json", LockFilePath("project.json"))
+	test.AssertEqual(t, filepath.Join("foo", "my-book.lock.json"), LockFilePath(filepath.Join("foo", "my-book.json")))
+	test.AssertEqual(t, "project.lock.json", LockFilePath("project"))
+}
+
+func TestLoadLockFile_notExisting(t *testing.T) {
+	// Act
+	lockFile, err := LoadLockFile(filepath.Join(t.TempDir(), "project.lock.json"))
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, NewLockFile(), lockFile)
+}
+
+func TestLockFile_SaveAndLoad(t *testing.T) {
+	// Arrange
+	file := filepath.Join(t.TempDir(), "project.lock.json")
+	lockFile := NewLockFile()
+	lockFile.Articles["Erde"] = LockedArticle{Revision: 1234}
+
+	// Act
+	err := lockFile.Save(file)
+	loadedLockFile, loadErr := LoadLockFile(file)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertNil(t, loadErr)
+	test.AssertEqual(t, lockFile, loadedLockFile)
+
+	fileContent, err := os.ReadFile(file)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "{\n  \"articles\": {\n    \"Erde\": {\n      \"revision\": 1234\n    }\n  }\n}\n", string(fileContent))
+}
+
+func TestLockFile_SaveAndLoad_withFiles(t *testing.T) {
+	// Arrange
+	file := filepath.Join(t.TempDir(), "project.lock.json")
+	lockFile := NewLockFile()
+	lockFile.Articles["Erde"] = LockedArticle{Revision: 1234}
+	lockFile.Files["images/Foo.jpg"] = LockedFile{Url: "https://upload.wikimedia.org/foo.jpg", Sha256: "abc"}
+
+	// Act
+	err := lockFile.Save(file)
+	loadedLockFile, loadErr := LoadLockFile(file)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertNil(t, loadErr)
+	test.AssertEqual(t, lockFile, loadedLockFile)
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/hauke96/sigolo/v2"
 	"github.com/pkg/errors"
@@ -12,9 +14,113 @@ import (
 
 type Project struct {
 	Configuration
-	Metadata   Metadata `json:"metadata"`
-	OutputFile string   `json:"output-file"`
-	Articles   []string `json:"articles"`
+	Metadata   Metadata  `json:"metadata"`
+	OutputFile string    `json:"output-file"`
+	Articles   []Article `json:"articles"`
+	// Chapters group articles under a common title. They are part of the book after the articles in Articles.
+	Chapters []Chapter `json:"chapters"`
+	// Parts group articles and chapters under a common title. They are part of the book after the chapters.
+	Parts []Part `json:"parts"`
+	// Categories whose articles are added to the articles of this project.
+	Categories []CategorySource `json:"categories"`
+
+	// LockFile is the path to the lock file of this project, which contains the revisions of all articles. It's not
+	// part of the project file but determined by the location of the project file.
+	LockFile string `json:"-"`
+}
+
+type Part struct {
+	Title string `json:"title"`
+	// Intro is optional wikitext shown below the title of the part.
+	Intro    string    `json:"intro"`
+	Articles []Article `json:"articles"`
+	Chapters []Chapter `json:"chapters"`
+}
+
+type Chapter struct {
+	Title string `json:"title"`
+	// Intro is optional wikitext shown below the title of the chapter.
+	Intro    string    `json:"intro"`
+	Articles []Article `json:"articles"`
+}
+
+// Article is an entry of an article list in a project file. It's either just the title of the article (e.g. "Erde")
+// or an object with the title and further options (e.g. {"title": "Erde", "exclude-sections": ["Weblinks"]}).
+type Article struct {
+	Title string `json:"title"`
+	// Sections are the only sections of the article that are part of the book. When empty, all sections are used.
+	Sections []string `json:"sections,omitempty"`
+	// ExcludeSections are sections of the article that are not part of the book.
+	ExcludeSections []string `json:"exclude-sections,omitempty"`
+	// Revision is the ID of the revision (the "oldid") of the article to use. When 0, the revision is determined by
+	// the date, the lock file or, if none of them is given, the latest revision is used.
+	Revision int `json:"revision,omitempty"`
+	// Date in the form "YYYY-MM-DD" to use the latest revision of the article at the end of that day (UTC).
+	Date string `json:"date,omitempty"`
+}
+
+// BookEntry is either an article or the title page of a part or chapter. The depth is the level within the hierarchy
+// of the book, starting at 1 for entries that are not within any part or chapter.
+type BookEntry struct {
+	Title     string
+	Intro     string
+	IsArticle bool
+	Depth     int
+
+	// Sections, excluded sections and the pinned revision or date of articles, see Article for details.
+	Sections        []string
+	ExcludeSections []string
+	Revision        int
+	Date            string
+}
+
+func NewArticles(titles ...string) []Article {
+	var articles []Article
+	for _, title := range titles {
+		articles = append(articles, Article{Title: title})
+	}
+	return articles
+}
+
+func (a *Article) UnmarshalJSON(data []byte) error {
+	var title string
+	if json.Unmarshal(data, &title) == nil {
+		*a = Article{Title: title}
+		return nil
+	}
+
+	// Another type is needed to prevent an endless recursion of this function.
+	type articleObject Article
+	var article articleObject
+	err := json.Unmarshal(data, &article)
+	if err != nil {
+		return errors.Wrapf(err, "Article entry %s is neither a string nor an article object", string(data))
+	}
+	*a = Article(article)
+	return nil
+}
+
+func (a Article) MarshalJSON() ([]byte, error) {
+	if len(a.Sections) == 0 && len(a.ExcludeSections) == 0 && a.Revision == 0 && a.Date == "" {
+		return json.Marshal(a.Title)
+	}
+
+	type articleObject Article
+	return json.Marshal(articleObject(a))
+}
+
+// CategorySource describes a Wikipedia category whose articles should be part of the book.
+type CategorySource struct {
+	// Name of the category, with or without category prefix (e.g. "Planet" or "Category:Planet").
+	Name string `json:"name"`
+	// Depth defines how many levels of subcategories are considered. A depth of 0 only uses the articles of the
+	// category itself.
+	Depth int `json:"depth"`
+	// Include contains regular expressions of which at least one must match an article title. When empty, all
+	// articles are included.
+	Include []string `json:"include"`
+	// Exclude contains regular expressions, and an article title matching any of them is not added to the book.
+	Exclude []string `json:"exclude"`
 }
 
 type Metadata struct {
@@ -23,12 +129,90 @@ type Metadata struct {
 	Author   string `json:"author"`
 	License  string `json:"license"`
 	Date     string `json:"date"`
+
+	// Sources are URLs to the exact revisions of the articles in the book. They are determined during the generation
+	// of the book and not part of the project file.
+	Sources []string `json:"-"`
 }
 
 func (p *Project) Print() {
 	jsonBytes, err := json.MarshalIndent(p.Metadata, "  ", "  ")
 	sigolo.FatalCheck(err)
-	sigolo.Debugf("Project:\n  OutputFile: %s\n  Articles: %v\n  Metadata: %s", p.OutputFile, strings.Join(p.Articles, ", "), string(jsonBytes))
+	chaptersJsonBytes, err := json.Marshal(p.Chapters)
+	sigolo.FatalCheck(err)
+	partsJsonBytes, err := json.Marshal(p.Parts)
+	sigolo.FatalCheck(err)
+	categoriesJsonBytes, err := json.Marshal(p.Categories)
+	sigolo.FatalCheck(err)
+	sigolo.Debugf("Project:\n  OutputFile: %s\n  Articles: %v\n  Chapters: %s\n  Parts: %s\n  Categories: %s\n  Metadata: %s", p.OutputFile, strings.Join(p.AllArticles(), ", "), string(chaptersJsonBytes), string(partsJsonBytes), string(categoriesJsonBytes), string(jsonBytes))
+}
+
+// HasStructure returns true when the project contains parts or chapters.
+func (p *Project) HasStructure() bool {
+	return len(p.Chapters) > 0 || len(p.Parts) > 0
+}
+
+// BookEntries returns all articles as well as the parts and chapters of this project in the order they appear in the
+// book. Articles are only contained once, at the position and with the sections of their first occurrence.
+func (p *Project) BookEntries() []BookEntry {
+	var entries []BookEntry
+	addedArticles := map[string]bool{}
+
+	addArticles := func(articles []Article, depth int) {
+		for _, article := range articles {
+			if !addedArticles[article.Title] {
+				addedArticles[article.Title] = true
+				entries = append(entries, BookEntry{
+					Title:           article.Title,
+					IsArticle:       true,
+					Depth:           depth,
+					Sections:        article.Sections,
+					ExcludeSections: article.ExcludeSections,
+					Revision:        article.Revision,
+					Date:            article.Date,
+				})
+			}
+		}
+	}
+	addChapters := func(chapters []Chapter, depth int) {
+		for _, chapter := range chapters {
+			entries = append(entries, BookEntry{Title: chapter.Title, Intro: chapter.Intro, Depth: depth})
+			addArticles(chapter.Articles, depth+1)
+		}
+	}
+
+	addArticles(p.Articles, 1)
+	addChapters(p.Chapters, 1)
+	for _, part := range p.Parts {
+		entries = append(entries, BookEntry{Title: part.Title, Intro: part.Intro, Depth: 1})
+		addArticles(part.Articles, 2)
+		addChapters(part.Chapters, 2)
+	}
+
+	return entries
+}
+
+// AllArticles returns the articles of all entries of the book. Each article is only contained once.
+func (p *Project) AllArticles() []string {
+	var articles []string
+	for _, entry := range p.BookEntries() {
+		if entry.IsArticle {
+			articles = append(articles, entry.Title)
+		}
+	}
+	return articles
+}
+
+// StructureDepth returns the number of hierarchy levels above the articles, e.g. 2 for articles within chapters of
+// parts.
+func (p *Project) StructureDepth() int {
+	structureDepth := 0
+	for _, entry := range p.BookEntries() {
+		if entry.IsArticle {
+			structureDepth = max(structureDepth, entry.Depth-1)
+		}
+	}
+	return structureDepth
 }
 
 // LoadProject reads the given file and creates a corresponding Project instance. It also alters the config.Current
@@ -46,5 +230,66 @@ func LoadProject(file string) (*Project, error) {
 		return nil, errors.Wrap(err, "Error parsing project file content")
 	}
 
+	for _, entry := range project.BookEntries() {
+		if !entry.IsArticle {
+			continue
+		}
+		if strings.TrimSpace(entry.Title) == "" {
+			return nil, errors.Errorf("Article without title in project file %s", file)
+		}
+		if entry.Revision < 0 {
+			return nil, errors.Errorf("Revision of article '%s' must not be negative but was %d", entry.Title, entry.Revision)
+		}
+		if entry.Date != "" {
+			if entry.Revision != 0 {
+				return nil, errors.Errorf("Article '%s' must not have a revision and a date at the same time", entry.Title)
+			}
+			_, err = time.Parse(time.DateOnly, entry.Date)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid date '%s' of article '%s', expected format is YYYY-MM-DD", entry.Date, entry.Title)
+			}
+		}
+	}
+	for _, chapter := range project.Chapters {
+		if strings.TrimSpace(chapter.Title) == "" {
+			return nil, errors.Errorf("Chapter without title in project file %s", file)
+		}
+	}
+	for _, part := range project.Parts {
+		if strings.TrimSpace(part.Title) == "" {
+			return nil, errors.Errorf("Part without title in project file %s", file)
+		}
+		for _, chapter := range part.Chapters {
+			if strings.TrimSpace(chapter.Title) == "" {
+				return nil, errors.Errorf("Chapter without title in part '%s' of project file %s", part.Title, file)
+			}
+		}
+	}
+
+	for _, category := range project.Categories {
+		err = category.assertValidity()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid category in project file %s", file)
+		}
+	}
+
+	project.LockFile = LockFilePath(file)
+
 	return project, nil
 }
+
+func (c *CategorySource) assertValidity() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("Category name must not be empty")
+	}
+	if c.Depth < 0 {
+		return errors.Errorf("Depth of category '%s' must not be negative but was %d", c.Name, c.Depth)
+	}
+	for _, expression := range append(append([]string{}, c.Include...), c.Exclude...) {
+		_, err := regexp.Compile(expression)
+		if err != nil {
+			return errors.Wrapf(err, "Invalid include or exclude expression '%s' of category '%s'", expression, c.Name)
+		}
+	}
+	return nil
+}
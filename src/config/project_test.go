@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"wiki2book/test"
+)
+
+func TestLoadProject_categories(t *testing.T) {
+	// Arrange
+	projectFile := filepath.Join(t.TempDir(), "project.json")
+	projectJson := `{"articles": ["Sun"], "categories": [{"name": "Planet", "depth": 1, "exclude": ["^Earth$"]}]}`
+	test.AssertNil(t, os.WriteFile(projectFile, []byte(projectJson), 0644))
+
+	// Act
+	project, err := LoadProject(projectFile)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, NewArticles("Sun"), project.Articles)
+	test.AssertEqual(t, []CategorySource{{Name: "Planet", Depth: 1, Exclude: []string{"^Earth$"}}}, project.Categories)
+}
+
+func TestLoadProject_invalidCategories(t *testing.T) {
+	for _, categoryJson := range []string{
+		`{"name": " "}`,
+		`{"name": "Planet", "depth": -1}`,
+		`{"name": "Planet", "include": ["("]}`,
+	} {
+		// Arrange
+		projectFile := filepath.Join(t.TempDir(), "project.json")
+		test.AssertNil(t, os.WriteFile(projectFile, []byte(`{"categories": [`+categoryJson+`]}`), 0644))
+
+		// Act
+		project, err := LoadProject(projectFile)
+
+		// Assert
+		test.AssertNotNil(t, err)
+		test.AssertNil(t, project)
+	}
+}
+
+func TestProject_AllArticles(t *testing.T) {
+	// Arrange
+	project := &Project{
+		Articles: NewArticles("Sun", "Earth"),
+		Chapters: []Chapter{
+			{Title: "Inner planets", Articles: NewArticles("Mercury", "Earth")},
+			{Title: "Outer planets", Articles: NewArticles("Jupiter")},
+		},
+	}
+
+	// Act
+	articles := project.AllArticles()
+
+	// Assert
+	test.AssertEqual(t, []string{"Sun", "Earth", "Mercury", "Jupiter"}, articles)
+}
+
+func TestProject_BookEntries(t *testing.T) {
+	// Arrange
+	project := &Project{
+		Articles: NewArticles("Sun"),
+		Chapters: []Chapter{
+			{Title: "Moons", Articles: NewArticles("Moon", "Sun")},
+		},
+		Parts: []Part{
+			{
+				Title:    "Planets",
+				Intro:    "Some ''intro''",
+				Articles: NewArticles("Planet"),
+				Chapters: []Chapter{{Title: "Inner planets", Articles: NewArticles("Earth")}},
+			},
+		},
+	}
+
+	// Act
+	entries := project.BookEntries()
+
+	// Assert
+	test.AssertEqual(t, []BookEntry{
+		{Title: "Sun", IsArticle: true, Depth: 1},
+		{Title: "Moons", Depth: 1},
+		{Title: "Moon", IsArticle: true, Depth: 2},
+		{Title: "Planets", Intro: "Some ''intro''", Depth: 1},
+		{Title: "Planet", IsArticle: true, Depth: 2},
+		{Title: "Inner planets", Depth: 2},
+		{Title: "Earth", IsArticle: true, Depth: 3},
+	}, entries)
+	test.AssertEqual(t, []string{"Sun", "Moon", "Planet", "Earth"}, project.AllArticles())
+	test.AssertTrue(t, project.HasStructure())
+	test.AssertEqual(t, 2, project.StructureDepth())
+}
+
+func TestLoadProject_articlesWithSections(t *testing.T) {
+	// Arrange
+	projectFile := filepath.Join(t.TempDir(), "project.json")
+	projectJson := `{"articles": ["Sonne", {"title": "Erde", "sections": ["Aufbau"], "exclude-sections": ["Weblinks"]}], "chapters": [{"title": "Monde", "articles": [{"title": "Mond"}]}]}`
+	test.AssertNil(t, os.WriteFile(projectFile, []byte(projectJson), 0644))
+
+	// Act
+	project, err := LoadProject(projectFile)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []Article{
+		{Title: "Sonne"},
+		{Title: "Erde", Sections: []string{"Aufbau"}, ExcludeSections: []string{"Weblinks"}},
+	}, project.Articles)
+	test.AssertEqual(t, NewArticles("Mond"), project.Chapters[0].Articles)
+	test.AssertEqual(t, BookEntry{Title: "Erde", IsArticle: true, Depth: 1, Sections: []string{"Aufbau"}, ExcludeSections: []string{"Weblinks"}}, project.BookEntries()[1])
+}
+
+func TestLoadProject_invalidArticles(t *testing.T) {
+	for _, articlesJson := range []string{
+		`[123]`,
+		`[""]`,
+		`[{"sections": ["Aufbau"]}]`,
+		`[{"title": "Erde", "revision": -1}]`,
+		`[{"title": "Erde", "date": "01.01.2024"}]`,
+		`[{"title": "Erde", "revision": 123, "date": "2024-01-01"}]`,
+	} {
+		// Arrange
+		projectFile := filepath.Join(t.TempDir(), "project.json")
+		test.AssertNil(t, os.WriteFile(projectFile, []byte(`{"articles": `+articlesJson+`}`), 0644))
+
+		// Act
+		project, err := LoadProject(projectFile)
+
+		// Assert
+		test.AssertNotNil(t, err)
+		test.AssertNil(t, project)
+	}
+}
+
+func TestLoadProject_articlesWithRevisions(t *testing.T) {
+	// Arrange
+	projectFile := filepath.Join(t.TempDir(), "project.json")
+	projectJson := `{"articles": [{"title": "Sonne", "revision": 1234}, {"title": "Erde", "date": "2024-01-01"}]}`
+	test.AssertNil(t, os.WriteFile(projectFile, []byte(projectJson), 0644))
+
+	// Act
+	project, err := LoadProject(projectFile)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []BookEntry{
+		{Title: "Sonne", IsArticle: true, Depth: 1, Revision: 1234},
+		{Title: "Erde", IsArticle: true, Depth: 1, Date: "2024-01-01"},
+	}, project.BookEntries())
+	test.AssertEqual(t, filepath.Join(filepath.Dir(projectFile), "project.lock.json"), project.LockFile)
+}
+
+func TestArticle_MarshalJSON(t *testing.T) {
+	jsonBytes, err := json.Marshal([]Article{{Title: "Sonne"}, {Title: "Erde", ExcludeSections: []string{"Weblinks"}}, {Title: "Mond", Revision: 1234}})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `["Sonne",{"title":"Erde","exclude-sections":["Weblinks"]},{"title":"Mond","revision":1234}]`, string(jsonBytes))
+}
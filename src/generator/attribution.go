@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"wiki2book/config"
+	"wiki2book/wikipedia"
+
+	"github.com/hauke96/sigolo/v2"
+)
+
+const TEMPLATE_ATTRIBUTION_TEXT_LICENSE = `<p>The texts of the articles are available under the license <a href="%s">%s</a>. The articles and their authors are listed below.</p>`
+const TEMPLATE_ATTRIBUTION_ARTICLE = `<a href="%s">%s</a><br>
+Authors: %s`
+const TEMPLATE_ATTRIBUTION_IMAGE = `<a href="%s">%s</a><br>
+Author: %s<br>
+License: %s`
+const TEMPLATE_IMAGE_CREDITS = `
+<div class="image-credits">%s</div>`
+
+// ArticleAttribution contains the information needed to attribute an article of the book.
+type ArticleAttribution struct {
+	Title string
+	// Url points to the used revision of the article.
+	Url string
+	// Contributors of the article or nil if they are unknown, e.g. when using a dump as article source.
+	Contributors *wikipedia.ArticleContributors
+}
+
+// GenerateAttributionPage creates the HTML page listing all articles with their authors and all images with their
+// authors, licenses and sources. The text license is optional. The file name must neither be used by an article nor
+// by another page.
+func (g *HtmlGenerator) GenerateAttributionPage(fileName string, title string, textLicense *wikipedia.License, articles []ArticleAttribution, images []wikipedia.ImageMetadata) (string, error) {
+	var content []string
+
+	if textLicense != nil && textLicense.Name != "" {
+		content = append(content, fmt.Sprintf(TEMPLATE_ATTRIBUTION_TEXT_LICENSE, html.EscapeString(textLicense.Url), html.EscapeString(textLicense.Name)))
+	}
+
+	if len(articles) > 0 {
+		var items []string
+		for _, article := range articles {
+			item := fmt.Sprintf(TEMPLATE_ATTRIBUTION_ARTICLE, html.EscapeString(article.Url), html.EscapeString(article.Title), html.EscapeString(contributorsText(article.Contributors)))
+			items = append(items, fmt.Sprintf(TEMPLATE_LI, item))
+		}
+		content = append(content, g.attributionHeading("Articles"), fmt.Sprintf(TEMPLATE_UL, strings.Join(items, "\n")))
+	}
+
+	if len(images) > 0 {
+		var items []string
+		for _, image := range images {
+			item := fmt.Sprintf(TEMPLATE_ATTRIBUTION_IMAGE, html.EscapeString(image.Source), html.EscapeString(image.Title), html.EscapeString(valueOrUnknown(image.Author)), licenseHtml(image.License))
+			items = append(items, fmt.Sprintf(TEMPLATE_LI, item))
+		}
+		content = append(content, g.attributionHeading("Images"), fmt.Sprintf(TEMPLATE_UL, strings.Join(items, "\n")))
+	}
+
+	return g.generateProjectPage(fileName, title, strings.Join(content, "\n"))
+}
+
+func (g *HtmlGenerator) attributionHeading(title string) string {
+	depth := g.headingDepth(2)
+	return fmt.Sprintf(TEMPLATE_HEADING, depth, title, depth)
+}
+
+func contributorsText(contributors *wikipedia.ArticleContributors) string {
+	if contributors == nil {
+		return "see version history of the article"
+	}
+
+	text := strings.Join(contributors.Names, ", ")
+	if contributors.AnonymousContributors > 0 {
+		anonymousText := fmt.Sprintf("%d anonymous authors", contributors.AnonymousContributors)
+		if text == "" {
+			text = anonymousText
+		} else {
+			text += " and " + anonymousText
+		}
+	}
+
+	return valueOrUnknown(text)
+}
+
+func licenseHtml(license wikipedia.License) string {
+	name := html.EscapeString(valueOrUnknown(license.Name))
+	if license.Url == "" {
+		return name
+	}
+	return fmt.Sprintf(HREF_TEMPLATE, html.EscapeString(license.Url), name)
+}
+
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
+
+// imageCredits returns the credits of the given image (without "File:" prefix) according to the configured template of
+// its license. The credits are empty when the template of the license is empty or the image metadata is unavailable.
+func (g *HtmlGenerator) imageCredits(filename string) string {
+	metadata, err := g.WikipediaService.GetImageMetadata("File:" + filename)
+	if err != nil {
+		sigolo.Warnf("Unable to get credits of image '%s': %s", filename, err.Error())
+		return ""
+	}
+
+	credits := config.Current.ImageCreditTemplate(metadata.License.Name)
+	credits = strings.ReplaceAll(credits, config.AuthorPlaceholder, valueOrUnknown(metadata.Author))
+	credits = strings.ReplaceAll(credits, config.LicensePlaceholder, valueOrUnknown(metadata.License.Name))
+	return html.EscapeString(credits)
+}
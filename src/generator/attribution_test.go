@@ -0,0 +1,84 @@
+package generator
+
+import (
+	"os"
+	"testing"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/parser"
+	"wiki2book/test"
+	"wiki2book/util"
+	"wiki2book/wikipedia"
+)
+
+func TestGenerateAttributionPage(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	htmlGenerator := &HtmlGenerator{
+		TokenMap: map[string]parser.Token{},
+	}
+	textLicense := &wikipedia.License{Name: "CC BY-SA 4.0", Url: "https://creativecommons.org/licenses/by-sa/4.0/"}
+	articles := []ArticleAttribution{
+		{
+			Title:        "Earth",
+			Url:          "https://en.wikipedia.org/w/index.php?title=Earth&oldid=123",
+			Contributors: &wikipedia.ArticleContributors{Names: []string{"Alice", "Bob"}, AnonymousContributors: 3},
+		},
+		{
+			Title: "Moon & Sun",
+			Url:   "https://en.wikipedia.org/wiki/Moon_%26_Sun",
+		},
+	}
+	images := []wikipedia.ImageMetadata{
+		{
+			Title:   "File:Earth.jpg",
+			Author:  "<Carol>",
+			License: wikipedia.License{Name: "CC0", Url: "https://creativecommons.org/publicdomain/zero/1.0/"},
+			Source:  "https://commons.wikimedia.org/wiki/File:Earth.jpg",
+		},
+		{
+			Title:  "File:Moon.jpg",
+			Source: "https://commons.wikimedia.org/wiki/File:Moon.jpg",
+		},
+	}
+
+	htmlFile, err := htmlGenerator.GenerateAttributionPage("attribution-page", "Sources and licenses", textLicense, articles, images)
+
+	test.AssertNil(t, err)
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<h1>Sources and licenses</h1>
+<p>The texts of the articles are available under the license <a href="https://creativecommons.org/licenses/by-sa/4.0/">CC BY-SA 4.0</a>. The articles and their authors are listed below.</p>
+<h2>Articles</h2>
+<ul>
+<li>
+<a href="https://en.wikipedia.org/w/index.php\?title=Earth&amp;oldid=123">Earth</a><br>
+Authors: Alice, Bob and 3 anonymous authors
+</li>
+<li>
+<a href="https://en.wikipedia.org/wiki/Moon_%26_Sun">Moon &amp; Sun</a><br>
+Authors: see version history of the article
+</li>
+</ul>
+<h2>Images</h2>
+<ul>
+<li>
+<a href="https://commons.wikimedia.org/wiki/File:Earth.jpg">File:Earth.jpg</a><br>
+Author: &lt;Carol&gt;<br>
+License: <a href="https://creativecommons.org/publicdomain/zero/1.0/">CC0</a>
+</li>
+<li>
+<a href="https://commons.wikimedia.org/wiki/File:Moon.jpg">File:Moon.jpg</a><br>
+Author: unknown<br>
+License: unknown
+</li>
+</ul>`, string(content))
+}
+
+func TestContributorsText(t *testing.T) {
+	test.AssertEqual(t, "see version history of the article", contributorsText(nil))
+	test.AssertEqual(t, "unknown", contributorsText(&wikipedia.ArticleContributors{}))
+	test.AssertEqual(t, "Alice", contributorsText(&wikipedia.ArticleContributors{Names: []string{"Alice"}}))
+	test.AssertEqual(t, "2 anonymous authors", contributorsText(&wikipedia.ArticleContributors{AnonymousContributors: 2}))
+}
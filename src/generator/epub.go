@@ -1,10 +1,12 @@
 package generator
 
 import (
+	"bytes"
 	"fmt"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"wiki2book/config"
 	"wiki2book/util"
 
@@ -14,31 +16,41 @@ import (
 )
 
 func GenerateEpub(articleFiles []string, outputFile string, metadata config.Metadata) error {
+	if config.Current.OutputType != config.OutputTypeEpub2 && config.Current.OutputType != config.OutputTypeEpub3 {
+		return errors.Errorf("Output type '%s' does not support EPUB generation. This is a Bug.", config.Current.OutputType)
+	}
+
+	return generateEpubOfType(articleFiles, outputFile, metadata, config.Current.OutputType)
+}
+
+// generateEpubOfType creates an EPUB file of the given type (epub2 or epub3) independent of the configured output type.
+// This allows other output types to use EPUB files as intermediate format.
+func generateEpubOfType(articleFiles []string, outputFile string, metadata config.Metadata, epubType string) error {
 	var err error
 
-	sigolo.Debugf("Generate EPUB to '%s' for articles %v", outputFile, articleFiles)
+	sigolo.Debugf("Generate %s to '%s' for articles %v", epubType, outputFile, articleFiles)
 
-	if config.Current.OutputType != config.OutputTypeEpub2 && config.Current.OutputType != config.OutputTypeEpub3 {
-		return errors.Errorf("Output type '%s' does not support EPUB generation. This is a Bug.", config.Current.OutputType)
+	if epubType != config.OutputTypeEpub2 && epubType != config.OutputTypeEpub3 {
+		return errors.Errorf("EPUB type '%s' is not supported. This is a Bug.", epubType)
 	}
 
 	if config.Current.OutputDriver == config.OutputDriverPandoc {
-		err = GenerateEpubWithPandoc(articleFiles, outputFile, metadata)
+		err = GenerateEpubWithPandoc(articleFiles, outputFile, metadata, epubType)
 	} else if config.Current.OutputDriver == config.OutputDriverInternal {
 		err = GenerateEpubWithGoLibrary(articleFiles, outputFile, metadata)
 	} else {
-		return errors.Errorf("Output type '%s' does not support EPUB generation. This is a Bug.", config.Current.OutputType)
+		return errors.Errorf("Output driver '%s' does not support EPUB generation. This is a Bug.", config.Current.OutputDriver)
 	}
 
 	return err
 }
 
-func GenerateEpubWithPandoc(sourceFiles []string, outputFile string, metadata config.Metadata) error {
+func GenerateEpubWithPandoc(sourceFiles []string, outputFile string, metadata config.Metadata, epubType string) error {
 	// Example: pandoc -o Stern.epub --css ../../style.css --epub-embed-font="/usr/share/fonts/TTF/DejaVuSans*.ttf" Stern.html
 
 	args := []string{
 		"-f", "html",
-		"-t", config.Current.OutputType,
+		"-t", epubType,
 		"-o", outputFile,
 		"--metadata", "title=" + metadata.Title,
 		"--metadata", "author=" + metadata.Author,
@@ -46,6 +58,9 @@ func GenerateEpubWithPandoc(sourceFiles []string, outputFile string, metadata co
 		"--metadata", "language=" + metadata.Language,
 		"--metadata", "date=" + metadata.Date,
 	}
+	for _, source := range metadata.Sources {
+		args = append(args, "--metadata", "source="+source)
+	}
 	if config.Current.TocDepth > 0 {
 		args = append(args, "--toc", "--toc-depth", strconv.Itoa(config.Current.TocDepth))
 	}
@@ -75,8 +90,7 @@ func GenerateEpubWithPandoc(sourceFiles []string, outputFile string, metadata co
 }
 
 func GenerateEpubWithGoLibrary(sourceFiles []string, outputFile string, metadata config.Metadata) error {
-
-	epubObj, err := epub.NewEpub("My title")
+	epubObj, err := epub.NewEpub(metadata.Title)
 	if err != nil {
 		return errors.Wrap(err, "Error generating new EPUB object")
 	}
@@ -85,65 +99,88 @@ func GenerateEpubWithGoLibrary(sourceFiles []string, outputFile string, metadata
 	epubObj.SetLang(metadata.Language)
 	epubObj.SetTitle(metadata.Title)
 
-	internalCoverImagePath, err := epubObj.AddImage(config.Current.CoverImage, "cover.png")
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error adding cover image '%s' to EPUB object", config.Current.CoverImage))
+	internalCssPath := ""
+	if config.Current.StyleFile != "" {
+		internalCssPath, err = epubObj.AddCSS(config.Current.StyleFile, "style.css")
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error adding CSS file %s to EPUB object", config.Current.StyleFile))
+		}
 	}
 
-	err = epubObj.SetCover(internalCoverImagePath, "")
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error setting internal image '%s' as cover image on EPUB object", internalCoverImagePath))
+	// The fonts are added with their original file name, because the style file references them by this name (e.g.
+	// "../fonts/DejaVuSans.ttf").
+	for _, fontFile := range config.Current.FontFiles {
+		sigolo.Debugf("Add font file %s to EPUB object", fontFile)
+		_, err = epubObj.AddFont(fontFile, filepath.Base(fontFile))
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error adding font file %s to EPUB object", fontFile))
+		}
 	}
 
-	headingTitleRegex := regexp.MustCompile(`(?s)<h1>(.*)</h1>`)
-	var fileBytes []byte
-	for _, sourceFile := range sourceFiles {
-		sigolo.Debugf("Add source file %s to EPUB object", sourceFile)
-		fileBytes, err = os.ReadFile(sourceFile)
+	if config.Current.CoverImage != "" {
+		internalCoverImagePath, err := epubObj.AddImage(config.Current.CoverImage, "cover"+strings.ToLower(filepath.Ext(config.Current.CoverImage)))
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error reading source file '%s' to add it to the EPUB object", sourceFile))
+			return errors.Wrap(err, fmt.Sprintf("Error adding cover image '%s' to EPUB object", config.Current.CoverImage))
 		}
 
-		fileContent := string(fileBytes)
-
-		sectionTitle := headingTitleRegex.FindStringSubmatch(fileContent)[1]
-
-		// TODO Find a way to add subsections to TOC as well
-		_, err = epubObj.AddSection(fileContent, sectionTitle, "", "")
+		err = epubObj.SetCover(internalCoverImagePath, internalCssPath)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error reading source file %s to add it to the EPUB object", sourceFile))
+			return errors.Wrap(err, fmt.Sprintf("Error setting internal image '%s' as cover image on EPUB object", internalCoverImagePath))
 		}
-		epubObj.EmbedImages()
 	}
 
-	_, err = epubObj.AddCSS(config.Current.StyleFile, "style.css")
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error adding CSS file %s to EPUB object", config.Current.StyleFile))
+	// Links between articles point to IDs within the whole book, which are turned into links to other sections.
+	// Therefore, the section of each ID must be known before converting the source files.
+	sourceFileContents := make([]string, len(sourceFiles))
+	sectionFilenamesById := map[string]string{}
+	for i, sourceFile := range sourceFiles {
+		fileBytes, err := os.ReadFile(sourceFile)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error reading source file '%s' to add it to the EPUB object", sourceFile))
+		}
+		sourceFileContents[i] = string(fileBytes)
+
+		for _, match := range htmlIdRegex.FindAllStringSubmatch(sourceFileContents[i], -1) {
+			sectionFilenamesById[match[1]] = epubSectionFilename(i)
+		}
 	}
 
-	//for _, image := range images {
-	//	image = strings.Split(image, ":")[1] // Remove whatever prefix (e.g. "File:" or "Datei:") this image has
-	//	imageFilepath := filepath.Join(imageCache, image)
-	//	sigolo.Debugf("Add image file %s to EPUB object", imageFilepath)
-	//	_, err = epubObj.AddImage(imageFilepath, imageFilepath)
-	//	if err != nil {
-	//		return errors.Wrap(err, fmt.Sprintf("Error adding image file %s to EPUB object", image))
-	//	}
-	//}
+	images := newEpubImageRegistry(epubObj)
+	var tocEntries []*epubTocEntry
+	var tocStack []*epubTocEntry
+	for i, sourceFile := range sourceFiles {
+		sigolo.Debugf("Add source file %s to EPUB object", sourceFile)
+		sectionFilename := epubSectionFilename(i)
+		section, err := toEpubSection(sourceFileContents[i], sectionFilename, images, sectionFilenamesById)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error converting source file '%s' into EPUB section", sourceFile))
+		}
 
-	// TODO Test if this if working. The name in the CSS style and the name inside the EPUB probably need to match.
-	for _, fontFile := range config.Current.FontFiles {
-		sigolo.Debugf("Add font file %s to EPUB object", fontFile)
-		_, err = epubObj.AddFont(fontFile, fontFile)
+		_, err = epubObj.AddSection(section.body, section.title, sectionFilename, internalCssPath)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error adding font file %s to EPUB object", fontFile))
+			return errors.Wrap(err, fmt.Sprintf("Error adding source file %s to the EPUB object", sourceFile))
 		}
+
+		tocEntries, tocStack = addTocEntries(tocEntries, tocStack, section.tocEntries)
 	}
 
-	err = epubObj.Write(outputFile)
+	var epubBuffer bytes.Buffer
+	_, err = epubObj.WriteTo(&epubBuffer)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error generating EPUB file %s", outputFile))
 	}
 
+	// The EPUB library neither supports nested TOC entries pointing into sections nor all metadata we have, which is
+	// why the written EPUB is post-processed.
+	postProcessedEpub, err := postProcessEpub(epubBuffer.Bytes(), epubObj.Identifier(), metadata, tocEntries)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error post-processing EPUB file %s", outputFile))
+	}
+
+	err = os.WriteFile(outputFile, postProcessedEpub, 0644)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error writing EPUB file %s", outputFile))
+	}
+
 	return nil
 }
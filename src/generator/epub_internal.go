@@ -0,0 +1,489 @@
+package generator
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"wiki2book/config"
+
+	"github.com/go-shiori/go-epub"
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// This file contains helper functions for the internal EPUB driver, which uses the go-epub library.
+
+const (
+	epubContentFolder     = "EPUB/"
+	epubSectionFolder     = "xhtml/"
+	epubPackageFile       = epubContentFolder + "package.opf"
+	epubNavFile           = epubContentFolder + "nav.xhtml"
+	epubNcxFile           = epubContentFolder + "toc.ncx"
+	epubHeadingIdTemplate = "wiki2book-heading-%d"
+)
+
+const EPUB_NAV_TEMPLATE = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+  <head>
+    <title>%s</title>
+  </head>
+  <body>
+    <nav epub:type="toc">
+      <h1>Table of Contents</h1>
+%s    </nav>
+  </body>
+</html>
+`
+const EPUB_NAV_LIST_TEMPLATE = `%s<ol>
+%s%s</ol>
+`
+const EPUB_NAV_ITEM_TEMPLATE = `%s<li><a href="%s">%s</a>
+%s%s</li>
+`
+const EPUB_NCX_TEMPLATE = `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+    <meta name="dtb:uid" content="%s" />
+    <meta name="dtb:depth" content="%d" />
+  </head>
+  <docTitle>
+    <text>%s</text>
+  </docTitle>
+  <docAuthor>
+    <text>%s</text>
+  </docAuthor>
+  <navMap>
+%s  </navMap>
+</ncx>
+`
+const EPUB_NCX_NAV_POINT_TEMPLATE = `%s<navPoint id="navPoint-%d" playOrder="%d">
+%s  <navLabel>
+%s    <text>%s</text>
+%s  </navLabel>
+%s  <content src="%s" />
+%s%s</navPoint>
+`
+
+var (
+	whitespaceRegex = regexp.MustCompile(`\s+`)
+	htmlIdRegex     = regexp.MustCompile(`\sid="([^"]+)"`)
+)
+
+// epubTocEntry is an entry in the table of content. The href is relative to the content folder of the EPUB file.
+type epubTocEntry struct {
+	title    string
+	href     string
+	depth    int
+	children []*epubTocEntry
+}
+
+// epubSection is the converted HTML of one article. The body is valid XHTML and can be used as section content.
+type epubSection struct {
+	title      string
+	body       string
+	tocEntries []*epubTocEntry
+}
+
+// epubImageRegistry adds each referenced image exactly once to the EPUB file, even when it's used by several articles.
+type epubImageRegistry struct {
+	addImageFunc  func(source string, internalFilename string) (string, error)
+	internalPaths map[string]string
+}
+
+func newEpubImageRegistry(epubObj *epub.Epub) *epubImageRegistry {
+	return &epubImageRegistry{
+		addImageFunc:  epubObj.AddImage,
+		internalPaths: map[string]string{},
+	}
+}
+
+// add adds the image file to the EPUB and returns the path that should be used in the sections. The internal file
+// names are numbered, which avoids collisions and problems with special characters in file names.
+func (r *epubImageRegistry) add(imageFile string) (string, error) {
+	if internalPath, ok := r.internalPaths[imageFile]; ok {
+		return internalPath, nil
+	}
+
+	internalFilename := fmt.Sprintf("image%04d%s", len(r.internalPaths)+1, strings.ToLower(filepath.Ext(imageFile)))
+	internalPath, err := r.addImageFunc(imageFile, internalFilename)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error adding image file '%s' to EPUB object", imageFile)
+	}
+
+	r.internalPaths[imageFile] = internalPath
+	return internalPath, nil
+}
+
+func epubSectionFilename(articleIndex int) string {
+	return fmt.Sprintf("article%04d.xhtml", articleIndex+1)
+}
+
+// toEpubSection turns the given HTML document, as created by the HtmlGenerator, into an EPUB section. All images are
+// added to the EPUB using the given image registry and all headings up to the configured TOC depth get an ID so that
+// the table of content can point to them. Links to IDs within other sections are turned into links to these sections.
+func toEpubSection(htmlContent string, sectionFilename string, images *epubImageRegistry, sectionFilenamesById map[string]string) (*epubSection, error) {
+	document, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing HTML")
+	}
+
+	body := findFirstElement(document, atom.Body)
+	if body == nil {
+		return nil, errors.New("HTML document has no body")
+	}
+
+	section := &epubSection{}
+	var tocStack []*epubTocEntry
+	headingCounter := 0
+
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			if node.DataAtom == atom.Img {
+				replaceImageSource(node, images)
+			} else if node.DataAtom == atom.A {
+				replaceLinkToOtherSection(node, sectionFilename, sectionFilenamesById)
+			} else if depth := headingDepthOfNode(node); depth > 0 {
+				title := whitespaceRegex.ReplaceAllString(strings.TrimSpace(textContent(node)), " ")
+				// Articles within parts or chapters have no h1 heading, so the first heading is used as title.
+				if section.title == "" {
+					section.title = title
+				}
+
+				if depth <= config.Current.TocDepth {
+					headingCounter++
+					id := getAttribute(node, "id")
+					if id == "" {
+						id = fmt.Sprintf(epubHeadingIdTemplate, headingCounter)
+						node.Attr = append(node.Attr, html.Attribute{Key: "id", Val: id})
+					}
+
+					entry := &epubTocEntry{
+						title: title,
+						href:  epubSectionFolder + sectionFilename + "#" + id,
+						depth: depth,
+					}
+
+					for len(tocStack) > 0 && tocStack[len(tocStack)-1].depth >= depth {
+						tocStack = tocStack[:len(tocStack)-1]
+					}
+					if len(tocStack) == 0 {
+						section.tocEntries = append(section.tocEntries, entry)
+					} else {
+						parent := tocStack[len(tocStack)-1]
+						parent.children = append(parent.children, entry)
+					}
+					tocStack = append(tocStack, entry)
+				}
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(body)
+
+	// The HTML renderer writes void elements as self-closing tags and escapes all special characters, so the result is
+	// valid XHTML.
+	var bodyBuffer bytes.Buffer
+	for child := body.FirstChild; child != nil; child = child.NextSibling {
+		err = html.Render(&bodyBuffer, child)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error rendering HTML body")
+		}
+	}
+	section.body = bodyBuffer.String()
+
+	return section, nil
+}
+
+// replaceLinkToOtherSection turns links like "#foo", which point to an ID within another section, into links to that
+// section. All sections are in the same folder, so the section filename is sufficient.
+func replaceLinkToOtherSection(node *html.Node, sectionFilename string, sectionFilenamesById map[string]string) {
+	for i, attr := range node.Attr {
+		if attr.Key != "href" || !strings.HasPrefix(attr.Val, "#") {
+			continue
+		}
+
+		targetSectionFilename, found := sectionFilenamesById[strings.TrimPrefix(attr.Val, "#")]
+		if found && targetSectionFilename != sectionFilename {
+			node.Attr[i].Val = targetSectionFilename + attr.Val
+		}
+		return
+	}
+}
+
+// replaceImageSource adds the image, which is referenced relative to the cache directory, to the EPUB and replaces
+// the source by the internal path within the EPUB.
+func replaceImageSource(node *html.Node, images *epubImageRegistry) {
+	for i, attr := range node.Attr {
+		if attr.Key != "src" || strings.HasPrefix(attr.Val, "data:") || strings.Contains(attr.Val, "://") {
+			continue
+		}
+
+		imageFile := unescapePathComponents(strings.TrimPrefix(attr.Val, "./"))
+		if !filepath.IsAbs(imageFile) {
+			imageFile = filepath.Join(config.Current.CacheDir, imageFile)
+		}
+
+		internalPath, err := images.add(imageFile)
+		if err != nil {
+			// Same behavior as pandoc: Missing resources are not a reason to abort the generation of the eBook.
+			sigolo.Warnf("Could not add image '%s' to EPUB: %+v", imageFile, err)
+			return
+		}
+
+		node.Attr[i].Val = internalPath
+		return
+	}
+}
+
+func unescapePathComponents(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		unescapedPart, err := url.QueryUnescape(part)
+		if err == nil {
+			parts[i] = unescapedPart
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// addTocEntries adds the top-level TOC entries of a section to the given entries of the table of content. Entries of
+// a section might be children of entries of previous sections, e.g. when the article of a section is part of the
+// chapter of a previous section. The stack contains the path to the last added entry and is returned together with the
+// new entries.
+func addTocEntries(tocEntries []*epubTocEntry, tocStack []*epubTocEntry, sectionTocEntries []*epubTocEntry) ([]*epubTocEntry, []*epubTocEntry) {
+	for _, entry := range sectionTocEntries {
+		for len(tocStack) > 0 && tocStack[len(tocStack)-1].depth >= entry.depth {
+			tocStack = tocStack[:len(tocStack)-1]
+		}
+		if len(tocStack) == 0 {
+			tocEntries = append(tocEntries, entry)
+		} else {
+			parent := tocStack[len(tocStack)-1]
+			parent.children = append(parent.children, entry)
+		}
+
+		tocStack = append(tocStack, entry)
+		for lastEntry := entry; len(lastEntry.children) > 0; {
+			lastEntry = lastEntry.children[len(lastEntry.children)-1]
+			tocStack = append(tocStack, lastEntry)
+		}
+	}
+	return tocEntries, tocStack
+}
+
+func headingDepthOfNode(node *html.Node) int {
+	switch node.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+func findFirstElement(node *html.Node, elementAtom atom.Atom) *html.Node {
+	if node.Type == html.ElementNode && node.DataAtom == elementAtom {
+		return node
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if result := findFirstElement(child, elementAtom); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
+func getAttribute(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func textContent(node *html.Node) string {
+	if node.Type == html.TextNode {
+		return node.Data
+	}
+	result := ""
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		result += textContent(child)
+	}
+	return result
+}
+
+// postProcessEpub rewrites the given EPUB file and adds the metadata the EPUB library doesn't support. It also
+// replaces the table of content files by one containing the given entries. All other files are copied unchanged,
+// which also keeps the uncompressed "mimetype" file at the beginning of the archive.
+func postProcessEpub(epubContent []byte, identifier string, metadata config.Metadata, tocEntries []*epubTocEntry) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(epubContent), int64(len(epubContent)))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading EPUB archive")
+	}
+
+	var resultBuffer bytes.Buffer
+	writer := zip.NewWriter(&resultBuffer)
+
+	for _, file := range reader.File {
+		var newContent string
+		switch file.Name {
+		case epubPackageFile:
+			content, err := readZipFile(file)
+			if err != nil {
+				return nil, err
+			}
+			newContent = addPackageMetadata(content, metadata)
+		case epubNavFile:
+			if len(tocEntries) == 0 {
+				break
+			}
+			newContent = fmt.Sprintf(EPUB_NAV_TEMPLATE, html.EscapeString(metadata.Title), renderNavList(tocEntries, "      "))
+		case epubNcxFile:
+			if len(tocEntries) == 0 {
+				break
+			}
+			playOrder := 0
+			navPoints := renderNcxNavPoints(tocEntries, "    ", &playOrder)
+			newContent = fmt.Sprintf(EPUB_NCX_TEMPLATE, html.EscapeString(identifier), tocDepthOf(tocEntries), html.EscapeString(metadata.Title), html.EscapeString(metadata.Author), navPoints)
+		}
+
+		if newContent != "" {
+			fileWriter, err := writer.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Deflate})
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error creating file '%s' in EPUB archive", file.Name)
+			}
+			_, err = fileWriter.Write([]byte(newContent))
+			if err != nil {
+				return nil, errors.Wrapf(err, "Error writing file '%s' in EPUB archive", file.Name)
+			}
+			continue
+		}
+
+		err = copyRawZipFile(writer, file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error closing EPUB archive")
+	}
+
+	return resultBuffer.Bytes(), nil
+}
+
+func readZipFile(file *zip.File) (string, error) {
+	fileReader, err := file.Open()
+	if err != nil {
+		return "", errors.Wrapf(err, "Error opening file '%s' in EPUB archive", file.Name)
+	}
+	defer fileReader.Close()
+
+	content, err := io.ReadAll(fileReader)
+	if err != nil {
+		return "", errors.Wrapf(err, "Error reading file '%s' in EPUB archive", file.Name)
+	}
+
+	return string(content), nil
+}
+
+func copyRawZipFile(writer *zip.Writer, file *zip.File) error {
+	fileWriter, err := writer.CreateRaw(&file.FileHeader)
+	if err != nil {
+		return errors.Wrapf(err, "Error creating file '%s' in EPUB archive", file.Name)
+	}
+
+	fileReader, err := file.OpenRaw()
+	if err != nil {
+		return errors.Wrapf(err, "Error opening file '%s' in EPUB archive", file.Name)
+	}
+
+	_, err = io.Copy(fileWriter, fileReader)
+	if err != nil {
+		return errors.Wrapf(err, "Error copying file '%s' in EPUB archive", file.Name)
+	}
+
+	return nil
+}
+
+// addPackageMetadata adds the license, date and sources to the metadata of the package file.
+func addPackageMetadata(packageContent string, metadata config.Metadata) string {
+	additionalMetadata := ""
+	if metadata.License != "" {
+		additionalMetadata += "\n    <dc:rights>" + html.EscapeString(metadata.License) + "</dc:rights>"
+	}
+	if metadata.Date != "" {
+		additionalMetadata += "\n    <dc:date>" + html.EscapeString(metadata.Date) + "</dc:date>"
+	}
+	for _, source := range metadata.Sources {
+		additionalMetadata += "\n    <dc:source>" + html.EscapeString(source) + "</dc:source>"
+	}
+	if additionalMetadata == "" {
+		return packageContent
+	}
+
+	return strings.Replace(packageContent, "</dc:language>", "</dc:language>"+additionalMetadata, 1)
+}
+
+func renderNavList(entries []*epubTocEntry, indentation string) string {
+	items := ""
+	for _, entry := range entries {
+		children := ""
+		if len(entry.children) > 0 {
+			children = renderNavList(entry.children, indentation+"    ")
+		}
+		items += fmt.Sprintf(EPUB_NAV_ITEM_TEMPLATE, indentation+"  ", html.EscapeString(entry.href), html.EscapeString(entry.title), children, indentation+"  ")
+	}
+	return fmt.Sprintf(EPUB_NAV_LIST_TEMPLATE, indentation, items, indentation)
+}
+
+func renderNcxNavPoints(entries []*epubTocEntry, indentation string, playOrder *int) string {
+	result := ""
+	for _, entry := range entries {
+		*playOrder++
+		currentPlayOrder := *playOrder
+		children := renderNcxNavPoints(entry.children, indentation+"  ", playOrder)
+		result += fmt.Sprintf(EPUB_NCX_NAV_POINT_TEMPLATE,
+			indentation, currentPlayOrder, currentPlayOrder,
+			indentation,
+			indentation, html.EscapeString(entry.title),
+			indentation,
+			indentation, html.EscapeString(entry.href),
+			children, indentation,
+		)
+	}
+	return result
+}
+
+func tocDepthOf(entries []*epubTocEntry) int {
+	maxDepth := 0
+	for _, entry := range entries {
+		depth := 1 + tocDepthOf(entry.children)
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+	return maxDepth
+}
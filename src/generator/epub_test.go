@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+const epubInternalTestFolder = "../test/epub-internal"
+
+var (
+	epubIdentifierRegex   = regexp.MustCompile(`urn:uuid:[0-9a-f-]+`)
+	epubModifiedRegex     = regexp.MustCompile(`<meta property="dcterms:modified">[^<]*</meta>`)
+	epubManifestItemRegex = regexp.MustCompile(`<item id="[^"]*" (href="[^"]*" media-type="[^"]*"[^>]*)>`)
+	epubSpineRegex        = regexp.MustCompile(`(?s)\s*<spine.*</spine>`)
+)
+
+func TestGenerateEpubWithGoLibrary_golden(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	config.Current.OutputDriver = config.OutputDriverInternal
+	config.Current.OutputType = config.OutputTypeEpub3
+	config.Current.CacheDir = epubInternalTestFolder
+	config.Current.StyleFile = filepath.Join(epubInternalTestFolder, "style.css")
+	config.Current.CoverImage = filepath.Join(epubInternalTestFolder, "cover.png")
+	config.Current.FontFiles = []string{filepath.Join(epubInternalTestFolder, "DejaVuSans.ttf")}
+	config.Current.TocDepth = 3
+
+	metadata := config.Metadata{
+		Title:    "My <book>",
+		Language: "de",
+		Author:   "Foo & Bar",
+		License:  "CC-BY-SA 4.0",
+		Date:     "2024-02-29",
+		Sources:  []string{"https://de.wikipedia.org/w/index.php?title=Erde&oldid=1234"},
+	}
+	sourceFiles := []string{
+		filepath.Join(epubInternalTestFolder, "article-a.html"),
+		filepath.Join(epubInternalTestFolder, "article-b.html"),
+	}
+	outputFile := filepath.Join(t.TempDir(), "internal.epub")
+
+	// Act
+	err := GenerateEpub(sourceFiles, outputFile, metadata)
+
+	// Assert
+	test.AssertNil(t, err)
+	assertEpubMatchesGoldenFiles(t, outputFile, filepath.Join(epubInternalTestFolder, "expected"))
+}
+
+// assertEpubMatchesGoldenFiles compares the list of files and the content of all text files of the EPUB with the
+// files in the given folder. Generated values like the identifier and modification date are replaced by placeholders.
+func assertEpubMatchesGoldenFiles(t *testing.T, epubFile string, goldenFolder string) {
+	reader, err := zip.OpenReader(epubFile)
+	test.AssertNil(t, err)
+	defer reader.Close()
+
+	test.AssertEqual(t, "mimetype", reader.File[0].Name)
+	test.AssertEqual(t, zip.Store, reader.File[0].Method)
+
+	var fileNames []string
+	for _, file := range reader.File {
+		fileNames = append(fileNames, file.Name)
+		if !isEpubTextFile(file.Name) {
+			continue
+		}
+
+		actualContent, err := readZipFile(file)
+		test.AssertNil(t, err)
+		actualContent = normalizeEpubFileContent(actualContent)
+
+		expectedContent, err := os.ReadFile(filepath.Join(goldenFolder, file.Name))
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(expectedContent), actualContent)
+	}
+
+	sort.Strings(fileNames)
+	expectedFileNames, err := os.ReadFile(filepath.Join(goldenFolder, "files.txt"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, strings.TrimSpace(string(expectedFileNames)), strings.Join(fileNames, "\n"))
+}
+
+func isEpubTextFile(name string) bool {
+	extension := filepath.Ext(name)
+	return extension == ".xhtml" || extension == ".opf" || extension == ".ncx"
+}
+
+// normalizeEpubFileContent removes generated values and sorts the manifest, which is unordered in the EPUB library.
+func normalizeEpubFileContent(content string) string {
+	content = epubIdentifierRegex.ReplaceAllString(content, "{IDENTIFIER}")
+	content = epubModifiedRegex.ReplaceAllString(content, `<meta property="dcterms:modified">{MODIFIED}</meta>`)
+	content = epubSpineRegex.ReplaceAllString(content, "")
+
+	manifestItems := epubManifestItemRegex.FindAllStringSubmatch(content, -1)
+	if len(manifestItems) > 0 {
+		var items []string
+		for _, item := range manifestItems {
+			items = append(items, "<item "+item[1]+">")
+		}
+		sort.Strings(items)
+		content = epubManifestItemRegex.ReplaceAllString(content, "")
+		content = regexp.MustCompile(`(?s)<manifest>.*</manifest>`).ReplaceAllString(content, "<manifest>\n    "+strings.Join(items, "\n    ")+"\n  </manifest>")
+	}
+
+	return content
+}
+
+func TestAddTocEntries(t *testing.T) {
+	// Arrange
+	chapter := &epubTocEntry{title: "Chapter", depth: 1}
+	firstArticle := &epubTocEntry{title: "First", depth: 2, children: []*epubTocEntry{{title: "Section", depth: 3}}}
+	secondArticle := &epubTocEntry{title: "Second", depth: 2}
+	thirdArticle := &epubTocEntry{title: "Third", depth: 1}
+
+	// Act
+	var tocEntries []*epubTocEntry
+	var tocStack []*epubTocEntry
+	for _, sectionTocEntries := range [][]*epubTocEntry{{chapter}, {firstArticle}, {secondArticle}, {thirdArticle}} {
+		tocEntries, tocStack = addTocEntries(tocEntries, tocStack, sectionTocEntries)
+	}
+
+	// Assert
+	test.AssertEqual(t, []*epubTocEntry{chapter, thirdArticle}, tocEntries)
+	test.AssertEqual(t, []*epubTocEntry{firstArticle, secondArticle}, chapter.children)
+	test.AssertEqual(t, 1, len(firstArticle.children))
+	test.AssertEqual(t, []*epubTocEntry{thirdArticle}, tocStack)
+}
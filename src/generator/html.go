@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"html"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -84,32 +85,136 @@ const TEMPLATE_DD = `<div class="dd">
 %s
 </div>`
 const TEMPLATE_HEADING = "<h%d>%s</h%d>"
+const TEMPLATE_HEADING_WITH_ID = `<h%d id="%s">%s</h%d>`
 const TEMPLATE_REF_DEF = "[%d] %s<br>"
 const TEMPLATE_REF_USAGE = "[%d]"
 
 var (
-	tokenRegex = regexp.MustCompile(parser.TOKEN_REGEX)
+	tokenRegex   = regexp.MustCompile(parser.TOKEN_REGEX)
+	htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
 )
 
 type HtmlGenerator struct {
 	// TODO must they be public?
 	TokenMap         map[string]parser.Token
 	WikipediaService wikipedia.WikipediaService
+
+	// ArticleSource is used to resolve redirects of linked articles and is therefore needed, when InternalLinkTargets
+	// is set.
+	ArticleSource wikipedia.ArticleSource
+
+	// InternalLinkTargets contains the articles that are part of the output. Internal links to these articles become
+	// hyperlinks, all other internal links are turned into plain text. A nil map therefore disables all internal links.
+	// When set, all headings get an ID, so that links can point to them.
+	InternalLinkTargets InternalLinkTargets
+
+	// HeadingOffset is added to the depth of all headings including the article title. This is used for articles
+	// within parts and chapters, whose titles are headings of a higher level than the article title.
+	HeadingOffset int
+
+	// FileName is the name of the HTML file of the article without file extension. The article title is used when
+	// empty.
+	FileName string
+
+	articleTitle  string
+	articleAnchor string
+	usedAnchors   map[string]bool
 }
 
 // Generate creates the HTML for the given article and returns either the HTML file path or an error.
 func (g *HtmlGenerator) Generate(wikiArticle *parser.Article) (string, error) {
+	content, err := g.generate(wikiArticle.Title, articleAnchor(wikiArticle.Title), wikiArticle.Content)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := g.FileName
+	if fileName == "" {
+		fileName = wikiArticle.Title
+	}
+	return write(fileName, cache.HtmlCacheDirName, content)
+}
+
+// GenerateStructurePage creates the HTML page of a part or chapter of the book, which consists of the title and the
+// optional intro. The title is a heading of the depth HeadingOffset+1. The file name must neither be used by an article
+// nor by another structure page.
+func (g *HtmlGenerator) GenerateStructurePage(fileName string, title string, intro *parser.Article) (string, error) {
+	content := ""
+	if intro != nil {
+		content = intro.Content
+	}
+	return g.generateProjectPage(fileName, title, content)
+}
+
+// generateProjectPage creates the HTML page of the given content, which belongs to the project, e.g. a structure page.
+// Such pages differ between projects, so the hash of the content is part of the file name. This way, projects using the
+// same cache, even at the same time, don't overwrite each other's pages.
+func (g *HtmlGenerator) generateProjectPage(fileName string, title string, articleContent string) (string, error) {
+	content, err := g.generate(title, structurePageAnchor(fileName), articleContent)
+	if err != nil {
+		return "", err
+	}
+
+	return write(fileName+"-"+util.Hash(content), cache.HtmlCacheDirName, content)
+}
+
+// generate creates the content of the HTML file with the given title as heading.
+func (g *HtmlGenerator) generate(title string, anchor string, articleContent string) (string, error) {
 	styleFile, err := util.ToRelativePathWithBasedir(config.Current.CacheDir, config.Current.StyleFile)
 	sigolo.FatalCheck(err)
 	content := strings.ReplaceAll(HEADER, "{{STYLE}}", styleFile)
-	content += "\n<h1>" + wikiArticle.Title + "</h1>\n"
-	expandedContent, err := expand(g, wikiArticle.Content)
+
+	titleHeadingDepth := g.headingDepth(1)
+	g.articleTitle = title
+	if g.InternalLinkTargets != nil {
+		err = g.addRedirectsOfLinkedArticles()
+		if err != nil {
+			return "", err
+		}
+
+		g.articleAnchor = anchor
+		g.usedAnchors = map[string]bool{g.articleAnchor: true}
+		content += "\n" + fmt.Sprintf(TEMPLATE_HEADING_WITH_ID, titleHeadingDepth, g.articleAnchor, title, titleHeadingDepth) + "\n"
+	} else {
+		content += "\n" + fmt.Sprintf(TEMPLATE_HEADING, titleHeadingDepth, title, titleHeadingDepth) + "\n"
+	}
+	expandedContent, err := expand(g, articleContent)
 	if err != nil {
 		return "", err
 	}
 	content += expandedContent
 	content += FOOTER
-	return write(wikiArticle.Title, cache.HtmlCacheDirName, content)
+	return content, nil
+}
+
+// headingDepth returns the depth of the HTML heading for a heading of the given depth within the article. HTML only
+// supports six levels of headings, which is why deeper headings end up as h6.
+func (g *HtmlGenerator) headingDepth(depth int) int {
+	return min(depth+g.HeadingOffset, 6)
+}
+
+// addRedirectsOfLinkedArticles adds all linked articles to the link targets, which are a redirect to an article of the
+// output. Links often use a redirect instead of the actual article name, e.g. a link to "Sun" for the article "Sun
+// (star)".
+func (g *HtmlGenerator) addRedirectsOfLinkedArticles() error {
+	var linkedArticles []string
+	for _, token := range g.TokenMap {
+		linkToken, isInternalLink := token.(parser.InternalLinkToken)
+		if isInternalLink && linkToken.ArticleName != "" && !g.InternalLinkTargets.Contains(linkToken.ArticleName) {
+			linkedArticles = append(linkedArticles, linkToken.ArticleName)
+		}
+	}
+	if len(linkedArticles) == 0 {
+		return nil
+	}
+
+	redirects, err := g.ArticleSource.ResolveRedirects(linkedArticles)
+	if err != nil {
+		return errors.Wrap(err, "Error resolving redirects of linked articles")
+	}
+
+	g.InternalLinkTargets = g.InternalLinkTargets.WithRedirects(redirects)
+	return nil
 }
 
 func (g *HtmlGenerator) getToken(tokenKey string) (parser.Token, bool) {
@@ -138,7 +243,27 @@ func (g *HtmlGenerator) expandHeadings(token parser.HeadingToken) (string, error
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf(TEMPLATE_HEADING, token.Depth, expandedHeadingText, token.Depth), nil
+
+	depth := g.headingDepth(token.Depth)
+	if g.articleAnchor != "" {
+		// Links to the section use the plain heading text, so the anchor must not contain escaped characters like "&amp;".
+		headingText := strings.TrimSpace(html.UnescapeString(htmlTagRegex.ReplaceAllString(expandedHeadingText, "")))
+		anchor := g.uniqueAnchor(sectionAnchor(g.articleAnchor, headingText))
+		return fmt.Sprintf(TEMPLATE_HEADING_WITH_ID, depth, anchor, expandedHeadingText, depth), nil
+	}
+
+	return fmt.Sprintf(TEMPLATE_HEADING, depth, expandedHeadingText, depth), nil
+}
+
+// uniqueAnchor returns the given anchor or, in case it's already used by another heading, the anchor with a number
+// appended. Links to sections with duplicated names therefore lead to the first of these sections, like in MediaWiki.
+func (g *HtmlGenerator) uniqueAnchor(anchor string) string {
+	uniqueAnchor := anchor
+	for i := 2; g.usedAnchors[uniqueAnchor]; i++ {
+		uniqueAnchor = fmt.Sprintf("%s-%d", anchor, i)
+	}
+	g.usedAnchors[uniqueAnchor] = true
+	return uniqueAnchor
 }
 
 func (g *HtmlGenerator) expandInlineImage(token parser.InlineImageToken) (string, error) {
@@ -154,6 +279,13 @@ func (g *HtmlGenerator) expandImage(token parser.ImageToken) (string, error) {
 		return "", errors.Wrap(err, fmt.Sprintf("Error while expanding caption of image %#v", token))
 	}
 
+	if config.Current.ImageCredits {
+		credits := g.imageCredits(token.Filename)
+		if credits != "" {
+			caption += fmt.Sprintf(TEMPLATE_IMAGE_CREDITS, credits)
+		}
+	}
+
 	sizeTemplate := expandSizeTemplate(token.SizeX, token.SizeY)
 	filename := filenameToImagePath(token.Filename)
 
@@ -199,9 +331,24 @@ func filenameToImagePath(filename string) string {
 }
 
 func (g *HtmlGenerator) expandInternalLink(token parser.InternalLinkToken) (string, error) {
-	// Currently links are not added to the eBook, even though it's possible. Maybe this will be made configurable in
-	// the future.
-	return expand(g, token.LinkText)
+	text, err := expand(g, token.LinkText)
+	if err != nil {
+		return "", err
+	}
+
+	articleName := token.ArticleName
+	if articleName == "" {
+		// Links like [[#Foo]] point to a section of the current article.
+		articleName = g.articleTitle
+	}
+
+	href, isPartOfOutput := g.InternalLinkTargets.Href(articleName, token.Section)
+	if !isPartOfOutput {
+		// Links to articles, that are not part of the output, would lead nowhere and are therefore just text.
+		return text, nil
+	}
+
+	return fmt.Sprintf(HREF_TEMPLATE, href, text), nil
 }
 
 func (g *HtmlGenerator) expandExternalLink(token parser.ExternalLinkToken) (string, error) {
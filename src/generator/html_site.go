@@ -0,0 +1,179 @@
+package generator
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const HTML_SITE_INDEX_FILE_NAME = "index.html"
+const HTML_SITE_STYLE_FILE_NAME = "style.css"
+const HTML_SITE_COVER_FILE_NAME = "cover"
+const HTML_SITE_INDEX_TEMPLATE = `<!DOCTYPE html>
+<html lang="{{LANGUAGE}}">
+<head>
+<meta charset="utf-8">
+<title>{{TITLE}}</title>
+{{STYLESHEET}}</head>
+<body>
+<h1>{{TITLE}}</h1>
+{{METADATA}}
+<ol class="toc">
+{{ARTICLES}}
+</ol>
+</body>
+</html>
+`
+const HTML_SITE_STYLESHEET_LINK = `<link rel="stylesheet" href="` + HTML_SITE_STYLE_FILE_NAME + `">` + "\n"
+const HTML_SITE_INDEX_METADATA_TEMPLATE = `<p class="%s">%s</p>`
+const HTML_SITE_INDEX_COVER_TEMPLATE = `<img alt="cover" class="cover" src="%s">`
+const HTML_SITE_INDEX_ARTICLE_TEMPLATE = `<li><a href="%s">%s</a></li>`
+const HTML_SITE_NAVIGATION_TEMPLATE = `<div class="navigation"><a href="` + HTML_SITE_INDEX_FILE_NAME + `">%s</a></div>`
+
+var (
+	htmlSiteStylesheetRegex    = regexp.MustCompile(`<link rel="stylesheet" href="[^"]*">\n?`)
+	htmlSiteBodyStartRegex     = regexp.MustCompile(`<body[^>]*>`)
+	htmlSiteLocalFileLinkRegex = regexp.MustCompile(`src="\./((?:` + cache.ImageCacheDirName + `|` + cache.MathCacheDirName + `)/[^"]+)"`)
+)
+
+// NewHtmlSiteLinkTargets creates the link targets for the given articles, which point to their pages on the website.
+// The articles must be the same as the ones given to GenerateHtmlSite, so that both determine the same page file names.
+func NewHtmlSiteLinkTargets(articleNames []string) InternalLinkTargets {
+	pageFileNames := htmlSitePageFileNames(articleNames)
+	linkTargets := InternalLinkTargets{}
+	for _, articleName := range articleNames {
+		linkTargets.Add(articleName, url.PathEscape(pageFileNames[normalizeArticleName(articleName)]))
+	}
+	return linkTargets
+}
+
+// htmlSitePageFileNames returns the file names of the pages of the given articles by their normalized name. Different
+// articles might result in the same file name on case-insensitive filesystems, e.g. "Foo" and "FOO". Later articles
+// therefore get a number appended in case of a collision, also with the index page.
+func htmlSitePageFileNames(articleNames []string) map[string]string {
+	pageFileNames := map[string]string{}
+	usedFileNames := map[string]bool{strings.ToLower(HTML_SITE_INDEX_FILE_NAME): true}
+	for _, articleName := range articleNames {
+		normalizedArticleName := normalizeArticleName(articleName)
+		if _, found := pageFileNames[normalizedArticleName]; found {
+			continue
+		}
+
+		baseName := util.SanitizeFilename(normalizedArticleName)
+		pageFileName := baseName + ".html"
+		for i := 2; usedFileNames[strings.ToLower(pageFileName)]; i++ {
+			pageFileName = fmt.Sprintf("%s-%d.html", baseName, i)
+		}
+
+		usedFileNames[strings.ToLower(pageFileName)] = true
+		pageFileNames[normalizedArticleName] = pageFileName
+	}
+	return pageFileNames
+}
+
+// GenerateHtmlSite creates a self-contained website within the given output folder. It contains an index page, one
+// page per article, the style file and all images and math files used by the articles. The pages are named after the
+// given article names, which are also their titles and must therefore have the same order as the given HTML files.
+// Without configured style file, the pages don't link to any stylesheet.
+func GenerateHtmlSite(articleNames []string, articleFiles []string, outputFolder string, metadata config.Metadata) error {
+	sigolo.Debugf("Generate HTML website to '%s' for articles %v", outputFolder, articleFiles)
+
+	if len(articleNames) != len(articleFiles) {
+		return errors.Errorf("Got %d article names but %d article files. This is a Bug.", len(articleNames), len(articleFiles))
+	}
+
+	var err error
+	stylesheetLink := ""
+	if config.Current.StyleFile != "" {
+		err = exportFile(config.Current.StyleFile, filepath.Join(outputFolder, HTML_SITE_STYLE_FILE_NAME))
+		if err != nil {
+			return err
+		}
+		stylesheetLink = HTML_SITE_STYLESHEET_LINK
+	}
+
+	title := metadata.Title
+	if title == "" && len(articleNames) > 0 {
+		title = articleNames[0]
+	}
+
+	pageFileNames := htmlSitePageFileNames(articleNames)
+	var articleListItems []string
+	linkedFiles := map[string]bool{}
+	for i, articleFile := range articleFiles {
+		contentBytes, err := util.CurrentFilesystem.ReadFile(articleFile)
+		if err != nil {
+			return errors.Wrapf(err, "Error reading HTML file '%s'", articleFile)
+		}
+		content := string(contentBytes)
+
+		for _, match := range htmlSiteLocalFileLinkRegex.FindAllStringSubmatch(content, -1) {
+			linkedFiles[match[1]] = true
+		}
+
+		// The stylesheet in the cached HTML is relative to the cache dir, which doesn't work within the website.
+		content = htmlSiteStylesheetRegex.ReplaceAllLiteralString(content, stylesheetLink)
+		bodyStart := htmlSiteBodyStartRegex.FindString(content)
+		content = strings.Replace(content, bodyStart, bodyStart+"\n"+fmt.Sprintf(HTML_SITE_NAVIGATION_TEMPLATE, html.EscapeString(title)), 1)
+
+		pageFileName := pageFileNames[normalizeArticleName(articleNames[i])]
+		err = writeFileContent(filepath.Join(outputFolder, pageFileName), strings.NewReader(content))
+		if err != nil {
+			return err
+		}
+
+		articleListItems = append(articleListItems, fmt.Sprintf(HTML_SITE_INDEX_ARTICLE_TEMPLATE, url.PathEscape(pageFileName), html.EscapeString(articleNames[i])))
+	}
+
+	for linkedFile := range linkedFiles {
+		err = exportCacheFile(unescapePathComponents(linkedFile), outputFolder)
+		if err != nil {
+			return err
+		}
+	}
+
+	var metadataElements []string
+	if config.Current.CoverImage != "" {
+		coverFileName := HTML_SITE_COVER_FILE_NAME + filepath.Ext(config.Current.CoverImage)
+		err = exportFile(config.Current.CoverImage, filepath.Join(outputFolder, coverFileName))
+		if err != nil {
+			return err
+		}
+		metadataElements = append(metadataElements, fmt.Sprintf(HTML_SITE_INDEX_COVER_TEMPLATE, coverFileName))
+	}
+	for _, metadataItem := range [][]string{{"author", metadata.Author}, {"date", metadata.Date}, {"license", metadata.License}} {
+		if metadataItem[1] != "" {
+			metadataElements = append(metadataElements, fmt.Sprintf(HTML_SITE_INDEX_METADATA_TEMPLATE, metadataItem[0], html.EscapeString(metadataItem[1])))
+		}
+	}
+
+	indexContent := strings.NewReplacer(
+		"{{LANGUAGE}}", html.EscapeString(metadata.Language),
+		"{{TITLE}}", html.EscapeString(title),
+		"{{STYLESHEET}}", stylesheetLink,
+		"{{METADATA}}", strings.Join(metadataElements, "\n"),
+		"{{ARTICLES}}", strings.Join(articleListItems, "\n"),
+	).Replace(HTML_SITE_INDEX_TEMPLATE)
+
+	return writeFileContent(filepath.Join(outputFolder, HTML_SITE_INDEX_FILE_NAME), strings.NewReader(indexContent))
+}
+
+func exportFile(sourceFile string, outputFile string) error {
+	sourceReader, err := os.Open(sourceFile)
+	if err != nil {
+		return errors.Wrapf(err, "Error opening file '%s'", sourceFile)
+	}
+	defer sourceReader.Close()
+
+	return writeFileContent(outputFile, sourceReader)
+}
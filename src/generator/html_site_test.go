@@ -0,0 +1,170 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/test"
+	"wiki2book/util"
+)
+
+func TestNewHtmlSiteLinkTargets(t *testing.T) {
+	linkTargets := NewHtmlSiteLinkTargets([]string{"foo bar", "AC/DC"})
+
+	href, found := linkTargets.Href("Foo_bar", "")
+	test.AssertTrue(t, found)
+	test.AssertEqual(t, "Foo%20bar.html", href)
+
+	href, found = linkTargets.Href("AC/DC", "Some section")
+	test.AssertTrue(t, found)
+	test.AssertEqual(t, "AC%252FDC.html#article-AC-DC--Some-section", href)
+
+	_, found = linkTargets.Href("Other", "")
+	test.AssertFalse(t, found)
+}
+
+func TestNewHtmlSiteLinkTargets_collidingFileNames(t *testing.T) {
+	linkTargets := NewHtmlSiteLinkTargets([]string{"Foo", "FOO", "Index", "foo", "FOO-2"})
+
+	href, _ := linkTargets.Href("Foo", "")
+	test.AssertEqual(t, "Foo.html", href)
+	href, _ = linkTargets.Href("FOO", "")
+	test.AssertEqual(t, "FOO-2.html", href)
+	href, _ = linkTargets.Href("Index", "")
+	test.AssertEqual(t, "Index-2.html", href)
+	href, _ = linkTargets.Href("FOO-2", "")
+	test.AssertEqual(t, "FOO-2-2.html", href)
+}
+
+func TestGenerateHtmlSite(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	config.Current.StyleFile = filepath.Join(config.Current.CacheDir, "my-style.css")
+	test.AssertNil(t, os.WriteFile(config.Current.StyleFile, []byte("body {}"), 0644))
+
+	htmlCacheDir := cache.GetDirPathInCache(cache.HtmlCacheDirName)
+	imageCacheDir := cache.GetDirPathInCache(cache.ImageCacheDirName)
+	test.AssertNil(t, os.MkdirAll(htmlCacheDir, os.ModePerm))
+	test.AssertNil(t, os.MkdirAll(imageCacheDir, os.ModePerm))
+	test.AssertNil(t, os.WriteFile(filepath.Join(imageCacheDir, "foo bar.png"), []byte("image"), 0644))
+
+	articleA := filepath.Join(htmlCacheDir, "Article A.html")
+	articleB := filepath.Join(htmlCacheDir, "B.html")
+	header := strings.ReplaceAll(HEADER, "{{STYLE}}", "my-style.css")
+	test.AssertNil(t, os.WriteFile(articleA, []byte(header+`<h1>Article A</h1>
+<img alt="image" src="./images/foo+bar.png" ><a href="B.html">B</a>`+FOOTER), 0644))
+	test.AssertNil(t, os.WriteFile(articleB, []byte(header+"<h1>B</h1>"+FOOTER), 0644))
+
+	outputFolder := t.TempDir()
+	metadata := config.Metadata{
+		Title:    "My <site>",
+		Language: "en",
+		Author:   "Foo",
+	}
+
+	// Act
+	err := GenerateHtmlSite([]string{"Article A", "B"}, []string{articleA, articleB}, outputFolder, metadata)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, HTML_SITE_STYLE_FILE_NAME)))
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, "images", "foo bar.png")))
+
+	indexContent, err := os.ReadFile(filepath.Join(outputFolder, HTML_SITE_INDEX_FILE_NAME))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>My &lt;site&gt;</title>
+<link rel="stylesheet" href="style.css">
+</head>
+<body>
+<h1>My &lt;site&gt;</h1>
+<p class="author">Foo</p>
+<ol class="toc">
+<li><a href="Article%20A.html">Article A</a></li>
+<li><a href="B.html">B</a></li>
+</ol>
+</body>
+</html>
+`, string(indexContent))
+
+	pageContent, err := os.ReadFile(filepath.Join(outputFolder, "Article A.html"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<meta charset="utf-8">
+<link rel="stylesheet" href="style.css">
+</head>
+<body xmlns:epub="http://www.idpf.org/2007/ops">
+<div class="navigation"><a href="index.html">My &lt;site&gt;</a></div>
+<h1>Article A</h1>
+<img alt="image" src="./images/foo+bar.png" ><a href="B.html">B</a>
+</body>
+</html>
+`, string(pageContent))
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, "B.html")))
+}
+
+func TestGenerateHtmlSite_withoutStyleFile(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	config.Current.StyleFile = ""
+
+	htmlCacheDir := cache.GetDirPathInCache(cache.HtmlCacheDirName)
+	test.AssertNil(t, os.MkdirAll(htmlCacheDir, os.ModePerm))
+
+	articleA := filepath.Join(htmlCacheDir, "A.html")
+	header := strings.ReplaceAll(HEADER, "{{STYLE}}", "")
+	test.AssertNil(t, os.WriteFile(articleA, []byte(header+"<h1>A</h1>"+FOOTER), 0644))
+
+	outputFolder := t.TempDir()
+
+	// Act
+	err := GenerateHtmlSite([]string{"A"}, []string{articleA}, outputFolder, config.Metadata{Title: "My site", Language: "en"})
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, util.PathExists(filepath.Join(outputFolder, HTML_SITE_STYLE_FILE_NAME)))
+
+	indexContent, err := os.ReadFile(filepath.Join(outputFolder, HTML_SITE_INDEX_FILE_NAME))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>My site</title>
+</head>
+<body>
+<h1>My site</h1>
+
+<ol class="toc">
+<li><a href="A.html">A</a></li>
+</ol>
+</body>
+</html>
+`, string(indexContent))
+
+	pageContent, err := os.ReadFile(filepath.Join(outputFolder, "A.html"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<meta charset="utf-8">
+</head>
+<body xmlns:epub="http://www.idpf.org/2007/ops">
+<div class="navigation"><a href="index.html">My site</a></div>
+<h1>A</h1>
+</body>
+</html>
+`, string(pageContent))
+}
@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"os"
 	"testing"
 	"wiki2book/cache"
 	"wiki2book/config"
@@ -96,6 +97,46 @@ some <b>caption</b>
 	test.AssertEqual(t, result, actualResult)
 }
 
+func TestExpandImage_withCredits(t *testing.T) {
+	config.Current.ImageCredits = true
+	config.Current.ImageCreditTemplates = map[string]string{
+		config.ImageCreditTemplateDefaultKey: "Image: {{AUTHOR}} ({{LICENSE}})",
+		"Public domain":                      "",
+	}
+	defer func() {
+		config.Current.ImageCredits = false
+		config.Current.ImageCreditTemplates = config.NewDefaultConfig().ImageCreditTemplates
+	}()
+
+	wikipediaService := wikipedia.NewMockWikipediaService()
+	wikipediaService.GetImageMetadataFunc = func(image string) (*wikipedia.ImageMetadata, error) {
+		if image == "File:public.jpg" {
+			return &wikipedia.ImageMetadata{Title: image, Author: "Bob", License: wikipedia.License{Name: "Public domain"}}, nil
+		}
+		return &wikipedia.ImageMetadata{Title: image, Author: "Alice & Bob", License: wikipedia.License{Name: "CC BY-SA 4.0"}}, nil
+	}
+	htmlGenerator := &HtmlGenerator{WikipediaService: wikipediaService}
+
+	result, err := htmlGenerator.expandImage(parser.ImageToken{Filename: "image.jpg", Caption: parser.CaptionToken{Content: "some caption"}, SizeX: -1, SizeY: -1})
+	publicDomainResult, publicDomainErr := htmlGenerator.expandImage(parser.ImageToken{Filename: "public.jpg", Caption: parser.CaptionToken{Content: "some caption"}, SizeX: -1, SizeY: -1})
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<div class="figure">
+<img alt="image" src="./images/image.jpg" >
+<div class="caption">
+some caption
+<div class="image-credits">Image: Alice &amp; Bob (CC BY-SA 4.0)</div>
+</div>
+</div>`, result)
+	test.AssertNil(t, publicDomainErr)
+	test.AssertEqual(t, `<div class="figure">
+<img alt="image" src="./images/public.jpg" >
+<div class="caption">
+some caption
+</div>
+</div>`, publicDomainResult)
+}
+
 func TestExpandImage_usePngFileForPdf(t *testing.T) {
 	config.Current.CommandTemplatePdfToPng = "some-command"
 
@@ -293,6 +334,172 @@ func TestExpandInternalLink(t *testing.T) {
 	test.AssertEqual(t, "b<b>a</b>r", link)
 }
 
+func TestExpandInternalLink_withLinkTargets(t *testing.T) {
+	htmlGenerator := &HtmlGenerator{
+		InternalLinkTargets: InternalLinkTargets{},
+	}
+	htmlGenerator.InternalLinkTargets.Add("Foo bar", "")
+
+	link, err := expand(htmlGenerator, parser.InternalLinkToken{ArticleName: "foo_bar", LinkText: "b" + parser.MARKER_BOLD_OPEN + "a" + parser.MARKER_BOLD_CLOSE + "r"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<a href="#article-Foo-bar">b<b>a</b>r</a>`, link)
+
+	link, err = expand(htmlGenerator, parser.InternalLinkToken{ArticleName: "Foo bar", Section: "Some_section", LinkText: "text"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `<a href="#article-Foo-bar--Some-section">text</a>`, link)
+
+	link, err = expand(htmlGenerator, parser.InternalLinkToken{ArticleName: "Other article", LinkText: "text"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "text", link)
+}
+
+func TestGenerate_withLinkToRedirect(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	tokenLink := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_INTERNAL_LINK, 0)
+	tokenOtherLink := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_INTERNAL_LINK, 1)
+	articleSource := wikipedia.NewMockArticleSource()
+	var resolvedTitles []string
+	articleSource.ResolveRedirectsFunc = func(titles []string) (map[string]string, error) {
+		resolvedTitles = titles
+		return map[string]string{"Sun": "Sonne"}, nil
+	}
+	htmlGenerator := &HtmlGenerator{
+		TokenMap: map[string]parser.Token{
+			tokenLink:      parser.InternalLinkToken{ArticleName: "Sun", LinkText: "sun"},
+			tokenOtherLink: parser.InternalLinkToken{ArticleName: "Sonne", LinkText: "sonne"},
+		},
+		WikipediaService:    wikipedia.NewMockWikipediaService(),
+		ArticleSource:       articleSource,
+		InternalLinkTargets: NewEpubLinkTargets([]string{"Erde", "Sonne"}),
+	}
+	article := &parser.Article{
+		Title:   "Erde",
+		Content: tokenLink + " " + tokenOtherLink,
+	}
+
+	htmlFile, err := htmlGenerator.Generate(article)
+	test.AssertNil(t, err)
+
+	test.AssertEqual(t, []string{"Sun"}, resolvedTitles)
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<a href="#article-Sonne">sun</a> <a href="#article-Sonne">sonne</a>`, string(content))
+}
+
+func TestGenerate_withLinkTargets(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	tokenHeading := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_HEADING, 0)
+	tokenHeadingDuplicate := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_HEADING, 1)
+	tokenLink := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_INTERNAL_LINK, 2)
+	htmlGenerator := &HtmlGenerator{
+		TokenMap: map[string]parser.Token{
+			tokenHeading:          parser.HeadingToken{Content: "Some " + parser.MARKER_BOLD_OPEN + "section" + parser.MARKER_BOLD_CLOSE, Depth: 2},
+			tokenHeadingDuplicate: parser.HeadingToken{Content: "Some section", Depth: 3},
+			tokenLink:             parser.InternalLinkToken{ArticleName: "", Section: "Some section", LinkText: "link"},
+		},
+		InternalLinkTargets: NewEpubLinkTargets([]string{"Foo"}),
+	}
+	article := &parser.Article{
+		Title:   "Foo",
+		Content: tokenHeading + tokenHeadingDuplicate + tokenLink,
+	}
+
+	htmlFile, err := htmlGenerator.Generate(article)
+	test.AssertNil(t, err)
+
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<h1 id="article-Foo">Foo</h1>
+<h2 id="article-Foo--Some-section">Some <b>section</b></h2><h3 id="article-Foo--Some-section-2">Some section</h3><a href="#article-Foo--Some-section">link</a>`, string(content))
+}
+
+func TestGenerate_withLinkTargetsAndEscapedHeading(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	tokenHeading := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_HEADING, 0)
+	tokenLink := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_INTERNAL_LINK, 1)
+	htmlGenerator := &HtmlGenerator{
+		TokenMap: map[string]parser.Token{
+			tokenHeading: parser.HeadingToken{Content: "Tom &amp; Jerry", Depth: 2},
+			tokenLink:    parser.InternalLinkToken{ArticleName: "", Section: "Tom & Jerry", LinkText: "link"},
+		},
+		InternalLinkTargets: NewEpubLinkTargets([]string{"Foo"}),
+	}
+	article := &parser.Article{
+		Title:   "Foo",
+		Content: tokenHeading + tokenLink,
+	}
+
+	htmlFile, err := htmlGenerator.Generate(article)
+	test.AssertNil(t, err)
+
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<h2 id="article-Foo--Tom-Jerry">Tom &amp; Jerry</h2><a href="#article-Foo--Tom-Jerry">link</a>`, string(content))
+}
+
+func TestGenerate_withHeadingOffset(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	tokenHeading := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_HEADING, 0)
+	tokenDeepHeading := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_HEADING, 1)
+	htmlGenerator := &HtmlGenerator{
+		TokenMap: map[string]parser.Token{
+			tokenHeading:     parser.HeadingToken{Content: "Section", Depth: 2},
+			tokenDeepHeading: parser.HeadingToken{Content: "Deep section", Depth: 5},
+		},
+		HeadingOffset: 2,
+	}
+	article := &parser.Article{
+		Title:   "Foo",
+		Content: tokenHeading + tokenDeepHeading,
+	}
+
+	htmlFile, err := htmlGenerator.Generate(article)
+	test.AssertNil(t, err)
+
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<h3>Foo</h3>
+<h4>Section</h4><h6>Deep section</h6>`, string(content))
+}
+
+func TestGenerateStructurePage(t *testing.T) {
+	config.Current.CacheDir = t.TempDir()
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	htmlGenerator := &HtmlGenerator{
+		TokenMap:            map[string]parser.Token{},
+		InternalLinkTargets: NewEpubLinkTargets([]string{"Foo"}),
+		HeadingOffset:       1,
+	}
+	intro := &parser.Article{
+		Title:   "Inner planets",
+		Content: "Some intro",
+	}
+
+	htmlFile, err := htmlGenerator.GenerateStructurePage("structure-page-1", "Inner planets", intro)
+	emptyHtmlFile, emptyErr := htmlGenerator.GenerateStructurePage("structure-page-2", "Outer planets", nil)
+
+	test.AssertNil(t, err)
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<h2 id="structure-structure-page-1">Inner planets</h2>
+Some intro`, string(content))
+
+	test.AssertNil(t, emptyErr)
+	content, err = os.ReadFile(emptyHtmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `<h2 id="structure-structure-page-2">Outer planets</h2>
+\s*</body>`, string(content))
+}
+
 func TestExpandExternalLink(t *testing.T) {
 	tokenLink := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_EXTERNAL_LINK, 0)
 	url := "https://foo.com"
@@ -0,0 +1,55 @@
+package generator
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const kindleIntermediateEpubFileName = "kindle-intermediate.epub"
+
+// GenerateKindle creates an AZW3 (KF8) file for Kindle devices. This is done by first creating an EPUB2 file, which
+// contains the metadata and the NCX navigation, and then converting it using the configured command, which is
+// "ebook-convert" of calibre by default.
+func GenerateKindle(articleFiles []string, outputFile string, metadata config.Metadata) error {
+	sigolo.Debugf("Generate Kindle file to '%s' for articles %v", outputFile, articleFiles)
+
+	if config.Current.OutputType != config.OutputTypeAzw3 {
+		return errors.Errorf("Output type '%s' does not support Kindle generation. This is a Bug.", config.Current.OutputType)
+	}
+
+	intermediateEpubFile := filepath.Join(cache.GetTempPath(), kindleIntermediateEpubFileName)
+	err := generateEpubOfType(articleFiles, intermediateEpubFile, metadata, config.OutputTypeEpub2)
+	if err != nil {
+		return errors.Wrapf(err, "Error generating intermediate EPUB file '%s' for Kindle file", intermediateEpubFile)
+	}
+
+	sigolo.Debugf("Convert intermediate EPUB file '%s' into Kindle file '%s'", intermediateEpubFile, outputFile)
+	command := getEpubToKindleCommand(intermediateEpubFile, outputFile)
+	if len(command) == 0 {
+		return errors.New("The command template to convert EPUB into Kindle files is empty")
+	}
+	err = util.Execute(command[0], config.Current.CacheDir, command[1:]...)
+	if errors.Is(err, exec.ErrNotFound) {
+		return errors.Wrapf(err, "Command '%s' not found. The default command is part of calibre, install it or configure another command to convert EPUB into Kindle files", command[0])
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error converting EPUB file '%s' into Kindle file '%s'", intermediateEpubFile, outputFile))
+	}
+
+	return nil
+}
+
+// getEpubToKindleCommand returns the executable and arguments of the configured conversion command.
+func getEpubToKindleCommand(epubFile string, kindleFile string) []string {
+	return util.FillCommandTemplate(config.Current.CommandTemplateEpubToKindle, map[string]string{
+		config.InputPlaceholder:  epubFile,
+		config.OutputPlaceholder: kindleFile,
+	})
+}
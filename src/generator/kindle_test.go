@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"testing"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+func TestGetEpubToKindleCommand(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	config.Current.CommandTemplateEpubToKindle = "convert -i " + config.InputPlaceholder + " -o " + config.OutputPlaceholder + " --foo"
+
+	// Act
+	command := getEpubToKindleCommand("/tmp/my book.epub", "/out/book.azw3")
+
+	// Assert
+	test.AssertEqual(t, []string{"convert", "-i", "/tmp/my book.epub", "-o", "/out/book.azw3", "--foo"}, command)
+}
+
+func TestGetEpubToKindleCommand_placeholderInPath(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	config.Current.CommandTemplateEpubToKindle = "convert " + config.InputPlaceholder + " " + config.OutputPlaceholder
+
+	// Act
+	command := getEpubToKindleCommand("/tmp/"+config.OutputPlaceholder+".epub", "/out/"+config.InputPlaceholder+".azw3")
+
+	// Assert
+	test.AssertEqual(t, []string{"convert", "/tmp/" + config.OutputPlaceholder + ".epub", "/out/" + config.InputPlaceholder + ".azw3"}, command)
+}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"wiki2book/util"
+)
+
+const (
+	articleAnchorPrefix       = "article-"
+	structurePageAnchorPrefix = "structure-"
+)
+
+var anchorInvalidCharsRegex = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// internalLinkTarget is the location of an article within the output. The file is empty when all articles end up in
+// the same document, which is e.g. the case for pandoc, which merges all HTML files before splitting them into
+// chapters.
+type internalLinkTarget struct {
+	file   string
+	anchor string
+}
+
+// InternalLinkTargets maps article names to their location within the output. The article names are normalized, so
+// that e.g. "foo_bar" and "Foo bar" refer to the same article, just like in MediaWiki.
+type InternalLinkTargets map[string]internalLinkTarget
+
+// NewEpubLinkTargets creates the link targets for the given articles, which all end up in the same eBook.
+func NewEpubLinkTargets(articleNames []string) InternalLinkTargets {
+	linkTargets := InternalLinkTargets{}
+	for _, articleName := range articleNames {
+		linkTargets.Add(articleName, "")
+	}
+	return linkTargets
+}
+
+// Add adds the article, which is located in the given file. An empty file means the article is part of the current
+// document.
+func (t InternalLinkTargets) Add(articleName string, file string) {
+	t[normalizeArticleName(articleName)] = internalLinkTarget{
+		file:   file,
+		anchor: articleAnchor(articleName),
+	}
+}
+
+// WithRedirects returns a copy of these link targets, which additionally contains the given redirects. The map
+// contains the redirect source as key and the redirect target as value. Both directions are considered: A redirect to
+// an article of the output as well as the actual article of a redirect, which is part of the output, become link
+// targets.
+func (t InternalLinkTargets) WithRedirects(redirects map[string]string) InternalLinkTargets {
+	result := InternalLinkTargets{}
+	for articleName, target := range t {
+		result[articleName] = target
+	}
+
+	for redirectSource, redirectTarget := range redirects {
+		normalizedSource := normalizeArticleName(redirectSource)
+		normalizedTarget := normalizeArticleName(redirectTarget)
+
+		if target, isTargetPartOfOutput := t[normalizedTarget]; isTargetPartOfOutput && !result.Contains(normalizedSource) {
+			result[normalizedSource] = target
+		} else if source, isSourcePartOfOutput := t[normalizedSource]; isSourcePartOfOutput && !result.Contains(normalizedTarget) {
+			result[normalizedTarget] = source
+		}
+	}
+
+	return result
+}
+
+// Hash returns a hash of all link targets. It changes whenever an article is added, removed or moved to a different
+// file, which changes the links of all articles.
+func (t InternalLinkTargets) Hash() string {
+	var targets []string
+	for articleName, target := range t {
+		targets = append(targets, articleName+"|"+target.file+"|"+target.anchor)
+	}
+	sort.Strings(targets)
+	return util.Hash(strings.Join(targets, "\n"))
+}
+
+// Contains returns true when the given article is part of the output.
+func (t InternalLinkTargets) Contains(articleName string) bool {
+	_, found := t[normalizeArticleName(articleName)]
+	return found
+}
+
+// Href returns the href to the given article and optionally to the given section within that article. The boolean is
+// false when the article is not part of the output.
+func (t InternalLinkTargets) Href(articleName string, section string) (string, bool) {
+	target, found := t[normalizeArticleName(articleName)]
+	if !found {
+		return "", false
+	}
+
+	if section != "" {
+		return target.file + "#" + sectionAnchor(target.anchor, section), true
+	}
+	if target.file != "" {
+		return target.file, true
+	}
+	return "#" + target.anchor, true
+}
+
+// normalizeArticleName turns the article name into the form MediaWiki uses for titles: Underscores are spaces, no
+// surrounding or repeated whitespace and the first character is always upper case.
+func normalizeArticleName(articleName string) string {
+	articleName = strings.ReplaceAll(articleName, "_", " ")
+	articleName = strings.Join(strings.Fields(articleName), " ")
+	if articleName == "" {
+		return articleName
+	}
+
+	firstRune, size := utf8.DecodeRuneInString(articleName)
+	return string(unicode.ToUpper(firstRune)) + articleName[size:]
+}
+
+// articleAnchor returns the ID of the first heading of the given article. The ID is unique within the whole output,
+// because pandoc merges all articles into one document.
+func articleAnchor(articleName string) string {
+	return articleAnchorPrefix + toAnchor(normalizeArticleName(articleName))
+}
+
+// structurePageAnchor returns the ID of the title of the part or chapter page with the given file name.
+func structurePageAnchor(fileName string) string {
+	return structurePageAnchorPrefix + toAnchor(fileName)
+}
+
+// sectionAnchor returns the ID of the heading of the given section within the article with the given anchor.
+func sectionAnchor(articleAnchor string, section string) string {
+	return articleAnchor + "--" + toAnchor(strings.ReplaceAll(section, "_", " "))
+}
+
+// toAnchor turns the given text into a string only consisting of letters, numbers and "-", which is a valid part of
+// an XML ID.
+func toAnchor(text string) string {
+	return strings.Trim(anchorInvalidCharsRegex.ReplaceAllString(text, "-"), "-")
+}
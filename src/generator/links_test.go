@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"testing"
+	"wiki2book/test"
+)
+
+func TestNormalizeArticleName(t *testing.T) {
+	test.AssertEqual(t, "Foo bar", normalizeArticleName("Foo bar"))
+	test.AssertEqual(t, "Foo bar", normalizeArticleName("foo_bar"))
+	test.AssertEqual(t, "Foo bar", normalizeArticleName("  foo  _bar "))
+	test.AssertEqual(t, "Ärger", normalizeArticleName("ärger"))
+	test.AssertEqual(t, "", normalizeArticleName(""))
+}
+
+func TestInternalLinkTargets_href(t *testing.T) {
+	linkTargets := NewEpubLinkTargets([]string{"Sonne", "erde_(Planet)"})
+
+	href, found := linkTargets.Href("sonne", "")
+	test.AssertTrue(t, found)
+	test.AssertEqual(t, "#article-Sonne", href)
+
+	href, found = linkTargets.Href("Erde (Planet)", "Aufbau_und Struktur")
+	test.AssertTrue(t, found)
+	test.AssertEqual(t, "#article-Erde-Planet--Aufbau-und-Struktur", href)
+
+	_, found = linkTargets.Href("Mond", "")
+	test.AssertFalse(t, found)
+}
+
+func TestInternalLinkTargets_withRedirects(t *testing.T) {
+	linkTargets := NewEpubLinkTargets([]string{"Sonne", "Erdball"})
+
+	result := linkTargets.WithRedirects(map[string]string{
+		"Sun":     "Sonne",
+		"Erdball": "Erde",
+		"Moon":    "Mond",
+	})
+
+	href, found := result.Href("Sun", "")
+	test.AssertTrue(t, found)
+	test.AssertEqual(t, "#article-Sonne", href)
+
+	href, found = result.Href("Erde", "")
+	test.AssertTrue(t, found)
+	test.AssertEqual(t, "#article-Erdball", href)
+
+	test.AssertFalse(t, result.Contains("Moon"))
+	test.AssertFalse(t, result.Contains("Mond"))
+
+	// The original link targets must not be changed
+	test.AssertFalse(t, linkTargets.Contains("Sun"))
+}
+
+func TestInternalLinkTargets_hash(t *testing.T) {
+	linkTargets := NewEpubLinkTargets([]string{"Sonne", "Erde"})
+	sameLinkTargets := NewEpubLinkTargets([]string{"Erde", "sonne"})
+	otherLinkTargets := NewHtmlSiteLinkTargets([]string{"Sonne", "Erde"})
+
+	test.AssertEqual(t, linkTargets.Hash(), sameLinkTargets.Hash())
+	test.AssertTrue(t, linkTargets.Hash() != otherLinkTargets.Hash())
+}
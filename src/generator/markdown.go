@@ -0,0 +1,485 @@
+package generator
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/parser"
+	"wiki2book/util"
+	"wiki2book/wikipedia"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const MARKDOWN_HEADING_TEMPLATE = "\n\n%s %s\n\n"
+const MARKDOWN_IMAGE_INLINE_TEMPLATE = "![image](%s)"
+const MARKDOWN_IMAGE_TEMPLATE = "\n\n![image](%s)\n\n"
+const MARKDOWN_IMAGE_WITH_CAPTION_TEMPLATE = "\n\n![image](%s)\\\n%s\n\n"
+const MARKDOWN_MATH_TEMPLATE = "![%s](%s)"
+const MARKDOWN_LINK_TEMPLATE = "[%s](%s)"
+const MARKDOWN_AUTOLINK_TEMPLATE = "<%s>"
+const MARKDOWN_REF_DEF_TEMPLATE = "[^%s]: %s"
+const MARKDOWN_REF_USAGE_TEMPLATE = "[^%s]"
+const MARKDOWN_TABLE_CELL_SEPARATOR = " | "
+const MARKDOWN_TABLE_DELIMITER_CELL = "---"
+
+// The markers are replaced by these placeholders, because the text around them is escaped afterward, which would also
+// escape the Markdown emphasis characters.
+const (
+	markdownBoldPlaceholder   = "\uE000"
+	markdownItalicPlaceholder = "\uE001"
+)
+
+var (
+	markdownSpecialCharReplacer = strings.NewReplacer(
+		`\`, `\\`,
+		"`", "\\`",
+		`*`, `\*`,
+		`_`, `\_`,
+		`[`, `\[`,
+		`]`, `\]`,
+	)
+	markdownAltTextReplacer = strings.NewReplacer(
+		`\`, `\\`,
+		`[`, `\[`,
+		`]`, `\]`,
+	)
+	markdownMultipleNewlinesRegex = regexp.MustCompile(`\n{3,}`)
+	markdownFootnoteLabelRegex    = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+	markdownLocalFileLinkRegex    = regexp.MustCompile(`\]\(((?:` + cache.ImageCacheDirName + `|` + cache.MathCacheDirName + `)/[^)\s]+)\)`)
+)
+
+type MarkdownGenerator struct {
+	tokenMap         map[string]parser.Token
+	wikipediaService wikipedia.WikipediaService
+	footnotePrefix   string
+}
+
+func NewMarkdownGenerator(tokenMap map[string]parser.Token, wikipediaService wikipedia.WikipediaService) *MarkdownGenerator {
+	return &MarkdownGenerator{
+		tokenMap:         tokenMap,
+		wikipediaService: wikipediaService,
+	}
+}
+
+// Generate creates the Markdown for the given article and returns either the Markdown file path or an error. Images
+// are linked relative to the cache directory, so that they can be exported next to the final Markdown file(s).
+func (g *MarkdownGenerator) Generate(wikiArticle *parser.Article) (string, error) {
+	// Footnote labels must be unique in the final document, which might consist of several articles.
+	g.footnotePrefix = strings.Trim(markdownFootnoteLabelRegex.ReplaceAllString(wikiArticle.Title, "-"), "-")
+
+	expandedContent, err := expand(g, wikiArticle.Content)
+	if err != nil {
+		return "", err
+	}
+
+	content := fmt.Sprintf(MARKDOWN_HEADING_TEMPLATE, "#", g.expandSimpleString(wikiArticle.Title))
+	content += expandedContent
+	content = cleanUpMarkdown(content)
+
+	outputFilepath, err := cache.CacheToFile(cache.MarkdownCacheDirName, wikiArticle.Title+".md", strings.NewReader(content))
+	if err != nil {
+		return "", errors.Wrapf(err, "Error writing Markdown of article '%s' to cache-file '%s'", wikiArticle.Title, outputFilepath)
+	}
+
+	return outputFilepath, nil
+}
+
+func cleanUpMarkdown(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	content = strings.Join(lines, "\n")
+	content = markdownMultipleNewlinesRegex.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content) + "\n"
+}
+
+func (g *MarkdownGenerator) getToken(tokenKey string) (parser.Token, bool) {
+	token, hasToken := g.tokenMap[tokenKey]
+	return token, hasToken
+}
+
+func (g *MarkdownGenerator) expandSimpleString(content string) string {
+	content = markdownSpecialCharReplacer.Replace(content)
+	content = strings.ReplaceAll(content, markdownBoldPlaceholder, "**")
+	content = strings.ReplaceAll(content, markdownItalicPlaceholder, "*")
+	return content
+}
+
+func (g *MarkdownGenerator) expandMarker(content string) string {
+	content = strings.ReplaceAll(content, parser.MARKER_BOLD_OPEN, markdownBoldPlaceholder)
+	content = strings.ReplaceAll(content, parser.MARKER_BOLD_CLOSE, markdownBoldPlaceholder)
+	content = strings.ReplaceAll(content, parser.MARKER_ITALIC_OPEN, markdownItalicPlaceholder)
+	content = strings.ReplaceAll(content, parser.MARKER_ITALIC_CLOSE, markdownItalicPlaceholder)
+	content = strings.ReplaceAll(content, parser.MARKER_PARAGRAPH, "\n\n")
+	return content
+}
+
+func (g *MarkdownGenerator) expandHeadings(token parser.HeadingToken) (string, error) {
+	expandedHeadingText, err := expand(g, token.Content)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(MARKDOWN_HEADING_TEMPLATE, strings.Repeat("#", token.Depth), toSingleLine(expandedHeadingText)), nil
+}
+
+func (g *MarkdownGenerator) expandInlineImage(token parser.InlineImageToken) (string, error) {
+	return fmt.Sprintf(MARKDOWN_IMAGE_INLINE_TEMPLATE, escapeUrlPathComponents(filenameToImagePath(token.Filename))), nil
+}
+
+func (g *MarkdownGenerator) expandImage(token parser.ImageToken) (string, error) {
+	caption, err := expand(g, token.Caption.Content)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Error while expanding caption of image %#v", token))
+	}
+
+	imagePath := escapeUrlPathComponents(filenameToImagePath(token.Filename))
+
+	caption = toSingleLine(caption)
+	if caption == "" {
+		return fmt.Sprintf(MARKDOWN_IMAGE_TEMPLATE, imagePath), nil
+	}
+	return fmt.Sprintf(MARKDOWN_IMAGE_WITH_CAPTION_TEMPLATE, imagePath, caption), nil
+}
+
+func (g *MarkdownGenerator) expandInternalLink(token parser.InternalLinkToken) (string, error) {
+	// Same as for the HTML: Links to other articles are not added.
+	return expand(g, token.LinkText)
+}
+
+func (g *MarkdownGenerator) expandExternalLink(token parser.ExternalLinkToken) (string, error) {
+	text, err := expand(g, token.LinkText)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return fmt.Sprintf(MARKDOWN_AUTOLINK_TEMPLATE, token.URL), nil
+	}
+	return fmt.Sprintf(MARKDOWN_LINK_TEMPLATE, toSingleLine(text), token.URL), nil
+}
+
+// expandTable creates a pipe table. Such tables require a header row, so an empty one is added if the first row
+// doesn't contain any heading cells. Attributes like "colspan" are not supported and therefore ignored.
+func (g *MarkdownGenerator) expandTable(token parser.TableToken) (string, error) {
+	numberOfColumns := 0
+	for _, rowToken := range token.Rows {
+		numberOfColumns = max(numberOfColumns, len(rowToken.Columns))
+	}
+	if numberOfColumns == 0 {
+		return "", nil
+	}
+
+	var expandedRows []string
+	for _, rowToken := range token.Rows {
+		expandedRow, err := g.expandTableRow(rowToken)
+		if err != nil {
+			return "", err
+		}
+
+		missingColumns := numberOfColumns - len(rowToken.Columns)
+		expandedRow += strings.Repeat(MARKDOWN_TABLE_CELL_SEPARATOR, missingColumns)
+
+		expandedRows = append(expandedRows, "| "+expandedRow+" |")
+	}
+
+	delimiterRow := "| " + strings.Repeat(MARKDOWN_TABLE_DELIMITER_CELL+MARKDOWN_TABLE_CELL_SEPARATOR, numberOfColumns-1) + MARKDOWN_TABLE_DELIMITER_CELL + " |"
+
+	firstRowIsHeading := false
+	for _, colToken := range token.Rows[0].Columns {
+		firstRowIsHeading = firstRowIsHeading || colToken.IsHeading
+	}
+	if firstRowIsHeading {
+		expandedRows = append([]string{expandedRows[0], delimiterRow}, expandedRows[1:]...)
+	} else {
+		emptyHeadingRow := "| " + strings.Repeat(MARKDOWN_TABLE_CELL_SEPARATOR, numberOfColumns-1) + " |"
+		expandedRows = append([]string{emptyHeadingRow, delimiterRow}, expandedRows...)
+	}
+
+	expandedCaption, err := expand(g, token.Caption)
+	if err != nil {
+		return "", err
+	}
+
+	result := "\n\n" + strings.Join(expandedRows, "\n") + "\n\n"
+	if expandedCaption != "" {
+		result += expandedCaption + "\n\n"
+	}
+	return result, nil
+}
+
+func (g *MarkdownGenerator) expandTableRow(token parser.TableRowToken) (string, error) {
+	var expandedCols []string
+	for _, colToken := range token.Columns {
+		expandedCol, err := expand(g, colToken)
+		if err != nil {
+			return "", err
+		}
+		expandedCols = append(expandedCols, expandedCol)
+	}
+
+	return strings.Join(expandedCols, MARKDOWN_TABLE_CELL_SEPARATOR), nil
+}
+
+func (g *MarkdownGenerator) expandTableColumn(token parser.TableColToken) (string, error) {
+	expandedTokenContent, err := expand(g, token.Content)
+	if err != nil {
+		return "", err
+	}
+
+	// Cells of pipe tables must not span multiple lines and must not contain unescaped pipes.
+	return strings.ReplaceAll(toSingleLine(expandedTokenContent), "|", `\|`), nil
+}
+
+func (g *MarkdownGenerator) expandTableCaption(token parser.TableCaptionToken) (string, error) {
+	expandedTokenContent, err := expand(g, token.Content)
+	if err != nil {
+		return "", err
+	}
+
+	return toSingleLine(expandedTokenContent), nil
+}
+
+func (g *MarkdownGenerator) expandUnorderedList(token parser.UnorderedListToken) (string, error) {
+	var expandedItems []string
+	for _, item := range token.Items {
+		expandedItem, err := g.expandListItem(item)
+		if err != nil {
+			return "", err
+		}
+		expandedItems = append(expandedItems, indentListItem("- ", expandedItem))
+	}
+	return strings.Join(expandedItems, "\n") + "\n\n", nil
+}
+
+func (g *MarkdownGenerator) expandOrderedList(token parser.OrderedListToken) (string, error) {
+	var expandedItems []string
+	for i, item := range token.Items {
+		expandedItem, err := g.expandListItem(item)
+		if err != nil {
+			return "", err
+		}
+		expandedItems = append(expandedItems, indentListItem(fmt.Sprintf("%d. ", i+1), expandedItem))
+	}
+	return strings.Join(expandedItems, "\n") + "\n\n", nil
+}
+
+func (g *MarkdownGenerator) expandDescriptionList(token parser.DescriptionListToken) (string, error) {
+	// CommonMark has no description lists, so each item becomes its own paragraph.
+	expandedItems, err := g.expandListItems(token.Items)
+	if err != nil {
+		return "", err
+	}
+	return "\n\n" + expandedItems + "\n\n", nil
+}
+
+func (g *MarkdownGenerator) expandListItems(items []parser.ListItemToken) (string, error) {
+	var expandedItems []string
+
+	for _, item := range items {
+		expandedItem, err := g.expandListItem(item)
+		if err != nil {
+			return "", err
+		}
+
+		expandedItems = append(expandedItems, expandedItem)
+	}
+
+	return strings.Join(expandedItems, "\n\n"), nil
+}
+
+func (g *MarkdownGenerator) expandListItem(token parser.ListItemToken) (string, error) {
+	listItemContent, err := expand(g, token.Content)
+	if err != nil {
+		return "", err
+	}
+	listItemContent = strings.TrimSpace(listItemContent)
+
+	if token.Type == parser.DESCRIPTION_HEAD {
+		listItemContent = "**" + listItemContent + "**"
+	} else if token.Type != parser.NORMAL_ITEM && token.Type != parser.DESCRIPTION_ITEM {
+		return "", errors.Errorf("Unknown list item type '%d'", token.Type)
+	}
+
+	listItemContents := []string{listItemContent}
+	for _, subListToken := range token.SubLists {
+		expandedSubList, err := expand(g, subListToken)
+		if err != nil {
+			return "", err
+		}
+		listItemContents = append(listItemContents, strings.Trim(expandedSubList, "\n"))
+	}
+
+	return strings.Join(listItemContents, "\n"), nil
+}
+
+// indentListItem adds the list marker to the first line of the item and indents all other lines, so that nested lists
+// and paragraphs belong to this item.
+func indentListItem(marker string, item string) string {
+	indentation := strings.Repeat(" ", len(marker))
+	lines := strings.Split(item, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = marker + line
+		} else if line != "" {
+			lines[i] = indentation + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (g *MarkdownGenerator) expandRefDefinition(token parser.RefDefinitionToken) (string, error) {
+	expandedRefContent, err := expand(g, token.Content)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(MARKDOWN_REF_DEF_TEMPLATE, g.footnoteLabel(token.Index), toSingleLine(expandedRefContent)), nil
+}
+
+func (g *MarkdownGenerator) expandRefUsage(token parser.RefUsageToken) string {
+	return fmt.Sprintf(MARKDOWN_REF_USAGE_TEMPLATE, g.footnoteLabel(token.Index))
+}
+
+func (g *MarkdownGenerator) footnoteLabel(index int) string {
+	if g.footnotePrefix == "" {
+		return fmt.Sprintf("%d", index+1)
+	}
+	return fmt.Sprintf("%s-%d", g.footnotePrefix, index+1)
+}
+
+// expandMath links the rendered PNG of the formula. The alt text contains the original formula, which keeps the
+// information for tools not displaying images.
+func (g *MarkdownGenerator) expandMath(token parser.MathToken) (string, error) {
+	_, pngAbsolutePath, err := g.wikipediaService.RenderMath(token.Content)
+	if err != nil {
+		return "", err
+	}
+
+	pngRelativePath, err := cache.GetPathRelativeToCache(pngAbsolutePath)
+	if err != nil {
+		return "", err
+	}
+
+	altText := markdownAltTextReplacer.Replace(toSingleLine(token.Content))
+	return fmt.Sprintf(MARKDOWN_MATH_TEMPLATE, altText, escapeUrlPathComponents(pngRelativePath)), nil
+}
+
+func (g *MarkdownGenerator) expandNowiki(token parser.NowikiToken) string {
+	return g.expandSimpleString(token.Content)
+}
+
+func toSingleLine(content string) string {
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(content, " "))
+}
+
+func escapeUrlPathComponents(path string) string {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// GenerateMarkdown combines the Markdown files of the articles. When the output path ends with ".md", all articles are
+// concatenated into this file. Otherwise, the output path is a folder and each article is written into its own file.
+// All images and math files linked by the articles are copied next to the Markdown file(s).
+func GenerateMarkdown(articleFiles []string, outputPath string) error {
+	sigolo.Debugf("Generate Markdown to '%s' for articles %v", outputPath, articleFiles)
+
+	outputFolder := outputPath
+	singleFile := strings.HasSuffix(outputPath, util.FileEndingMd)
+	if singleFile {
+		outputFolder = filepath.Dir(outputPath)
+	}
+
+	var combinedContent []string
+	linkedFiles := map[string]bool{}
+	for _, articleFile := range articleFiles {
+		contentBytes, err := util.CurrentFilesystem.ReadFile(articleFile)
+		if err != nil {
+			return errors.Wrapf(err, "Error reading Markdown file '%s'", articleFile)
+		}
+		content := string(contentBytes)
+
+		for _, match := range markdownLocalFileLinkRegex.FindAllStringSubmatch(content, -1) {
+			linkedFiles[match[1]] = true
+		}
+
+		if singleFile {
+			combinedContent = append(combinedContent, strings.TrimSpace(content))
+			continue
+		}
+
+		articleOutputFile := filepath.Join(outputFolder, filepath.Base(articleFile))
+		err = writeFileContent(articleOutputFile, strings.NewReader(content))
+		if err != nil {
+			return err
+		}
+	}
+
+	if singleFile {
+		err := writeFileContent(outputPath, strings.NewReader(strings.Join(combinedContent, "\n\n")+"\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	for linkedFile := range linkedFiles {
+		relativePath, err := url.PathUnescape(linkedFile)
+		if err != nil {
+			return errors.Wrapf(err, "Error unescaping path '%s'", linkedFile)
+		}
+
+		err = exportCacheFile(relativePath, outputFolder)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportCacheFile copies the file with the given path, which is relative to the cache dir, into the same relative
+// location within the output folder.
+func exportCacheFile(relativePath string, outputFolder string) error {
+	sourceFile := filepath.Join(config.Current.CacheDir, relativePath)
+	sourceReader, err := os.Open(sourceFile)
+	if err != nil {
+		// Same as the other output types: Missing files should not prevent the book from being created.
+		sigolo.Warnf("Could not export file '%s': %+v", sourceFile, err)
+		return nil
+	}
+	defer sourceReader.Close()
+
+	return writeFileContent(filepath.Join(outputFolder, relativePath), sourceReader)
+}
+
+func writeFileContent(outputFile string, reader io.Reader) error {
+	// The output files are not within the cache, so they are written without the cache filesystem abstraction.
+	err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm)
+	if err != nil {
+		return errors.Wrapf(err, "Error creating folder for file '%s'", outputFile)
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return errors.Wrapf(err, "Error creating file '%s'", outputFile)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing file '%s'", outputFile)
+	}
+
+	return nil
+}
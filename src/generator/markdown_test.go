@@ -0,0 +1,255 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/parser"
+	"wiki2book/test"
+	"wiki2book/util"
+	"wiki2book/wikipedia"
+)
+
+func newMarkdownGenerator(tokenMap map[string]parser.Token) *MarkdownGenerator {
+	return NewMarkdownGenerator(tokenMap, wikipedia.NewMockWikipediaService())
+}
+
+func TestMarkdownExpandMarkerAndSimpleString(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+
+	result, err := expand(markdownGenerator, "a_b*c "+parser.MARKER_BOLD_OPEN+"bold"+parser.MARKER_BOLD_CLOSE+" "+parser.MARKER_ITALIC_OPEN+"[italic]"+parser.MARKER_ITALIC_CLOSE+parser.MARKER_PARAGRAPH+"next")
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "a\\_b\\*c **bold** *\\[italic\\]*\n\nnext", result)
+}
+
+func TestMarkdownExpandHeadings(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	token := parser.HeadingToken{
+		Content: "foo " + parser.MARKER_BOLD_OPEN + "bar" + parser.MARKER_BOLD_CLOSE,
+		Depth:   3,
+	}
+
+	result, err := expand(markdownGenerator, token)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "\n\n### foo **bar**\n\n", result)
+}
+
+func TestMarkdownExpandImage(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	token := parser.ImageToken{
+		Filename: "File:foo bar.jpg",
+		Caption:  parser.CaptionToken{Content: "some " + parser.MARKER_BOLD_OPEN + "caption" + parser.MARKER_BOLD_CLOSE},
+		SizeX:    10,
+		SizeY:    20,
+	}
+
+	result, err := expand(markdownGenerator, token)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "\n\n![image](images/File%253Afoo%20bar.jpg)\\\nsome **caption**\n\n", result)
+}
+
+func TestMarkdownExpandImage_noCaption(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	token := parser.ImageToken{
+		Filename: "foo.jpg",
+		SizeX:    -1,
+		SizeY:    -1,
+	}
+
+	result, err := expand(markdownGenerator, token)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "\n\n![image](images/foo.jpg)\n\n", result)
+}
+
+func TestMarkdownExpandImageInline(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+
+	result, err := expand(markdownGenerator, parser.InlineImageToken{Filename: "foo.png", SizeX: -1, SizeY: -1})
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "![image](images/foo.png)", result)
+}
+
+func TestMarkdownExpandLinks(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+
+	result, err := expand(markdownGenerator, parser.InternalLinkToken{ArticleName: "Foo", LinkText: "bar"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "bar", result)
+
+	result, err = expand(markdownGenerator, parser.ExternalLinkToken{URL: "https://foo.com", LinkText: "foo"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "[foo](https://foo.com)", result)
+
+	result, err = expand(markdownGenerator, parser.ExternalLinkToken{URL: "https://foo.com", LinkText: ""})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "<https://foo.com>", result)
+}
+
+func TestMarkdownExpandTable(t *testing.T) {
+	tokenTable := fmt.Sprintf(parser.TOKEN_TEMPLATE, parser.TOKEN_TABLE, 0)
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{
+		tokenTable: parser.TableToken{
+			Caption: parser.TableCaptionToken{Content: "caption"},
+			Rows: []parser.TableRowToken{
+				{
+					Columns: []parser.TableColToken{
+						{Content: "head 1", IsHeading: true},
+						{Content: "head 2", IsHeading: true},
+					},
+				},
+				{
+					Columns: []parser.TableColToken{
+						{Content: "a|b"},
+						{Content: "multi\nline"},
+					},
+				},
+				{
+					Columns: []parser.TableColToken{
+						{Content: "only one"},
+					},
+				},
+			},
+		},
+	})
+
+	result, err := expand(markdownGenerator, tokenTable)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `
+
+| head 1 | head 2 |
+| --- | --- |
+| a\|b | multi line |
+| only one |  |
+
+caption
+
+`, result)
+}
+
+func TestMarkdownExpandTable_withoutHeading(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	token := parser.TableToken{
+		Rows: []parser.TableRowToken{
+			{Columns: []parser.TableColToken{{Content: "a"}, {Content: "b"}}},
+		},
+	}
+
+	result, err := expand(markdownGenerator, token)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `
+
+|  |  |
+| --- | --- |
+| a | b |
+
+`, result)
+}
+
+func TestMarkdownExpandNestedLists(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	itemInner := parser.ListItemToken{Type: parser.NORMAL_ITEM, Content: " bar"}
+	listInner := parser.OrderedListToken{Items: []parser.ListItemToken{itemInner, itemInner}}
+	itemOuter := parser.ListItemToken{Type: parser.NORMAL_ITEM, Content: " foo", SubLists: []parser.ListToken{listInner}}
+	listOuter := parser.UnorderedListToken{Items: []parser.ListItemToken{itemOuter, {Type: parser.NORMAL_ITEM, Content: "baz"}}}
+
+	result, err := expand(markdownGenerator, listOuter)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `- foo
+  1. bar
+  2. bar
+- baz
+
+`, result)
+}
+
+func TestMarkdownExpandDescriptionList(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	token := parser.DescriptionListToken{Items: []parser.ListItemToken{
+		{Type: parser.DESCRIPTION_HEAD, Content: "foo"},
+		{Type: parser.DESCRIPTION_ITEM, Content: "bar"},
+	}}
+
+	result, err := expand(markdownGenerator, token)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "\n\n**foo**\n\nbar\n\n", result)
+}
+
+func TestMarkdownExpandReferences(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	markdownGenerator.footnotePrefix = "Foo-bar"
+
+	result, err := expand(markdownGenerator, parser.RefDefinitionToken{Index: 42, Content: "some\n" + parser.MARKER_BOLD_OPEN + "ref" + parser.MARKER_BOLD_CLOSE})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "[^Foo-bar-43]: some **ref**", result)
+
+	result, err = expand(markdownGenerator, parser.RefUsageToken{Index: 42})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "[^Foo-bar-43]", result)
+}
+
+func TestMarkdownExpandMath(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+	markdownGenerator.wikipediaService.(*wikipedia.MockWikipediaService).RenderMathFunc = func(mathString string) (string, string, error) {
+		return "image.svg", cache.GetFilePathInCache(cache.MathCacheDirName, "image.png"), nil
+	}
+
+	result, err := expand(markdownGenerator, parser.MathToken{Content: `\sqrt[3]{x}`})
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `![\\sqrt\[3\]{x}](math/image.png)`, result)
+}
+
+func TestMarkdownExpandNowiki(t *testing.T) {
+	markdownGenerator := newMarkdownGenerator(map[string]parser.Token{})
+
+	result, err := expand(markdownGenerator, parser.NowikiToken{Content: "[[foo]]"})
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, `\[\[foo\]\]`, result)
+}
+
+func TestGenerateMarkdown(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current.CacheDir = t.TempDir()
+	markdownCacheDir := cache.GetDirPathInCache(cache.MarkdownCacheDirName)
+	imageCacheDir := cache.GetDirPathInCache(cache.ImageCacheDirName)
+	test.AssertNil(t, os.MkdirAll(markdownCacheDir, os.ModePerm))
+	test.AssertNil(t, os.MkdirAll(imageCacheDir, os.ModePerm))
+	test.AssertNil(t, os.WriteFile(filepath.Join(imageCacheDir, "foo bar.png"), []byte("image"), 0644))
+
+	articleA := filepath.Join(markdownCacheDir, "A.md")
+	articleB := filepath.Join(markdownCacheDir, "B.md")
+	test.AssertNil(t, os.WriteFile(articleA, []byte("# A\n\n![image](images/foo%20bar.png)\n"), 0644))
+	test.AssertNil(t, os.WriteFile(articleB, []byte("# B\n"), 0644))
+
+	outputFolder := t.TempDir()
+
+	// Act
+	singleFileErr := GenerateMarkdown([]string{articleA, articleB}, filepath.Join(outputFolder, "single", "book.md"))
+	folderErr := GenerateMarkdown([]string{articleA, articleB}, filepath.Join(outputFolder, "folder"))
+
+	// Assert
+	test.AssertNil(t, singleFileErr)
+	content, err := os.ReadFile(filepath.Join(outputFolder, "single", "book.md"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "# A\n\n![image](images/foo%20bar.png)\n\n# B\n", string(content))
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, "single", "images", "foo bar.png")))
+
+	test.AssertNil(t, folderErr)
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, "folder", "A.md")))
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, "folder", "B.md")))
+	test.AssertTrue(t, util.PathExists(filepath.Join(outputFolder, "folder", "images", "foo bar.png")))
+}
@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strconv"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	pdfPageStyleFileName = "pdf-page-style.css"
+	pdfCoverFileName     = "pdf-cover.html"
+)
+
+// PDF_PAGE_STYLE contains the CSS paged media rules for page numbers on each page and in the table of content. This is
+// added in addition to the normal style file, which is shared with the EPUB output.
+const PDF_PAGE_STYLE = `@page {
+  @bottom-center {
+    content: counter(page);
+  }
+}
+@page :first {
+  @bottom-center {
+    content: none;
+  }
+}
+.wiki2book-cover {
+  page-break-after: always;
+  text-align: center;
+}
+.wiki2book-cover img {
+  max-width: 100%;
+  max-height: 100%;
+}
+#TOC {
+  page-break-after: always;
+}
+#TOC a::after {
+  content: leader('.') target-counter(attr(href), page);
+}
+h1 {
+  page-break-before: always;
+}
+`
+
+const PDF_COVER_TEMPLATE = `<div class="wiki2book-cover"><img src="%s" alt="%s"></div>
+`
+
+func GeneratePdf(articleFiles []string, outputFile string, metadata config.Metadata) error {
+	sigolo.Debugf("Generate PDF to '%s' for articles %v", outputFile, articleFiles)
+
+	if config.Current.OutputType != config.OutputTypePdf {
+		return errors.Errorf("Output type '%s' does not support PDF generation. This is a Bug.", config.Current.OutputType)
+	}
+
+	if config.Current.OutputDriver != config.OutputDriverPandoc {
+		return errors.Errorf("Output driver '%s' does not support PDF generation. This is a Bug.", config.Current.OutputDriver)
+	}
+
+	return GeneratePdfWithPandoc(articleFiles, outputFile, metadata)
+}
+
+func GeneratePdfWithPandoc(sourceFiles []string, outputFile string, metadata config.Metadata) error {
+	// Example: pandoc -f html -t html5 -o Stern.pdf --pdf-engine weasyprint --css ../../style.css Stern.html
+
+	pageStyleFile := filepath.Join(cache.GetTempPath(), pdfPageStyleFileName)
+	err := os.WriteFile(pageStyleFile, []byte(PDF_PAGE_STYLE), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "Error writing PDF page style file '%s'", pageStyleFile)
+	}
+
+	coverFile := ""
+	if config.Current.CoverImage != "" {
+		coverFile = filepath.Join(cache.GetTempPath(), pdfCoverFileName)
+		coverContent := fmt.Sprintf(PDF_COVER_TEMPLATE, html.EscapeString(config.Current.CoverImage), html.EscapeString(metadata.Title))
+		err = os.WriteFile(coverFile, []byte(coverContent), 0644)
+		if err != nil {
+			return errors.Wrapf(err, "Error writing PDF cover file '%s'", coverFile)
+		}
+	}
+
+	args := getPandocPdfArgs(sourceFiles, outputFile, metadata, pageStyleFile, coverFile)
+
+	err = util.Execute(config.Current.PandocExecutable, config.Current.CacheDir, args...)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error generating PDF file '%s' using pandoc", outputFile))
+	}
+
+	return nil
+}
+
+// getPandocPdfArgs returns the arguments for pandoc to turn the given HTML files into a PDF file. The page style file
+// is added after the normal style file so that its rules take precedence. The cover file is optional and will be
+// ignored if empty.
+func getPandocPdfArgs(sourceFiles []string, outputFile string, metadata config.Metadata, pageStyleFile string, coverFile string) []string {
+	args := []string{
+		"-f", "html",
+		"-t", "html5",
+		"-o", outputFile,
+		"--pdf-engine", config.Current.PdfEngine,
+		"--standalone",
+		"--metadata", "title=" + metadata.Title,
+		"--metadata", "author=" + metadata.Author,
+		"--metadata", "rights=" + metadata.License,
+		"--metadata", "language=" + metadata.Language,
+		"--metadata", "date=" + metadata.Date,
+	}
+	for _, source := range metadata.Sources {
+		args = append(args, "--metadata", "source="+source)
+	}
+	if config.Current.TocDepth > 0 {
+		args = append(args, "--toc", "--toc-depth", strconv.Itoa(config.Current.TocDepth))
+	}
+	if config.Current.PandocDataDir != "" {
+		args = append(args, "--data-dir", config.Current.PandocDataDir)
+	}
+	if config.Current.StyleFile != "" {
+		args = append(args, "--css", config.Current.StyleFile)
+	}
+	args = append(args, "--css", pageStyleFile)
+	if coverFile != "" {
+		args = append(args, "--include-before-body", coverFile)
+	}
+
+	args = append(args, sourceFiles...)
+
+	return args
+}
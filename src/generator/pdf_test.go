@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"testing"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+func TestGetPandocPdfArgs(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	config.Current.OutputType = config.OutputTypePdf
+	config.Current.PdfEngine = "my-engine"
+	config.Current.TocDepth = 3
+	config.Current.StyleFile = "/style.css"
+	metadata := config.Metadata{
+		Title:    "title",
+		Language: "lang",
+		Author:   "author",
+		License:  "license",
+		Date:     "date",
+		Sources:  []string{"https://en.wikipedia.org/w/index.php?title=Earth&oldid=1234"},
+	}
+
+	// Act
+	args := getPandocPdfArgs([]string{"a.html", "b.html"}, "out.pdf", metadata, "/page.css", "/cover.html")
+
+	// Assert
+	test.AssertEqual(t, []string{
+		"-f", "html",
+		"-t", "html5",
+		"-o", "out.pdf",
+		"--pdf-engine", "my-engine",
+		"--standalone",
+		"--metadata", "title=title",
+		"--metadata", "author=author",
+		"--metadata", "rights=license",
+		"--metadata", "language=lang",
+		"--metadata", "date=date",
+		"--metadata", "source=https://en.wikipedia.org/w/index.php?title=Earth&oldid=1234",
+		"--toc", "--toc-depth", "3",
+		"--css", "/style.css",
+		"--css", "/page.css",
+		"--include-before-body", "/cover.html",
+		"a.html", "b.html",
+	}, args)
+}
+
+func TestGetPandocPdfArgs_noTocAndNoCover(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	config.Current.OutputType = config.OutputTypePdf
+	config.Current.TocDepth = 0
+	config.Current.StyleFile = ""
+
+	// Act
+	args := getPandocPdfArgs([]string{"a.html"}, "out.pdf", config.Metadata{}, "/page.css", "")
+
+	// Assert
+	test.AssertEqual(t, []string{
+		"-f", "html",
+		"-t", "html5",
+		"-o", "out.pdf",
+		"--pdf-engine", "weasyprint",
+		"--standalone",
+		"--metadata", "title=",
+		"--metadata", "author=",
+		"--metadata", "rights=",
+		"--metadata", "language=",
+		"--metadata", "date=",
+		"--css", "/page.css",
+		"a.html",
+	}, args)
+}
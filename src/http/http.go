@@ -1,11 +1,17 @@
 package http
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"wiki2book/cache"
 	"wiki2book/config"
@@ -17,14 +23,29 @@ import (
 
 const (
 	HeaderContentType       = "Content-Type"
+	HeaderETag              = "ETag"
+	HeaderIfModifiedSince   = "If-Modified-Since"
+	HeaderIfNoneMatch       = "If-None-Match"
+	HeaderLastModified      = "Last-Modified"
 	HeaderMediawikiApiError = "mediawiki-api-error"
 	HeaderRetryAfter        = "Retry-After"
 	HeaderUserAgent         = "User-Agent"
 	HeaderXResourceLocation = "x-resource-location"
 )
 
+const (
+	// MaxlagError is the value of the MediaWiki API error header, when the request was refused due to the maxlag
+	// parameter.
+	MaxlagError = "maxlag"
+
+	retryBaseWaitTime = time.Second
+	retryMaxWaitTime  = time.Minute
+)
+
 var (
-	sleepFunc = func(seconds int) { time.Sleep(time.Duration(seconds) * time.Second) }
+	sleepFunc         = func(seconds int) { time.Sleep(time.Duration(seconds) * time.Second) }
+	sleepDurationFunc = time.Sleep
+	jitterFunc        = rand.Float64
 )
 
 type HttpClient interface {
@@ -34,59 +55,315 @@ type HttpClient interface {
 
 type HttpService interface {
 	PostFormEncoded(url, contentType string) (resp *http.Response, err error)
+	PostFormEncodedAndCache(url string, requestData string, cacheFolder string, filename string, responseContent func(response *http.Response) (string, error)) (string, bool, error)
 	DownloadAndCache(url string, cacheFolder string, filename string) (string, bool, error)
+	DownloadAndCacheWithRevisionCheck(url string, cacheFolder string, filename string, revisionCheck RevisionCheck) (string, bool, error)
 }
 
+// RevisionCheck determines whether an outdated cached file is still up-to-date by comparing the revision of its
+// content with the latest revision. Requesting the latest revision is much cheaper than downloading the whole content,
+// which is useful for content without "ETag" and "Last-Modified" headers, like articles from the Wikipedia API.
+type RevisionCheck struct {
+	// LatestRevisionUrl is the URL to request the latest revision from.
+	LatestRevisionUrl string
+	// LatestRevision returns the latest revision from the response of the LatestRevisionUrl.
+	LatestRevision func(content []byte) (int, error)
+	// RevisionOf returns the revision of the downloaded content.
+	RevisionOf func(content []byte) (int, error)
+}
+
+// fetchFunc requests the content of a file. When validators of the cached file are given, the returned content is nil
+// in case the cached file is still up-to-date. The validators of the returned content are returned as well.
+type fetchFunc func(validators *cache.Validators) ([]byte, cache.Validators, error)
+
 type DefaultHttpService struct {
 	httpClient HttpClient
+
+	// usedFiles maps the path within the cache of each file returned by DownloadAndCache and PostFormEncodedAndCache to
+	// its URL and the hash of its downloaded content.
+	usedFiles      map[string]config.LockedFile
+	usedFilesMutex sync.Mutex
+	// recordHashes ensures that the hashes of all used files are known (s. RecordHashes).
+	recordHashes bool
+
+	// frozenFiles are the only files DownloadAndCache is allowed to use. This is nil when not in frozen mode.
+	frozenFiles map[string]config.LockedFile
+
+	// backOffUntil is the point in time until which no request is made after a "too many requests" response. It's
+	// shared by all requests, so that concurrent requests (e.g. image downloads) don't ignore the back-off.
+	backOffUntil time.Time
+	backOffMutex sync.Mutex
+
+	// rateLimiter limits the requests per host of all requests made by this service.
+	rateLimiter *rateLimiter
+	// retryBudget limits the retries of all requests made by this service.
+	retryBudget *retryBudget
 }
 
 func NewDefaultHttpService() *DefaultHttpService {
 	return &DefaultHttpService{
-		httpClient: &http.Client{},
+		httpClient:  &http.Client{},
+		usedFiles:   map[string]config.LockedFile{},
+		rateLimiter: newRateLimiter(config.Current.HttpRequestsPerSecond),
+		retryBudget: newRetryBudget(),
+	}
+}
+
+// Freeze turns on the frozen mode, in which only the given files are used. Files not contained in the given map are
+// not downloaded and the hashes of all used files are verified. Cached files are used regardless of their age, since
+// their content is determined by their hash.
+func (d *DefaultHttpService) Freeze(lockedFiles map[string]config.LockedFile) {
+	d.frozenFiles = lockedFiles
+}
+
+// RecordHashes ensures that the hashes of the downloaded content of all used files are known (s. UsedFiles). Cached
+// files with unknown hash, e.g. because they were cached by an older version, are downloaded again.
+func (d *DefaultHttpService) RecordHashes() {
+	d.recordHashes = true
+}
+
+// UsedFiles returns the URLs and the hashes of the downloaded content of all files returned by DownloadAndCache and
+// PostFormEncodedAndCache so far. The keys are the paths within the cache. Unknown hashes are empty (s. RecordHashes).
+func (d *DefaultHttpService) UsedFiles() map[string]config.LockedFile {
+	d.usedFilesMutex.Lock()
+	defer d.usedFilesMutex.Unlock()
+
+	usedFiles := map[string]config.LockedFile{}
+	for file, lockedFile := range d.usedFiles {
+		usedFiles[file] = lockedFile
 	}
+	return usedFiles
 }
 
 // DownloadAndCache downloads the data of the given URL and returns the full output path, a flag indicating whether the
 // file was downloaded and an error. In case the file is already cached, nothing is downloaded and the cached path
 // together with "false" are returned.
 func (d *DefaultHttpService) DownloadAndCache(url string, cacheFolderName string, filename string) (string, bool, error) {
+	return d.fetchAndCache(url, cacheFolderName, filename, func(validators *cache.Validators) ([]byte, cache.Validators, error) {
+		return d.downloadContent(url, validators)
+	})
+}
+
+// DownloadAndCacheWithRevisionCheck works like DownloadAndCache, but outdated cached files are only downloaded again
+// when the latest revision differs from the revision of the cached content (s. RevisionCheck).
+func (d *DefaultHttpService) DownloadAndCacheWithRevisionCheck(url string, cacheFolderName string, filename string, revisionCheck RevisionCheck) (string, bool, error) {
+	return d.fetchAndCache(url, cacheFolderName, filename, func(validators *cache.Validators) ([]byte, cache.Validators, error) {
+		if validators != nil && validators.Revision != 0 {
+			latestRevisionContent, _, err := d.downloadContent(revisionCheck.LatestRevisionUrl, nil)
+			if err != nil {
+				return nil, cache.Validators{}, err
+			}
+
+			latestRevision, err := revisionCheck.LatestRevision(latestRevisionContent)
+			if err != nil {
+				// The revision check is just an optimization, so the content is simply downloaded again.
+				sigolo.Warnf("Unable to determine latest revision from %s, I'll download %s again: %s", revisionCheck.LatestRevisionUrl, url, err.Error())
+			} else if latestRevision == validators.Revision {
+				return nil, *validators, nil
+			}
+		}
+
+		content, _, err := d.downloadContent(url, nil)
+		if err != nil {
+			return nil, cache.Validators{}, err
+		}
+
+		revision, err := revisionCheck.RevisionOf(content)
+		if err != nil {
+			// Without revision, the file is simply downloaded again once it's outdated.
+			sigolo.Warnf("Unable to determine revision of content from %s: %s", url, err.Error())
+			return content, cache.Validators{}, nil
+		}
+		return content, cache.Validators{Revision: revision}, nil
+	})
+}
+
+// PostFormEncodedAndCache works like DownloadAndCache but makes a POST request with the given form data. The given
+// function determines the content to cache from the response. Other than PostFormEncoded, this is allowed in frozen
+// mode, since the content is verified against the lock file. The URL in the lock file contains the form data as query.
+func (d *DefaultHttpService) PostFormEncodedAndCache(url string, requestData string, cacheFolderName string, filename string, responseContent func(response *http.Response) (string, error)) (string, bool, error) {
+	return d.fetchAndCache(url+"?"+requestData, cacheFolderName, filename, func(_ *cache.Validators) ([]byte, cache.Validators, error) {
+		response, err := d.postFormEncoded(url, requestData)
+		if err != nil {
+			return nil, cache.Validators{}, err
+		}
+		defer response.Body.Close()
+
+		content, err := responseContent(response)
+		if err != nil {
+			return nil, cache.Validators{}, err
+		}
+		return []byte(content), cache.Validators{}, nil
+	})
+}
+
+// fetchAndCache returns the cached file or fetches it with the given function, depending on the cache and the frozen
+// mode. The file is recorded as used file (s. UsedFiles).
+func (d *DefaultHttpService) fetchAndCache(url string, cacheFolderName string, filename string, fetch fetchFunc) (string, bool, error) {
+	var outputFilepath string
+	var freshlyDownloaded bool
+	var contentHash string
+	var err error
+
+	if d.frozenFiles != nil {
+		outputFilepath, freshlyDownloaded, contentHash, err = d.fetchAndCacheFrozen(url, cacheFolderName, filename, fetch)
+	} else {
+		outputFilepath, freshlyDownloaded, contentHash, err = d.fetchAndCacheUnfrozen(url, cacheFolderName, filename, fetch)
+	}
+	if err != nil {
+		return outputFilepath, freshlyDownloaded, err
+	}
+
+	d.usedFilesMutex.Lock()
+	defer d.usedFilesMutex.Unlock()
+	if d.usedFiles == nil {
+		d.usedFiles = map[string]config.LockedFile{}
+	}
+	d.usedFiles[lockFilePath(cacheFolderName, filename)] = config.LockedFile{Url: url, Sha256: contentHash}
+
+	return outputFilepath, freshlyDownloaded, nil
+}
+
+func (d *DefaultHttpService) fetchAndCacheUnfrozen(url string, cacheFolderName string, filename string, fetch fetchFunc) (string, bool, string, error) {
 	// If file already cached -> don't download and use cached file
-	outputFilepath, fileIsCached, err := cache.GetFile(cacheFolderName, filename)
-	if err == nil && fileIsCached {
-		sigolo.Debugf("File '%s' does already exist -> use this cached file", outputFilepath)
-		return outputFilepath, false, nil
+	outputFilepath, fileIsCached, validators, err := cache.GetFileWithValidators(cacheFolderName, filename)
+	if err != nil {
+		return "", false, "", errors.Wrapf(err, "Unable to check whether file '%s' is already cached or not", outputFilepath)
+	}
+
+	if fileIsCached {
+		contentHash := cache.GetContentHash(cacheFolderName, filename)
+		if contentHash != "" || !d.recordHashes {
+			sigolo.Debugf("File '%s' does already exist -> use this cached file", outputFilepath)
+			return outputFilepath, false, contentHash, nil
+		}
+		sigolo.Debugf("Hash of downloaded content of file '%s' unknown -> download fresh one", outputFilepath)
+	} else if validators != nil {
+		sigolo.Debugf("File '%s' outdated -> check if it's still up-to-date", outputFilepath)
+	} else {
+		sigolo.Debugf("File '%s' not cached -> download fresh one", outputFilepath)
+	}
+
+	return d.fetchToCache(url, cacheFolderName, filename, validators, "", fetch)
+}
+
+// fetchAndCacheFrozen only uses the file when it's contained in the frozen files and has the expected hash. Missing
+// files are downloaded and have to match the expected hash as well.
+func (d *DefaultHttpService) fetchAndCacheFrozen(url string, cacheFolderName string, filename string, fetch fetchFunc) (string, bool, string, error) {
+	fileInCache := lockFilePath(cacheFolderName, filename)
+	lockedFile, isLocked := d.frozenFiles[fileInCache]
+	if !isLocked || lockedFile.Url != url {
+		return "", false, "", errors.Errorf("Refusing to download %s in frozen mode, since the lock file does not contain file '%s' with this URL", url, fileInCache)
+	}
+
+	outputFilepath := cache.GetFilePathInCache(cacheFolderName, filename)
+	_, err := util.CurrentFilesystem.Stat(outputFilepath)
+	if os.IsNotExist(err) {
+		sigolo.Debugf("Locked file '%s' not cached -> download it", outputFilepath)
+		return d.fetchToCache(url, cacheFolderName, filename, nil, lockedFile.Sha256, fetch)
+	} else if err != nil {
+		return "", false, "", errors.Wrapf(err, "Unable to check whether file '%s' is already cached or not", outputFilepath)
+	}
+
+	// Images are changed after the download by the image processing, so their hash differs from the hash of the
+	// downloaded content. Therefore, the hash of the downloaded content stored in the cache index is verified for
+	// images. All other files (e.g. articles, templates and math) are never changed, so the file itself is verified.
+	if cacheFolderName != cache.ImageCacheDirName {
+		content, err := util.CurrentFilesystem.ReadFile(outputFilepath)
+		if err != nil {
+			return "", false, "", errors.Wrapf(err, "Unable to read locked file '%s'", outputFilepath)
+		}
+		fileHash := util.Sha256(content)
+		if fileHash != lockedFile.Sha256 {
+			return "", false, "", errors.Errorf("Hash of file '%s' from %s does not match the lock file: Expected %s but was %s", outputFilepath, url, lockedFile.Sha256, fileHash)
+		}
+		return outputFilepath, false, fileHash, nil
 	}
+
+	contentHash := cache.GetContentHash(cacheFolderName, filename)
+	if contentHash == "" {
+		sigolo.Debugf("Hash of downloaded content of locked file '%s' unknown -> download it again", outputFilepath)
+		return d.fetchToCache(url, cacheFolderName, filename, nil, lockedFile.Sha256, fetch)
+	}
+	if contentHash != lockedFile.Sha256 {
+		return "", false, "", errors.Errorf("Hash of file '%s' from %s does not match the lock file: Expected %s but was %s", outputFilepath, url, lockedFile.Sha256, contentHash)
+	}
+
+	return outputFilepath, false, contentHash, nil
+}
+
+// fetchToCache fetches the file with the given function into the cache, regardless of whether the file is already
+// cached or not. When validators of the cached file are given, the cached file is kept in case it's still up-to-date.
+// When an expected hash is given, the fetched content is only cached when it has this hash. The full output path,
+// whether the file has been downloaded and the hash of the downloaded content are returned.
+func (d *DefaultHttpService) fetchToCache(url string, cacheFolderName string, filename string, validators *cache.Validators, expectedHash string, fetch fetchFunc) (string, bool, string, error) {
+	content, newValidators, err := fetch(validators)
 	if err != nil {
-		return "", false, errors.Wrapf(err, "Unable to check whether file '%s' is already cached or not", outputFilepath)
+		return "", true, "", err
 	}
-	sigolo.Debugf("File '%s' not cached -> download fresh one", outputFilepath)
 
-	// Get the data
-	responseBodyReader, err := d.download(url)
-	if responseBodyReader != nil {
-		defer responseBodyReader.Close()
+	if content == nil {
+		sigolo.Debugf("File '%s' not modified -> keep cached file", filename)
+		outputFilepath, err := cache.Touch(cacheFolderName, filename)
 		if err != nil {
-			responseBodyText := util.ReaderToString(responseBodyReader)
-			sigolo.Errorf("Response body of failed request:\n%s", responseBodyText)
-			return "", true, err
+			return "", false, "", err
 		}
+		return outputFilepath, false, cache.GetContentHash(cacheFolderName, filename), nil
+	}
+
+	contentHash := util.Sha256(content)
+	if expectedHash != "" && contentHash != expectedHash {
+		return "", true, "", errors.Errorf("Hash of file '%s' from %s does not match the lock file: Expected %s but was %s", lockFilePath(cacheFolderName, filename), url, expectedHash, contentHash)
+	}
+
+	outputFilepath, err := cache.CacheToFile(cacheFolderName, filename, bytes.NewReader(content))
+	if err != nil {
+		return "", true, "", errors.Wrapf(err, "Unable to cache to '%s'", outputFilepath)
+	}
+
+	cache.SetOrigin(cacheFolderName, filename, url, contentHash)
+
+	err = cache.SetValidators(cacheFolderName, filename, newValidators)
+	if err != nil {
+		// Without validators, the file is simply downloaded again once it's outdated.
+		sigolo.Warnf("Unable to store validators of file '%s': %s", outputFilepath, err.Error())
 	}
+
+	return outputFilepath, true, contentHash, nil
+}
+
+// downloadContent returns the content and validators of the given URL. When validators are given, the request is a
+// conditional request and nil is returned as content in case the cached file is still up-to-date.
+func (d *DefaultHttpService) downloadContent(url string, validators *cache.Validators) ([]byte, cache.Validators, error) {
+	response, err := d.download(url, validators)
 	if err != nil {
-		return "", true, err
+		return nil, cache.Validators{}, err
 	}
+	defer response.Body.Close()
 
-	outputFilepath, err = cache.CacheToFile(cacheFolderName, filename, responseBodyReader)
+	if response.StatusCode == http.StatusNotModified {
+		return nil, cache.Validators{}, nil
+	}
+
+	content, err := io.ReadAll(response.Body)
 	if err != nil {
-		return "", true, errors.Wrapf(err, "Unable to cache to '%s'", outputFilepath)
+		return nil, cache.Validators{}, errors.Wrapf(err, "Unable to read response of GET request to url %s", url)
 	}
 
-	return outputFilepath, true, nil
+	return content, cache.Validators{
+		ETag:         response.Header.Get(HeaderETag),
+		LastModified: response.Header.Get(HeaderLastModified),
+	}, nil
+}
+
+// lockFilePath returns the path of the file within the cache as it's used in lock files.
+func lockFilePath(cacheFolderName string, filename string) string {
+	return filepath.ToSlash(cache.GetRelativeFilePathInCache(cacheFolderName, filename))
 }
 
-// download returns the open response body of the GET request for the given URL. The article name is just there for
-// logging purposes.
-func (d *DefaultHttpService) download(url string) (io.ReadCloser, error) {
+// download returns the response of the GET request for the given URL. When validators are given, the request is a
+// conditional request and the response might have the status code 304 (not modified) without body.
+func (d *DefaultHttpService) download(url string, validators *cache.Validators) (*http.Response, error) {
 	var response *http.Response
 	var request *http.Request
 	var err error
@@ -101,15 +378,32 @@ func (d *DefaultHttpService) download(url string) (io.ReadCloser, error) {
 	userAgentString = strings.ReplaceAll(userAgentString, "{{VERSION}}", util.VERSION)
 	request.Header.Set(HeaderUserAgent, userAgentString)
 
+	if validators != nil {
+		if validators.ETag != "" {
+			request.Header.Set(HeaderIfNoneMatch, validators.ETag)
+		}
+		if validators.LastModified != "" {
+			request.Header.Set(HeaderIfModifiedSince, validators.LastModified)
+		}
+	}
+
 	response, err = d.doRequest(url, request)
 	if err != nil {
 		return nil, err
 	}
 	sigolo.Tracef("Response: %#v", response)
-	return response.Body, nil
+	return response, nil
 }
 
 func (d *DefaultHttpService) PostFormEncoded(url, requestData string) (resp *http.Response, err error) {
+	if d.frozenFiles != nil {
+		return nil, errors.Errorf("Refusing to make POST request to %s in frozen mode", url)
+	}
+
+	return d.postFormEncoded(url, requestData)
+}
+
+func (d *DefaultHttpService) postFormEncoded(url, requestData string) (*http.Response, error) {
 	sigolo.Debugf("Make POST request to %s with form data '%s'", url, util.TruncString(requestData))
 	request, err := http.NewRequest("POST", url, strings.NewReader(requestData))
 	if err != nil {
@@ -130,18 +424,46 @@ func (d *DefaultHttpService) PostFormEncoded(url, requestData string) (resp *htt
 	return response, nil
 }
 
+// doRequest executes the request and retries it when the server is overloaded (429 status code or lagging MediaWiki
+// API), on server errors (5xx status codes) and on network errors. Only responses with status code 200 or 304 (not
+// modified, only possible for conditional requests) are returned. Failed requests are not retried when the retry budget
+// shared by all requests is used up (s. retryBudget).
 func (d *DefaultHttpService) doRequest(url string, request *http.Request) (*http.Response, error) {
-	var response *http.Response
-	var err error
+	addMaxlagParameter(request)
+
+	for retry := 0; ; retry++ {
+		if retry > 0 && request.GetBody != nil {
+			// The body of the previous attempt has already been read.
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Unable to reset body of %s request to url %s", request.Method, url))
+			}
+			request.Body = body
+		}
 
-	for {
-		response, err = d.httpClient.Do(request)
+		d.waitForBackOff()
+		if d.rateLimiter != nil {
+			d.rateLimiter.wait(request.URL.Host)
+		}
+
+		response, err := d.httpClient.Do(request)
 		if err != nil {
-			return nil, errors.Wrap(err, fmt.Sprintf("Error executing %s request to url %s", request.Method, url))
+			err = errors.Wrap(err, fmt.Sprintf("Error executing %s request to url %s", request.Method, url))
+			if retry >= config.Current.HttpMaxRetries {
+				return nil, err
+			}
+			if !d.withdrawRetry() {
+				return nil, errors.Wrap(err, "Giving up since the retry budget is used up")
+			}
+			sigolo.Debugf("Request failed, retry %d of %d: %s", retry+1, config.Current.HttpMaxRetries, err.Error())
+			waitExponentially(retry)
+			continue
 		}
 
 		sigolo.Tracef("Response: %#v", response)
 
+		var retryReason error
+		responseErrorHeader := response.Header.Get(HeaderMediawikiApiError)
 		if response.StatusCode == http.StatusTooManyRequests {
 			// 429 (too many requests): wait a bit and retry
 			var waitTime int
@@ -151,18 +473,118 @@ func (d *DefaultHttpService) doRequest(url string, request *http.Request) (*http
 				sigolo.Warnf("Unable to parse '%s' header value after receiving HTTP status code %d. Instead I'll wait %d seconds, but this might lead to recurring HTTP errors.", HeaderRetryAfter, http.StatusTooManyRequests, waitTime)
 			}
 			sigolo.Debugf("Received response status code %d and try request again in %d seconds", response.StatusCode, waitTime)
-			sleepFunc(waitTime)
-			continue
-		} else if response.StatusCode != http.StatusOK {
+			retryReason = errors.Errorf("%s request to url %s failed with status code %d", request.Method, url, response.StatusCode)
+			d.backOff(waitTime)
+		} else if response.StatusCode >= 500 {
+			retryReason = errors.Errorf("%s request to url %s failed with status code %d", request.Method, url, response.StatusCode)
+		} else if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotModified {
+			logFailedResponseBody(response)
+			response.Body.Close()
 			return nil, errors.Errorf("%s request to url %s failed with status code %d", request.Method, url, response.StatusCode)
+		} else if responseErrorHeader == MaxlagError {
+			// The API is lagging, which is not a failure of the request. All requests should wait a bit.
+			waitTime, err := strconv.Atoi(response.Header.Get(HeaderRetryAfter))
+			if err != nil {
+				waitTime = max(config.Current.HttpMaxlag, 1)
+			}
+			sigolo.Debugf("MediaWiki API is lagging, try request again in %d seconds", waitTime)
+			retryReason = errors.Errorf("%s request to url %s failed since the API is lagging", request.Method, url)
+			d.backOff(waitTime)
+		} else if responseErrorHeader != "" {
+			response.Body.Close()
+			return nil, errors.Errorf("%s request to url %s failed with error header '%s' value '%s'", request.Method, url, HeaderMediawikiApiError, responseErrorHeader)
+		} else {
+			d.depositRetry()
+			return response, nil
 		}
 
-		responseErrorHeader := response.Header.Get(HeaderMediawikiApiError)
-		if responseErrorHeader != "" {
-			return nil, errors.Errorf("%s request to url %s failed with error header '%s' value '%s'", request.Method, url, HeaderMediawikiApiError, responseErrorHeader)
+		if retry >= config.Current.HttpMaxRetries {
+			logFailedResponseBody(response)
+			response.Body.Close()
+			return nil, errors.Wrapf(retryReason, "Giving up after %d retries", retry)
+		}
+		// The API lagging is not a failure of the request, so these retries are not part of the retry budget.
+		if responseErrorHeader != MaxlagError && !d.withdrawRetry() {
+			logFailedResponseBody(response)
+			response.Body.Close()
+			return nil, errors.Wrap(retryReason, "Giving up since the retry budget is used up")
+		}
+		response.Body.Close()
+		sigolo.Debugf("Request failed, retry %d of %d: %s", retry+1, config.Current.HttpMaxRetries, retryReason.Error())
+		if response.StatusCode >= 500 {
+			waitExponentially(retry)
 		}
-		break
 	}
+}
 
-	return response, nil
+// withdrawRetry takes a retry from the retry budget and returns whether the request may be retried.
+func (d *DefaultHttpService) withdrawRetry() bool {
+	if d.retryBudget == nil {
+		return true
+	}
+	return d.retryBudget.withdraw()
+}
+
+// depositRetry adds the share of a retry for a successful request to the retry budget.
+func (d *DefaultHttpService) depositRetry() {
+	if d.retryBudget != nil {
+		d.retryBudget.deposit()
+	}
+}
+
+// logFailedResponseBody logs the body of the response of a failed request, which often contains details about the
+// failure.
+func logFailedResponseBody(response *http.Response) {
+	responseBodyText := util.ReaderToString(response.Body)
+	sigolo.Errorf("Response body of failed request:\n%s", responseBodyText)
+}
+
+// addMaxlagParameter adds the configured "maxlag" parameter to requests to the MediaWiki API.
+func addMaxlagParameter(request *http.Request) {
+	if config.Current.HttpMaxlag <= 0 || !strings.HasSuffix(request.URL.Path, "api.php") || request.URL.Query().Has("maxlag") {
+		return
+	}
+
+	maxlagParameter := "maxlag=" + strconv.Itoa(config.Current.HttpMaxlag)
+	if request.URL.RawQuery == "" {
+		request.URL.RawQuery = maxlagParameter
+	} else {
+		request.URL.RawQuery += "&" + maxlagParameter
+	}
+}
+
+// waitExponentially waits before the given retry of a failed request. The wait time doubles with every retry and
+// contains a random part, so that concurrent requests failing at the same time are not retried at the same time.
+func waitExponentially(retry int) {
+	waitTime := retryMaxWaitTime
+	if retry < 16 {
+		waitTime = min(retryBaseWaitTime<<retry, retryMaxWaitTime)
+	}
+	waitTime = waitTime/2 + time.Duration(jitterFunc()*float64(waitTime/2))
+
+	sigolo.Debugf("Wait %s before retrying request", waitTime)
+	sleepDurationFunc(waitTime)
+}
+
+// backOff makes all requests wait for the given number of seconds. An already longer back-off is not shortened.
+func (d *DefaultHttpService) backOff(seconds int) {
+	d.backOffMutex.Lock()
+	defer d.backOffMutex.Unlock()
+
+	backOffUntil := time.Now().Add(time.Duration(seconds) * time.Second)
+	if backOffUntil.After(d.backOffUntil) {
+		d.backOffUntil = backOffUntil
+	}
+}
+
+// waitForBackOff blocks until the current back-off caused by a "too many requests" response is over.
+func (d *DefaultHttpService) waitForBackOff() {
+	d.backOffMutex.Lock()
+	remainingBackOff := time.Until(d.backOffUntil)
+	d.backOffMutex.Unlock()
+
+	if remainingBackOff > 0 {
+		sigolo.Tracef("Wait %s due to previous 'too many requests' response", remainingBackOff)
+		sleepFunc(int(math.Ceil(remainingBackOff.Seconds())))
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"sync/atomic"
 )
 
 type mockHttpClient struct {
@@ -61,32 +62,43 @@ func (h *mockHttpClient) Post(url, contentType string, body io.Reader) (resp *ht
 	}, nil
 }
 
+// mockHttpService counts the calls atomically, since it might be called concurrently (e.g. by the image workers).
 type mockHttpService struct {
-	DownloadAndCacheCounter int
-	DownloadAndCacheFunc    func(url string, cacheFolder string, filename string) (string, bool, error)
-	PostFormEncodedCounter  int
-	PostFormEncodedFunc     func(url, contentType string) (resp *http.Response, err error)
+	DownloadAndCacheCounter        atomic.Int32
+	DownloadAndCacheFunc           func(url string, cacheFolder string, filename string) (string, bool, error)
+	PostFormEncodedCounter         atomic.Int32
+	PostFormEncodedFunc            func(url, contentType string) (resp *http.Response, err error)
+	PostFormEncodedAndCacheCounter atomic.Int32
+	PostFormEncodedAndCacheFunc    func(url string, requestData string, cacheFolder string, filename string, responseContent func(response *http.Response) (string, error)) (string, bool, error)
 }
 
 func (h *mockHttpService) DownloadAndCache(url string, cacheFolder string, filename string) (string, bool, error) {
-	h.DownloadAndCacheCounter++
+	h.DownloadAndCacheCounter.Add(1)
 	return h.DownloadAndCacheFunc(url, cacheFolder, filename)
 }
 
+// DownloadAndCacheWithRevisionCheck ignores the revision check and behaves like DownloadAndCache.
+func (h *mockHttpService) DownloadAndCacheWithRevisionCheck(url string, cacheFolder string, filename string, revisionCheck RevisionCheck) (string, bool, error) {
+	return h.DownloadAndCache(url, cacheFolder, filename)
+}
+
 func (h *mockHttpService) PostFormEncoded(url, contentType string) (resp *http.Response, err error) {
-	h.PostFormEncodedCounter++
+	h.PostFormEncodedCounter.Add(1)
 	return h.PostFormEncodedFunc(url, contentType)
 }
 
+func (h *mockHttpService) PostFormEncodedAndCache(url string, requestData string, cacheFolder string, filename string, responseContent func(response *http.Response) (string, error)) (string, bool, error) {
+	h.PostFormEncodedAndCacheCounter.Add(1)
+	return h.PostFormEncodedAndCacheFunc(url, requestData, cacheFolder, filename, responseContent)
+}
+
 func NewMockHttpService(
 	downloadAndCacheFunc func(url string, cacheFolder string, filename string) (string, bool, error),
 	postFormEncodedFunc func(url, contentType string) (resp *http.Response, err error),
 ) *mockHttpService {
 	mockedHttpClient := &mockHttpService{
-		DownloadAndCacheCounter: 0,
-		DownloadAndCacheFunc:    downloadAndCacheFunc,
-		PostFormEncodedCounter:  0,
-		PostFormEncodedFunc:     postFormEncodedFunc,
+		DownloadAndCacheFunc: downloadAndCacheFunc,
+		PostFormEncodedFunc:  postFormEncodedFunc,
 	}
 	return mockedHttpClient
 }
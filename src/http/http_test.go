@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"wiki2book/cache"
 	"wiki2book/config"
 	"wiki2book/test"
 	"wiki2book/util"
@@ -111,18 +115,57 @@ func TestDownloadAndCache_tooManyRequestsResponse(t *testing.T) {
 	httpService.httpClient = mockHttpClient
 
 	// Act
-	reader, err := httpService.download("http://foobar")
+	response, err := httpService.download("http://foobar", nil)
 
 	// Assert
 	test.AssertNil(t, err)
 
-	all, err := io.ReadAll(reader)
+	all, err := io.ReadAll(response.Body)
 	test.AssertNil(t, err)
 	test.AssertEqual(t, "response of call3", string(all))
 
 	test.AssertEqual(t, []int{2, expectedSleepCallParam}, sleepFuncCallParams)
 }
 
+func TestDownloadAndCache_tooManyRequestsResponseDelaysOtherRequests(t *testing.T) {
+	// Arrange
+	var sleepFuncCallParams []int
+	sleepFunc = func(seconds int) {
+		sleepFuncCallParams = append(sleepFuncCallParams, seconds)
+	}
+
+	doCall := 0
+	mockHttpClient := NewMockHttpClient("", http.StatusOK)
+	mockHttpClient.doFunc = func(req *http.Request) (*http.Response, error) {
+		doCall++
+		if doCall == 1 {
+			return &http.Response{
+				Body:       io.NopCloser(bytes.NewReader([]byte("response of call1"))),
+				StatusCode: http.StatusTooManyRequests,
+				Header:     map[string][]string{HeaderRetryAfter: {"60"}},
+			}, nil
+		}
+		return &http.Response{
+			Body:       io.NopCloser(bytes.NewReader([]byte("response of another call"))),
+			StatusCode: http.StatusOK,
+		}, nil
+	}
+
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+
+	// Act
+	_, err := httpService.download("http://foobar", nil)
+	test.AssertNil(t, err)
+	_, err = httpService.download("http://other-request", nil)
+	test.AssertNil(t, err)
+
+	// Assert
+	// The sleep function doesn't actually sleep, so the back-off is still active for the second request.
+	test.AssertEqual(t, []int{60, 60}, sleepFuncCallParams)
+	test.AssertEqual(t, 3, doCall)
+}
+
 func TestPostFormEncoded_tooManyRequestsResponse(t *testing.T) {
 	// Arrange
 	expectedSleepCallParam := 123
@@ -171,3 +214,552 @@ func TestPostFormEncoded_tooManyRequestsResponse(t *testing.T) {
 
 	test.AssertEqual(t, []int{2, expectedSleepCallParam}, sleepFuncCallParams)
 }
+
+func prepareFrozenTest(t *testing.T) {
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+}
+
+func TestDownloadAndCache_recordsUsedFiles(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = NewMockHttpClient("some content", http.StatusOK)
+
+	// Act
+	_, _, err := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+	_, _, cachedErr := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertNil(t, cachedErr)
+	test.AssertEqual(t, map[string]config.LockedFile{
+		"images/bar.jpg": {Url: "http://foo/bar.jpg", Sha256: "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"},
+	}, httpService.UsedFiles())
+}
+
+func TestDownloadAndCache_recordHashesOfCachedFiles(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	config.Current.CacheMaxAge = 100
+	_, err := cache.CacheToFile(cache.ImageCacheDirName, "bar.jpg", strings.NewReader("cached by older version"))
+	test.AssertNil(t, err)
+
+	mockHttpClient := NewMockHttpClient("some content", http.StatusOK)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.RecordHashes()
+
+	// Act
+	_, freshlyDownloaded, err := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+	_, freshlyDownloadedAgain, errAgain := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertTrue(t, freshlyDownloaded)
+	test.AssertNil(t, errAgain)
+	test.AssertFalse(t, freshlyDownloadedAgain)
+	test.AssertEqual(t, 1, mockHttpClient.GetCalls)
+	test.AssertEqual(t, "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56", httpService.UsedFiles()["images/bar.jpg"].Sha256)
+}
+
+func TestDownloadAndCache_frozen(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	content := "some content"
+	contentHash := "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"
+
+	mockHttpClient := NewMockHttpClient(content, http.StatusOK)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.Freeze(map[string]config.LockedFile{
+		"images/bar.jpg": {Url: "http://foo/bar.jpg", Sha256: contentHash},
+	})
+
+	// Act
+	cachedFilePath, freshlyDownloaded, err := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+	_, _, notLockedErr := httpService.DownloadAndCache("http://foo/other.jpg", cache.ImageCacheDirName, "other.jpg")
+	_, _, otherUrlErr := httpService.DownloadAndCache("http://other/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+	_, postErr := httpService.PostFormEncoded("http://foo/math", "some data")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertTrue(t, freshlyDownloaded)
+	test.AssertEqual(t, filepath.Join(config.Current.CacheDir, cache.ImageCacheDirName, "bar.jpg"), cachedFilePath)
+	test.AssertNotNil(t, notLockedErr)
+	test.AssertNotNil(t, otherUrlErr)
+	test.AssertNotNil(t, postErr)
+	test.AssertEqual(t, 1, mockHttpClient.GetCalls)
+	test.AssertEqual(t, 0, mockHttpClient.PostCalls)
+}
+
+func TestDownloadAndCache_frozenWithProcessedCachedFile(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	cachedFile, err := cache.CacheToFile(cache.ImageCacheDirName, "bar.jpg", strings.NewReader("some content"))
+	test.AssertNil(t, err)
+	cache.SetOrigin(cache.ImageCacheDirName, "bar.jpg", "http://foo/bar.jpg", "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56")
+	test.AssertNil(t, os.WriteFile(cachedFile, []byte("processed content"), 0644))
+
+	mockHttpClient := NewMockHttpClient("some content", http.StatusOK)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.Freeze(map[string]config.LockedFile{
+		"images/bar.jpg": {Url: "http://foo/bar.jpg", Sha256: "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"},
+	})
+
+	// Act
+	cachedFilePath, freshlyDownloaded, err := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, cachedFile, cachedFilePath)
+	test.AssertFalse(t, freshlyDownloaded)
+	test.AssertEqual(t, 0, mockHttpClient.GetCalls)
+}
+
+func TestDownloadAndCache_frozenWithChangedCachedArticle(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	cachedFile, err := cache.CacheToFile(cache.ArticleCacheDirName, "Foo.json", strings.NewReader("some content"))
+	test.AssertNil(t, err)
+	cache.SetOrigin(cache.ArticleCacheDirName, "Foo.json", "http://foo/Foo", "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56")
+
+	mockHttpClient := NewMockHttpClient("some content", http.StatusOK)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.Freeze(map[string]config.LockedFile{
+		"articles/Foo.json": {Url: "http://foo/Foo", Sha256: "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"},
+	})
+
+	// Act
+	cachedFilePath, _, err := httpService.DownloadAndCache("http://foo/Foo", cache.ArticleCacheDirName, "Foo.json")
+	test.AssertNil(t, os.WriteFile(cachedFile, []byte("changed content"), 0644))
+	_, _, changedErr := httpService.DownloadAndCache("http://foo/Foo", cache.ArticleCacheDirName, "Foo.json")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, cachedFile, cachedFilePath)
+	test.AssertNotNil(t, changedErr)
+	test.AssertEqual(t, 0, mockHttpClient.GetCalls)
+}
+
+func TestDownloadAndCache_frozenWithOtherCachedFile(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	_, err := cache.CacheToFile(cache.ImageCacheDirName, "bar.jpg", strings.NewReader("other content"))
+	test.AssertNil(t, err)
+	cache.SetOrigin(cache.ImageCacheDirName, "bar.jpg", "http://foo/bar.jpg", util.Sha256([]byte("other content")))
+
+	mockHttpClient := NewMockHttpClient("some content", http.StatusOK)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.Freeze(map[string]config.LockedFile{
+		"images/bar.jpg": {Url: "http://foo/bar.jpg", Sha256: "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"},
+	})
+
+	// Act
+	cachedFilePath, freshlyDownloaded, err := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertEqual(t, "", cachedFilePath)
+	test.AssertFalse(t, freshlyDownloaded)
+	test.AssertEqual(t, 0, mockHttpClient.GetCalls)
+	test.AssertEqual(t, map[string]config.LockedFile{}, httpService.UsedFiles())
+}
+
+func TestDownloadAndCache_frozenWithWrongDownloadedContent(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	mockHttpClient := NewMockHttpClient("changed content", http.StatusOK)
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.Freeze(map[string]config.LockedFile{
+		"images/bar.jpg": {Url: "http://foo/bar.jpg", Sha256: "290f493c44f5d63d06b374d0a5abd292fae38b92cab2fae5efefe1b0e9347f56"},
+	})
+
+	// Act
+	_, _, err := httpService.DownloadAndCache("http://foo/bar.jpg", cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNotNil(t, err)
+	_, fileIsCached, err := cache.GetFile(cache.ImageCacheDirName, "bar.jpg")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, fileIsCached)
+}
+
+func TestPostFormEncodedAndCache_frozen(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	mockHttpClient := NewMockHttpClient("", http.StatusOK)
+	mockHttpClient.doFunc = func(request *http.Request) (*http.Response, error) {
+		header := http.Header{}
+		header.Set(HeaderXResourceLocation, "some-location")
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(""))}, nil
+	}
+	httpService := NewDefaultHttpService()
+	httpService.httpClient = mockHttpClient
+	httpService.Freeze(map[string]config.LockedFile{
+		"math/foo": {Url: "http://foo/math?q=foo", Sha256: util.Sha256([]byte("some-location"))},
+	})
+	responseContent := func(response *http.Response) (string, error) {
+		return response.Header.Get(HeaderXResourceLocation), nil
+	}
+
+	// Act
+	cachedFilePath, freshlyDownloaded, err := httpService.PostFormEncodedAndCache("http://foo/math", "q=foo", cache.MathCacheDirName, "foo", responseContent)
+	_, _, notLockedErr := httpService.PostFormEncodedAndCache("http://foo/math", "q=bar", cache.MathCacheDirName, "foo", responseContent)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertTrue(t, freshlyDownloaded)
+	content, err := os.ReadFile(cachedFilePath)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "some-location", string(content))
+	test.AssertNotNil(t, notLockedErr)
+	test.AssertEqual(t, 1, mockHttpClient.PostCalls)
+}
+
+func TestDownloadAndCache_notModified(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	config.Current.CacheMaxAge = 10
+
+	var conditionalHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditionalHeaders = append(conditionalHeaders, r.Header.Get(HeaderIfNoneMatch)+"|"+r.Header.Get(HeaderIfModifiedSince))
+		if r.Header.Get(HeaderIfNoneMatch) == `"123"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(HeaderETag, `"123"`)
+		w.Header().Set(HeaderLastModified, "Wed, 21 Oct 2015 07:28:00 GMT")
+		_, _ = w.Write([]byte("some content"))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+	cachedFilePath, _, err := httpService.DownloadAndCache(server.URL, cache.ImageCacheDirName, "bar.jpg")
+	test.AssertNil(t, err)
+	outdatedTime := time.Now().Add(-20 * time.Minute)
+	test.AssertNil(t, os.Chtimes(cachedFilePath, outdatedTime, outdatedTime))
+
+	// Act
+	refreshedFilePath, freshlyDownloaded, err := httpService.DownloadAndCache(server.URL, cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, cachedFilePath, refreshedFilePath)
+	test.AssertFalse(t, freshlyDownloaded)
+	test.AssertEqual(t, []string{"|", `"123"|Wed, 21 Oct 2015 07:28:00 GMT`}, conditionalHeaders)
+
+	content, err := os.ReadFile(refreshedFilePath)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "some content", string(content))
+
+	fileInfo, err := os.Stat(refreshedFilePath)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, fileInfo.ModTime().After(outdatedTime))
+}
+
+func TestDownloadAndCache_modifiedSinceLastDownload(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	config.Current.CacheMaxAge = 10
+
+	numberOfRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests++
+		w.Header().Set(HeaderETag, `"`+strconv.Itoa(numberOfRequests)+`"`)
+		_, _ = w.Write([]byte("content " + strconv.Itoa(numberOfRequests)))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+	cachedFilePath, _, err := httpService.DownloadAndCache(server.URL, cache.ImageCacheDirName, "bar.jpg")
+	test.AssertNil(t, err)
+	outdatedTime := time.Now().Add(-20 * time.Minute)
+	test.AssertNil(t, os.Chtimes(cachedFilePath, outdatedTime, outdatedTime))
+
+	// Act
+	_, freshlyDownloaded, err := httpService.DownloadAndCache(server.URL, cache.ImageCacheDirName, "bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertTrue(t, freshlyDownloaded)
+	test.AssertEqual(t, 2, numberOfRequests)
+
+	content, err := os.ReadFile(cachedFilePath)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "content 2", string(content))
+}
+
+func TestDownloadAndCacheWithRevisionCheck(t *testing.T) {
+	// Arrange
+	prepareFrozenTest(t)
+	config.Current.CacheMaxAge = 10
+
+	latestRevision := 1
+	var requestedPaths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPaths = append(requestedPaths, r.URL.Path)
+		if r.URL.Path == "/revision" {
+			_, _ = w.Write([]byte(strconv.Itoa(latestRevision)))
+			return
+		}
+		_, _ = w.Write([]byte("content " + strconv.Itoa(latestRevision)))
+	}))
+	defer server.Close()
+
+	revisionCheck := RevisionCheck{
+		LatestRevisionUrl: server.URL + "/revision",
+		LatestRevision: func(content []byte) (int, error) {
+			return strconv.Atoi(string(content))
+		},
+		RevisionOf: func(content []byte) (int, error) {
+			return strconv.Atoi(strings.TrimPrefix(string(content), "content "))
+		},
+	}
+
+	httpService := NewDefaultHttpService()
+	cachedFilePath, _, err := httpService.DownloadAndCacheWithRevisionCheck(server.URL+"/article", cache.ArticleCacheDirName, "foo.json", revisionCheck)
+	test.AssertNil(t, err)
+	outdatedTime := time.Now().Add(-20 * time.Minute)
+	test.AssertNil(t, os.Chtimes(cachedFilePath, outdatedTime, outdatedTime))
+
+	// Act
+	_, freshlyDownloadedWithSameRevision, err := httpService.DownloadAndCacheWithRevisionCheck(server.URL+"/article", cache.ArticleCacheDirName, "foo.json", revisionCheck)
+	test.AssertNil(t, err)
+	test.AssertNil(t, os.Chtimes(cachedFilePath, outdatedTime, outdatedTime))
+	latestRevision = 2
+	_, freshlyDownloadedWithNewRevision, err := httpService.DownloadAndCacheWithRevisionCheck(server.URL+"/article", cache.ArticleCacheDirName, "foo.json", revisionCheck)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertFalse(t, freshlyDownloadedWithSameRevision)
+	test.AssertTrue(t, freshlyDownloadedWithNewRevision)
+	test.AssertEqual(t, []string{"/article", "/revision", "/revision", "/article"}, requestedPaths)
+
+	content, err := os.ReadFile(cachedFilePath)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "content 2", string(content))
+}
+
+func TestDoRequest_retriesServerErrorsWithExponentialBackOff(t *testing.T) {
+	// Arrange
+	var sleepDurations []time.Duration
+	sleepDurationFunc = func(d time.Duration) { sleepDurations = append(sleepDurations, d) }
+	jitterFunc = func() float64 { return 1 }
+
+	var receivedBodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receivedBodies = append(receivedBodies, string(body))
+		if len(receivedBodies) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("success"))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+	httpService.rateLimiter = newRateLimiter(0)
+
+	// Act
+	response, err := httpService.PostFormEncoded(server.URL, "some data")
+
+	// Assert
+	test.AssertNil(t, err)
+	responseBody, err := io.ReadAll(response.Body)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "success", string(responseBody))
+	test.AssertEqual(t, []string{"some data", "some data", "some data"}, receivedBodies)
+	test.AssertEqual(t, []time.Duration{time.Second, 2 * time.Second}, sleepDurations)
+}
+
+func TestDoRequest_retryBudgetExhausted(t *testing.T) {
+	// Arrange
+	sleepDurationFunc = func(d time.Duration) {}
+	config.Current.HttpMaxRetries = 2
+	defer func() { config.Current.HttpMaxRetries = config.NewDefaultConfig().HttpMaxRetries }()
+
+	numberOfRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+
+	// Act
+	response, err := httpService.download(server.URL, nil)
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertNil(t, response)
+	test.AssertEqual(t, 3, numberOfRequests)
+}
+
+func TestDoRequest_retryBudgetSharedByAllRequests(t *testing.T) {
+	// Arrange
+	sleepDurationFunc = func(d time.Duration) {}
+	config.Current.HttpMaxRetries = 2
+	defer func() { config.Current.HttpMaxRetries = config.NewDefaultConfig().HttpMaxRetries }()
+
+	numberOfRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+	httpService.retryBudget.tokens = 3
+
+	// Act
+	_, err := httpService.download(server.URL+"/foo", nil)
+	_, err2 := httpService.download(server.URL+"/bar", nil)
+	_, err3 := httpService.download(server.URL+"/baz", nil)
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertNotNil(t, err2)
+	test.AssertNotNil(t, err3)
+	// The first request is retried twice, the second one only once and the third one not at all.
+	test.AssertEqual(t, 3+2+1, numberOfRequests)
+}
+
+func TestDoRequest_clientErrorIsNotRetried(t *testing.T) {
+	// Arrange
+	numberOfRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+
+	// Act
+	_, err := httpService.download(server.URL, nil)
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertEqual(t, 1, numberOfRequests)
+}
+
+func TestDoRequest_retriesNetworkErrors(t *testing.T) {
+	// Arrange
+	sleepDurationFunc = func(d time.Duration) {}
+
+	numberOfRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numberOfRequests++
+		if numberOfRequests == 1 {
+			// Close the connection without any response
+			connection, _, err := w.(http.Hijacker).Hijack()
+			test.AssertNil(t, err)
+			_ = connection.Close()
+			return
+		}
+		_, _ = w.Write([]byte("success"))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+
+	// Act
+	response, err := httpService.download(server.URL, nil)
+
+	// Assert
+	test.AssertNil(t, err)
+	responseBody, err := io.ReadAll(response.Body)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "success", string(responseBody))
+	test.AssertEqual(t, 2, numberOfRequests)
+}
+
+func TestDoRequest_maxlag(t *testing.T) {
+	// Arrange
+	var sleepFuncCallParams []int
+	sleepFunc = func(seconds int) {
+		sleepFuncCallParams = append(sleepFuncCallParams, seconds)
+	}
+
+	var requestedQueries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedQueries = append(requestedQueries, r.URL.RawQuery)
+		if len(requestedQueries) == 1 {
+			w.Header().Set(HeaderMediawikiApiError, MaxlagError)
+			w.Header().Set(HeaderRetryAfter, "7")
+			_, _ = w.Write([]byte(`{"error":{"code":"maxlag","info":"Waiting for a database server: 6 seconds lagged."}}`))
+			return
+		}
+		_, _ = w.Write([]byte("success"))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+
+	// Act
+	response, err := httpService.download(server.URL+"/w/api.php?action=query&format=json", nil)
+
+	// Assert
+	test.AssertNil(t, err)
+	responseBody, err := io.ReadAll(response.Body)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "success", string(responseBody))
+	test.AssertEqual(t, []string{"action=query&format=json&maxlag=5", "action=query&format=json&maxlag=5"}, requestedQueries)
+	test.AssertEqual(t, []int{7}, sleepFuncCallParams)
+}
+
+func TestDoRequest_noMaxlagForOtherUrls(t *testing.T) {
+	// Arrange
+	requestedQuery := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedQuery = r.URL.RawQuery
+		_, _ = w.Write([]byte("success"))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+
+	// Act
+	_, err := httpService.download(server.URL+"/wikipedia/commons/a/ab/Foo.jpg?foo=bar", nil)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "foo=bar", requestedQuery)
+}
+
+func TestDoRequest_rateLimit(t *testing.T) {
+	// Arrange
+	var sleepDurations []time.Duration
+	sleepDurationFunc = func(d time.Duration) { sleepDurations = append(sleepDurations, d) }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("success"))
+	}))
+	defer server.Close()
+
+	httpService := NewDefaultHttpService()
+	httpService.rateLimiter = newRateLimiter(2)
+
+	// Act
+	for i := 0; i < 4; i++ {
+		_, err := httpService.download(server.URL, nil)
+		test.AssertNil(t, err)
+	}
+
+	// Assert
+	// The first two requests are within the burst, the others have to wait for their token. The sleep function
+	// doesn't actually sleep, so the tokens are reserved in advance.
+	test.AssertEqual(t, 2, len(sleepDurations))
+	test.AssertTrue(t, sleepDurations[0] > 400*time.Millisecond && sleepDurations[0] <= 500*time.Millisecond)
+	test.AssertTrue(t, sleepDurations[1] > 900*time.Millisecond && sleepDurations[1] <= time.Second)
+}
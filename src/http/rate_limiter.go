@@ -0,0 +1,68 @@
+package http
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hauke96/sigolo/v2"
+)
+
+// rateLimiter limits the number of requests per second for each host using a token bucket. The bucket of a host holds
+// at most one second worth of requests, which allows short bursts of requests.
+type rateLimiter struct {
+	requestsPerSecond int
+	buckets           map[string]*tokenBucket
+	mutex             sync.Mutex
+}
+
+type tokenBucket struct {
+	// tokens can become negative, which means requests have already reserved tokens that are not yet available.
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newRateLimiter creates a rate limiter for the given number of requests per second and host. A value of 0 or less
+// disables the rate limiting.
+func newRateLimiter(requestsPerSecond int) *rateLimiter {
+	return &rateLimiter{
+		requestsPerSecond: requestsPerSecond,
+		buckets:           map[string]*tokenBucket{},
+	}
+}
+
+// wait blocks until a request to the given host is allowed.
+func (r *rateLimiter) wait(host string) {
+	waitTime := r.reserve(host)
+	if waitTime > 0 {
+		sigolo.Tracef("Wait %s due to rate limit of host %s", waitTime, host)
+		sleepDurationFunc(waitTime)
+	}
+}
+
+// reserve takes a token from the bucket of the given host and returns the time to wait until this token is available.
+func (r *rateLimiter) reserve(host string) time.Duration {
+	if r.requestsPerSecond <= 0 {
+		return 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	capacity := float64(r.requestsPerSecond)
+
+	bucket, ok := r.buckets[host]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, lastRefill: now}
+		r.buckets[host] = bucket
+	}
+
+	bucket.tokens = min(bucket.tokens+now.Sub(bucket.lastRefill).Seconds()*capacity, capacity)
+	bucket.lastRefill = now
+	bucket.tokens--
+
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / capacity * float64(time.Second))
+}
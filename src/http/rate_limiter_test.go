@@ -0,0 +1,26 @@
+package http
+
+import (
+	"testing"
+	"time"
+	"wiki2book/test"
+)
+
+func TestRateLimiter_reserve(t *testing.T) {
+	rateLimiter := newRateLimiter(1)
+
+	test.AssertEqual(t, time.Duration(0), rateLimiter.reserve("foo.com"))
+	waitTime := rateLimiter.reserve("foo.com")
+	test.AssertTrue(t, waitTime > 900*time.Millisecond && waitTime <= time.Second)
+
+	// Each host has its own limit
+	test.AssertEqual(t, time.Duration(0), rateLimiter.reserve("bar.com"))
+}
+
+func TestRateLimiter_disabled(t *testing.T) {
+	rateLimiter := newRateLimiter(0)
+
+	for i := 0; i < 100; i++ {
+		test.AssertEqual(t, time.Duration(0), rateLimiter.reserve("foo.com"))
+	}
+}
@@ -0,0 +1,48 @@
+package http
+
+import (
+	"sync"
+)
+
+const (
+	// retryBudgetCapacity is the maximum number of retries the retry budget allows in a row.
+	retryBudgetCapacity = 20
+	// retryBudgetTokensPerSuccess is the share of a retry each successful request adds to the retry budget. In the long
+	// run, this is the share of requests that can be retried.
+	retryBudgetTokensPerSuccess = 0.1
+)
+
+// retryBudget limits the retries of all requests using a token bucket. Each retry takes a token and each successful
+// request adds a fraction of a token. When the server keeps failing, the bucket runs empty and failed requests are not
+// retried anymore, so that many concurrent requests don't flood the server with retries.
+type retryBudget struct {
+	tokens float64
+	mutex  sync.Mutex
+}
+
+func newRetryBudget() *retryBudget {
+	return &retryBudget{
+		tokens: retryBudgetCapacity,
+	}
+}
+
+// withdraw takes a token for a retry from the bucket. When the bucket is empty, "false" is returned and the request
+// must not be retried.
+func (r *retryBudget) withdraw() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// deposit adds the share of a token for a successful request to the bucket.
+func (r *retryBudget) deposit() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.tokens = min(r.tokens+retryBudgetTokensPerSuccess, retryBudgetCapacity)
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"testing"
+	"wiki2book/test"
+)
+
+func TestRetryBudget_withdraw(t *testing.T) {
+	retryBudget := newRetryBudget()
+
+	for i := 0; i < retryBudgetCapacity; i++ {
+		test.AssertTrue(t, retryBudget.withdraw())
+	}
+	test.AssertFalse(t, retryBudget.withdraw())
+}
+
+func TestRetryBudget_deposit(t *testing.T) {
+	retryBudget := newRetryBudget()
+	for retryBudget.withdraw() {
+	}
+
+	for i := 0; i < 9; i++ {
+		retryBudget.deposit()
+	}
+	test.AssertFalse(t, retryBudget.withdraw())
+
+	retryBudget.deposit()
+	retryBudget.deposit()
+	test.AssertTrue(t, retryBudget.withdraw())
+	test.AssertFalse(t, retryBudget.withdraw())
+}
+
+func TestRetryBudget_depositDoesNotExceedCapacity(t *testing.T) {
+	retryBudget := newRetryBudget()
+
+	for i := 0; i < 100; i++ {
+		retryBudget.deposit()
+	}
+
+	for i := 0; i < retryBudgetCapacity; i++ {
+		test.AssertTrue(t, retryBudget.withdraw())
+	}
+	test.AssertFalse(t, retryBudget.withdraw())
+}
@@ -1,7 +1,6 @@
 package image
 
 import (
-	"strings"
 	"wiki2book/config"
 	"wiki2book/util"
 
@@ -24,19 +23,23 @@ func NewImageProcessingService() ImageProcessingService {
 func (s *ImageProcessingServiceImpl) ResizeAndCompressImage(imageFilepath string, commandTemplate string) error {
 	sigolo.Tracef("Process image '%s'", imageFilepath)
 
-	commandString := strings.ReplaceAll(commandTemplate, config.InputPlaceholder, imageFilepath)
-	commandString = strings.ReplaceAll(commandString, config.OutputPlaceholder, imageFilepath)
+	placeholderValues := map[string]string{
+		config.InputPlaceholder:  imageFilepath,
+		config.OutputPlaceholder: imageFilepath,
+	}
 
-	err := util.ExecuteCommandWithArgs(commandString, config.Current.CacheDir)
+	err := util.ExecuteCommandTemplate(commandTemplate, placeholderValues, config.Current.CacheDir)
 	return errors.Wrapf(err, "Converting image '%s' failed", imageFilepath)
 }
 
 func (s *ImageProcessingServiceImpl) ConvertToPng(inputFile string, pngFile string, commandTemplate string) error {
 	sigolo.Tracef("Convert '%s' to PNG '%s'", inputFile, pngFile)
 
-	commandString := strings.ReplaceAll(commandTemplate, config.InputPlaceholder, inputFile)
-	commandString = strings.ReplaceAll(commandString, config.OutputPlaceholder, pngFile)
+	placeholderValues := map[string]string{
+		config.InputPlaceholder:  inputFile,
+		config.OutputPlaceholder: pngFile,
+	}
 
-	err := util.ExecuteCommandWithArgs(commandString, ".")
+	err := util.ExecuteCommandTemplate(commandTemplate, placeholderValues, ".")
 	return errors.Wrapf(err, "Converting image '%s' to PNG failed", inputFile)
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
@@ -26,8 +28,30 @@ import (
 
 const (
 	defaultEpubOutputFile      = "ebook.epub"
+	defaultPdfOutputFile       = "ebook.pdf"
+	defaultAzw3OutputFile      = "ebook.azw3"
+	defaultMarkdownOutputFile  = "ebook.md"
+	defaultHtmlSiteOutputDir   = "website"
 	defaultStatsJsonOutputFile = "stats.json"
-	defaultStatsTxtOutputFile  = "stats.txt"
+
+	// File name of the HTML pages of parts and chapters. It contains characters not allowed in article titles to avoid
+	// collisions with the HTML files of articles.
+	structurePageFileNameTemplate = "wiki2book-structure-page-%04d"
+	// File name of the HTML page with sources and licenses. Like the structure pages, it cannot collide with articles.
+	attributionPageFileName = "wiki2book-attribution-page"
+	attributionPageTitle    = "Sources and licenses"
+	// Suffix of the file next to the HTML file of an article, which contains the images used by the article.
+	articleImagesFileSuffix   = ".images.json"
+	defaultStatsTxtOutputFile = "stats.txt"
+
+	// lockModeRead uses the revisions of an existing lock file of the project but leaves the lock file unchanged.
+	lockModeRead = "read"
+	// lockModeArticles writes the revisions of all articles into the lock file of the project.
+	lockModeArticles = "articles"
+	// lockModeFiles additionally writes all downloaded files and their hashes into the lock file of the project.
+	lockModeFiles = "files"
+	// lockModeFrozen only uses the files of the lock file and leaves the lock file unchanged.
+	lockModeFrozen = "frozen"
 )
 
 var cliConfig = config.NewDefaultConfig()
@@ -48,6 +72,9 @@ func initCli() *cobra.Command {
 	var cliOutputFile = ""
 	var cliDiagnosticsProfiling = false
 	var cliDiagnosticsTrace = false
+	var cliFrozen = false
+	var cliUpdateLock = false
+	var cliNumberOfOldestEntries = 10
 	var start time.Time
 
 	rootCmd := &cobra.Command{
@@ -80,12 +107,15 @@ func initCli() *cobra.Command {
 
 	rootCmd.PersistentFlags().BoolVarP(&cliConfig.ForceRegenerateHtml, "force-regenerate-html", "r", cliConfig.ForceRegenerateHtml, "Forces wiki2book to recreate HTML files even if they exists from a previous run.")
 	rootCmd.PersistentFlags().BoolVar(&cliConfig.SvgSizeToViewbox, "svg-size-to-viewbox", cliConfig.SvgSizeToViewbox, "Sets the 'width' and 'height' property of an SimpleSvgAttributes image to its viewbox width and height. This might fix wrong SVG sizes on some eBook-readers.")
-	rootCmd.PersistentFlags().StringVar(&cliConfig.OutputType, "output-type", cliConfig.OutputType, "The output file type. Possible values are: 'epub2', 'epub3', 'stats-json' and 'stats.txt'.")
-	rootCmd.PersistentFlags().StringVar(&cliConfig.OutputDriver, "output-driver", cliConfig.OutputDriver, "The method to generate the output file. Available driver: 'pandoc', 'internal' (experimental!)")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.OutputType, "output-type", cliConfig.OutputType, "The output file type. Possible values are: 'epub2', 'epub3', 'pdf', 'azw3', 'markdown', 'html-site', 'stats-json' and 'stats.txt'.")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.OutputDriver, "output-driver", cliConfig.OutputDriver, "The method to generate the output file. Available driver: 'pandoc', 'internal' (no pandoc needed, supports 'epub3' but not 'epub2').")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CacheDir, "cache-dir", cliConfig.CacheDir, "The directory where all cached files will be written to.")
 	rootCmd.PersistentFlags().Int64Var(&cliConfig.CacheMaxSize, "cache-max-size", cliConfig.CacheMaxSize, "The maximum size of the file cache in bytes.")
 	rootCmd.PersistentFlags().Int64Var(&cliConfig.CacheMaxAge, "cache-max-age", cliConfig.CacheMaxAge, "The maximum age in minutes of files in the cache. All files older than this, will be downloaded/recreated again.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CacheEvictionStrategy, "cache-eviction-strategy", cliConfig.CacheEvictionStrategy, "The strategy by which files are removed from the case when it's full. Can be: 'none', 'lru', 'largest'")
+	rootCmd.PersistentFlags().Var(&cachePoliciesFlag{policies: &cliConfig.CachePolicies}, "cache-policies", "Policies for single cache folders as JSON object, e.g. '{\"articles\": {\"max-age\": 1440}}'. Possible properties are 'max-age', 'max-size-share' and 'eviction-priority'.")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.CacheStore, "cache-store", cliConfig.CacheStore, "The store in which cached files are kept in addition to the cache dir. Can be: 'filesystem', 'content-addressed'")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.CacheStoreDir, "cache-store-dir", cliConfig.CacheStoreDir, "The directory of the content-addressed store, which can be shared by multiple processes.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.StyleFile, "style-file", cliConfig.StyleFile, "The CSS file that should be used.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CoverImage, "cover-image", cliConfig.CoverImage, "A cover image for the front cover of the eBook.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CommandTemplateSvgToPng, "command-template-svg-to-png", cliConfig.CommandTemplateSvgToPng, "Command template to use for SVG to PNG conversion. Must contain the placeholders '{INPUT}' and '{OUTPUT}'.")
@@ -93,8 +123,10 @@ func initCli() *cobra.Command {
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CommandTemplateImageProcessing, "command-template-image-processing", cliConfig.CommandTemplateImageProcessing, "Command template to use for math SVG to PNG conversion. Disables processing and uses original images when empty. When set, it must contain the placeholders '{INPUT}' and '{OUTPUT}'.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CommandTemplatePdfToPng, "command-template-pdf-to-png", cliConfig.CommandTemplatePdfToPng, "Command template to use for PDF to PNG conversion. Must contain the placeholders '{INPUT}' and '{OUTPUT}'.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.CommandTemplateWebpToPng, "command-template-webp-to-png", cliConfig.CommandTemplateWebpToPng, "Command template to use for math WebP to PNG conversion. Disables conversion when empty. When set, it must contain the placeholders '{INPUT}' and '{OUTPUT}'.")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.CommandTemplateEpubToKindle, "command-template-epub-to-kindle", cliConfig.CommandTemplateEpubToKindle, "Command template to use for EPUB to Kindle (AZW3) conversion. Must contain the placeholders '{INPUT}' and '{OUTPUT}'.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.PandocExecutable, "pandoc-executable", cliConfig.PandocExecutable, "The executable name or file for pandoc.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.PandocDataDir, "pandoc-data-dir", cliConfig.PandocDataDir, "The data directory for pandoc. This enables you to override pandocs defaults for HTML and therefore EPUB generation.")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.PdfEngine, "pdf-engine", cliConfig.PdfEngine, "The HTML-based PDF engine used by pandoc to create PDF files, e.g. 'weasyprint'.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.FontFiles, "font-files", cliConfig.FontFiles, "A list of font files that should be used. They are references in your style file.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.IgnoredTemplates, "ignored-templates", cliConfig.IgnoredTemplates, "List of templates that should be ignored and removed from the input wikitext. The list must be in lower case.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.TrailingTemplates, "trailing-templates", cliConfig.TrailingTemplates, "List of templates that will be moved to the end of the document.")
@@ -102,16 +134,26 @@ func initCli() *cobra.Command {
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.IgnoredMediaTypes, "ignored-media-types", cliConfig.IgnoredMediaTypes, "List of media types to ignore, i.e. list of file extensions.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.WikipediaInstance, "wikipedia-instance", cliConfig.WikipediaInstance, "The subdomain of the Wikipedia instance.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.WikipediaHost, "wikipedia-host", cliConfig.WikipediaHost, "The domain of the Wikipedia instance.")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.ArticleSource, "article-source", cliConfig.ArticleSource, "The source of the article wikitext. Possible values are: 'api' (download from the Wikipedia instance) and 'dump' (read from the file given by --article-dump-file).")
+	rootCmd.PersistentFlags().StringVar(&cliConfig.ArticleDumpFile, "article-dump-file", cliConfig.ArticleDumpFile, "The bzip2 compressed multistream MediaWiki XML dump used for the article source 'dump'.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.WikipediaImageHost, "wikipedia-image-host", cliConfig.WikipediaImageHost, "The domain of the Wikipedia image instance.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.WikipediaMathRestApi, "wikipedia-math-rest-api", cliConfig.WikipediaMathRestApi, "The URL to the math API of wikipedia.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.WikipediaImageArticleHosts, "wikipedia-image-article-hosts", cliConfig.WikipediaImageArticleHosts, "Hosts used to search for image article files.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.FilePrefixes, "file-prefixes", cliConfig.FilePrefixes, "A list of prefixes to detect files, e.g. in 'File:picture.jpg' the substring 'File' is the image prefix.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.AllowedLinkPrefixes, "allowed-link-prefixes", cliConfig.AllowedLinkPrefixes, "A list of prefixes that are considered links and are therefore not removed.")
 	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.CategoryPrefixes, "category-prefixes", cliConfig.CategoryPrefixes, "A list of category prefixes, which are technically internals links.")
+	rootCmd.PersistentFlags().StringArrayVar(&cliConfig.TemplatePrefixes, "template-prefixes", cliConfig.TemplatePrefixes, "A list of prefixes of template pages, e.g. in 'Template:Foo' the substring 'Template' is the template prefix.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.MathConverter, "math-converter", cliConfig.MathConverter, "Converter turning math SVGs into PNGs.")
 	rootCmd.PersistentFlags().IntVar(&cliConfig.TocDepth, "toc-depth", cliConfig.TocDepth, "Depth of the table of content. Allowed range is 0 - 6.")
+	rootCmd.PersistentFlags().BoolVar(&cliConfig.AttributionAppendix, "attribution-appendix", cliConfig.AttributionAppendix, "Appends a chapter listing the sources, authors and licenses of all articles and images.")
+	rootCmd.PersistentFlags().BoolVar(&cliConfig.ImageCredits, "image-credits", cliConfig.ImageCredits, "Adds the author and license of each image below its caption.")
+	rootCmd.PersistentFlags().StringToStringVar(&cliConfig.ImageCreditTemplates, "image-credit-templates", cliConfig.ImageCreditTemplates, "Templates of the image credits by license short name (e.g. 'CC0={{AUTHOR}}'). The template 'default' is used for all other licenses.")
 	rootCmd.PersistentFlags().IntVar(&cliConfig.WorkerThreads, "worker-threads", cliConfig.WorkerThreads, "Number of threads to process the articles. Only affects projects but not single articles or the standalone mode. The value must at least be 1.")
+	rootCmd.PersistentFlags().IntVar(&cliConfig.ImageWorkerThreads, "image-worker-threads", cliConfig.ImageWorkerThreads, "Number of threads to download and process the images of an article. The value must at least be 1.")
 	rootCmd.PersistentFlags().StringVar(&cliConfig.UserAgentTemplate, "user-agent-template", cliConfig.UserAgentTemplate, "Template for the user-agent used in HTTP requests.")
+	rootCmd.PersistentFlags().IntVar(&cliConfig.HttpRequestsPerSecond, "http-requests-per-second", cliConfig.HttpRequestsPerSecond, "Maximum number of HTTP requests per second to each host. Use 0 to disable the limit.")
+	rootCmd.PersistentFlags().IntVar(&cliConfig.HttpMaxRetries, "http-max-retries", cliConfig.HttpMaxRetries, "Maximum number of retries of a failed HTTP request.")
+	rootCmd.PersistentFlags().IntVar(&cliConfig.HttpMaxlag, "http-maxlag", cliConfig.HttpMaxlag, "Value of the 'maxlag' parameter of MediaWiki API requests in seconds. Use 0 to not send this parameter.")
 
 	projectCmd := getCommand("project [file]", "Uses a project file to create the eBook.")
 	projectCmd.Args = cobra.MatchAll(cobra.ExactArgs(1))
@@ -123,9 +165,38 @@ func initCli() *cobra.Command {
 			cliOutputFile = ""
 		}
 
+		if cliFrozen && cliUpdateLock {
+			sigolo.Fatalf("The flags --frozen and --update-lock cannot be used together")
+		}
+
+		lockMode := lockModeRead
+		if cliFrozen {
+			lockMode = lockModeFrozen
+		} else if cliUpdateLock {
+			lockMode = lockModeArticles
+		}
+
+		generateProjectEbook(
+			args[0],
+			cliOutputFile,
+			lockMode,
+		)
+	}
+	projectCmd.Flags().BoolVar(&cliFrozen, "frozen", cliFrozen, "Only use the files of the lock file (s. 'lock' command), verify their hashes and refuse to download anything else.")
+	projectCmd.Flags().BoolVar(&cliUpdateLock, "update-lock", cliUpdateLock, "Writes the revisions of all articles into the lock file of the project. Without this flag, an existing lock file is only read.")
+
+	lockCmd := getCommand("lock [file]", "Uses a project file to create the eBook and writes all used revisions and files with their hashes into the lock file of the project.")
+	lockCmd.Args = cobra.MatchAll(cobra.ExactArgs(1))
+	lockCmd.Run = func(cmd *cobra.Command, args []string) {
+		sigolo.Infof("Prepare generating eBook from project and lock its files")
+		if !rootCmd.PersistentFlags().Changed(cliOutputFileArgKey) {
+			cliOutputFile = ""
+		}
+
 		generateProjectEbook(
 			args[0],
 			cliOutputFile,
+			lockModeFiles,
 		)
 	}
 
@@ -140,6 +211,17 @@ func initCli() *cobra.Command {
 		)
 	}
 
+	bookPageCmd := getCommand("book-page [title]", "Renders a Wikipedia book page (e.g. \"Book:Planets\") with all its articles into an eBook.")
+	bookPageCmd.Args = cobra.MatchAll(cobra.ExactArgs(1))
+	bookPageCmd.Run = func(cmd *cobra.Command, args []string) {
+		sigolo.Infof("Prepare generating eBook from book page")
+		config.MergeIntoCurrentConfig(cliConfig)
+		generateBookPageEbook(
+			args[0],
+			cliOutputFile,
+		)
+	}
+
 	standaloneCmd := getCommand("standalone [file]", "Renders a single mediawiki file into an eBook.")
 	standaloneCmd.Args = cobra.MatchAll(cobra.ExactArgs(1))
 	standaloneCmd.Run = func(cmd *cobra.Command, args []string) {
@@ -151,7 +233,52 @@ func initCli() *cobra.Command {
 		)
 	}
 
-	rootCmd.AddCommand(projectCmd, articleCmd, standaloneCmd)
+	cacheCmd := getCommand("cache", "Inspection and maintenance of the file cache.")
+	cacheCmd.Args = cobra.NoArgs
+	cacheCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		removeTempDir()
+	}
+
+	cacheStatsCmd := getCommand("stats", "Prints the number and size of cached files per cache folder and the least recently used files.")
+	cacheStatsCmd.Args = cobra.NoArgs
+	cacheStatsCmd.Run = func(cmd *cobra.Command, args []string) {
+		config.MergeIntoCurrentConfig(cliConfig)
+		printCacheStats(cliNumberOfOldestEntries)
+	}
+	cacheStatsCmd.Flags().IntVar(&cliNumberOfOldestEntries, "oldest", cliNumberOfOldestEntries, "Number of least recently used files to print.")
+
+	cachePruneCmd := getCommand("prune", "Removes outdated files from the cache and applies the eviction strategy until the cache doesn't exceed its max size.")
+	cachePruneCmd.Args = cobra.NoArgs
+	cachePruneCmd.Run = func(cmd *cobra.Command, args []string) {
+		config.MergeIntoCurrentConfig(cliConfig)
+		removedFiles, removedBytes, err := cache.Prune()
+		sigolo.FatalCheck(err)
+		sigolo.Infof("Removed %d files (%.2f MB) from cache '%s'", removedFiles, util.ToMB(removedBytes), config.Current.CacheDir)
+	}
+
+	cacheClearCmd := getCommand("clear [folder]", "Removes all files of the given cache folder (e.g. 'images') or of the whole cache, when no folder is given.")
+	cacheClearCmd.Args = cobra.MaximumNArgs(1)
+	cacheClearCmd.Run = func(cmd *cobra.Command, args []string) {
+		config.MergeIntoCurrentConfig(cliConfig)
+		folder := ""
+		if len(args) == 1 {
+			folder = args[0]
+		}
+		removedFiles, removedBytes, err := cache.Clear(folder)
+		sigolo.FatalCheck(err)
+		sigolo.Infof("Removed %d files (%.2f MB) from cache '%s'", removedFiles, util.ToMB(removedBytes), config.Current.CacheDir)
+	}
+
+	cacheVerifyCmd := getCommand("verify", "Checks the cache for empty and truncated files as well as leftovers of aborted runs in the temp folder.")
+	cacheVerifyCmd.Args = cobra.NoArgs
+	cacheVerifyCmd.Run = func(cmd *cobra.Command, args []string) {
+		config.MergeIntoCurrentConfig(cliConfig)
+		verifyCache()
+	}
+
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd, cacheVerifyCmd)
+
+	rootCmd.AddCommand(projectCmd, lockCmd, articleCmd, bookPageCmd, standaloneCmd, cacheCmd)
 
 	rootCmd.InitDefaultHelpCmd()
 	var helpCommand *cobra.Command
@@ -214,6 +341,33 @@ func initialize(cliLogging string, cliConfig *config.Configuration, cliConfigFil
 	return cliOutputFile
 }
 
+// cachePoliciesFlag is a flag value for the cache policies (s. config.Configuration.CachePolicies) given as JSON object.
+type cachePoliciesFlag struct {
+	policies *map[string]config.CachePolicy
+}
+
+func (f *cachePoliciesFlag) String() string {
+	policiesBytes, err := json.Marshal(*f.policies)
+	if err != nil {
+		return ""
+	}
+	return string(policiesBytes)
+}
+
+func (f *cachePoliciesFlag) Set(value string) error {
+	policies := map[string]config.CachePolicy{}
+	err := json.Unmarshal([]byte(value), &policies)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse cache policies '%s'", value)
+	}
+	*f.policies = policies
+	return nil
+}
+
+func (f *cachePoliciesFlag) Type() string {
+	return "json"
+}
+
 func getCommand(use string, shortDoc string) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   use,
@@ -225,7 +379,48 @@ func getCommand(use string, shortDoc string) *cobra.Command {
 	return cmd
 }
 
-func generateProjectEbook(projectFile string, outputFile string) {
+func printCacheStats(numberOfOldestEntries int) {
+	stats, err := cache.GetStats(numberOfOldestEntries)
+	sigolo.FatalCheck(err)
+
+	sigolo.Infof("Cache '%s' contains %d files (%.2f MB)", config.Current.CacheDir, stats.Files, util.ToMB(stats.SizeInBytes))
+	for _, folderStats := range stats.Folders {
+		sigolo.Infof("  %-12s %8d files %12.2f MB", folderStats.Folder, folderStats.Files, util.ToMB(folderStats.SizeInBytes))
+	}
+
+	if len(stats.OldestEntries) == 0 {
+		return
+	}
+
+	sigolo.Infof("Least recently used files:")
+	for _, entry := range stats.OldestEntries {
+		sigolo.Infof("  %s  %10.2f MB  %s", entry.LastAccess.Format(time.DateTime), util.ToMB(entry.Size), entry.Path)
+	}
+}
+
+func verifyCache() {
+	result, err := cache.Verify()
+	sigolo.FatalCheck(err)
+
+	for _, file := range result.EmptyFiles {
+		sigolo.Warnf("Empty file: %s", file)
+	}
+	for _, file := range result.ModifiedFiles {
+		sigolo.Warnf("File size differs from cache index (truncated or modified file): %s", file)
+	}
+	for _, file := range result.TempFiles {
+		sigolo.Warnf("Leftover temp file: %s", file)
+	}
+
+	if result.NumberOfProblems() > 0 {
+		// Exiting skips the usual cleanup, which is therefore done here.
+		removeTempDir()
+		sigolo.Fatalf("Found %d problems in cache '%s'. Use the 'cache clear' command or remove the files manually.", result.NumberOfProblems(), config.Current.CacheDir)
+	}
+	sigolo.Infof("No problems found in cache '%s'", config.Current.CacheDir)
+}
+
+func generateProjectEbook(projectFile string, outputFile string, lockMode string) {
 	var err error
 
 	sigolo.Infof("Use project file: '%s'", projectFile)
@@ -248,6 +443,8 @@ func generateProjectEbook(projectFile string, outputFile string) {
 	sigolo.Debug("Turn output file path into absolute path")
 	proj.OutputFile, err = util.ToAbsolutePath(proj.OutputFile)
 	sigolo.FatalCheck(err)
+	proj.LockFile, err = util.ToAbsolutePath(proj.LockFile)
+	sigolo.FatalCheck(err)
 
 	config.MergeIntoCurrentConfig(&proj.Configuration)
 	config.MergeIntoCurrentConfig(cliConfig)
@@ -255,7 +452,7 @@ func generateProjectEbook(projectFile string, outputFile string) {
 	config.Current.Print()
 	proj.Print()
 
-	generateBookFromArticles(proj)
+	generateBookFromArticles(proj, lockMode)
 }
 
 func generateStandaloneEbook(inputFile string, outputFile string) {
@@ -281,16 +478,34 @@ func generateStandaloneEbook(inputFile string, outputFile string) {
 		http.NewDefaultHttpService(),
 	)
 
-	tokenizer := parser.NewTokenizer(wikipediaService)
+	articleSource, err := wikipedia.NewArticleSource(wikipediaService)
+	sigolo.FatalCheck(err)
+
+	tokenizer := parser.NewTokenizer(wikipediaService, templateSourceOf(articleSource))
 	article, err := tokenizer.Tokenize(string(fileContent), title)
 	sigolo.FatalCheck(err)
 
 	err = wikipediaService.DownloadImages(article.Images)
 	sigolo.FatalCheck(err)
 
+	if config.Current.OutputType == config.OutputTypeMarkdown {
+		markdownGenerator := generator.NewMarkdownGenerator(article.TokenMap, wikipediaService)
+		markdownFilePath, err := markdownGenerator.Generate(article)
+		sigolo.FatalCheck(err)
+
+		sigolo.Infof("Start generating %s file", config.Current.OutputType)
+		err = generator.GenerateMarkdown([]string{markdownFilePath}, outputFile)
+		sigolo.FatalCheck(err)
+
+		absoluteOutputFile, err := util.ToAbsolutePath(outputFile)
+		sigolo.FatalCheck(err)
+		sigolo.Infof("Successfully created %s file '%s'", config.Current.OutputType, absoluteOutputFile)
+		return
+	}
+
 	// TODO Adjust this when additional non-epub output types are supported.
-	htmlFilePath := path.Join(cache.HtmlCacheDirName, article.Title+".html")
-	if shouldRecreateHtml(htmlFilePath, config.Current.ForceRegenerateHtml) {
+	htmlFilePath := cache.GetFilePathInCache(cache.HtmlCacheDirName, article.Title+".html")
+	if shouldRecreateHtml(article.Title+".html", config.Current.ForceRegenerateHtml) {
 		htmlGenerator := &generator.HtmlGenerator{
 			TokenMap:         article.TokenMap,
 			WikipediaService: wikipediaService,
@@ -304,13 +519,19 @@ func generateStandaloneEbook(inputFile string, outputFile string) {
 		Title: title,
 	}
 
-	err = generator.GenerateEpub([]string{htmlFilePath}, outputFile, metadata)
+	switch config.Current.OutputType {
+	case config.OutputTypePdf:
+		err = generator.GeneratePdf([]string{htmlFilePath}, outputFile, metadata)
+	case config.OutputTypeHtmlSite:
+		err = generator.GenerateHtmlSite([]string{article.Title}, []string{htmlFilePath}, outputFile, metadata)
+	case config.OutputTypeAzw3:
+		err = generator.GenerateKindle([]string{htmlFilePath}, outputFile, metadata)
+	default:
+		err = generator.GenerateEpub([]string{htmlFilePath}, outputFile, metadata)
+	}
 	sigolo.FatalCheck(err)
 
-	err = os.RemoveAll(cache.GetTempPath())
-	if err != nil {
-		sigolo.Warnf("Error cleaning up '%s' directory", cache.GetTempPath())
-	}
+	removeTempDir()
 
 	absoluteOutputFile, err := util.ToAbsolutePath(outputFile)
 	sigolo.FatalCheck(err)
@@ -318,32 +539,76 @@ func generateStandaloneEbook(inputFile string, outputFile string) {
 }
 
 func generateArticleEbook(articleName string, outputFile string) {
-	var articles []string
-	articles = append(articles, articleName)
-
 	proj := &config.Project{}
 	proj.Metadata = config.Metadata{}
 	proj.OutputFile = outputFile
-	proj.Articles = articles
+	proj.Articles = config.NewArticles(articleName)
 
 	config.Current.Print()
 
-	generateBookFromArticles(proj)
+	generateBookFromArticles(proj, lockModeRead)
+}
+
+func generateBookPageEbook(bookPageTitle string, outputFile string) {
+	config.Current.Print()
+
+	// The book page is downloaded before the usual book generation, which requires the cache to exist.
+	util.EnsureDirectory(cache.GetTempPath())
+	util.EnsureDirectory(cache.GetDirPathInCache(cache.ArticleCacheDirName))
+
+	wikipediaService := wikipedia.NewWikipediaService(
+		config.Current.WikipediaInstance,
+		config.Current.WikipediaHost,
+		config.Current.WikipediaImageArticleHosts,
+		config.Current.WikipediaImageHost,
+		config.Current.WikipediaMathRestApi,
+		image.NewImageProcessingService(),
+		http.NewDefaultHttpService(),
+	)
+
+	articleSource, err := wikipedia.NewArticleSource(wikipediaService)
+	sigolo.FatalCheck(err)
+
+	proj, err := wikipedia.GetBookPageProject(articleSource, bookPageTitle)
+	sigolo.FatalCheck(err)
+	proj.OutputFile = outputFile
+
+	proj.Print()
+
+	generateBookFromArticles(proj, lockModeRead)
 }
 
-func generateBookFromArticles(project *config.Project) {
-	articles := project.Articles
+// generateBookFromArticles creates the book of the given project. The lock mode (e.g. lockModeArticles) defines how
+// the lock file of the project is used, which only has an effect when the project has a lock file.
+func generateBookFromArticles(project *config.Project, lockMode string) {
+	bookEntries := project.BookEntries()
+	articles := project.AllArticles()
 	metadata := project.Metadata
 
 	outputFile := ensurePathsAndClearTempDir(project.OutputFile)
 
 	config.Current.AssertFilesAndPathsExists()
 
-	numberOfArticles := len(articles)
-	articleOutputFiles := make([]string, numberOfArticles)
+	httpService := http.NewDefaultHttpService()
 
-	articleChan := make(chan string, config.Current.WorkerThreads)
-	sigolo.Debugf("Use %d worker threads to process the articles", config.Current.WorkerThreads)
+	// The lock file contains the revisions used the last time this project was built. Articles without explicit
+	// revision or date use these revisions, so that the book contains the same texts as before.
+	var lockFile *config.LockFile
+	if project.LockFile != "" {
+		var err error
+		lockFile, err = config.LoadLockFile(project.LockFile)
+		sigolo.FatalCheck(err)
+
+		if lockMode == lockModeFrozen {
+			if len(lockFile.Files) == 0 {
+				sigolo.Fatalf("Lock file '%s' does not contain any files, use the 'lock' command to create them", project.LockFile)
+			}
+			sigolo.Infof("Only use the %d files of lock file '%s'", len(lockFile.Files), project.LockFile)
+			httpService.Freeze(lockFile.Files)
+		} else if lockMode == lockModeFiles {
+			httpService.RecordHashes()
+		}
+	}
 
 	wikipediaService := wikipedia.NewWikipediaService(
 		config.Current.WikipediaInstance,
@@ -352,9 +617,121 @@ func generateBookFromArticles(project *config.Project) {
 		config.Current.WikipediaImageHost,
 		config.Current.WikipediaMathRestApi,
 		image.NewImageProcessingService(),
-		http.NewDefaultHttpService(),
+		httpService,
 	)
 
+	articleSource, err := wikipedia.NewArticleSource(wikipediaService)
+	sigolo.FatalCheck(err)
+
+	if len(project.Categories) > 0 {
+		categoryArticles, err := wikipedia.ArticlesOfCategories(wikipediaService, project.Categories)
+		sigolo.FatalCheck(err)
+		sigolo.Infof("Found %d articles in the categories of the project", len(categoryArticles))
+
+		// Explicitly listed articles come first, since their order has been chosen by the author of the project.
+		for _, categoryArticle := range categoryArticles {
+			if !util.Contains(articles, categoryArticle) {
+				articles = append(articles, categoryArticle)
+				bookEntries = append(bookEntries, config.BookEntry{Title: categoryArticle, IsArticle: true, Depth: 1})
+			}
+		}
+	}
+
+	// Parts and chapters are separate pages between the articles, which is only supported by output types that combine
+	// the HTML files of all articles into one document.
+	useBookStructure := false
+	if project.HasStructure() {
+		switch config.Current.OutputType {
+		case config.OutputTypeEpub2:
+			fallthrough
+		case config.OutputTypeEpub3:
+			fallthrough
+		case config.OutputTypePdf:
+			fallthrough
+		case config.OutputTypeAzw3:
+			useBookStructure = true
+		default:
+			sigolo.Warnf("Output type '%s' does not support parts and chapters, all articles will be on the same level", config.Current.OutputType)
+		}
+	}
+
+	articleEntries := map[string]config.BookEntry{}
+	numberOfLockedArticles := 0
+	for _, entry := range bookEntries {
+		if entry.IsArticle {
+			if !useBookStructure {
+				entry.Depth = 1
+			}
+			if lockFile != nil && entry.Revision == 0 && entry.Date == "" {
+				if lockedArticle, ok := lockFile.Articles[entry.Title]; ok {
+					sigolo.Debugf("Use revision %d of article '%s' from lock file", lockedArticle.Revision, entry.Title)
+					entry.Revision = lockedArticle.Revision
+					numberOfLockedArticles++
+				}
+			}
+			articleEntries[entry.Title] = entry
+		}
+	}
+	if numberOfLockedArticles > 0 {
+		sigolo.Infof("Use revisions of %d articles from lock file '%s'. Remove the lock file to use the latest revisions.", numberOfLockedArticles, project.LockFile)
+	}
+
+	// Articles with a revision are downloaded by their revision ID. The files of such downloads are different from the
+	// files of the latest revisions, which is why all articles must have a revision when locking the files. Otherwise,
+	// a frozen build would use files not contained in the lock file.
+	if lockMode == lockModeFiles {
+		for title, entry := range articleEntries {
+			if entry.Revision == 0 && entry.Date == "" {
+				article, err := articleSource.GetArticle(title)
+				sigolo.FatalCheck(err)
+				entry.Revision = article.Parse.RevisionId
+				articleEntries[title] = entry
+			}
+		}
+	}
+
+	if useBookStructure {
+		// The TOC depth refers to the headings of the articles, so parts and chapters must not hide them.
+		if config.Current.TocDepth > 0 {
+			config.Current.TocDepth = min(config.Current.TocDepth+project.StructureDepth(), 6)
+			sigolo.Debugf("Increased TOC depth to %d due to parts and chapters of project", config.Current.TocDepth)
+		}
+	}
+
+	numberOfArticles := len(articles)
+	articleOutputFiles := make([]string, numberOfArticles)
+	articleRevisions := make([]int, numberOfArticles)
+	articleImages := make([][]string, numberOfArticles)
+
+	forceRecreateHtml := shouldForceRecreateHtml(lockMode)
+
+	articleChan := make(chan string, config.Current.WorkerThreads)
+	sigolo.Debugf("Use %d worker threads to process the articles", config.Current.WorkerThreads)
+
+	// Links between articles only make sense when there are at least two of them. The website is an exception, since
+	// its pages are linked from the index page anyway.
+	var internalLinkTargets generator.InternalLinkTargets
+	switch config.Current.OutputType {
+	case config.OutputTypeHtmlSite:
+		internalLinkTargets = generator.NewHtmlSiteLinkTargets(articles)
+	case config.OutputTypeEpub2:
+		fallthrough
+	case config.OutputTypeEpub3:
+		fallthrough
+	case config.OutputTypePdf:
+		fallthrough
+	case config.OutputTypeAzw3:
+		if len(articles) > 1 {
+			internalLinkTargets = generator.NewEpubLinkTargets(articles)
+		}
+	}
+	if internalLinkTargets != nil {
+		// Project articles might be redirects, so links to the actual articles should also work.
+		redirects, err := articleSource.ResolveRedirects(articles)
+		sigolo.FatalCheck(err)
+		internalLinkTargets = internalLinkTargets.WithRedirects(redirects)
+	}
+
 	// Create a wait-group that is zero when all threads are done
 	threadPoolWaitGroup := &sync.WaitGroup{}
 	threadPoolWaitGroup.Add(config.Current.WorkerThreads)
@@ -374,8 +751,10 @@ func generateBookFromArticles(project *config.Project) {
 					}
 				}
 
-				thisArticleOutputFile := processArticle(articleName, articleNumber+1, numberOfArticles, wikipediaService)
+				thisArticleOutputFile, thisArticleRevision, thisArticleImages := processArticle(articleEntries[articleName], articleNumber+1, numberOfArticles, articleSource, wikipediaService, internalLinkTargets, forceRecreateHtml)
 				articleOutputFiles[articleNumber] = thisArticleOutputFile
+				articleRevisions[articleNumber] = thisArticleRevision
+				articleImages[articleNumber] = thisArticleImages
 			}
 
 			// This thread will close, so mark it as done in the wait-group
@@ -395,12 +774,83 @@ func generateBookFromArticles(project *config.Project) {
 	threadPoolWaitGroup.Wait()
 	sigolo.Debugf("Worker threads are done processing articles")
 
+	wikipediaArticleHost := fmt.Sprintf("%s.%s", config.Current.WikipediaInstance, config.Current.WikipediaHost)
+	for i, article := range articles {
+		if articleRevisions[i] != 0 {
+			metadata.Sources = append(metadata.Sources, wikipedia.ArticleRevisionUrl(wikipediaArticleHost, article, articleRevisions[i]))
+		}
+	}
+
+	var images []string
+	for _, imagesOfArticle := range articleImages {
+		images = append(images, imagesOfArticle...)
+	}
+
+	bookOutputFiles := articleOutputFiles
+	if useBookStructure {
+		sigolo.Infof("Generate pages of parts and chapters")
+		var structureImages []string
+		bookOutputFiles, structureImages = generateBookStructure(bookEntries, articles, articleOutputFiles, articleSource, wikipediaService, internalLinkTargets)
+		images = append(images, structureImages...)
+	}
+
+	if config.Current.AttributionAppendix {
+		switch config.Current.OutputType {
+		case config.OutputTypeEpub2:
+			fallthrough
+		case config.OutputTypeEpub3:
+			fallthrough
+		case config.OutputTypePdf:
+			fallthrough
+		case config.OutputTypeAzw3:
+			sigolo.Infof("Generate page of sources and licenses")
+			attributionPageFile, err := generateAttributionPage(articles, articleRevisions, images, wikipediaService)
+			sigolo.FatalCheck(err)
+			bookOutputFiles = append(bookOutputFiles, attributionPageFile)
+		default:
+			sigolo.Debugf("Output type '%s' does not support the page of sources and licenses", config.Current.OutputType)
+		}
+	}
+
+	// All downloads are done at this point, so the lock file contains all files needed for the book.
+	if lockFile != nil && (lockMode == lockModeArticles || lockMode == lockModeFiles) {
+		lockFile.Articles = map[string]config.LockedArticle{}
+		for i, article := range articles {
+			if articleRevisions[i] != 0 {
+				lockFile.Articles[article] = config.LockedArticle{Revision: articleRevisions[i]}
+			}
+		}
+
+		if lockMode == lockModeFiles {
+			lockFile.Files = httpService.UsedFiles()
+		}
+
+		sigolo.Infof("Write %d articles and %d files to lock file '%s'", len(lockFile.Articles), len(lockFile.Files), project.LockFile)
+		err = lockFile.Save(project.LockFile)
+		if err != nil {
+			// The book itself doesn't depend on the lock file, so it's still generated.
+			sigolo.Errorf("Unable to write lock file '%s': %s", project.LockFile, err.Error())
+		}
+	}
+
 	sigolo.Infof("Start generating %s file", config.Current.OutputType)
 	switch config.Current.OutputType {
 	case config.OutputTypeEpub2:
 		fallthrough
 	case config.OutputTypeEpub3:
-		err := generator.GenerateEpub(articleOutputFiles, outputFile, metadata)
+		err := generator.GenerateEpub(bookOutputFiles, outputFile, metadata)
+		sigolo.FatalCheck(err)
+	case config.OutputTypePdf:
+		err := generator.GeneratePdf(bookOutputFiles, outputFile, metadata)
+		sigolo.FatalCheck(err)
+	case config.OutputTypeAzw3:
+		err := generator.GenerateKindle(bookOutputFiles, outputFile, metadata)
+		sigolo.FatalCheck(err)
+	case config.OutputTypeMarkdown:
+		err := generator.GenerateMarkdown(articleOutputFiles, outputFile)
+		sigolo.FatalCheck(err)
+	case config.OutputTypeHtmlSite:
+		err := generator.GenerateHtmlSite(articles, articleOutputFiles, outputFile, metadata)
 		sigolo.FatalCheck(err)
 	case config.OutputTypeStatsJson:
 		fallthrough
@@ -409,10 +859,7 @@ func generateBookFromArticles(project *config.Project) {
 		sigolo.FatalCheck(err)
 	}
 
-	err := os.RemoveAll(cache.GetTempPath())
-	if err != nil {
-		sigolo.Warnf("Error cleaning up '%s' directory", cache.GetTempPath())
-	}
+	removeTempDir()
 
 	absoluteOutputFile, err := util.ToAbsolutePath(outputFile)
 	sigolo.FatalCheck(err)
@@ -421,40 +868,81 @@ func generateBookFromArticles(project *config.Project) {
 
 // processArticle processes a given article, which means, the content (including images etc.) is downloaded and the
 // article will be tokenized, parsed and converted into the output format stored in the current configuration.
-func processArticle(articleName string, currentArticleNumber int, totalNumberOfArticles int, wikipediaService *wikipedia.DefaultWikipediaService) string {
+//
+// The ID of the used revision of the article is returned as well, which is 0 if the article source doesn't know it.
+// The returned images are the ones used by the article. When existing HTML is reused, they are read from the file stored
+// next to it (s. writeArticleImages). Existing HTML is never reused when forceRecreateHtml is true.
+func processArticle(articleEntry config.BookEntry, currentArticleNumber int, totalNumberOfArticles int, articleSource wikipedia.ArticleSource, wikipediaService *wikipedia.DefaultWikipediaService, internalLinkTargets generator.InternalLinkTargets, forceRecreateHtml bool) (string, int, []string) {
+	articleName := articleEntry.Title
+	headingOffset := articleEntry.Depth - 1
 	sigolo.Infof("Article '%s' (%d/%d): Start processing", articleName, currentArticleNumber, totalNumberOfArticles)
 
-	wikipediaArticleHost := fmt.Sprintf("%s.%s", config.Current.WikipediaInstance, config.Current.WikipediaHost)
-	htmlFilePath := filepath.Join(cache.HtmlCacheDirName, articleName+".html") // TODO use generator to get this file (currently determining the filepath happens twice)
+	// The article is needed in any case to know its revision. Getting it is cheap when it's already in the cache.
+	sigolo.Debugf("Article '%s' (%d/%d): Get article from %s", articleName, currentArticleNumber, totalNumberOfArticles, config.Current.ArticleSource)
+	wikiArticleDto, err := getArticle(articleEntry, articleSource)
+	sigolo.FatalCheck(err)
+
+	htmlFileName := articleHtmlFileName(articleEntry, wikiArticleDto.Parse.RevisionId, internalLinkTargets)
+	htmlFilePath := cache.GetFilePathInCache(cache.HtmlCacheDirName, htmlFileName+".html")
 	articleOutputFile := ""
-	if !shouldRecreateHtml(htmlFilePath, config.Current.ForceRegenerateHtml) {
+	var articleImages []string
+	reuseHtml := !shouldRecreateHtml(htmlFileName+".html", forceRecreateHtml)
+	if reuseHtml {
+		// The attribution page needs to know the images of the article, which are stored next to its HTML.
+		articleImages, err = readArticleImages(htmlFileName)
+		if err != nil {
+			sigolo.Debugf("Article '%s' (%d/%d): Images of existing HTML unknown, HTML will be recreated: %s", articleName, currentArticleNumber, totalNumberOfArticles, err.Error())
+			reuseHtml = false
+		}
+	}
+
+	if reuseHtml {
 		sigolo.Debugf("Article '%s' (%d/%d): HTML for article does already exist. Skip parsing and HTML generation.", articleName, currentArticleNumber, totalNumberOfArticles)
+		articleOutputFile = htmlFilePath
+		// The images aren't downloaded, which would protect them from being evicted by other processes using the cache.
+		wikipedia.MarkImagesAccessed(articleImages)
 	} else {
-		sigolo.Debugf("Article '%s' (%d/%d): Download article", articleName, currentArticleNumber, totalNumberOfArticles)
-		wikiArticleDto, err := wikipediaService.DownloadArticle(wikipediaArticleHost, articleName)
-		sigolo.FatalCheck(err)
-
 		sigolo.Debugf("Article '%s' (%d/%d): Tokenize content", articleName, currentArticleNumber, totalNumberOfArticles)
-		tokenizer := parser.NewTokenizer(wikipediaService)
+		tokenizer := parser.NewTokenizer(wikipediaService, templateSourceOf(articleSource))
+		tokenizer.SelectSections(articleEntry.Sections, articleEntry.ExcludeSections)
 		article, err := tokenizer.Tokenize(wikiArticleDto.Parse.Wikitext.Content, wikiArticleDto.Parse.OriginalTitle)
 		sigolo.FatalCheck(err)
 
 		sigolo.Debugf("Article '%s' (%d/%d): Download images", articleName, currentArticleNumber, totalNumberOfArticles)
 		err = wikipediaService.DownloadImages(article.Images)
 		sigolo.FatalCheck(err)
+		articleImages = article.Images
 
 		switch config.Current.OutputType {
 		case config.OutputTypeEpub2:
 			fallthrough
 		case config.OutputTypeEpub3:
+			fallthrough
+		case config.OutputTypePdf:
+			fallthrough
+		case config.OutputTypeAzw3:
+			fallthrough
+		case config.OutputTypeHtmlSite:
 			sigolo.Debugf("Article '%s' (%d/%d): Generate HTML", articleName, currentArticleNumber, totalNumberOfArticles)
 			htmlGenerator := &generator.HtmlGenerator{
-				TokenMap:         article.TokenMap,
-				WikipediaService: wikipediaService,
+				TokenMap:            article.TokenMap,
+				WikipediaService:    wikipediaService,
+				ArticleSource:       articleSource,
+				InternalLinkTargets: internalLinkTargets,
+				HeadingOffset:       headingOffset,
+				FileName:            htmlFileName,
 			}
 			htmlFilePath, err = htmlGenerator.Generate(article)
 			articleOutputFile = htmlFilePath
 			sigolo.FatalCheck(err)
+
+			err = writeArticleImages(htmlFileName, articleImages)
+			sigolo.FatalCheck(err)
+		case config.OutputTypeMarkdown:
+			sigolo.Debugf("Article '%s' (%d/%d): Generate Markdown", articleName, currentArticleNumber, totalNumberOfArticles)
+			markdownGenerator := generator.NewMarkdownGenerator(article.TokenMap, wikipediaService)
+			articleOutputFile, err = markdownGenerator.Generate(article)
+			sigolo.FatalCheck(err)
 		case config.OutputTypeStatsJson:
 			fallthrough
 		case config.OutputTypeStatsTxt:
@@ -467,23 +955,250 @@ func processArticle(articleName string, currentArticleNumber int, totalNumberOfA
 
 	sigolo.Debugf("Article '%s' (%d/%d): Finished processing", articleName, currentArticleNumber, totalNumberOfArticles)
 
-	return articleOutputFile
+	return articleOutputFile, wikiArticleDto.Parse.RevisionId, articleImages
+}
+
+// articleHtmlFileName returns the name of the HTML file of the given article without file extension. The HTML depends
+// on the revision and the project (links to other articles, heading depths, selected sections and image credits), so
+// the name contains a hash of all these parameters. This way, the HTML is reused as long as nothing changed and projects using the same
+// cache, even at the same time, don't overwrite each other's HTML files.
+func articleHtmlFileName(articleEntry config.BookEntry, revision int, internalLinkTargets generator.InternalLinkTargets) string {
+	linkTargetsHash := ""
+	if internalLinkTargets != nil {
+		linkTargetsHash = internalLinkTargets.Hash()
+	}
+	// The keys of the image credit templates are printed in sorted order, so the hash doesn't depend on the map order.
+	parameters := fmt.Sprintf("%d|%d|%q|%q|%s|%t|%q", revision, articleEntry.Depth-1, articleEntry.Sections, articleEntry.ExcludeSections, linkTargetsHash, config.Current.ImageCredits, config.Current.ImageCreditTemplates)
+	return articleEntry.Title + "-" + util.Hash(parameters)
+}
+
+// writeArticleImages stores the given images of an article next to its HTML file with the given name (without file
+// extension), so that the images are known when the HTML is reused.
+func writeArticleImages(htmlFileName string, images []string) error {
+	if images == nil {
+		images = []string{}
+	}
+
+	imagesJson, err := json.Marshal(images)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to serialize images of HTML file '%s'", htmlFileName)
+	}
+
+	_, err = cache.CacheToFile(cache.HtmlCacheDirName, htmlFileName+articleImagesFileSuffix, bytes.NewReader(imagesJson))
+	if err != nil {
+		return errors.Wrapf(err, "Unable to write images of HTML file '%s'", htmlFileName)
+	}
+	return nil
+}
+
+// readArticleImages returns the images stored by writeArticleImages for the HTML file with the given name (without
+// file extension). An error is returned when the images are unknown.
+func readArticleImages(htmlFileName string) ([]string, error) {
+	imagesFilePath, exists, err := cache.GetFile(cache.HtmlCacheDirName, htmlFileName+articleImagesFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.Errorf("File '%s' with images of HTML file does not exist", imagesFilePath)
+	}
+
+	imagesJson, err := util.CurrentFilesystem.ReadFile(imagesFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read images of HTML file from '%s'", imagesFilePath)
+	}
+
+	var images []string
+	err = json.Unmarshal(imagesJson, &images)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse images of HTML file from '%s'", imagesFilePath)
+	}
+	return images, nil
+}
+
+// templateSourceOf returns the source of template pages for the local template evaluation. Template pages are only
+// read from dumps: With the API as article source, each template page would be an additional request, which is
+// not cheaper than evaluating the template remotely in the first place.
+func templateSourceOf(articleSource wikipedia.ArticleSource) wikipedia.ArticleSource {
+	if config.Current.ArticleSource != config.ArticleSourceDump {
+		return nil
+	}
+	return articleSource
+}
+
+// getArticle returns the revision of the article the entry is pinned to, either by its revision ID or its date. The
+// latest revision is returned for entries that are not pinned.
+func getArticle(articleEntry config.BookEntry, articleSource wikipedia.ArticleSource) (*wikipedia.WikiArticleDto, error) {
+	revision := articleEntry.Revision
+	if revision == 0 && articleEntry.Date != "" {
+		var err error
+		revision, err = articleSource.GetRevisionAtDate(articleEntry.Title, articleEntry.Date)
+		if err != nil {
+			return nil, err
+		}
+		sigolo.Debugf("Use revision %d of article '%s' at %s", revision, articleEntry.Title, articleEntry.Date)
+	}
+
+	if revision == 0 {
+		return articleSource.GetArticle(articleEntry.Title)
+	}
+	return articleSource.GetArticleRevision(articleEntry.Title, revision)
+}
+
+// generateBookStructure creates the HTML pages of all parts and chapters. The files of these pages and the given
+// article files are returned in the order of the book together with the images used in the intros of these pages.
+func generateBookStructure(bookEntries []config.BookEntry, articles []string, articleOutputFiles []string, articleSource wikipedia.ArticleSource, wikipediaService *wikipedia.DefaultWikipediaService, internalLinkTargets generator.InternalLinkTargets) ([]string, []string) {
+	articleOutputFilesByName := map[string]string{}
+	for i, article := range articles {
+		articleOutputFilesByName[article] = articleOutputFiles[i]
+	}
+
+	var bookOutputFiles []string
+	var images []string
+	numberOfStructurePages := 0
+	for _, entry := range bookEntries {
+		if entry.IsArticle {
+			bookOutputFiles = append(bookOutputFiles, articleOutputFilesByName[entry.Title])
+			continue
+		}
+
+		numberOfStructurePages++
+		sigolo.Debugf("Generate page of part or chapter '%s'", entry.Title)
+
+		var intro *parser.Article
+		tokenMap := map[string]parser.Token{}
+		if strings.TrimSpace(entry.Intro) != "" {
+			var err error
+			tokenizer := parser.NewTokenizer(wikipediaService, templateSourceOf(articleSource))
+			intro, err = tokenizer.Tokenize(entry.Intro, entry.Title)
+			sigolo.FatalCheck(err)
+
+			err = wikipediaService.DownloadImages(intro.Images)
+			sigolo.FatalCheck(err)
+
+			tokenMap = intro.TokenMap
+			images = append(images, intro.Images...)
+		}
+
+		htmlGenerator := &generator.HtmlGenerator{
+			TokenMap:            tokenMap,
+			WikipediaService:    wikipediaService,
+			ArticleSource:       articleSource,
+			InternalLinkTargets: internalLinkTargets,
+			HeadingOffset:       entry.Depth - 1,
+		}
+		fileName := fmt.Sprintf(structurePageFileNameTemplate, numberOfStructurePages)
+		structurePageFile, err := htmlGenerator.GenerateStructurePage(fileName, entry.Title, intro)
+		sigolo.FatalCheck(err)
+
+		bookOutputFiles = append(bookOutputFiles, structurePageFile)
+	}
+
+	return bookOutputFiles, images
 }
 
-func shouldRecreateHtml(htmlFilePath string, forceHtmlRecreate bool) bool {
-	if forceHtmlRecreate || config.Current.OutputType == config.OutputTypeStatsJson || config.Current.OutputType == config.OutputTypeStatsTxt {
+// generateAttributionPage creates the HTML page listing the sources, authors and licenses of the given articles and
+// images. The given revisions belong to the articles, a revision of 0 means the latest revision is used.
+func generateAttributionPage(articles []string, articleRevisions []int, images []string, wikipediaService wikipedia.WikipediaService) (string, error) {
+	wikipediaArticleHost := fmt.Sprintf("%s.%s", config.Current.WikipediaInstance, config.Current.WikipediaHost)
+
+	textLicense, err := wikipediaService.GetTextLicense(wikipediaArticleHost)
+	if err != nil {
+		return "", err
+	}
+
+	var articleAttributions []generator.ArticleAttribution
+	for i, article := range articles {
+		articleUrl := wikipedia.ArticleUrl(wikipediaArticleHost, article)
+		if articleRevisions[i] != 0 {
+			articleUrl = wikipedia.ArticleRevisionUrl(wikipediaArticleHost, article, articleRevisions[i])
+		}
+
+		// Dumps don't contain the contributors and the API might know a different version of the article.
+		var contributors *wikipedia.ArticleContributors
+		if config.Current.ArticleSource != config.ArticleSourceDump {
+			contributors, err = wikipediaService.GetArticleContributors(wikipediaArticleHost, article)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		articleAttributions = append(articleAttributions, generator.ArticleAttribution{
+			Title:        article,
+			Url:          articleUrl,
+			Contributors: contributors,
+		})
+	}
+
+	// Images can be used multiple times and with different (e.g. localized) prefixes.
+	var uniqueImages []string
+	knownImages := map[string]bool{}
+	for _, image := range images {
+		_, imageName, _ := strings.Cut(image, ":")
+		if !knownImages[imageName] {
+			knownImages[imageName] = true
+			uniqueImages = append(uniqueImages, image)
+		}
+	}
+
+	metadataByImage, err := wikipediaService.GetImagesMetadata(uniqueImages)
+	if err != nil {
+		return "", err
+	}
+
+	var imageMetadata []wikipedia.ImageMetadata
+	for _, image := range uniqueImages {
+		metadata, ok := metadataByImage[image]
+		if !ok {
+			// The image itself couldn't be downloaded in this case, so it's not part of the book anyway.
+			sigolo.Errorf("Unable to find metadata of image '%s', it will not be listed on the page of sources and licenses", image)
+			continue
+		}
+		imageMetadata = append(imageMetadata, *metadata)
+	}
+
+	htmlGenerator := &generator.HtmlGenerator{
+		TokenMap:         map[string]parser.Token{},
+		WikipediaService: wikipediaService,
+	}
+	return htmlGenerator.GenerateAttributionPage(attributionPageFileName, attributionPageTitle, textLicense, articleAttributions, imageMetadata)
+}
+
+// shouldForceRecreateHtml returns whether existing HTML must not be reused in the given lock mode. Reused HTML doesn't
+// request its images, templates and math again. When locking files, they would be missing in the lock file and in
+// frozen mode, they wouldn't be verified. Therefore, the HTML is always recreated in these modes.
+func shouldForceRecreateHtml(lockMode string) bool {
+	return config.Current.ForceRegenerateHtml || lockMode == lockModeFiles || lockMode == lockModeFrozen
+}
+
+// shouldRecreateHtml returns whether the given HTML file within the HTML cache must be (re)created. Existing HTML files
+// are marked as accessed in the cache, so that other processes using the cache don't evict them.
+func shouldRecreateHtml(htmlFileName string, forceHtmlRecreate bool) bool {
+	if forceHtmlRecreate || config.Current.OutputType == config.OutputTypeStatsJson || config.Current.OutputType == config.OutputTypeStatsTxt || config.Current.OutputType == config.OutputTypeMarkdown || config.Current.OutputType == config.OutputTypeHtmlSite {
 		return true
 	}
 
 	// Check if HTML file already exists. If so, no recreate is wanted.
-	_, err := os.Stat(htmlFilePath)
-	htmlFileExists := err == nil
+	_, htmlFileExists, err := cache.GetFile(cache.HtmlCacheDirName, htmlFileName)
+	if err != nil {
+		sigolo.Debugf("Unable to determine whether HTML file '%s' exists, it will be recreated: %s", htmlFileName, err.Error())
+		return true
+	}
 
 	return !htmlFileExists
 }
 
+// removeTempDir removes the temp folder of this process. Other processes using the same cache consider files used by
+// this process to be in use as long as this folder exists (s. cache.GetTempPath).
+func removeTempDir() {
+	err := os.RemoveAll(cache.GetTempPath())
+	if err != nil {
+		sigolo.Warnf("Error cleaning up '%s' directory", cache.GetTempPath())
+	}
+}
+
 // ensurePathsAndClearTempDir ensures that the output folder for the given outputFile exists and clears up any
-// temporary files in the temp files folder that might still exist from previous runs.
+// temporary files in the temp files folder that might still exist from previous runs. Temp files of other runs using
+// the same cache at the same time are kept.
 func ensurePathsAndClearTempDir(outputFile string) string {
 	var err error
 
@@ -494,6 +1209,45 @@ func ensurePathsAndClearTempDir(outputFile string) string {
 		outputFile, err = util.ToAbsolutePath(outputFile)
 		sigolo.FatalCheck(err)
 	}
+	if config.Current.OutputType == config.OutputTypePdf && strings.HasSuffix(outputFile, defaultEpubOutputFile) {
+		// The default output file is an EPUB, therefore we change it to the default PDF file.
+		outputFile = defaultPdfOutputFile
+		sigolo.Infof("Notice: Changing output file from default '%s' to '%s'", defaultEpubOutputFile, outputFile)
+		outputFile, err = util.ToAbsolutePath(outputFile)
+		sigolo.FatalCheck(err)
+	}
+	if config.Current.OutputType == config.OutputTypeAzw3 && strings.HasSuffix(outputFile, defaultEpubOutputFile) {
+		// The default output file is an EPUB, therefore we change it to the default Kindle file.
+		outputFile = defaultAzw3OutputFile
+		sigolo.Infof("Notice: Changing output file from default '%s' to '%s'", defaultEpubOutputFile, outputFile)
+		outputFile, err = util.ToAbsolutePath(outputFile)
+		sigolo.FatalCheck(err)
+	}
+	if config.Current.OutputType == config.OutputTypeMarkdown {
+		if strings.HasSuffix(outputFile, defaultEpubOutputFile) {
+			// The default output file is an EPUB, therefore we change it to the default Markdown file.
+			outputFile = defaultMarkdownOutputFile
+			sigolo.Infof("Notice: Changing output file from default '%s' to '%s'", defaultEpubOutputFile, outputFile)
+			outputFile, err = util.ToAbsolutePath(outputFile)
+			sigolo.FatalCheck(err)
+		} else if !strings.HasSuffix(outputFile, util.FileEndingMd) {
+			// Output paths not being a Markdown file are folders, which will contain one file per article.
+			err = os.MkdirAll(outputFile, os.ModePerm)
+			sigolo.FatalCheck(errors.Wrapf(err, "Error creating output folder %s", outputFile))
+		}
+	}
+	if config.Current.OutputType == config.OutputTypeHtmlSite {
+		if strings.HasSuffix(outputFile, defaultEpubOutputFile) {
+			// The default output file is an EPUB, therefore we change it to the default website folder.
+			outputFile = defaultHtmlSiteOutputDir
+			sigolo.Infof("Notice: Changing output file from default '%s' to '%s'", defaultEpubOutputFile, outputFile)
+			outputFile, err = util.ToAbsolutePath(outputFile)
+			sigolo.FatalCheck(err)
+		}
+		// The website consists of several files, so the output path is always a folder.
+		err = os.MkdirAll(outputFile, os.ModePerm)
+		sigolo.FatalCheck(errors.Wrapf(err, "Error creating output folder %s", outputFile))
+	}
 	if config.Current.OutputType == config.OutputTypeStatsTxt && !strings.HasSuffix(outputFile, "txt") {
 		// For stats, the output file is not an EPUB, therefore we change the default file in case it's the default EPUB one.
 		outputFile = defaultStatsTxtOutputFile
@@ -527,6 +1281,14 @@ func ensurePathsAndClearTempDir(outputFile string) string {
 			fallthrough
 		case config.OutputTypeEpub3:
 			outputFile = path.Join(outputFile, defaultEpubOutputFile)
+		case config.OutputTypePdf:
+			outputFile = path.Join(outputFile, defaultPdfOutputFile)
+		case config.OutputTypeAzw3:
+			outputFile = path.Join(outputFile, defaultAzw3OutputFile)
+		case config.OutputTypeMarkdown:
+			// Markdown files can be written into a folder, so this is not changed here.
+		case config.OutputTypeHtmlSite:
+			// The website is always written into a folder.
 		case config.OutputTypeStatsJson:
 			outputFile = path.Join(outputFile, defaultStatsJsonOutputFile)
 		case config.OutputTypeStatsTxt:
@@ -538,8 +1300,8 @@ func ensurePathsAndClearTempDir(outputFile string) string {
 	outputFile, err = util.ToAbsolutePath(outputFile)
 	sigolo.FatalCheck(err)
 
-	err = os.RemoveAll(cache.GetTempPath())
-	sigolo.FatalCheck(errors.Wrapf(err, "Error removing '%s' directory", cache.GetTempPath()))
+	err = cache.ClearTempDirs()
+	sigolo.FatalCheck(err)
 
 	sigolo.Debug("Ensure cache directories exist")
 	util.EnsureDirectory(cache.GetTempPath())
@@ -3,9 +3,16 @@ package main
 import (
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"wiki2book/cache"
 	"wiki2book/config"
+	"wiki2book/generator"
+	"wiki2book/http"
+	"wiki2book/image"
 	"wiki2book/test"
+	"wiki2book/util"
+	"wiki2book/wikipedia"
 
 	"github.com/hauke96/sigolo/v2"
 )
@@ -29,6 +36,7 @@ func testProjectGerman(t *testing.T) {
 	generateProjectEbook(
 		"../projects/de/astronomie/astronomie.json",
 		"../.wiki2book/profiling.epub",
+		lockModeArticles,
 	)
 }
 
@@ -43,6 +51,9 @@ func TestCliArgs(t *testing.T) {
 		"--cache-max-size", "123",
 		"--cache-max-age", "234",
 		"--cache-eviction-strategy", "cache-eviction-strategy",
+		"--cache-store", "cache-store",
+		"--cache-store-dir", "cache-store-dir",
+		"--cache-policies", `{"images": {"max-age": 345, "max-size-share": 0.5, "eviction-priority": 1}}`,
 		"--style-file", "style-file",
 		"--cover-image", "cover-image",
 		"--command-template-svg-to-png", "command-template-svg-to-png",
@@ -50,8 +61,10 @@ func TestCliArgs(t *testing.T) {
 		"--command-template-image-processing", "command-template-image-processing",
 		"--command-template-pdf-to-png", "command-template-pdf-to-png",
 		"--command-template-webp-to-png", "command-template-webp-to-png",
+		"--command-template-epub-to-kindle", "command-template-epub-to-kindle",
 		"--pandoc-executable", "pandoc-executable",
 		"--pandoc-data-dir", "pandoc-data-dir",
+		"--pdf-engine", "pdf-engine",
 		"--font-files", "font-files",
 		"--ignored-templates", "ignored-templates",
 		"--trailing-templates", "trailing-templates",
@@ -59,16 +72,26 @@ func TestCliArgs(t *testing.T) {
 		"--ignored-media-types", "ignored-media-types",
 		"--wikipedia-instance", "wikipedia-instance",
 		"--wikipedia-host", "wikipedia-host",
+		"--article-source", "article-source",
+		"--article-dump-file", "article-dump-file",
 		"--wikipedia-image-host", "wikipedia-image-host",
 		"--wikipedia-math-rest-api", "wikipedia-math-rest-api",
 		"--wikipedia-image-article-hosts", "wikipedia-image-article-hosts",
 		"--file-prefixes", "file-prefixes",
 		"--allowed-link-prefixes", "allowed-link-prefixes",
 		"--category-prefixes", "category-prefixes",
+		"--template-prefixes", "template-prefixes",
 		"--math-converter", "math-converter",
 		"--toc-depth", "123",
+		"--attribution-appendix", "attribution-appendix",
+		"--image-credits", "image-credits",
+		"--image-credit-templates", "image-credit-templates=template",
 		"--worker-threads", "234",
+		"--image-worker-threads", "345",
 		"--user-agent-template", "user-agent-template",
+		"--http-requests-per-second", "456",
+		"--http-max-retries", "567",
+		"--http-maxlag", "678",
 	}
 	testCmd := getCommand("test", "")
 	cliConfig = &config.Configuration{}
@@ -89,6 +112,9 @@ func TestCliArgs(t *testing.T) {
 	test.AssertEqual(t, 123, cliConfig.CacheMaxSize)
 	test.AssertEqual(t, 234, cliConfig.CacheMaxAge)
 	test.AssertEqual(t, "cache-eviction-strategy", cliConfig.CacheEvictionStrategy)
+	test.AssertEqual(t, "cache-store", cliConfig.CacheStore)
+	test.AssertEqual(t, "cache-store-dir", cliConfig.CacheStoreDir)
+	test.AssertEqual(t, map[string]config.CachePolicy{"images": {MaxAge: 345, MaxSizeShare: 0.5, EvictionPriority: 1}}, cliConfig.CachePolicies)
 	test.AssertEqual(t, "style-file", cliConfig.StyleFile)
 	test.AssertEqual(t, "cover-image", cliConfig.CoverImage)
 	test.AssertEqual(t, "command-template-svg-to-png", cliConfig.CommandTemplateSvgToPng)
@@ -96,8 +122,10 @@ func TestCliArgs(t *testing.T) {
 	test.AssertEqual(t, "command-template-image-processing", cliConfig.CommandTemplateImageProcessing)
 	test.AssertEqual(t, "command-template-pdf-to-png", cliConfig.CommandTemplatePdfToPng)
 	test.AssertEqual(t, "command-template-webp-to-png", cliConfig.CommandTemplateWebpToPng)
+	test.AssertEqual(t, "command-template-epub-to-kindle", cliConfig.CommandTemplateEpubToKindle)
 	test.AssertEqual(t, "pandoc-executable", cliConfig.PandocExecutable)
 	test.AssertEqual(t, "pandoc-data-dir", cliConfig.PandocDataDir)
+	test.AssertEqual(t, "pdf-engine", cliConfig.PdfEngine)
 	test.AssertEqual(t, []string{"font-files"}, cliConfig.FontFiles)
 	test.AssertEqual(t, []string{"ignored-templates"}, cliConfig.IgnoredTemplates)
 	test.AssertEqual(t, []string{"trailing-templates"}, cliConfig.TrailingTemplates)
@@ -105,14 +133,188 @@ func TestCliArgs(t *testing.T) {
 	test.AssertEqual(t, []string{"ignored-media-types"}, cliConfig.IgnoredMediaTypes)
 	test.AssertEqual(t, "wikipedia-instance", cliConfig.WikipediaInstance)
 	test.AssertEqual(t, "wikipedia-host", cliConfig.WikipediaHost)
+	test.AssertEqual(t, "article-source", cliConfig.ArticleSource)
+	test.AssertEqual(t, "article-dump-file", cliConfig.ArticleDumpFile)
 	test.AssertEqual(t, "wikipedia-image-host", cliConfig.WikipediaImageHost)
 	test.AssertEqual(t, "wikipedia-math-rest-api", cliConfig.WikipediaMathRestApi)
 	test.AssertEqual(t, []string{"wikipedia-image-article-hosts"}, cliConfig.WikipediaImageArticleHosts)
 	test.AssertEqual(t, []string{"file-prefixes"}, cliConfig.FilePrefixes)
 	test.AssertEqual(t, []string{"allowed-link-prefixes"}, cliConfig.AllowedLinkPrefixes)
 	test.AssertEqual(t, []string{"category-prefixes"}, cliConfig.CategoryPrefixes)
+	test.AssertEqual(t, []string{"template-prefixes"}, cliConfig.TemplatePrefixes)
 	test.AssertEqual(t, "math-converter", cliConfig.MathConverter)
 	test.AssertEqual(t, 123, cliConfig.TocDepth)
+	test.AssertTrue(t, cliConfig.AttributionAppendix)
+	test.AssertTrue(t, cliConfig.ImageCredits)
+	test.AssertEqual(t, map[string]string{"image-credit-templates": "template"}, cliConfig.ImageCreditTemplates)
 	test.AssertEqual(t, 234, cliConfig.WorkerThreads)
+	test.AssertEqual(t, 345, cliConfig.ImageWorkerThreads)
 	test.AssertEqual(t, "user-agent-template", cliConfig.UserAgentTemplate)
+	test.AssertEqual(t, 456, cliConfig.HttpRequestsPerSecond)
+	test.AssertEqual(t, 567, cliConfig.HttpMaxRetries)
+	test.AssertEqual(t, 678, cliConfig.HttpMaxlag)
+}
+
+func TestGetArticle(t *testing.T) {
+	// Arrange
+	articleSource := wikipedia.NewMockArticleSource()
+	articleSource.GetArticleFunc = func(title string) (*wikipedia.WikiArticleDto, error) {
+		return &wikipedia.WikiArticleDto{Parse: wikipedia.WikiParseArticleDto{Title: title, RevisionId: 3}}, nil
+	}
+	articleSource.GetArticleRevisionFunc = func(title string, revision int) (*wikipedia.WikiArticleDto, error) {
+		return &wikipedia.WikiArticleDto{Parse: wikipedia.WikiParseArticleDto{Title: title, RevisionId: revision}}, nil
+	}
+	articleSource.GetRevisionAtDateFunc = func(title string, date string) (int, error) {
+		return 2, nil
+	}
+
+	// Act
+	latestArticle, latestErr := getArticle(config.BookEntry{Title: "Erde"}, articleSource)
+	pinnedArticle, pinnedErr := getArticle(config.BookEntry{Title: "Erde", Revision: 1}, articleSource)
+	dateArticle, dateErr := getArticle(config.BookEntry{Title: "Erde", Date: "2024-01-01"}, articleSource)
+
+	// Assert
+	test.AssertNil(t, latestErr)
+	test.AssertEqual(t, 3, latestArticle.Parse.RevisionId)
+	test.AssertNil(t, pinnedErr)
+	test.AssertEqual(t, 1, pinnedArticle.Parse.RevisionId)
+	test.AssertNil(t, dateErr)
+	test.AssertEqual(t, 2, dateArticle.Parse.RevisionId)
+}
+
+func TestArticleHtmlFileName(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	entry := config.BookEntry{Title: "Foo", IsArticle: true, Depth: 1}
+	linkTargets := generator.NewEpubLinkTargets([]string{"Foo", "Bar"})
+
+	// Act
+	fileName := articleHtmlFileName(entry, 123, linkTargets)
+	sameFileName := articleHtmlFileName(entry, 123, generator.NewEpubLinkTargets([]string{"Bar", "Foo"}))
+	otherFileNames := []string{
+		articleHtmlFileName(entry, 124, linkTargets),
+		articleHtmlFileName(entry, 123, nil),
+		articleHtmlFileName(entry, 123, generator.NewEpubLinkTargets([]string{"Foo"})),
+		articleHtmlFileName(config.BookEntry{Title: "Foo", IsArticle: true, Depth: 2}, 123, linkTargets),
+		articleHtmlFileName(config.BookEntry{Title: "Foo", IsArticle: true, Depth: 1, Sections: []string{"A"}}, 123, linkTargets),
+		articleHtmlFileName(config.BookEntry{Title: "Foo", IsArticle: true, Depth: 1, ExcludeSections: []string{"A"}}, 123, linkTargets),
+	}
+	config.Current.ImageCredits = true
+	otherFileNames = append(otherFileNames, articleHtmlFileName(entry, 123, linkTargets))
+	config.Current.ImageCreditTemplates = map[string]string{config.ImageCreditTemplateDefaultKey: config.AuthorPlaceholder}
+	otherFileNames = append(otherFileNames, articleHtmlFileName(entry, 123, linkTargets))
+
+	// Assert
+	test.AssertTrue(t, strings.HasPrefix(fileName, "Foo-"))
+	test.AssertEqual(t, fileName, sameFileName)
+	for _, otherFileName := range otherFileNames {
+		test.AssertTrue(t, fileName != otherFileName)
+	}
+}
+
+func TestTemplateSourceOf(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	articleSource := wikipedia.NewMockArticleSource()
+
+	// Act
+	apiTemplateSource := templateSourceOf(articleSource)
+	config.Current.ArticleSource = config.ArticleSourceDump
+	dumpTemplateSource := templateSourceOf(articleSource)
+
+	// Assert
+	test.AssertNil(t, apiTemplateSource)
+	test.AssertEqual(t, articleSource, dumpTemplateSource)
+}
+
+func TestReadArticleImages(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+	test.AssertNil(t, writeArticleImages("Foo-123", []string{"File:Foo.jpg", "Datei:Bar.png"}))
+	test.AssertNil(t, writeArticleImages("Bar-123", nil))
+
+	// Act
+	images, err := readArticleImages("Foo-123")
+	noImages, noImagesErr := readArticleImages("Bar-123")
+	_, unknownErr := readArticleImages("Unknown-123")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []string{"File:Foo.jpg", "Datei:Bar.png"}, images)
+	test.AssertNil(t, noImagesErr)
+	test.AssertEqual(t, []string{}, noImages)
+	test.AssertNotNil(t, unknownErr)
+}
+
+func TestGenerateAttributionPage(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+
+	var requestedImages []string
+	wikipediaService := wikipedia.NewMockWikipediaService()
+	wikipediaService.GetArticleContributorsFunc = func(host string, title string) (*wikipedia.ArticleContributors, error) {
+		return &wikipedia.ArticleContributors{Names: []string{"Contributor of " + title}}, nil
+	}
+	wikipediaService.GetImagesMetadataFunc = func(images []string) (map[string]*wikipedia.ImageMetadata, error) {
+		requestedImages = append(requestedImages, images...)
+		return map[string]*wikipedia.ImageMetadata{
+			"File:Foo.jpg": {Title: "File:Foo.jpg", Author: "Author of File:Foo.jpg"},
+		}, nil
+	}
+
+	// Act
+	htmlFile, err := generateAttributionPage([]string{"Earth", "Moon"}, []int{123, 0}, []string{"File:Foo.jpg", "Datei:Foo.jpg", "File:Missing.jpg"}, wikipediaService)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []string{"File:Foo.jpg", "File:Missing.jpg"}, requestedImages)
+	content, err := os.ReadFile(htmlFile)
+	test.AssertNil(t, err)
+	test.AssertMatch(t, `index.php\?title=Earth&amp;oldid=123">Earth</a><br>\nAuthors: Contributor of Earth`, string(content))
+	test.AssertMatch(t, `https://en.wikipedia.org/wiki/Moon">Moon</a><br>\nAuthors: Contributor of Moon`, string(content))
+	test.AssertMatch(t, `Author: Author of File:Foo.jpg`, string(content))
+	test.AssertFalse(t, strings.Contains(string(content), "Missing.jpg"))
+}
+
+func TestProcessArticle_lockRecreatesExistingHtml(t *testing.T) {
+	// Arrange
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	config.Current.StyleFile = ""
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+
+	articleSource := wikipedia.NewMockArticleSource()
+	articleSource.GetArticleRevisionFunc = func(title string, revision int) (*wikipedia.WikiArticleDto, error) {
+		return &wikipedia.WikiArticleDto{Parse: wikipedia.WikiParseArticleDto{Title: title, OriginalTitle: title, RevisionId: revision, Wikitext: wikipedia.WikiWildcardTextDto{Content: "Some text"}}}, nil
+	}
+	wikipediaService := wikipedia.NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), http.NewMockHttpService(nil, nil))
+	entry := config.BookEntry{Title: "Foo", IsArticle: true, Depth: 1, Revision: 123}
+
+	// The HTML of a previous run, e.g. a build without lock file, is already cached.
+	htmlFileName := articleHtmlFileName(entry, 123, nil)
+	_, err := cache.CacheToFile(cache.HtmlCacheDirName, htmlFileName+".html", strings.NewReader("cached html"))
+	test.AssertNil(t, err)
+	test.AssertNil(t, writeArticleImages(htmlFileName, nil))
+
+	// Act
+	reusedFile, _, _ := processArticle(entry, 1, 1, articleSource, wikipediaService, nil, shouldForceRecreateHtml(lockModeRead))
+	reusedContent, reusedErr := os.ReadFile(reusedFile)
+	lockedFile, revision, _ := processArticle(entry, 1, 1, articleSource, wikipediaService, nil, shouldForceRecreateHtml(lockModeFiles))
+	lockedContent, lockedErr := os.ReadFile(lockedFile)
+
+	// Assert
+	test.AssertNil(t, reusedErr)
+	test.AssertEqual(t, "cached html", string(reusedContent))
+	test.AssertNil(t, lockedErr)
+	test.AssertEqual(t, 123, revision)
+	test.AssertTrue(t, strings.Contains(string(lockedContent), "Some text"))
+	test.AssertTrue(t, shouldForceRecreateHtml(lockModeFrozen))
+	test.AssertFalse(t, shouldForceRecreateHtml(lockModeArticles))
 }
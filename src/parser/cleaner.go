@@ -4,6 +4,8 @@ import (
 	"strings"
 	"wiki2book/config"
 	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
 )
 
 const semiHeadingDepth = 10
@@ -18,6 +20,7 @@ func (t *Tokenizer) clean(content string) (string, error) {
 	//content = removeUnwantedHtml(content)
 	content = t.removeUnwantedWikitext(content)
 	content = t.removeEmptyListEntries(content)
+	content = t.selectSections(content)
 	content = t.removeEmptySections(content)
 
 	content, err = t.hackGermanRailwayTemplates(content, 0)
@@ -262,6 +265,74 @@ func (t *Tokenizer) removeEmptySections(content string) string {
 	return strings.Join(resultLines, "\n")
 }
 
+// selectSections keeps only the selected sections (if any) and removes the excluded sections of the article. The text
+// before the first heading is only kept, when no sections are selected.
+func (t *Tokenizer) selectSections(content string) string {
+	if len(t.sections) == 0 && len(t.excludedSections) == 0 {
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+	var resultLines []string
+	foundSections := map[string]bool{}
+
+	// A heading depth of 0 means the lines are not part of a selected or excluded section.
+	selectedSectionDepth := 0
+	excludedSectionDepth := 0
+
+	for _, line := range lines {
+		headingDepth := t.headingDepth(strings.TrimSpace(line))
+		if headingDepth > 0 && headingDepth != semiHeadingDepth {
+			heading := normalizeSectionName(strings.Trim(strings.TrimSpace(line), "="))
+
+			if excludedSectionDepth > 0 && headingDepth <= excludedSectionDepth {
+				excludedSectionDepth = 0
+			}
+			if excludedSectionDepth == 0 && containsSectionName(t.excludedSections, heading) {
+				excludedSectionDepth = headingDepth
+			}
+
+			if selectedSectionDepth > 0 && headingDepth <= selectedSectionDepth {
+				selectedSectionDepth = 0
+			}
+			if selectedSectionDepth == 0 && containsSectionName(t.sections, heading) {
+				selectedSectionDepth = headingDepth
+				foundSections[heading] = true
+			}
+		}
+
+		isSelected := len(t.sections) == 0 || selectedSectionDepth > 0
+		if isSelected && excludedSectionDepth == 0 {
+			resultLines = append(resultLines, line)
+		}
+	}
+
+	if !t.missingSectionsReported {
+		for _, section := range t.sections {
+			if !foundSections[normalizeSectionName(section)] {
+				sigolo.Warnf("Article '%s': Section '%s' not found", t.articleTitle, section)
+			}
+		}
+		t.missingSectionsReported = true
+	}
+
+	return strings.Join(resultLines, "\n")
+}
+
+// normalizeSectionName makes section names comparable, e.g. " Foo_bar " and "Foo bar" are the same sections.
+func normalizeSectionName(section string) string {
+	return strings.ToLower(strings.TrimSpace(strings.ReplaceAll(section, "_", " ")))
+}
+
+func containsSectionName(sections []string, normalizedSection string) bool {
+	for _, section := range sections {
+		if normalizeSectionName(section) == normalizedSection {
+			return true
+		}
+	}
+	return false
+}
+
 // walkSection goes through the lines from index i till the end or the next heading. For i the condition i < len(lines)
 // has to hold.
 func (t *Tokenizer) walkSection(i int, lines []string, previousHeadingDepth int) (int, bool) {
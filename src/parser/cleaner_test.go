@@ -426,3 +426,39 @@ func TestRemoveEmptySection_pureBoldTextShouldNotBeChanged(t *testing.T) {
 	expectedResult := `'''foo'''`
 	test.AssertEqual(t, expectedResult, tokenizer.removeEmptySections(content))
 }
+
+func TestSelectSections(t *testing.T) {
+	content := `Intro
+== Aufbau ==
+Aufbau text
+=== Kern ===
+Kern text
+== Geschichte ==
+Geschichte text
+=== Frühzeit ===
+Frühzeit text
+'''Semi heading'''
+More text
+=== Literatur ===
+Literature in history
+== Weblinks ==
+Links`
+
+	tokenizer := NewTokenizerWithMockWikipediaService()
+	tokenizer.SelectSections([]string{"geschichte", "Not existing"}, []string{"Literatur"})
+	test.AssertEqual(t, `== Geschichte ==
+Geschichte text
+=== Frühzeit ===
+Frühzeit text
+'''Semi heading'''
+More text`, tokenizer.selectSections(content))
+
+	tokenizer = NewTokenizerWithMockWikipediaService()
+	tokenizer.SelectSections(nil, []string{"Kern", "Geschichte", "Weblinks"})
+	test.AssertEqual(t, `Intro
+== Aufbau ==
+Aufbau text`, tokenizer.selectSections(content))
+
+	tokenizer = NewTokenizerWithMockWikipediaService()
+	test.AssertEqual(t, content, tokenizer.selectSections(content))
+}
@@ -0,0 +1,356 @@
+package parser
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// expressionOperator is an operator of the "#expr" parser function. The precedences are the same as in MediaWiki, which
+// means that e.g. the unary minus binds stronger than "^" ("-2^2" is 4).
+type expressionOperator struct {
+	name       string
+	precedence int
+	isUnary    bool
+}
+
+var (
+	expressionUnaryOperators = map[string]int{
+		"-":     10,
+		"+":     10,
+		"not":   9,
+		"exp":   9,
+		"ln":    9,
+		"abs":   9,
+		"trunc": 9,
+		"floor": 9,
+		"ceil":  9,
+		"sqrt":  9,
+		"sin":   9,
+		"cos":   9,
+		"tan":   9,
+		"asin":  9,
+		"acos":  9,
+		"atan":  9,
+	}
+	expressionBinaryOperators = map[string]int{
+		"e":     10,
+		"^":     8,
+		"*":     7,
+		"/":     7,
+		"div":   7,
+		"mod":   7,
+		"fmod":  7,
+		"+":     6,
+		"-":     6,
+		"round": 5,
+		"=":     4,
+		"!=":    4,
+		"<>":    4,
+		"<":     4,
+		">":     4,
+		"<=":    4,
+		">=":    4,
+		"and":   3,
+		"or":    2,
+	}
+)
+
+// evaluateExpression evaluates the mathematical expression like the "#expr" parser function of MediaWiki. The result
+// is nil for an empty expression.
+func evaluateExpression(expression string) (*float64, error) {
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	var operands []float64
+	var operators []*expressionOperator // nil represents an opening parenthesis
+
+	applyTopOperator := func() error {
+		operator := operators[len(operators)-1]
+		operators = operators[:len(operators)-1]
+
+		if operator.isUnary {
+			if len(operands) < 1 {
+				return errors.Errorf("Missing operand for %s", operator.name)
+			}
+			result, err := applyUnaryExpressionOperator(operator.name, operands[len(operands)-1])
+			if err != nil {
+				return err
+			}
+			operands[len(operands)-1] = result
+			return nil
+		}
+
+		if len(operands) < 2 {
+			return errors.Errorf("Missing operand for %s", operator.name)
+		}
+		result, err := applyBinaryExpressionOperator(operator.name, operands[len(operands)-2], operands[len(operands)-1])
+		if err != nil {
+			return err
+		}
+		operands = append(operands[:len(operands)-2], result)
+		return nil
+	}
+
+	expectOperand := true
+	for _, token := range tokens {
+		if expectOperand {
+			if number, err := strconv.ParseFloat(token, 64); err == nil && (unicode.IsDigit(rune(token[0])) || token[0] == '.') {
+				operands = append(operands, number)
+				expectOperand = false
+			} else if token == "e" {
+				operands = append(operands, math.E)
+				expectOperand = false
+			} else if token == "pi" {
+				operands = append(operands, math.Pi)
+				expectOperand = false
+			} else if token == "(" {
+				operators = append(operators, nil)
+			} else if precedence, isUnary := expressionUnaryOperators[token]; isUnary {
+				operators = append(operators, &expressionOperator{name: token, precedence: precedence, isUnary: true})
+			} else {
+				return nil, errors.Errorf("Unexpected token '%s' in expression '%s'", token, expression)
+			}
+			continue
+		}
+
+		if token == ")" {
+			for len(operators) > 0 && operators[len(operators)-1] != nil {
+				err = applyTopOperator()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if len(operators) == 0 {
+				return nil, errors.Errorf("Unexpected closing parenthesis in expression '%s'", expression)
+			}
+			operators = operators[:len(operators)-1]
+			continue
+		}
+
+		precedence, isBinary := expressionBinaryOperators[token]
+		if !isBinary {
+			return nil, errors.Errorf("Unexpected token '%s' in expression '%s'", token, expression)
+		}
+
+		// All operators are left-associative except "^".
+		for len(operators) > 0 && operators[len(operators)-1] != nil {
+			topPrecedence := operators[len(operators)-1].precedence
+			if topPrecedence < precedence || (token == "^" && topPrecedence == precedence) {
+				break
+			}
+			err = applyTopOperator()
+			if err != nil {
+				return nil, err
+			}
+		}
+		operators = append(operators, &expressionOperator{name: token, precedence: precedence})
+		expectOperand = true
+	}
+
+	if expectOperand {
+		return nil, errors.Errorf("Missing operand at the end of expression '%s'", expression)
+	}
+	for len(operators) > 0 {
+		if operators[len(operators)-1] == nil {
+			return nil, errors.Errorf("Unclosed parenthesis in expression '%s'", expression)
+		}
+		err = applyTopOperator()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &operands[0], nil
+}
+
+// tokenizeExpression splits the expression into numbers, words (lower case) and symbols.
+func tokenizeExpression(expression string) ([]string, error) {
+	var tokens []string
+	runes := []rune(strings.ToLower(expression))
+
+	for i := 0; i < len(runes); {
+		char := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(char):
+			i++
+			continue
+		case unicode.IsDigit(char) || char == '.':
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+		case unicode.IsLetter(char):
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+		case strings.ContainsRune("<>!", char):
+			i++
+			if i < len(runes) && (runes[i] == '=' || (char == '<' && runes[i] == '>')) {
+				i++
+			}
+		case strings.ContainsRune("+-*/^()=", char):
+			i++
+		case char == '−':
+			// MediaWiki also accepts the actual minus sign.
+			tokens = append(tokens, "-")
+			i++
+			continue
+		default:
+			return nil, errors.Errorf("Unrecognized character '%c' in expression '%s'", char, expression)
+		}
+
+		tokens = append(tokens, string(runes[start:i]))
+	}
+
+	return tokens, nil
+}
+
+func applyUnaryExpressionOperator(operator string, value float64) (float64, error) {
+	switch operator {
+	case "-":
+		return -value, nil
+	case "+":
+		return value, nil
+	case "not":
+		return boolToFloat(value == 0), nil
+	case "exp":
+		return math.Exp(value), nil
+	case "ln":
+		if value <= 0 {
+			return 0, errors.New("Invalid argument for ln")
+		}
+		return math.Log(value), nil
+	case "abs":
+		return math.Abs(value), nil
+	case "trunc":
+		return math.Trunc(value), nil
+	case "floor":
+		return math.Floor(value), nil
+	case "ceil":
+		return math.Ceil(value), nil
+	case "sqrt":
+		if value < 0 {
+			return 0, errors.New("Invalid argument for sqrt")
+		}
+		return math.Sqrt(value), nil
+	case "sin":
+		return math.Sin(value), nil
+	case "cos":
+		return math.Cos(value), nil
+	case "tan":
+		return math.Tan(value), nil
+	case "asin":
+		if value < -1 || value > 1 {
+			return 0, errors.New("Invalid argument for asin")
+		}
+		return math.Asin(value), nil
+	case "acos":
+		if value < -1 || value > 1 {
+			return 0, errors.New("Invalid argument for acos")
+		}
+		return math.Acos(value), nil
+	case "atan":
+		return math.Atan(value), nil
+	}
+	return 0, errors.Errorf("Unknown unary operator '%s'", operator)
+}
+
+func applyBinaryExpressionOperator(operator string, left float64, right float64) (float64, error) {
+	switch operator {
+	case "e":
+		return left * math.Pow(10, right), nil
+	case "^":
+		result := math.Pow(left, right)
+		if math.IsNaN(result) {
+			return 0, errors.New("Invalid arguments for ^")
+		}
+		return result, nil
+	case "*":
+		return left * right, nil
+	case "/", "div":
+		if right == 0 {
+			return 0, errors.New("Division by zero")
+		}
+		return left / right, nil
+	case "mod":
+		// Like PHP, the operands are converted to integers.
+		if math.Trunc(right) == 0 {
+			return 0, errors.New("Division by zero")
+		}
+		return float64(int64(left) % int64(right)), nil
+	case "fmod":
+		if right == 0 {
+			return 0, errors.New("Division by zero")
+		}
+		return math.Mod(left, right), nil
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "round":
+		factor := math.Pow(10, math.Trunc(right))
+		return math.Round(left*factor) / factor, nil
+	case "=":
+		return boolToFloat(left == right), nil
+	case "!=", "<>":
+		return boolToFloat(left != right), nil
+	case "<":
+		return boolToFloat(left < right), nil
+	case ">":
+		return boolToFloat(left > right), nil
+	case "<=":
+		return boolToFloat(left <= right), nil
+	case ">=":
+		return boolToFloat(left >= right), nil
+	case "and":
+		return boolToFloat(left != 0 && right != 0), nil
+	case "or":
+		return boolToFloat(left != 0 || right != 0), nil
+	}
+	return 0, errors.Errorf("Unknown binary operator '%s'", operator)
+}
+
+// formatExpressionResult formats the number like PHP does with its default precision of 14 digits, e.g. "1/3" results
+// in "0.33333333333333" and "1e20" in "1.0E+20".
+func formatExpressionResult(value float64) string {
+	if value == 0 {
+		// Prevents "-0"
+		return "0"
+	}
+	if math.IsInf(value, 0) {
+		if value > 0 {
+			return "INF"
+		}
+		return "-INF"
+	}
+
+	result := strconv.FormatFloat(value, 'g', 14, 64)
+	mantissa, exponent, hasExponent := strings.Cut(result, "e")
+	if !hasExponent {
+		return result
+	}
+
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exponentSign := exponent[:1]
+	exponent = strings.TrimLeft(exponent[1:], "0")
+	return mantissa + "E" + exponentSign + exponent
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
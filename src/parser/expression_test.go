@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"testing"
+	"wiki2book/test"
+)
+
+func assertExpression(t *testing.T, expected string, expression string) {
+	result, err := evaluateExpression(expression)
+	test.AssertNil(t, err)
+	test.AssertNotNil(t, result)
+	test.AssertEqual(t, expected, formatExpressionResult(*result))
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	assertExpression(t, "7", "1 + 2 * 3")
+	assertExpression(t, "9", "(1 + 2) * 3")
+	assertExpression(t, "4", "-2^2")
+	assertExpression(t, "512", "2^3^2")
+	assertExpression(t, "0.33333333333333", "1/3")
+	assertExpression(t, "1", "7 mod 3")
+	assertExpression(t, "2.5", "5 div 2")
+	assertExpression(t, "3.14", "pi round 2")
+	assertExpression(t, "2000", "2e3")
+	assertExpression(t, "1.0E+20", "10^20")
+	assertExpression(t, "1", "2 > 1 and not 0")
+	assertExpression(t, "0", "1 = 2 or 3 <> 3")
+	assertExpression(t, "3", "floor 3.7")
+	assertExpression(t, "-4", "ceil -4.5")
+	assertExpression(t, "2", "abs −2")
+}
+
+func TestEvaluateExpression_empty(t *testing.T) {
+	result, err := evaluateExpression("  ")
+	test.AssertNil(t, err)
+	test.AssertNil(t, result)
+}
+
+func TestEvaluateExpression_errors(t *testing.T) {
+	for _, expression := range []string{"1/0", "1 +", "(1", "1)", "foo", "1 $ 2", "sqrt -1", "inf"} {
+		_, err := evaluateExpression(expression)
+		test.AssertNotNil(t, err)
+	}
+}
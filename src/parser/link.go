@@ -17,6 +17,7 @@ const (
 type InternalLinkToken struct {
 	Token
 	ArticleName string
+	Section     string // Optional section the link points to, e.g. "Foo" for a link like [[Article#Foo]].
 	LinkText    string
 }
 
@@ -36,10 +37,11 @@ func (t *Tokenizer) parseExternalLinks(content string) string {
 
 // parseLink takes the given bracket type and tries to find the link content in between them and replaces it with a
 // token. The parameter delimiterRequired specifies if the link must definitely have two parts (URL/Article and a
-// display text) or if the delimiter is optional. The parameter removeSectionReference specifies whether everything
-// behind the first "#" should be ignored or not. Link to e.g. categories start with a ":" and will be treated as normal
-// links, which means, in case of a missing delimiter, the text of the part behind the last ":" is used as link text.
-func (t *Tokenizer) parseLink(content string, openingBrackets string, closingBrackets string, linkDelimiter string, linkType LinkType, delimiterRequired bool, removeSectionReference bool) string {
+// display text) or if the delimiter is optional. The parameter splitSectionReference specifies whether everything
+// behind the first "#" is the referenced section or part of the link target. Link to e.g. categories start with a ":"
+// and will be treated as normal links, which means, in case of a missing delimiter, the text of the part behind the
+// last ":" is used as link text.
+func (t *Tokenizer) parseLink(content string, openingBrackets string, closingBrackets string, linkDelimiter string, linkType LinkType, delimiterRequired bool, splitSectionReference bool) string {
 	splitContent := strings.Split(content, openingBrackets)
 	var resultSegments []string
 
@@ -76,8 +78,13 @@ func (t *Tokenizer) parseLink(content string, openingBrackets string, closingBra
 
 		wikitextElements := strings.Split(possibleLinkWikitext, linkDelimiter)
 		linkTarget := wikitextElements[0]
-		if removeSectionReference {
-			linkTarget = strings.SplitN(linkTarget, "#", 2)[0]
+		linkSection := ""
+		if splitSectionReference {
+			linkTargetSegments := strings.SplitN(linkTarget, "#", 2)
+			linkTarget = linkTargetSegments[0]
+			if len(linkTargetSegments) == 2 {
+				linkSection = strings.TrimSpace(linkTargetSegments[1])
+			}
 		}
 		linkTarget = strings.TrimSpace(linkTarget)
 
@@ -90,7 +97,10 @@ func (t *Tokenizer) parseLink(content string, openingBrackets string, closingBra
 				continue
 			}
 
-			if linkTarget[0] == ':' {
+			if linkTarget == "" {
+				// A link to a section within the same article, e.g. [[#Foo]]. The section is used as link text.
+				linkText = linkSection
+			} else if linkTarget[0] == ':' {
 				// A link starting with ":" indicates e.g. a link to a category. Because we have no delimiter here, the
 				// link text is the part behind the last ":".
 				linkSegments := strings.SplitN(linkTarget, ":", -1)
@@ -111,6 +121,7 @@ func (t *Tokenizer) parseLink(content string, openingBrackets string, closingBra
 		if linkType == LINK_TYPE_INTERNAL {
 			token = InternalLinkToken{
 				ArticleName: linkTarget,
+				Section:     linkSection,
 				LinkText:    t.tokenizeContent(t, linkText),
 			}
 			linkTokenKey = TOKEN_INTERNAL_LINK
@@ -53,11 +53,26 @@ func TestParseInternalLinks_withSectionReference(t *testing.T) {
 	test.AssertMapEqual(t, map[string]Token{
 		"$$TOKEN_" + TOKEN_INTERNAL_LINK + "_0$$": InternalLinkToken{
 			ArticleName: "article",
+			Section:     "section",
 			LinkText:    "article",
 		},
 	}, tokenizer.getTokenMap())
 }
 
+func TestParseInternalLinks_withSectionReferenceOnly(t *testing.T) {
+	tokenizer := NewTokenizerWithMockWikipediaService()
+
+	content := tokenizer.parseInternalLinks("foo [[#some section]]")
+	test.AssertEqual(t, "foo $$TOKEN_"+TOKEN_INTERNAL_LINK+"_0$$", content)
+	test.AssertMapEqual(t, map[string]Token{
+		"$$TOKEN_" + TOKEN_INTERNAL_LINK + "_0$$": InternalLinkToken{
+			ArticleName: "",
+			Section:     "some section",
+			LinkText:    "some section",
+		},
+	}, tokenizer.getTokenMap())
+}
+
 func TestParseInternalLinks_externalLinkWillNotBeTouched(t *testing.T) {
 	tokenizer := NewTokenizerWithMockWikipediaService()
 	content := tokenizer.parseInternalLinks("foo [http://bar.com website]")
@@ -0,0 +1,349 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"wiki2book/config"
+
+	"github.com/pkg/errors"
+)
+
+var numberRegex = regexp.MustCompile(`^([-+]?)(\d*)(\.\d+)?$`)
+
+// parserFunctionCall contains the arguments of a call like "{{#if: first | a | b }}". The first argument is already
+// evaluated, the others are only evaluated when needed, since e.g. only one branch of "#if" is relevant.
+type parserFunctionCall struct {
+	firstArgument string
+	arguments     []wikitextNodes
+	frame         *templateFrame
+}
+
+type parserFunction func(e *localTemplateEvaluator, call *parserFunctionCall) (string, error)
+
+// parserFunctions contains the supported parser functions by their lower case name. It's filled in init() because
+// the functions indirectly use this map themselves.
+var parserFunctions map[string]parserFunction
+
+func init() {
+	parserFunctions = map[string]parserFunction{
+		"#if":       parserFunctionIf,
+		"#ifeq":     parserFunctionIfeq,
+		"#iferror":  parserFunctionIferror,
+		"#ifexpr":   parserFunctionIfexpr,
+		"#switch":   parserFunctionSwitch,
+		"#expr":     parserFunctionExpr,
+		"#tag":      parserFunctionTag,
+		"lc":        parserFunctionLc,
+		"uc":        parserFunctionUc,
+		"lcfirst":   parserFunctionLcfirst,
+		"ucfirst":   parserFunctionUcfirst,
+		"formatnum": parserFunctionFormatnum,
+		"padleft":   parserFunctionPadleft,
+		"padright":  parserFunctionPadright,
+	}
+}
+
+// magicWords contains the supported variables like "{{PAGENAME}}". They are case-sensitive.
+var magicWords = map[string]func(e *localTemplateEvaluator) string{
+	"!":                func(e *localTemplateEvaluator) string { return "|" },
+	"=":                func(e *localTemplateEvaluator) string { return "=" },
+	"PAGENAME":         func(e *localTemplateEvaluator) string { return e.articleTitle },
+	"FULLPAGENAME":     func(e *localTemplateEvaluator) string { return e.articleTitle },
+	"BASEPAGENAME":     func(e *localTemplateEvaluator) string { return e.articleTitle },
+	"ROOTPAGENAME":     func(e *localTemplateEvaluator) string { return e.articleTitle },
+	"SUBPAGENAME":      func(e *localTemplateEvaluator) string { return e.articleTitle },
+	"NAMESPACE":        func(e *localTemplateEvaluator) string { return "" },
+	"CURRENTYEAR":      func(e *localTemplateEvaluator) string { return now().Format("2006") },
+	"CURRENTMONTH":     func(e *localTemplateEvaluator) string { return now().Format("01") },
+	"CURRENTMONTH1":    func(e *localTemplateEvaluator) string { return now().Format("1") },
+	"CURRENTDAY":       func(e *localTemplateEvaluator) string { return now().Format("2") },
+	"CURRENTDAY2":      func(e *localTemplateEvaluator) string { return now().Format("02") },
+	"CURRENTDOW":       func(e *localTemplateEvaluator) string { return strconv.Itoa(int(now().Weekday())) },
+	"CURRENTHOUR":      func(e *localTemplateEvaluator) string { return now().Format("15") },
+	"CURRENTTIME":      func(e *localTemplateEvaluator) string { return now().Format("15:04") },
+	"CURRENTTIMESTAMP": func(e *localTemplateEvaluator) string { return now().Format("20060102150405") },
+}
+
+// now returns the current time in UTC, which is what the CURRENT... magic words of MediaWiki use.
+var now = func() time.Time {
+	return time.Now().UTC()
+}
+
+// argument evaluates the argument with the given index (0 is the first argument after the first one). The boolean is
+// false when there's no such argument.
+func (c *parserFunctionCall) argument(e *localTemplateEvaluator, index int) (string, bool, error) {
+	if index >= len(c.arguments) {
+		return "", false, nil
+	}
+
+	value, err := e.evaluateNodes(c.arguments[index], c.frame)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(value), true, nil
+}
+
+func (c *parserFunctionCall) argumentOrEmpty(e *localTemplateEvaluator, index int) (string, error) {
+	value, _, err := c.argument(e, index)
+	return value, err
+}
+
+func parserFunctionIf(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	if call.firstArgument != "" {
+		return call.argumentOrEmpty(e, 0)
+	}
+	return call.argumentOrEmpty(e, 1)
+}
+
+func parserFunctionIfeq(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	otherValue, err := call.argumentOrEmpty(e, 0)
+	if err != nil {
+		return "", err
+	}
+
+	if valuesAreEqual(call.firstArgument, otherValue) {
+		return call.argumentOrEmpty(e, 1)
+	}
+	return call.argumentOrEmpty(e, 2)
+}
+
+func parserFunctionIferror(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	if strings.Contains(call.firstArgument, `class="error"`) {
+		return call.argumentOrEmpty(e, 0)
+	}
+
+	value, found, err := call.argument(e, 1)
+	if err != nil || found {
+		return value, err
+	}
+	return call.firstArgument, nil
+}
+
+func parserFunctionIfexpr(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	result, err := evaluateExpression(call.firstArgument)
+	if err != nil {
+		// The exact error message of MediaWiki is only available via the API.
+		return "", errors.Wrap(errNotLocallyEvaluable, err.Error())
+	}
+
+	if result != nil && *result != 0 {
+		return call.argumentOrEmpty(e, 0)
+	}
+	return call.argumentOrEmpty(e, 1)
+}
+
+func parserFunctionExpr(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	result, err := evaluateExpression(call.firstArgument)
+	if err != nil {
+		return "", errors.Wrap(errNotLocallyEvaluable, err.Error())
+	}
+	if result == nil {
+		return "", nil
+	}
+	return formatExpressionResult(*result), nil
+}
+
+// parserFunctionSwitch returns the value of the first case matching the first argument. Cases without value fall
+// through to the next case with value, e.g. "a" and "b" both result in "x" for "{{#switch:a|a|b=x|c=y}}".
+func parserFunctionSwitch(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	var defaultValue wikitextNodes
+	hasMatchingCase := false
+
+	for i, argumentNodes := range call.arguments {
+		keyNodes, valueNodes, hasValue := splitNamedArgument(argumentNodes)
+		if !hasValue {
+			if i == len(call.arguments)-1 {
+				// The last case without value is the default value.
+				defaultValue = argumentNodes
+				break
+			}
+			keyNodes = argumentNodes
+		}
+
+		key, err := e.evaluateNodes(keyNodes, call.frame)
+		if err != nil {
+			return "", err
+		}
+		key = strings.TrimSpace(key)
+
+		if valuesAreEqual(call.firstArgument, key) {
+			hasMatchingCase = true
+		}
+		if !hasValue {
+			continue
+		}
+
+		if hasMatchingCase {
+			value, err := e.evaluateNodes(valueNodes, call.frame)
+			return strings.TrimSpace(value), err
+		}
+		if key == "#default" {
+			defaultValue = valueNodes
+		}
+	}
+
+	if defaultValue == nil {
+		return "", nil
+	}
+	value, err := e.evaluateNodes(defaultValue, call.frame)
+	return strings.TrimSpace(value), err
+}
+
+// parserFunctionTag creates an HTML or extension tag, e.g. "{{#tag:ref|content|name=foo}}" becomes
+// `<ref name="foo">content</ref>`.
+func parserFunctionTag(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	tagName := strings.ToLower(call.firstArgument)
+
+	var attributes []string
+	for _, argumentNodes := range call.arguments[min(1, len(call.arguments)):] {
+		nameNodes, valueNodes, isNamed := splitNamedArgument(argumentNodes)
+		if !isNamed {
+			continue
+		}
+
+		name, err := e.evaluateNodes(nameNodes, call.frame)
+		if err != nil {
+			return "", err
+		}
+		value, err := e.evaluateNodes(valueNodes, call.frame)
+		if err != nil {
+			return "", err
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		attributes = append(attributes, fmt.Sprintf(` %s="%s"`, strings.TrimSpace(name), html.EscapeString(value)))
+	}
+
+	if len(call.arguments) == 0 {
+		return fmt.Sprintf("<%s%s />", tagName, strings.Join(attributes, "")), nil
+	}
+
+	content, err := e.evaluateNodes(call.arguments[0], call.frame)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%s%s>%s</%s>", tagName, strings.Join(attributes, ""), content, tagName), nil
+}
+
+func parserFunctionLc(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	return strings.ToLower(call.firstArgument), nil
+}
+
+func parserFunctionUc(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	return strings.ToUpper(call.firstArgument), nil
+}
+
+func parserFunctionLcfirst(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	return lowerCaseFirst(call.firstArgument), nil
+}
+
+func parserFunctionUcfirst(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	return upperCaseFirst(call.firstArgument), nil
+}
+
+// parserFunctionFormatnum adds the separators of the language of the configured Wikipedia instance to a number, e.g.
+// "1234567.8" becomes "1,234,567.8" for English. The argument "R" reverses this and "NOSEP" omits the group separators.
+func parserFunctionFormatnum(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	option, err := call.argumentOrEmpty(e, 0)
+	if err != nil {
+		return "", err
+	}
+
+	groupSeparator, decimalSeparator := numberSeparators(config.Current.WikipediaInstance)
+
+	if option == "R" {
+		number := strings.ReplaceAll(call.firstArgument, groupSeparator, "")
+		return strings.Replace(number, decimalSeparator, ".", 1), nil
+	}
+
+	numberParts := numberRegex.FindStringSubmatch(call.firstArgument)
+	if numberParts == nil || numberParts[2] == "" {
+		// MediaWiki leaves text unchanged, which is no plain number.
+		return call.firstArgument, nil
+	}
+
+	sign, integerPart, fractionalPart := numberParts[1], numberParts[2], numberParts[3]
+	if option != "NOSEP" {
+		var groups []string
+		for len(integerPart) > 3 {
+			groups = append([]string{integerPart[len(integerPart)-3:]}, groups...)
+			integerPart = integerPart[:len(integerPart)-3]
+		}
+		integerPart = strings.Join(append([]string{integerPart}, groups...), groupSeparator)
+	}
+	if fractionalPart != "" {
+		fractionalPart = decimalSeparator + fractionalPart[1:]
+	}
+
+	return sign + integerPart + fractionalPart, nil
+}
+
+// numberSeparators returns the group and decimal separator used by the given Wikipedia instance.
+func numberSeparators(wikipediaInstance string) (string, string) {
+	switch wikipediaInstance {
+	case "de", "es", "it", "nl", "pt", "da", "id", "tr":
+		return ".", ","
+	case "fr", "pl", "ru", "sv", "fi", "cs", "nb", "uk":
+		return "\u00a0", ","
+	}
+	return ",", "."
+}
+
+func parserFunctionPadleft(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	padding, err := paddingForCall(e, call)
+	return padding + call.firstArgument, err
+}
+
+func parserFunctionPadright(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	padding, err := paddingForCall(e, call)
+	return call.firstArgument + padding, err
+}
+
+// paddingForCall returns the padding needed for the "padleft" and "padright" functions. The padding string defaults
+// to "0" and is repeated until the first argument has the requested length.
+func paddingForCall(e *localTemplateEvaluator, call *parserFunctionCall) (string, error) {
+	lengthString, err := call.argumentOrEmpty(e, 0)
+	if err != nil {
+		return "", err
+	}
+	paddingString, found, err := call.argument(e, 1)
+	if err != nil {
+		return "", err
+	}
+	if !found || paddingString == "" {
+		paddingString = "0"
+	}
+
+	length, err := strconv.Atoi(lengthString)
+	if err != nil {
+		return "", nil
+	}
+	// Same limit as in MediaWiki.
+	length = min(length, 500)
+
+	paddingRunes := []rune(paddingString)
+	missingLength := length - utf8.RuneCountInString(call.firstArgument)
+	var padding []rune
+	for i := 0; i < missingLength; i++ {
+		padding = append(padding, paddingRunes[i%len(paddingRunes)])
+	}
+	return string(padding), nil
+}
+
+// valuesAreEqual compares the values like MediaWiki does: Numbers are compared numerically, everything else as string.
+func valuesAreEqual(a string, b string) bool {
+	numberA, errA := strconv.ParseFloat(a, 64)
+	numberB, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil && numberRegex.MatchString(a) && numberRegex.MatchString(b) {
+		return numberA == numberB
+	}
+	return a == b
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"testing"
+	"time"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+func assertLocallyEvaluated(t *testing.T, expected string, templateText string) {
+	result, isEvaluated := newTestTemplateEvaluator(map[string]string{}).evaluate(templateText)
+	test.AssertTrue(t, isEvaluated)
+	test.AssertEqual(t, expected, result)
+}
+
+func TestParserFunctionIf(t *testing.T) {
+	assertLocallyEvaluated(t, "yes", "{{#if: foo | yes | no }}")
+	assertLocallyEvaluated(t, "no", "{{#if:  | yes | no }}")
+	assertLocallyEvaluated(t, "", "{{#if: | yes }}")
+}
+
+func TestParserFunctionIfeq(t *testing.T) {
+	assertLocallyEvaluated(t, "yes", "{{#ifeq: foo | foo | yes | no }}")
+	assertLocallyEvaluated(t, "no", "{{#ifeq: foo | Foo | yes | no }}")
+	assertLocallyEvaluated(t, "yes", "{{#ifeq: 01 | 1 | yes | no }}")
+}
+
+func TestParserFunctionIferror(t *testing.T) {
+	assertLocallyEvaluated(t, "error", `{{#iferror: <strong class="error">x</strong> | error | fine }}`)
+	assertLocallyEvaluated(t, "fine", "{{#iferror: foo | error | fine }}")
+	assertLocallyEvaluated(t, "foo", "{{#iferror: foo | error }}")
+}
+
+func TestParserFunctionIfexpr(t *testing.T) {
+	assertLocallyEvaluated(t, "yes", "{{#ifexpr: 2 > 1 | yes | no }}")
+	assertLocallyEvaluated(t, "no", "{{#ifexpr: 2 < 1 | yes | no }}")
+}
+
+func TestParserFunctionSwitch(t *testing.T) {
+	assertLocallyEvaluated(t, "x", "{{#switch: b | a | b = x | c = y }}")
+	assertLocallyEvaluated(t, "y", "{{#switch: c | a | b = x | c = y }}")
+	assertLocallyEvaluated(t, "default", "{{#switch: d | a = x | default }}")
+	assertLocallyEvaluated(t, "default", "{{#switch: d | #default = default | a = x }}")
+	assertLocallyEvaluated(t, "", "{{#switch: d | a = x }}")
+	assertLocallyEvaluated(t, "number", "{{#switch: 1.0 | 1 = number }}")
+}
+
+func TestParserFunctionExpr(t *testing.T) {
+	assertLocallyEvaluated(t, "7", "{{#expr: 1 + 2 * 3 }}")
+	assertLocallyEvaluated(t, "", "{{#expr: }}")
+}
+
+func TestParserFunctionTag(t *testing.T) {
+	assertLocallyEvaluated(t, `<ref name="foo&amp;bar" group="g">some [[content]]</ref>`, `{{#tag:ref|some [[content]]|name="foo&bar"|group=g}}`)
+	assertLocallyEvaluated(t, `<references />`, `{{#tag:references}}`)
+}
+
+func TestParserFunctionCaseConversion(t *testing.T) {
+	assertLocallyEvaluated(t, "foo bar", "{{lc: Foo BAR }}")
+	assertLocallyEvaluated(t, "FOO BAR", "{{uc:Foo bar}}")
+	assertLocallyEvaluated(t, "äBC", "{{lcfirst:ÄBC}}")
+	assertLocallyEvaluated(t, "Äbc", "{{ucfirst:äbc}}")
+}
+
+func TestParserFunctionFormatnum(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	assertLocallyEvaluated(t, "1,234,567.89", "{{formatnum:1234567.89}}")
+	assertLocallyEvaluated(t, "-123", "{{formatnum:-123}}")
+	assertLocallyEvaluated(t, "1234567", "{{formatnum:1,234,567|R}}")
+	assertLocallyEvaluated(t, "1234.5", "{{formatnum:1234.5|NOSEP}}")
+	assertLocallyEvaluated(t, "foo", "{{formatnum:foo}}")
+
+	config.Current.WikipediaInstance = "de"
+	assertLocallyEvaluated(t, "1.234.567,89", "{{formatnum:1234567.89}}")
+	assertLocallyEvaluated(t, "1234567.89", "{{formatnum:1.234.567,89|R}}")
+}
+
+func TestParserFunctionPadding(t *testing.T) {
+	assertLocallyEvaluated(t, "007", "{{padleft:7|3}}")
+	assertLocallyEvaluated(t, "7abab", "{{padright:7|5|ab}}")
+	assertLocallyEvaluated(t, "1234", "{{padleft:1234|2}}")
+}
+
+func TestMagicWords(t *testing.T) {
+	originalNow := now
+	defer func() { now = originalNow }()
+	now = func() time.Time {
+		return time.Date(2024, 3, 5, 7, 8, 9, 0, time.UTC)
+	}
+
+	assertLocallyEvaluated(t, "Some article", "{{PAGENAME}}")
+	assertLocallyEvaluated(t, "a|b", "a{{!}}b")
+	assertLocallyEvaluated(t, "2024-03-5-03", "{{CURRENTYEAR}}-{{CURRENTMONTH}}-{{CURRENTDAY}}-{{CURRENTMONTH}}")
+	assertLocallyEvaluated(t, "20240305070809", "{{CURRENTTIMESTAMP}}")
+	assertLocallyEvaluated(t, "2", "{{CURRENTDOW}}")
+}
@@ -24,13 +24,14 @@ func (t *Tokenizer) evaluateTemplates(content string) (string, error) {
 	// All evaluated templates are stored in this map. Replacing evaluated templates by placeholders reduces the length
 	// of request URLs significantly and prevents errors due to too long URLs.
 	placeholderToContent := map[string]string{}
+	templateEvaluator := newLocalTemplateEvaluator(t.templateSource, t.articleTitle, placeholderToContent)
 
 	sigolo.Debug("Start evaluating templates and replacing them by placeholders")
-	content, err := t.replaceTemplateByPlaceholders(content, placeholderToContent)
+	content, err := t.replaceTemplateByPlaceholders(content, placeholderToContent, templateEvaluator)
 	if err != nil {
 		return "", err
 	}
-	sigolo.Debug("Finished finding and evaluating templates")
+	sigolo.Infof("Article '%s': Evaluated %d templates locally, %d templates needed the Wikipedia API", t.articleTitle, t.locallyEvaluatedTemplates, t.remotelyEvaluatedTemplates)
 
 	// Replace all template placeholders with the actual content until no placeholders are unresolved. This is not very
 	// elegant or fast but due to the nesting a simple and working approach.
@@ -54,7 +55,9 @@ func (t *Tokenizer) evaluateTemplates(content string) (string, error) {
 	return content, nil
 }
 
-func (t *Tokenizer) replaceTemplateByPlaceholders(content string, placeholderToContent map[string]string) (string, error) {
+// replaceTemplateByPlaceholders evaluates all templates and replaces them by placeholders. Templates are evaluated
+// locally if possible, only the remaining ones are evaluated using the Wikipedia API.
+func (t *Tokenizer) replaceTemplateByPlaceholders(content string, placeholderToContent map[string]string, templateEvaluator *localTemplateEvaluator) (string, error) {
 	sigolo.Tracef("Replace template tokens in content '%s'", util.TruncString(content))
 	for i := 0; i < len(content)-templateEndTokenLen; i++ {
 		cursor := content[i : i+templateStartTokenLen]
@@ -73,7 +76,7 @@ func (t *Tokenizer) replaceTemplateByPlaceholders(content string, placeholderToC
 				// If the template itself contains a template, then proceed to first evaluate the inner template and
 				// to evaluate the outer template in a later run
 				sigolo.Trace("Template contains templates, inner templates are replaced first")
-				newContent, err := t.replaceTemplateByPlaceholders(templateText[templateStartTokenLen:], placeholderToContent)
+				newContent, err := t.replaceTemplateByPlaceholders(templateText[templateStartTokenLen:], placeholderToContent, templateEvaluator)
 				if err != nil {
 					return "", err
 				}
@@ -83,9 +86,16 @@ func (t *Tokenizer) replaceTemplateByPlaceholders(content string, placeholderToC
 			key := util.Hash(templateText)
 
 			sigolo.Tracef("Evaluate template: %s", util.TruncString(templateText))
-			evaluatedTemplate, err := t.wikipediaService.EvaluateTemplate(templateText, key)
-			if err != nil {
-				return "", err
+			evaluatedTemplate, isEvaluatedLocally := templateEvaluator.evaluate(templateText)
+			if isEvaluatedLocally {
+				t.locallyEvaluatedTemplates++
+			} else {
+				t.remotelyEvaluatedTemplates++
+				var err error
+				evaluatedTemplate, err = t.wikipediaService.EvaluateTemplate(templateText, key)
+				if err != nil {
+					return "", err
+				}
 			}
 
 			// Replace the template by a placeholder. We do not directly replace the wikitext of the template with the
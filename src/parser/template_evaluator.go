@@ -0,0 +1,543 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"wiki2book/config"
+	"wiki2book/util"
+	"wiki2book/wikipedia"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+// Same limit as the default of MediaWiki ($wgMaxTemplateDepth).
+const maxTemplateEvaluationDepth = 40
+
+// errNotLocallyEvaluable signals that a template contains something the local evaluation doesn't support, e.g. an
+// unknown parser function, a Lua module or a template page that isn't available. Such templates are evaluated by the
+// Wikipedia API instead.
+var errNotLocallyEvaluable = errors.New("Template cannot be evaluated locally")
+
+var (
+	// Content of these tags is not evaluated by MediaWiki, so templates in there stay as they are.
+	verbatimTagStartRegex    = regexp.MustCompile(`(?i)^<(nowiki|pre|math|chem|ce|syntaxhighlight|source)(\s[^>]*?)?(/?)>`)
+	verbatimTagEndRegexes    = map[string]*regexp.Regexp{}
+	templatePlaceholderRegex = regexp.MustCompile(regexp.QuoteMeta(templatePlaceholderPrefix) + `([0-9a-f]+)\$\$`)
+	noincludeRegex           = regexp.MustCompile(`(?is)<noinclude>.*?(</noinclude>|$)`)
+	includeonlyTagRegex      = regexp.MustCompile(`(?i)</?includeonly>`)
+	onlyincludeContentRegex  = regexp.MustCompile(`(?is)<onlyinclude>(.*?)</onlyinclude>`)
+)
+
+func init() {
+	for _, tagName := range []string{"nowiki", "pre", "math", "chem", "ce", "syntaxhighlight", "source"} {
+		verbatimTagEndRegexes[tagName] = regexp.MustCompile(`(?i)</` + tagName + `>`)
+	}
+}
+
+// wikitextNode is either a textNode, templateNode or parameterNode.
+type wikitextNode interface{}
+type wikitextNodes []wikitextNode
+
+type textNode string
+
+// templateNode is a template or parser function call "{{...}}". The parts are separated by "|", the first part is the
+// name.
+type templateNode struct {
+	parts []wikitextNodes
+}
+
+// parameterNode is a template parameter "{{{...}}}" with its name and optional default value.
+type parameterNode struct {
+	parts []wikitextNodes
+}
+
+// openBracket is an opened but not yet closed "{{", "{{{" or "[[" while parsing.
+type openBracket struct {
+	char  byte
+	count int
+	parts []wikitextNodes
+}
+
+func (b *openBracket) appendNode(node wikitextNode) {
+	if node == textNode("") {
+		return
+	}
+
+	lastPart := &b.parts[len(b.parts)-1]
+	if text, isText := node.(textNode); isText && len(*lastPart) > 0 {
+		if lastText, lastIsText := (*lastPart)[len(*lastPart)-1].(textNode); lastIsText {
+			(*lastPart)[len(*lastPart)-1] = lastText + text
+			return
+		}
+	}
+	*lastPart = append(*lastPart, node)
+}
+
+// flattenInto appends the content of this bracket as it was written in the wikitext to the given bracket. This is used
+// for links and brackets without closing counterpart.
+func (b *openBracket) flattenInto(target *openBracket, openToken string, closeToken string) {
+	target.appendNode(textNode(openToken))
+	for i, part := range b.parts {
+		if i > 0 {
+			target.appendNode(textNode("|"))
+		}
+		for _, node := range part {
+			target.appendNode(node)
+		}
+	}
+	target.appendNode(textNode(closeToken))
+}
+
+// parseWikitextNodes splits the wikitext into text, templates and parameters. Like in MediaWiki, runs of braces are
+// matched from the inside out, so that e.g. "{{{{{a}}}}}" is a template whose name is the parameter "a". Links are
+// considered as well, because the "|" in "[[foo|bar]]" doesn't separate template arguments.
+func parseWikitextNodes(text string) wikitextNodes {
+	root := &openBracket{parts: []wikitextNodes{{}}}
+	stack := []*openBracket{root}
+	top := func() *openBracket {
+		return stack[len(stack)-1]
+	}
+
+	for i := 0; i < len(text); {
+		char := text[i]
+
+		switch {
+		case char == '<':
+			if strings.HasPrefix(text[i:], "<!--") {
+				commentEnd := strings.Index(text[i:], "-->")
+				if commentEnd == -1 {
+					i = len(text)
+				} else {
+					i += commentEnd + 3
+				}
+				continue
+			}
+			verbatimLength := verbatimTagLength(text[i:])
+			if verbatimLength == 0 {
+				verbatimLength = 1
+			}
+			top().appendNode(textNode(text[i : i+verbatimLength]))
+			i += verbatimLength
+		case char == '{' || char == '[':
+			count := countRepeatedChar(text, i, char)
+			if count < 2 {
+				top().appendNode(textNode(text[i : i+1]))
+			} else {
+				stack = append(stack, &openBracket{char: char, count: count, parts: []wikitextNodes{{}}})
+			}
+			i += count
+		case char == '|' && len(stack) > 1:
+			top().parts = append(top().parts, wikitextNodes{})
+			i++
+		case char == '}' || char == ']':
+			count := countRepeatedChar(text, i, char)
+			i += count
+
+			openChar := byte('{')
+			if char == ']' {
+				openChar = '['
+			}
+
+			for count >= 2 && len(stack) > 1 && top().char == openChar {
+				bracket := top()
+				stack = stack[:len(stack)-1]
+
+				usedCount := 2
+				if openChar == '{' && min(count, bracket.count) >= 3 {
+					usedCount = 3
+				}
+				count -= usedCount
+				bracket.count -= usedCount
+
+				var node wikitextNode
+				if openChar == '{' && usedCount == 3 {
+					node = parameterNode{parts: bracket.parts}
+				} else if openChar == '{' {
+					node = templateNode{parts: bracket.parts}
+				}
+
+				if bracket.count >= 2 && openChar == '{' {
+					// The remaining braces belong to an outer template or parameter.
+					stack = append(stack, &openBracket{char: openChar, count: bracket.count, parts: []wikitextNodes{{node}}})
+					continue
+				}
+
+				top().appendNode(textNode(strings.Repeat(string(openChar), bracket.count)))
+				if node != nil {
+					top().appendNode(node)
+				} else {
+					bracket.flattenInto(top(), "[[", "]]")
+				}
+			}
+
+			top().appendNode(textNode(strings.Repeat(string(char), count)))
+		default:
+			nextSpecialChar := strings.IndexAny(text[i:], "<{[|}]")
+			if nextSpecialChar == -1 {
+				nextSpecialChar = len(text) - i
+			} else if nextSpecialChar == 0 {
+				// A "|" outside any template is just text.
+				nextSpecialChar = 1
+			}
+			top().appendNode(textNode(text[i : i+nextSpecialChar]))
+			i += nextSpecialChar
+		}
+	}
+
+	// Brackets without closing counterpart are just text.
+	for len(stack) > 1 {
+		bracket := top()
+		stack = stack[:len(stack)-1]
+		bracket.flattenInto(top(), strings.Repeat(string(bracket.char), bracket.count), "")
+	}
+
+	return root.parts[0]
+}
+
+// verbatimTagLength returns the length of the tag including its content and closing tag, if the text starts with a tag
+// whose content is not evaluated. Otherwise, 0 is returned.
+func verbatimTagLength(text string) int {
+	startTagMatch := verbatimTagStartRegex.FindStringSubmatch(text[:min(len(text), 200)])
+	if startTagMatch == nil {
+		return 0
+	}
+	if startTagMatch[3] == "/" {
+		return len(startTagMatch[0])
+	}
+
+	closingTagLocation := verbatimTagEndRegexes[strings.ToLower(startTagMatch[1])].FindStringIndex(text)
+	if closingTagLocation == nil {
+		return len(startTagMatch[0])
+	}
+	return closingTagLocation[1]
+}
+
+func countRepeatedChar(text string, start int, char byte) int {
+	count := 0
+	for start+count < len(text) && text[start+count] == char {
+		count++
+	}
+	return count
+}
+
+// templateArgument is an argument of a template call. Its value is evaluated in the frame of the caller.
+type templateArgument struct {
+	nodes   wikitextNodes
+	isNamed bool
+}
+
+// templateFrame contains the arguments of the template currently being evaluated. The frame of the article itself has
+// no arguments.
+type templateFrame struct {
+	parent         *templateFrame
+	arguments      map[string]templateArgument
+	evaluatedCache map[string]string
+	depth          int
+}
+
+func (f *templateFrame) isArticleFrame() bool {
+	return f.parent == nil
+}
+
+// localTemplateEvaluator evaluates templates without the Wikipedia API. It supports the most common parser functions
+// and magic words as well as templates whose wikitext is available from the template source.
+type localTemplateEvaluator struct {
+	templateSource       wikipedia.ArticleSource
+	articleTitle         string
+	placeholderToContent map[string]string
+	templatePages        map[string]wikitextNodes
+}
+
+func newLocalTemplateEvaluator(templateSource wikipedia.ArticleSource, articleTitle string, placeholderToContent map[string]string) *localTemplateEvaluator {
+	return &localTemplateEvaluator{
+		templateSource:       templateSource,
+		articleTitle:         articleTitle,
+		placeholderToContent: placeholderToContent,
+		templatePages:        map[string]wikitextNodes{},
+	}
+}
+
+// evaluate returns the evaluated form of the given template call. The boolean is false when the template cannot be
+// evaluated locally.
+func (e *localTemplateEvaluator) evaluate(templateText string) (string, bool) {
+	result, err := e.evaluateNodes(parseWikitextNodes(templateText), &templateFrame{})
+	if err != nil {
+		sigolo.Tracef("Template cannot be evaluated locally: %s", err.Error())
+		return "", false
+	}
+	return result, true
+}
+
+func (e *localTemplateEvaluator) evaluateNodes(nodes wikitextNodes, frame *templateFrame) (string, error) {
+	builder := strings.Builder{}
+	for _, node := range nodes {
+		var result string
+		var err error
+
+		switch n := node.(type) {
+		case textNode:
+			result = e.resolvePlaceholders(string(n))
+		case parameterNode:
+			result, err = e.evaluateParameter(n, frame)
+		case templateNode:
+			result, err = e.evaluateTemplate(n, frame)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		builder.WriteString(result)
+	}
+	return builder.String(), nil
+}
+
+// resolvePlaceholders replaces the placeholders of already evaluated inner templates by their content.
+func (e *localTemplateEvaluator) resolvePlaceholders(text string) string {
+	for strings.Contains(text, templatePlaceholderPrefix) {
+		replacedText := templatePlaceholderRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+			key := templatePlaceholderRegex.FindStringSubmatch(placeholder)[1]
+			if content, found := e.placeholderToContent[key]; found {
+				return content
+			}
+			// Unknown placeholders are resolved later on.
+			return placeholder
+		})
+		if replacedText == text {
+			break
+		}
+		text = replacedText
+	}
+	return text
+}
+
+func (e *localTemplateEvaluator) evaluateParameter(node parameterNode, frame *templateFrame) (string, error) {
+	evaluatedParts := make([]string, len(node.parts))
+	for i, part := range node.parts {
+		// Only the name and the default value are needed but evaluating them upfront keeps the code simple.
+		evaluatedPart, err := e.evaluateNodes(part, frame)
+		if err != nil {
+			return "", err
+		}
+		evaluatedParts[i] = evaluatedPart
+	}
+
+	if !frame.isArticleFrame() {
+		name := strings.TrimSpace(evaluatedParts[0])
+		value, found, err := e.argument(frame, name)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return value, nil
+		}
+		if len(evaluatedParts) > 1 {
+			return evaluatedParts[1], nil
+		}
+	}
+
+	return "{{{" + strings.Join(evaluatedParts, "|") + "}}}", nil
+}
+
+// argument returns the evaluated value of the argument with the given name of the current template call.
+func (e *localTemplateEvaluator) argument(frame *templateFrame, name string) (string, bool, error) {
+	if value, found := frame.evaluatedCache[name]; found {
+		return value, true, nil
+	}
+
+	argument, found := frame.arguments[name]
+	if !found {
+		return "", false, nil
+	}
+
+	value, err := e.evaluateNodes(argument.nodes, frame.parent)
+	if err != nil {
+		return "", false, err
+	}
+	if argument.isNamed {
+		value = strings.TrimSpace(value)
+	}
+
+	frame.evaluatedCache[name] = value
+	return value, true, nil
+}
+
+func (e *localTemplateEvaluator) evaluateTemplate(node templateNode, frame *templateFrame) (string, error) {
+	if frame.depth >= maxTemplateEvaluationDepth {
+		return "", errors.Wrapf(errNotLocallyEvaluable, "Maximum template depth of %d reached", maxTemplateEvaluationDepth)
+	}
+
+	name, err := e.evaluateNodes(node.parts[0], frame)
+	if err != nil {
+		return "", err
+	}
+	name = strings.TrimSpace(name)
+	for _, substPrefix := range []string{"subst:", "safesubst:"} {
+		if util.HasPrefixIgnoreCase(name, substPrefix) {
+			name = strings.TrimSpace(name[len(substPrefix):])
+		}
+	}
+	arguments := node.parts[1:]
+
+	if prefix, firstArgument, hasColon := strings.Cut(name, ":"); hasColon {
+		prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+		if parserFunction, found := parserFunctions[prefix]; found {
+			return parserFunction(e, &parserFunctionCall{
+				firstArgument: strings.TrimSpace(firstArgument),
+				arguments:     arguments,
+				frame:         frame,
+			})
+		}
+		if util.Contains(config.Current.TemplatePrefixes, prefix) {
+			return e.evaluateTemplatePage([]string{templateTitle(prefix, firstArgument)}, arguments, frame)
+		}
+
+		return "", errors.Wrapf(errNotLocallyEvaluable, "Unsupported parser function or namespace '%s'", prefix)
+	}
+
+	if len(arguments) == 0 {
+		if magicWord, found := magicWords[name]; found {
+			return magicWord(e), nil
+		}
+	}
+
+	var titles []string
+	for _, templatePrefix := range config.Current.TemplatePrefixes {
+		titles = append(titles, templateTitle(templatePrefix, name))
+	}
+	return e.evaluateTemplatePage(titles, arguments, frame)
+}
+
+// evaluateTemplatePage evaluates the wikitext of the first existing template page of the given titles.
+func (e *localTemplateEvaluator) evaluateTemplatePage(titles []string, arguments []wikitextNodes, frame *templateFrame) (string, error) {
+	templateNodes, err := e.templatePage(titles)
+	if err != nil {
+		return "", err
+	}
+
+	templateFrame := &templateFrame{
+		parent:         frame,
+		arguments:      map[string]templateArgument{},
+		evaluatedCache: map[string]string{},
+		depth:          frame.depth + 1,
+	}
+
+	positionalArgumentIndex := 1
+	for _, argumentNodes := range arguments {
+		nameNodes, valueNodes, isNamed := splitNamedArgument(argumentNodes)
+		if !isNamed {
+			templateFrame.arguments[strconv.Itoa(positionalArgumentIndex)] = templateArgument{nodes: argumentNodes}
+			positionalArgumentIndex++
+			continue
+		}
+
+		name, err := e.evaluateNodes(nameNodes, frame)
+		if err != nil {
+			return "", err
+		}
+		templateFrame.arguments[strings.TrimSpace(name)] = templateArgument{nodes: valueNodes, isNamed: true}
+	}
+
+	result, err := e.evaluateNodes(templateNodes, templateFrame)
+	if err != nil {
+		return "", err
+	}
+
+	// Like in MediaWiki, a template starting with a list or table starts on a new line.
+	if util.HasAnyPrefix(result, "{|", ":", ";", "#", "*") {
+		result = "\n" + result
+	}
+
+	return result, nil
+}
+
+// templatePage returns the parsed wikitext of the first existing page of the given titles, as it's transcluded into
+// other pages.
+func (e *localTemplateEvaluator) templatePage(titles []string) (wikitextNodes, error) {
+	if e.templateSource == nil {
+		return nil, errors.Wrap(errNotLocallyEvaluable, "No source for template pages available")
+	}
+
+	for _, title := range titles {
+		if nodes, found := e.templatePages[title]; found {
+			if nodes == nil {
+				continue
+			}
+			return nodes, nil
+		}
+
+		article, err := e.templateSource.GetArticle(title)
+		if err != nil || article == nil || article.Parse.Title == "" {
+			sigolo.Tracef("Template page '%s' not available: %v", title, err)
+			e.templatePages[title] = nil
+			continue
+		}
+
+		nodes := parseWikitextNodes(transcludedContent(article.Parse.Wikitext.Content))
+		e.templatePages[title] = nodes
+		return nodes, nil
+	}
+
+	return nil, errors.Wrapf(errNotLocallyEvaluable, "None of the template pages %v is available", titles)
+}
+
+// transcludedContent returns the part of the wikitext of a template page that is used when using the template.
+func transcludedContent(wikitext string) string {
+	onlyincludeMatches := onlyincludeContentRegex.FindAllStringSubmatch(wikitext, -1)
+	if len(onlyincludeMatches) > 0 {
+		var onlyincludeContents []string
+		for _, match := range onlyincludeMatches {
+			onlyincludeContents = append(onlyincludeContents, match[1])
+		}
+		wikitext = strings.Join(onlyincludeContents, "")
+	}
+
+	wikitext = noincludeRegex.ReplaceAllString(wikitext, "")
+	return includeonlyTagRegex.ReplaceAllString(wikitext, "")
+}
+
+// splitNamedArgument splits "name=value" at the first "=", which is not part of a nested template or parameter.
+func splitNamedArgument(nodes wikitextNodes) (wikitextNodes, wikitextNodes, bool) {
+	for i, node := range nodes {
+		text, isText := node.(textNode)
+		if !isText {
+			continue
+		}
+
+		name, value, found := strings.Cut(string(text), "=")
+		if !found {
+			continue
+		}
+
+		nameNodes := append(append(wikitextNodes{}, nodes[:i]...), textNode(name))
+		valueNodes := append(wikitextNodes{textNode(value)}, nodes[i+1:]...)
+		return nameNodes, valueNodes, true
+	}
+	return nil, nil, false
+}
+
+// templateTitle returns the page title of the template, e.g. "Template:Foo bar" for the prefix "template" and the name
+// "foo_bar".
+func templateTitle(prefix string, name string) string {
+	return upperCaseFirst(prefix) + ":" + upperCaseFirst(strings.Join(strings.Fields(strings.ReplaceAll(name, "_", " ")), " "))
+}
+
+func upperCaseFirst(text string) string {
+	if text == "" {
+		return text
+	}
+	firstRune, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(firstRune)) + text[size:]
+}
+
+func lowerCaseFirst(text string) string {
+	if text == "" {
+		return text
+	}
+	firstRune, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToLower(firstRune)) + text[size:]
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+	"wiki2book/config"
+	"wiki2book/test"
+	"wiki2book/wikipedia"
+
+	"github.com/pkg/errors"
+)
+
+func newTestTemplateEvaluator(templatePages map[string]string) *localTemplateEvaluator {
+	templateSource := wikipedia.NewMockArticleSource()
+	templateSource.GetArticleFunc = func(title string) (*wikipedia.WikiArticleDto, error) {
+		content, found := templatePages[title]
+		if !found {
+			return nil, errors.Errorf("Page %s not found", title)
+		}
+		return &wikipedia.WikiArticleDto{Parse: wikipedia.WikiParseArticleDto{Title: title, Wikitext: wikipedia.WikiWildcardTextDto{Content: content}}}, nil
+	}
+	return newLocalTemplateEvaluator(templateSource, "Some article", map[string]string{})
+}
+
+func TestParseWikitextNodes(t *testing.T) {
+	test.AssertEqual(t, wikitextNodes{textNode("foo")}, parseWikitextNodes("foo"))
+	test.AssertEqual(t, wikitextNodes{
+		textNode("a "),
+		templateNode{parts: []wikitextNodes{{textNode("foo")}, {textNode("[[bar|baz]]")}, {textNode("x="), parameterNode{parts: []wikitextNodes{{textNode("1")}, {textNode("y")}}}}}},
+		textNode(" b"),
+	}, parseWikitextNodes("a {{foo|[[bar|baz]]|x={{{1|y}}}}} b"))
+}
+
+func TestParseWikitextNodes_nestedBraces(t *testing.T) {
+	test.AssertEqual(t, wikitextNodes{
+		templateNode{parts: []wikitextNodes{{parameterNode{parts: []wikitextNodes{{textNode("a")}}}}}},
+	}, parseWikitextNodes("{{{{{a}}}}}"))
+}
+
+func TestParseWikitextNodes_unclosedAndVerbatim(t *testing.T) {
+	test.AssertEqual(t, wikitextNodes{textNode("{{foo|bar}")}, parseWikitextNodes("{{foo|bar}"))
+	test.AssertEqual(t, wikitextNodes{textNode("a | b }} c")}, parseWikitextNodes("a | b }} c"))
+	test.AssertEqual(t, wikitextNodes{textNode("<nowiki>{{foo}}</nowiki><math>{{a}}</math>")}, parseWikitextNodes("<nowiki>{{foo}}</nowiki><math>{{a}}</math>"))
+	test.AssertEqual(t, wikitextNodes{textNode("a b")}, parseWikitextNodes("a <!-- {{foo}} -->b"))
+}
+
+func TestLocalTemplateEvaluator_templateWithParameters(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	evaluator := newTestTemplateEvaluator(map[string]string{
+		"Template:Foo bar": "<noinclude>Docs</noinclude>{{{1}}}-{{{name|default}}}-{{{2|{{{other|none}}}}}}<includeonly>!</includeonly>",
+	})
+
+	result, isEvaluated := evaluator.evaluate("{{foo_bar| a | name = b }}")
+
+	test.AssertTrue(t, isEvaluated)
+	test.AssertEqual(t, " a -b-none!", result)
+}
+
+func TestLocalTemplateEvaluator_nestedTemplates(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	config.Current.TemplatePrefixes = []string{"vorlage", "template"}
+	evaluator := newTestTemplateEvaluator(map[string]string{
+		"Template:Outer": "* {{Inner|{{{1}}}}}",
+		"Vorlage:Inner":  "<onlyinclude>[[{{{1}}}|{{lc:{{{1}}}}}]]</onlyinclude> not included",
+	})
+
+	result, isEvaluated := evaluator.evaluate("{{Outer|Foo}}")
+
+	test.AssertTrue(t, isEvaluated)
+	test.AssertEqual(t, "\n* [[Foo|foo]]", result)
+}
+
+func TestLocalTemplateEvaluator_placeholders(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	evaluator := newTestTemplateEvaluator(map[string]string{})
+	evaluator.placeholderToContent["abc123"] = "x " + fmt.Sprintf(templatePlaceholderTemplate, "def456")
+	evaluator.placeholderToContent["def456"] = "y"
+
+	result, isEvaluated := evaluator.evaluate("{{#if:" + fmt.Sprintf(templatePlaceholderTemplate, "abc123") + "|{{uc:" + fmt.Sprintf(templatePlaceholderTemplate, "abc123") + "}}}}")
+
+	test.AssertTrue(t, isEvaluated)
+	test.AssertEqual(t, "X Y", result)
+}
+
+func TestLocalTemplateEvaluator_notLocallyEvaluable(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	evaluator := newTestTemplateEvaluator(map[string]string{
+		"Template:Lua":       "{{#invoke:Foo|bar}}",
+		"Template:Recursive": "{{Recursive}}",
+	})
+
+	for _, templateText := range []string{"{{Unknown}}", "{{Lua}}", "{{Recursive}}", "{{#time:Y}}", "{{#expr:1/0}}"} {
+		_, isEvaluated := evaluator.evaluate(templateText)
+		test.AssertFalse(t, isEvaluated)
+	}
+
+	// Without a template source, templates are never evaluated locally.
+	_, isEvaluated := newLocalTemplateEvaluator(nil, "", map[string]string{}).evaluate("{{Lua}}")
+	test.AssertFalse(t, isEvaluated)
+}
+
+func TestLocalTemplateEvaluator_unusedBranchIsNotEvaluated(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	evaluator := newTestTemplateEvaluator(map[string]string{})
+
+	result, isEvaluated := evaluator.evaluate("{{#if: |{{Unknown}}|fine}}")
+
+	test.AssertTrue(t, isEvaluated)
+	test.AssertEqual(t, "fine", result)
+}
+
+func TestTranscludedContent(t *testing.T) {
+	test.AssertEqual(t, "a c", transcludedContent("a <noinclude>b</noinclude>c"))
+	test.AssertEqual(t, "a ", transcludedContent("a <noinclude>b"))
+	test.AssertEqual(t, "bd", transcludedContent("a<onlyinclude>b</onlyinclude>c<onlyinclude>d</onlyinclude>"))
+	test.AssertEqual(t, "a b c", transcludedContent("a <includeonly>b</includeonly> c"))
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"wiki2book/test"
 	"wiki2book/wikipedia"
+
+	"github.com/pkg/errors"
 )
 
 var templateFolder = test.TestCacheFolder
@@ -13,7 +15,7 @@ func TestEvaluateTemplate_existingFile(t *testing.T) {
 	wikipediaService.EvaluateTemplateFunc = func(template string, cacheFile string) (string, error) {
 		return "blubb", nil
 	}
-	tokenizer := NewTokenizer(wikipediaService)
+	tokenizer := NewTokenizer(wikipediaService, nil)
 
 	content, err := tokenizer.evaluateTemplates("Wikitext with {{my-template}}.")
 	test.AssertNil(t, err)
@@ -26,7 +28,7 @@ func TestEvaluateTemplate_newTemplate(t *testing.T) {
 	wikipediaService.EvaluateTemplateFunc = func(template string, cacheFile string) (string, error) {
 		return expectedTemplateContent, nil
 	}
-	tokenizer := NewTokenizer(wikipediaService)
+	tokenizer := NewTokenizer(wikipediaService, nil)
 
 	// Evaluate content
 	content, err := tokenizer.evaluateTemplates("Siehe {{Hauptartikel|Sternentstehung}}.")
@@ -45,7 +47,7 @@ func TestEvaluateTemplate_nestedTemplates(t *testing.T) {
 	wikipediaService.EvaluateTemplateFunc = func(template string, cacheFile string) (string, error) {
 		return expectedTemplateContent, nil
 	}
-	tokenizer := NewTokenizer(wikipediaService)
+	tokenizer := NewTokenizer(wikipediaService, nil)
 
 	// Evaluate content
 	content, err := tokenizer.evaluateTemplates("Siehe {{FOO|{{FOO}} bar}}")
@@ -64,7 +66,7 @@ func TestEvaluateTemplate_nestedTemplatesWithTouchingEnds(t *testing.T) {
 	wikipediaService.EvaluateTemplateFunc = func(template string, cacheFile string) (string, error) {
 		return expectedTemplateContent, nil
 	}
-	tokenizer := NewTokenizer(wikipediaService)
+	tokenizer := NewTokenizer(wikipediaService, nil)
 
 	// Evaluate content -> no space/separator between first }} and second }}
 	content, err := tokenizer.evaluateTemplates("Siehe {{FOO|{{FOO}}}}")
@@ -74,3 +76,29 @@ func TestEvaluateTemplate_nestedTemplatesWithTouchingEnds(t *testing.T) {
 	test.AssertNil(t, err)
 	test.AssertEqual(t, expectedContent, content)
 }
+
+func TestEvaluateTemplate_localEvaluationWithApiFallback(t *testing.T) {
+	var templatesEvaluatedByApi []string
+	wikipediaService := wikipedia.NewMockWikipediaService()
+	wikipediaService.EvaluateTemplateFunc = func(template string, cacheFile string) (string, error) {
+		templatesEvaluatedByApi = append(templatesEvaluatedByApi, template)
+		return "api", nil
+	}
+	templateSource := wikipedia.NewMockArticleSource()
+	templateSource.GetArticleFunc = func(title string) (*wikipedia.WikiArticleDto, error) {
+		if title == "Template:Greeting" {
+			return &wikipedia.WikiArticleDto{Parse: wikipedia.WikiParseArticleDto{Title: title, Wikitext: wikipedia.WikiWildcardTextDto{Content: "Hello {{{1|you}}}"}}}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	tokenizer := NewTokenizer(wikipediaService, templateSource)
+	tokenizer.articleTitle = "Foo"
+
+	content, err := tokenizer.evaluateTemplates("{{Greeting|{{uc:{{PAGENAME}}}}}}, {{#if:{{Unknown}}|yes|no}} {{#invoke:Foo|bar}}")
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "Hello FOO, yes api", content)
+	test.AssertEqual(t, []string{"{{Unknown}}", "{{#invoke:Foo|bar}}"}, templatesEvaluatedByApi)
+	test.AssertEqual(t, 4, tokenizer.locallyEvaluatedTemplates)
+	test.AssertEqual(t, 2, tokenizer.remotelyEvaluatedTemplates)
+}
@@ -49,6 +49,18 @@ type Tokenizer struct {
 	tokenCounter     int
 	images           []string
 	wikipediaService wikipedia.WikipediaService
+	templateSource   wikipedia.ArticleSource
+	articleTitle     string
+
+	// Sections of the article to keep or to remove. An empty list of sections means all sections are kept.
+	sections         []string
+	excludedSections []string
+	// The cleanup runs several times, but missing sections should only be reported once.
+	missingSectionsReported bool
+
+	// Number of templates evaluated locally or using the Wikipedia API.
+	locallyEvaluatedTemplates  int
+	remotelyEvaluatedTemplates int
 
 	tokenizeContent func(tokenizer *Tokenizer, content string) string
 }
@@ -69,19 +81,30 @@ type StringToken struct {
 	String string
 }
 
-func NewTokenizer(wikipediaService wikipedia.WikipediaService) Tokenizer {
+// NewTokenizer creates a new tokenizer. The template source provides the wikitext of templates, so that they can be
+// evaluated locally. It may be nil, in which case only parser functions and magic words are evaluated locally.
+func NewTokenizer(wikipediaService wikipedia.WikipediaService, templateSource wikipedia.ArticleSource) Tokenizer {
 	return Tokenizer{
 		tokenMap:         map[string]Token{},
 		tokenCounter:     0,
 		images:           []string{},
 		wikipediaService: wikipediaService,
+		templateSource:   templateSource,
 
 		tokenizeContent: tokenizeContent,
 	}
 }
 
+// SelectSections sets the sections of the article that should be kept or removed. Sections are identified by their
+// heading and contain all their subsections.
+func (t *Tokenizer) SelectSections(sections []string, excludedSections []string) {
+	t.sections = sections
+	t.excludedSections = excludedSections
+}
+
 func (t *Tokenizer) Tokenize(content string, title string) (*Article, error) {
 	var err error
+	t.articleTitle = title
 
 	sigolo.Debugf("Tokenize article '%s' [1/4]: First cleanup", title)
 	content, err = t.clean(content)
@@ -2,19 +2,45 @@ package util
 
 import (
 	"fmt"
+	"maps"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/hauke96/sigolo/v2"
 	"github.com/pkg/errors"
 )
 
-func ExecuteCommandWithArgs(commandString string, workingDirectory string) error {
-	commandParts := strings.Split(commandString, " ")
-	commandExecutable := commandParts[0]
-	commandArgs := commandParts[1:]
+// ExecuteCommandTemplate executes the command of the given template after replacing its placeholders (s.
+// FillCommandTemplate).
+func ExecuteCommandTemplate(commandTemplate string, placeholderValues map[string]string, workingDirectory string) error {
+	commandParts := FillCommandTemplate(commandTemplate, placeholderValues)
+	if len(commandParts) == 0 {
+		return errors.New("Unable to execute empty command template")
+	}
+
+	return Execute(commandParts[0], workingDirectory, commandParts[1:]...)
+}
 
-	return Execute(commandExecutable, workingDirectory, commandArgs...)
+// FillCommandTemplate splits the given command template into the executable and its arguments and then replaces the
+// placeholders (the keys of the given map) within each of them. Values containing spaces (e.g. file paths) therefore
+// stay one single argument. All placeholders are replaced in one pass, so placeholders within the values (e.g. a file
+// named "{OUTPUT}.png") are not replaced.
+func FillCommandTemplate(commandTemplate string, placeholderValues map[string]string) []string {
+	// The replacer prefers the first of several placeholders matching at the same position, so the order must not
+	// depend on the random order of the map.
+	placeholders := slices.Sorted(maps.Keys(placeholderValues))
+	var oldNewPairs []string
+	for _, placeholder := range placeholders {
+		oldNewPairs = append(oldNewPairs, placeholder, placeholderValues[placeholder])
+	}
+	replacer := strings.NewReplacer(oldNewPairs...)
+
+	commandParts := strings.Fields(commandTemplate)
+	for i, part := range commandParts {
+		commandParts[i] = replacer.Replace(part)
+	}
+	return commandParts
 }
 
 func Execute(name string, workingDirectory string, arg ...string) error {
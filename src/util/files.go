@@ -17,6 +17,7 @@ const (
 	FileEndingPng  = ".png"
 	FileEndingPdf  = ".pdf"
 	FileEndingWebp = ".webp"
+	FileEndingMd   = ".md"
 )
 
 func ToRelativePaths(paths ...string) ([]string, error) {
@@ -240,12 +241,13 @@ type Filesystem interface {
 	GetSizeInBytes(path string) (int64, error)
 	Rename(oldPath string, newPath string) error
 	Remove(name string) error
+	RemoveAll(path string) error
 	Create(name string) (FileLike, error)
+	CreateExclusive(name string) (FileLike, error)
 	MkdirAll(path string) error
 	CreateTemp(dir, pattern string) (FileLike, error)
-	DirSizeInBytes(path string) (error, int64)
-	FindLargestFile(path string, exceptDir string) (error, int64, string)
-	FindLruFile(path string, exceptDir string) (error, int64, string)
+	AppendFile(name string, data []byte) error
+	Walk(root string, walkFunc filepath.WalkFunc) error
 	ReadFile(name string) ([]byte, error)
 	Stat(name string) (os.FileInfo, error)
 	Chtimes(name string, atime time.Time, mtime time.Time) error
@@ -292,114 +294,48 @@ func (o *OsFilesystem) Remove(path string) error {
 	return os.Remove(path)
 }
 
-func (o *OsFilesystem) Create(path string) (FileLike, error) {
+func (o *OsFilesystem) RemoveAll(path string) error {
 	RequireFilePathIsSanitized(path)
 
-	return os.Create(path)
+	return os.RemoveAll(path)
 }
 
-func (o *OsFilesystem) DirSizeInBytes(path string) (error, int64) {
+func (o *OsFilesystem) Create(path string) (FileLike, error) {
 	RequireFilePathIsSanitized(path)
 
-	var dirSizeBytes int64 = 0
-
-	readSize := func(path string, file os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsNotExist(err) {
-				// It might happen, that files are deleted during file walk (concurrency etc.)
-				return nil
-			}
-			return err
-		}
-		if !file.IsDir() {
-			dirSizeBytes += file.Size()
-		}
-		return nil
-	}
-
-	err := filepath.Walk(path, readSize)
-	if err != nil {
-		return err, math.MinInt64
-	}
-
-	return nil, dirSizeBytes
+	return os.Create(path)
 }
 
-func (o *OsFilesystem) FindLargestFile(path string, exceptDir string) (error, int64, string) {
+// CreateExclusive creates the given file. In contrast to Create, an error satisfying os.IsExist is returned when the
+// file already exists.
+func (o *OsFilesystem) CreateExclusive(path string) (FileLike, error) {
 	RequireFilePathIsSanitized(path)
-	RequireFilePathIsSanitized(exceptDir)
-
-	var currentLargestFile os.FileInfo
-	var currentLargestFilePath string
 
-	readSize := func(path string, file os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsNotExist(err) {
-				// It might happen, that files are deleted during file walk (concurrency etc.)
-				return nil
-			}
-			return err
-		}
-		if !file.IsDir() {
-			if currentLargestFile == nil || file.Size() > currentLargestFile.Size() {
-				currentLargestFile = file
-				currentLargestFilePath = path
-			}
-		} else if file.Name() == exceptDir {
-			// The directory for temporary files might be inside the cache folder. This is fine, but we don't want to
-			// count in temporary files then.
-			return filepath.SkipDir
-		}
-		return nil
-	}
-
-	err := filepath.Walk(path, readSize)
-	if err != nil {
-		return err, math.MinInt64, ""
-	}
-
-	return nil, currentLargestFile.Size(), currentLargestFilePath
+	return os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 }
 
-func (o *OsFilesystem) FindLruFile(path string, exceptDir string) (error, int64, string) {
-	RequireFilePathIsSanitized(path)
-	RequireFilePathIsSanitized(exceptDir)
-
-	var currentLruFilePath string
-	var currentLruFile os.FileInfo
+// AppendFile appends the given data to the file, which is created if it doesn't exist.
+func (o *OsFilesystem) AppendFile(name string, data []byte) error {
+	RequireFilePathIsSanitized(name)
 
-	readModTime := func(path string, file os.FileInfo, err error) error {
-		if err != nil {
-			if os.IsNotExist(err) {
-				// It might happen, that files are deleted during file walk (concurrency etc.)
-				return nil
-			}
-			return err
-		}
-		if !file.IsDir() {
-			if currentLruFile == nil || file.ModTime().Before(currentLruFile.ModTime()) {
-				currentLruFile = file
-				currentLruFilePath = path
-			}
-		} else if file.Name() == exceptDir {
-			// The directory for temporary files might be inside the cache folder. This is fine, but we don't want to
-			// count in temporary files then.
-			return filepath.SkipDir
-		}
-		return nil
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
 	}
 
-	err := filepath.Walk(path, readModTime)
+	_, err = file.Write(data)
 	if err != nil {
-		return err, math.MinInt64, ""
+		file.Close()
+		return err
 	}
+	return file.Close()
+}
 
-	if currentLruFile == nil {
-		// No file was found
-		return nil, 0, ""
-	}
+// Walk calls the walk function for all files and folders within the given root folder, s. filepath.Walk for details.
+func (o *OsFilesystem) Walk(root string, walkFunc filepath.WalkFunc) error {
+	RequireFilePathIsSanitized(root)
 
-	return nil, currentLruFile.Size(), currentLruFilePath
+	return filepath.Walk(root, walkFunc)
 }
 
 func (o *OsFilesystem) ReadFile(name string) ([]byte, error) {
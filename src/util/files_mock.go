@@ -2,6 +2,7 @@ package util
 
 import (
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -80,12 +81,13 @@ type MockFilesystem struct {
 	GetSizeInBytesFunc  func(path string) (int64, error)
 	RenameFunc          func(oldPath string, newPath string) error
 	RemoveFunc          func(name string) error
+	RemoveAllFunc       func(path string) error
 	CreateFunc          func(name string) (FileLike, error)
+	CreateExclusiveFunc func(name string) (FileLike, error)
 	MkdirAllFunc        func(path string) error
 	CreateTempFunc      func(dir, pattern string) (FileLike, error)
-	DirSizeInBytesFunc  func(path string) (error, int64)
-	FindLargestFileFunc func(path string, exceptDir string) (error, int64, string)
-	FindLruFileFunc     func(path string, exceptDir string) (error, int64, string)
+	AppendFileFunc      func(name string, data []byte) error
+	WalkFunc            func(root string, walkFunc filepath.WalkFunc) error
 	ReadFileFunc        func(name string) ([]byte, error)
 	StatFunc            func(name string) (os.FileInfo, error)
 	ChtimesFunc         func(name string, atime time.Time, mtime time.Time) error
@@ -96,12 +98,13 @@ func NewDefaultMockFilesystem() *MockFilesystem {
 		GetSizeInBytesFunc:  func(path string) (int64, error) { return -1, nil },
 		RenameFunc:          func(oldPath string, newPath string) error { return nil },
 		RemoveFunc:          func(name string) error { return nil },
+		RemoveAllFunc:       func(path string) error { return nil },
 		CreateFunc:          func(name string) (FileLike, error) { return NewMockFile(name), nil },
+		CreateExclusiveFunc: func(name string) (FileLike, error) { return NewMockFile(name), nil },
 		MkdirAllFunc:        func(path string) error { return nil },
 		CreateTempFunc:      func(dir, pattern string) (FileLike, error) { return NewMockFile(pattern), nil },
-		DirSizeInBytesFunc:  func(path string) (error, int64) { return nil, -1 },
-		FindLargestFileFunc: func(path string, exceptDir string) (error, int64, string) { return nil, -1, "" },
-		FindLruFileFunc:     func(path string, exceptDir string) (error, int64, string) { return nil, -1, "" },
+		AppendFileFunc:      func(name string, data []byte) error { return nil },
+		WalkFunc:            func(root string, walkFunc filepath.WalkFunc) error { return nil },
 		ReadFileFunc:        func(name string) ([]byte, error) { return []byte{}, nil },
 		StatFunc:            func(name string) (os.FileInfo, error) { return NewMockFileInfo("__mock-file-info__"), nil },
 		ChtimesFunc:         func(name string, atime time.Time, mtime time.Time) error { return nil },
@@ -140,30 +143,34 @@ func (m *MockFilesystem) Remove(path string) error {
 	return m.RemoveFunc(path)
 }
 
+func (m *MockFilesystem) RemoveAll(path string) error {
+	RequireFilePathIsSanitized(path)
+
+	return m.RemoveAllFunc(path)
+}
+
 func (m *MockFilesystem) Create(path string) (FileLike, error) {
 	RequireFilePathIsSanitized(path)
 
 	return m.CreateFunc(path)
 }
 
-func (m *MockFilesystem) DirSizeInBytes(path string) (error, int64) {
+func (m *MockFilesystem) CreateExclusive(path string) (FileLike, error) {
 	RequireFilePathIsSanitized(path)
 
-	return m.DirSizeInBytesFunc(path)
+	return m.CreateExclusiveFunc(path)
 }
 
-func (m *MockFilesystem) FindLargestFile(path string, exceptDir string) (error, int64, string) {
-	RequireFilePathIsSanitized(path)
-	RequireFilePathIsSanitized(exceptDir)
+func (m *MockFilesystem) AppendFile(name string, data []byte) error {
+	RequireFilePathIsSanitized(name)
 
-	return m.FindLargestFileFunc(path, exceptDir)
+	return m.AppendFileFunc(name, data)
 }
 
-func (m *MockFilesystem) FindLruFile(path string, exceptDir string) (error, int64, string) {
-	RequireFilePathIsSanitized(path)
-	RequireFilePathIsSanitized(exceptDir)
+func (m *MockFilesystem) Walk(root string, walkFunc filepath.WalkFunc) error {
+	RequireFilePathIsSanitized(root)
 
-	return m.FindLruFileFunc(path, exceptDir)
+	return m.WalkFunc(root, walkFunc)
 }
 
 func (m *MockFilesystem) ReadFile(name string) ([]byte, error) {
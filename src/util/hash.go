@@ -2,6 +2,7 @@ package util
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -10,3 +11,9 @@ func Hash(data string) string {
 	hash.Write([]byte(data))
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// Sha256 returns the hex encoded SHA-256 hash of the given content.
+func Sha256(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,58 @@
+package wikipedia
+
+import (
+	"fmt"
+	"wiki2book/config"
+)
+
+// ArticleSource provides the wikitext of articles. The returned DTO looks the same, regardless of where the article
+// comes from.
+type ArticleSource interface {
+	GetArticle(title string) (*WikiArticleDto, error)
+	GetArticleRevision(title string, revision int) (*WikiArticleDto, error)
+	// GetRevisionAtDate returns the ID of the latest revision of the article at the end of the given date (format
+	// "2006-01-02").
+	GetRevisionAtDate(title string, date string) (int, error)
+	// ResolveRedirects returns a map from the given article titles to the titles of the articles they redirect to.
+	// Titles, which are no redirects, are not part of the map.
+	ResolveRedirects(titles []string) (map[string]string, error)
+}
+
+// NewArticleSource creates the article source selected in the current configuration.
+func NewArticleSource(wikipediaService WikipediaService) (ArticleSource, error) {
+	if config.Current.ArticleSource == config.ArticleSourceDump {
+		return NewDumpArticleSource(config.Current.ArticleDumpFile)
+	}
+
+	wikipediaArticleHost := fmt.Sprintf("%s.%s", config.Current.WikipediaInstance, config.Current.WikipediaHost)
+	return NewApiArticleSource(wikipediaService, wikipediaArticleHost), nil
+}
+
+// ApiArticleSource downloads the articles from the API of a Wikipedia instance.
+type ApiArticleSource struct {
+	wikipediaService WikipediaService
+	host             string
+}
+
+func NewApiArticleSource(wikipediaService WikipediaService, host string) *ApiArticleSource {
+	return &ApiArticleSource{
+		wikipediaService: wikipediaService,
+		host:             host,
+	}
+}
+
+func (s *ApiArticleSource) GetArticle(title string) (*WikiArticleDto, error) {
+	return s.wikipediaService.DownloadArticle(s.host, title)
+}
+
+func (s *ApiArticleSource) GetArticleRevision(title string, revision int) (*WikiArticleDto, error) {
+	return s.wikipediaService.DownloadArticleRevision(s.host, title, revision)
+}
+
+func (s *ApiArticleSource) GetRevisionAtDate(title string, date string) (int, error) {
+	return s.wikipediaService.GetRevisionAtDate(s.host, title, date)
+}
+
+func (s *ApiArticleSource) ResolveRedirects(titles []string) (map[string]string, error) {
+	return s.wikipediaService.ResolveRedirects(titles)
+}
@@ -0,0 +1,33 @@
+package wikipedia
+
+type MockArticleSource struct {
+	GetArticleFunc         func(title string) (*WikiArticleDto, error)
+	GetArticleRevisionFunc func(title string, revision int) (*WikiArticleDto, error)
+	GetRevisionAtDateFunc  func(title string, date string) (int, error)
+	ResolveRedirectsFunc   func(titles []string) (map[string]string, error)
+}
+
+func NewMockArticleSource() *MockArticleSource {
+	return &MockArticleSource{
+		GetArticleFunc:         func(title string) (*WikiArticleDto, error) { return nil, nil },
+		GetArticleRevisionFunc: func(title string, revision int) (*WikiArticleDto, error) { return nil, nil },
+		GetRevisionAtDateFunc:  func(title string, date string) (int, error) { return 0, nil },
+		ResolveRedirectsFunc:   func(titles []string) (map[string]string, error) { return map[string]string{}, nil },
+	}
+}
+
+func (m *MockArticleSource) GetArticle(title string) (*WikiArticleDto, error) {
+	return m.GetArticleFunc(title)
+}
+
+func (m *MockArticleSource) GetArticleRevision(title string, revision int) (*WikiArticleDto, error) {
+	return m.GetArticleRevisionFunc(title, revision)
+}
+
+func (m *MockArticleSource) GetRevisionAtDate(title string, date string) (int, error) {
+	return m.GetRevisionAtDateFunc(title, date)
+}
+
+func (m *MockArticleSource) ResolveRedirects(titles []string) (map[string]string, error) {
+	return m.ResolveRedirectsFunc(titles)
+}
@@ -0,0 +1,264 @@
+package wikipedia
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"wiki2book/cache"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+var (
+	metadataHtmlTagRegex    = regexp.MustCompile(`<[^>]*>`)
+	metadataWhitespaceRegex = regexp.MustCompile(`\s+`)
+)
+
+type WikiQueryContributorsDto struct {
+	Continue WikiContributorsContinueDto `json:"continue"`
+	Query    WikiContributorsPagesDto    `json:"query"`
+}
+
+type WikiContributorsContinueDto struct {
+	PcContinue string `json:"pccontinue"`
+}
+
+type WikiContributorsPagesDto struct {
+	Pages map[string]WikiContributorsPageDto `json:"pages"`
+}
+
+type WikiContributorsPageDto struct {
+	Title                 string               `json:"title"`
+	Contributors          []WikiContributorDto `json:"contributors"`
+	AnonymousContributors int                  `json:"anoncontributors"`
+}
+
+type WikiContributorDto struct {
+	Name string `json:"name"`
+}
+
+type WikiQuerySiteRightsDto struct {
+	Query WikiSiteRightsDto `json:"query"`
+}
+
+type WikiSiteRightsDto struct {
+	RightsInfo WikiRightsInfoDto `json:"rightsinfo"`
+}
+
+type WikiRightsInfoDto struct {
+	Url  string `json:"url"`
+	Text string `json:"text"`
+}
+
+type WikiQueryImageInfoDto struct {
+	Query WikiImageInfoPagesDto `json:"query"`
+}
+
+type WikiImageInfoPagesDto struct {
+	Pages map[string]WikiImageInfoPageDto `json:"pages"`
+}
+
+type WikiImageInfoPageDto struct {
+	Title     string             `json:"title"`
+	ImageInfo []WikiImageInfoDto `json:"imageinfo"`
+}
+
+type WikiImageInfoDto struct {
+	Url            string                             `json:"url"`
+	DescriptionUrl string                             `json:"descriptionurl"`
+	ExtMetadata    map[string]WikiExtMetadataValueDto `json:"extmetadata"`
+}
+
+type WikiExtMetadataValueDto struct {
+	// The value is usually a string, but some entries (e.g. "Categories") can be of other types.
+	Value any `json:"value"`
+}
+
+// ArticleContributors contains the registered contributors of an article and the number of anonymous ones.
+type ArticleContributors struct {
+	Names                 []string
+	AnonymousContributors int
+}
+
+// License of content, e.g. "Creative Commons Attribution-Share Alike 4.0" with a link to the license text.
+type License struct {
+	Name string
+	Url  string
+}
+
+// ImageMetadata contains the author, license and source of an image as shown on its file description page.
+type ImageMetadata struct {
+	// Title of the image including the "File:" prefix.
+	Title   string
+	Author  string
+	License License
+	// Source is the URL of the file description page.
+	Source string
+}
+
+// GetArticleContributors returns all contributors of the given article. Redirects are resolved.
+func (w *DefaultWikipediaService) GetArticleContributors(host string, title string) (*ArticleContributors, error) {
+	contributors := &ArticleContributors{}
+
+	continueToken := ""
+	for {
+		sigolo.Debugf("Get contributors of article %s (continue token: '%s')", title, continueToken)
+
+		urlString := fmt.Sprintf("https://%s/w/api.php?action=query&prop=contributors&pclimit=max&redirects=true&format=json&titles=%s", host, url.QueryEscape(title))
+		if continueToken != "" {
+			urlString += "&pccontinue=" + url.QueryEscape(continueToken)
+		}
+
+		cacheFile := "contributors-" + util.Hash(host+"|"+title+"|"+continueToken) + ".json"
+		cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cacheFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to get contributors of article %s", title)
+		}
+
+		cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read cached contributors file '%s'", cachedFilePath)
+		}
+
+		queryDto := &WikiQueryContributorsDto{}
+		err = json.Unmarshal(cachedResponseBytes, queryDto)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing JSON of contributors from file '%s'", cachedFilePath)
+		}
+
+		for _, page := range queryDto.Query.Pages {
+			for _, contributor := range page.Contributors {
+				contributors.Names = append(contributors.Names, contributor.Name)
+			}
+			// The number of anonymous contributors is part of every response.
+			contributors.AnonymousContributors = page.AnonymousContributors
+		}
+
+		continueToken = queryDto.Continue.PcContinue
+		if continueToken == "" {
+			break
+		}
+	}
+
+	return contributors, nil
+}
+
+// GetTextLicense returns the license of the texts of the given Wikipedia instance.
+func (w *DefaultWikipediaService) GetTextLicense(host string) (*License, error) {
+	urlString := fmt.Sprintf("https://%s/w/api.php?action=query&meta=siteinfo&siprop=rightsinfo&format=json", host)
+	cacheFile := "rightsinfo-" + util.Hash(host) + ".json"
+	cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cacheFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to get text license of %s", host)
+	}
+
+	cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read cached license file '%s'", cachedFilePath)
+	}
+
+	queryDto := &WikiQuerySiteRightsDto{}
+	err = json.Unmarshal(cachedResponseBytes, queryDto)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing JSON of license from file '%s'", cachedFilePath)
+	}
+
+	return &License{
+		Name: queryDto.Query.RightsInfo.Text,
+		Url:  queryDto.Query.RightsInfo.Url,
+	}, nil
+}
+
+// GetImageMetadata returns the author, license and source of the given image (e.g. "File:Foo.jpg"). The image article
+// hosts are used in the given order until one of them knows the image.
+func (w *DefaultWikipediaService) GetImageMetadata(image string) (*ImageMetadata, error) {
+	imagesMetadata, err := w.GetImagesMetadata([]string{image})
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, ok := imagesMetadata[image]
+	if !ok {
+		return nil, errors.Errorf("Unable to find metadata of image %s on any image article host", imageTitle(image))
+	}
+	return metadata, nil
+}
+
+// GetImagesMetadata works like GetImageMetadata but for multiple images. The metadata of images resolved before (e.g.
+// when downloading them) is reused, all other images are requested in batches. The keys of the returned map are the
+// given images, unknown images are not part of the map.
+func (w *DefaultWikipediaService) GetImagesMetadata(images []string) (map[string]*ImageMetadata, error) {
+	var unresolvedImages []string
+	for _, image := range uniqueImages(images) {
+		if w.getImageMetadata(image) == nil {
+			unresolvedImages = append(unresolvedImages, image)
+		}
+	}
+
+	if len(unresolvedImages) > 0 {
+		sigolo.Debugf("Get metadata of images %s", util.TruncString(strings.Join(unresolvedImages, "|")))
+		_, err := w.resolveImageUrls(unresolvedImages)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to get metadata of images %s", util.TruncString(strings.Join(unresolvedImages, "|")))
+		}
+	}
+
+	imagesMetadata := map[string]*ImageMetadata{}
+	for _, image := range images {
+		if metadata := w.getImageMetadata(image); metadata != nil {
+			imagesMetadata[image] = metadata
+		}
+	}
+	return imagesMetadata, nil
+}
+
+// newImageMetadata creates the metadata of the image with the given title from the image info of the MediaWiki API.
+func newImageMetadata(imageTitle string, imageInfo WikiImageInfoDto) *ImageMetadata {
+	return &ImageMetadata{
+		Title:  imageTitle,
+		Author: extMetadataText(imageInfo.ExtMetadata, "Artist"),
+		License: License{
+			Name: extMetadataText(imageInfo.ExtMetadata, "LicenseShortName"),
+			Url:  extMetadataText(imageInfo.ExtMetadata, "LicenseUrl"),
+		},
+		Source: imageInfo.DescriptionUrl,
+	}
+}
+
+// addImageMetadata keeps the given metadata for GetImageMetadata.
+func (w *DefaultWikipediaService) addImageMetadata(metadata *ImageMetadata) {
+	w.imageMetadataMutex.Lock()
+	defer w.imageMetadataMutex.Unlock()
+
+	if w.imageMetadata == nil {
+		w.imageMetadata = map[string]*ImageMetadata{}
+	}
+	w.imageMetadata[metadata.Title] = metadata
+}
+
+// getImageMetadata returns the kept metadata of the given image or nil, when the image hasn't been resolved yet.
+func (w *DefaultWikipediaService) getImageMetadata(image string) *ImageMetadata {
+	w.imageMetadataMutex.Lock()
+	defer w.imageMetadataMutex.Unlock()
+
+	return w.imageMetadata[imageTitle(image)]
+}
+
+// extMetadataText returns the plain text of the given metadata entry. Entries like the author often contain HTML
+// (e.g. links to user pages), which is removed.
+func extMetadataText(metadata map[string]WikiExtMetadataValueDto, key string) string {
+	value, ok := metadata[key].Value.(string)
+	if !ok {
+		return ""
+	}
+
+	value = metadataHtmlTagRegex.ReplaceAllString(value, "")
+	value = html.UnescapeString(value)
+	value = metadataWhitespaceRegex.ReplaceAllString(value, " ")
+	return strings.TrimSpace(value)
+}
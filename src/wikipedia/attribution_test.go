@@ -0,0 +1,176 @@
+package wikipedia
+
+import (
+	"path/filepath"
+	"testing"
+	"wiki2book/http"
+	"wiki2book/image"
+	"wiki2book/test"
+	"wiki2book/util"
+)
+
+func TestGetArticleContributors(t *testing.T) {
+	// Arrange
+	var requestedUrls []string
+	responses := map[string]string{
+		"https://en.wikipedia.org/w/api.php?action=query&prop=contributors&pclimit=max&redirects=true&format=json&titles=Earth":                     `{"continue":{"pccontinue":"9228|2","continue":"||"},"query":{"pages":{"9228":{"pageid":9228,"ns":0,"title":"Earth","anoncontributors":5,"contributors":[{"userid":1,"name":"Alice"},{"userid":2,"name":"Bob"}]}}}}`,
+		"https://en.wikipedia.org/w/api.php?action=query&prop=contributors&pclimit=max&redirects=true&format=json&titles=Earth&pccontinue=9228%7C2": `{"batchcomplete":"","query":{"pages":{"9228":{"pageid":9228,"ns":0,"title":"Earth","anoncontributors":5,"contributors":[{"userid":3,"name":"Carol"}]}}}}`,
+	}
+	filesToUrls := map[string]string{}
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(responses[filesToUrls[name]]), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrls = append(requestedUrls, url)
+			file := filepath.Join(test.TestCacheFolder, filename)
+			filesToUrls[file] = url
+			return file, true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	contributors, err := wikipediaService.GetArticleContributors("en.wikipedia.org", "Earth")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 2, len(requestedUrls))
+	test.AssertEqual(t, []string{"Alice", "Bob", "Carol"}, contributors.Names)
+	test.AssertEqual(t, 5, contributors.AnonymousContributors)
+}
+
+func TestGetTextLicense(t *testing.T) {
+	// Arrange
+	requestedUrl := ""
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"batchcomplete":"","query":{"rightsinfo":{"url":"https://creativecommons.org/licenses/by-sa/4.0/","text":"Creative Commons Attribution-Share Alike 4.0"}}}`), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrl = url
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	license, err := wikipediaService.GetTextLicense("en.wikipedia.org")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "https://en.wikipedia.org/w/api.php?action=query&meta=siteinfo&siprop=rightsinfo&format=json", requestedUrl)
+	test.AssertEqual(t, &License{Name: "Creative Commons Attribution-Share Alike 4.0", Url: "https://creativecommons.org/licenses/by-sa/4.0/"}, license)
+}
+
+func TestGetImageMetadata(t *testing.T) {
+	// Arrange
+	var requestedUrls []string
+	responses := map[string]string{
+		"https://commons.wikimedia.org/w/api.php?action=query&prop=imageinfo&iiprop=url%7Cextmetadata&redirects=true&format=json&titles=File%3AFoo+bar.jpg": `{"batchcomplete":"","query":{"pages":{"-1":{"ns":6,"title":"File:Foo bar.jpg","missing":"","imagerepository":""}}}}`,
+		"https://en.wikipedia.org/w/api.php?action=query&prop=imageinfo&iiprop=url%7Cextmetadata&redirects=true&format=json&titles=File%3AFoo+bar.jpg":      `{"batchcomplete":"","query":{"pages":{"123":{"ns":6,"title":"File:Foo bar.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/foo.jpg","descriptionurl":"https://en.wikipedia.org/wiki/File:Foo_bar.jpg","extmetadata":{"Artist":{"value":"<a href=\"//commons.wikimedia.org/wiki/User:Alice\">Alice &amp; Bob</a>\n","source":"commons-desc-page"},"LicenseShortName":{"value":"CC BY-SA 4.0","source":"commons-desc-page"},"LicenseUrl":{"value":"https://creativecommons.org/licenses/by-sa/4.0","source":"commons-desc-page"},"Categories":{"value":["A","B"]}}}]}}}}`,
+	}
+	filesToUrls := map[string]string{}
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(responses[filesToUrls[name]]), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrls = append(requestedUrls, url)
+			file := filepath.Join(test.TestCacheFolder, filename)
+			filesToUrls[file] = url
+			return file, true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{"commons.wikimedia.org", "en.wikipedia.org"}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	metadata, err := wikipediaService.GetImageMetadata("Datei:Foo bar.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 2, len(requestedUrls))
+	test.AssertEqual(t, &ImageMetadata{
+		Title:  "File:Foo bar.jpg",
+		Author: "Alice & Bob",
+		License: License{
+			Name: "CC BY-SA 4.0",
+			Url:  "https://creativecommons.org/licenses/by-sa/4.0",
+		},
+		Source: "https://en.wikipedia.org/wiki/File:Foo_bar.jpg",
+	}, metadata)
+}
+
+func TestGetImageMetadata_unknownImage(t *testing.T) {
+	// Arrange
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"batchcomplete":"","query":{"pages":{"-1":{"ns":6,"title":"File:Foo.jpg","missing":"","imagerepository":""}}}}`), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{"commons.wikimedia.org", "en.wikipedia.org"}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	metadata, err := wikipediaService.GetImageMetadata("File:Foo.jpg")
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertNil(t, metadata)
+}
+
+func TestGetImageMetadata_reusesMetadataOfResolvedImages(t *testing.T) {
+	// Arrange
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"batchcomplete":"","query":{"pages":{"123":{"ns":6,"title":"File:Foo.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/foo.jpg","descriptionurl":"https://commons.wikimedia.org/wiki/File:Foo.jpg","extmetadata":{"Artist":{"value":"Alice"},"LicenseShortName":{"value":"CC0"}}}]}}}}`), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	numberOfRequests := 0
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			numberOfRequests++
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{"commons.wikimedia.org"}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+	imageUrls, err := wikipediaService.resolveImageUrls([]string{"File:Foo.jpg"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "https://upload.wikimedia.org/foo.jpg", imageUrls["File:Foo.jpg"])
+
+	// Act
+	metadata, err := wikipediaService.GetImageMetadata("File:Foo.jpg")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 1, numberOfRequests)
+	test.AssertEqual(t, &ImageMetadata{
+		Title:   "File:Foo.jpg",
+		Author:  "Alice",
+		License: License{Name: "CC0"},
+		Source:  "https://commons.wikimedia.org/wiki/File:Foo.jpg",
+	}, metadata)
+}
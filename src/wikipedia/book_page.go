@@ -0,0 +1,113 @@
+package wikipedia
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"wiki2book/config"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	bookPageCommentRegex        = regexp.MustCompile(`(?s)<!--.*?-->`)
+	bookPageTitleRegex          = regexp.MustCompile(`^==\s*([^=].*?)\s*==$`)
+	bookPageChapterRegex        = regexp.MustCompile(`^;\s*(.*?)\s*$`)
+	bookPageArticleRegex        = regexp.MustCompile(`^:+\s*\[\[\s*([^|\]]+?)\s*(\|[^\]]*)?]]`)
+	bookPagePinnedRevisionRegex = regexp.MustCompile(`^:+\s*\[\{\{\s*fullurl:\s*([^|}]+?)\s*\|([^}]*)}}[^\]]*]`)
+	bookPageOldIdRegex          = regexp.MustCompile(`(?:^|&)\s*oldid\s*=\s*(\d+)`)
+	bookPageNamespaceRegex      = regexp.MustCompile(`^[^:]+:(.*/)?`)
+)
+
+// GetBookPageProject downloads the given book page (e.g. "Book:Planets" or "Wikipedia:Books/Planets") and turns it
+// into a project. See ParseBookPage for details.
+func GetBookPageProject(articleSource ArticleSource, title string) (*config.Project, error) {
+	bookPage, err := articleSource.GetArticle(title)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to get book page '%s'", title)
+	}
+	if bookPage.Parse.Title == "" {
+		return nil, errors.Errorf("Book page '%s' not found", title)
+	}
+
+	project := ParseBookPage(bookPage.Parse.Title, bookPage.Parse.Wikitext.Content)
+	if len(project.AllArticles()) == 0 {
+		return nil, errors.Errorf("Book page '%s' does not contain any articles", title)
+	}
+
+	return project, nil
+}
+
+// ParseBookPage turns the wikitext of a community-maintained book page into a project. Such pages have the following
+// structure, where chapters are optional and articles before the first chapter are not part of any chapter:
+//
+//	== Title ==
+//	=== Subtitle ===
+//	;Chapter
+//	:[[Article]]
+//	:[[Other article|Label]]
+//
+// When there's no title heading, the page title without namespace (e.g. "Planets" for "Book:Planets") is used.
+func ParseBookPage(pageTitle string, wikitext string) *config.Project {
+	project := &config.Project{}
+
+	wikitext = bookPageCommentRegex.ReplaceAllString(wikitext, "")
+	var currentChapter *config.Chapter
+	for _, line := range strings.Split(wikitext, "\n") {
+		line = strings.TrimSpace(line)
+
+		if match := bookPageTitleRegex.FindStringSubmatch(line); match != nil {
+			if project.Metadata.Title == "" {
+				project.Metadata.Title = match[1]
+			}
+		} else if match = bookPageChapterRegex.FindStringSubmatch(line); match != nil {
+			project.Chapters = append(project.Chapters, config.Chapter{Title: match[1]})
+			currentChapter = &project.Chapters[len(project.Chapters)-1]
+		} else if article := bookPageArticle(line); article != nil {
+			if currentChapter == nil {
+				project.Articles = append(project.Articles, *article)
+			} else {
+				currentChapter.Articles = append(currentChapter.Articles, *article)
+			}
+		}
+	}
+
+	// Chapters without articles would result in empty chapters in the book.
+	var chapters []config.Chapter
+	for _, chapter := range project.Chapters {
+		if len(chapter.Articles) > 0 {
+			chapters = append(chapters, chapter)
+		}
+	}
+	project.Chapters = chapters
+
+	if project.Metadata.Title == "" {
+		project.Metadata.Title = bookPageNamespaceRegex.ReplaceAllString(pageTitle, "")
+	}
+
+	return project
+}
+
+// bookPageArticle returns the article of an article line (e.g. ":[[Foo|bar]]") or nil if the line is not such a line.
+// Lines with a link to a specific revision (e.g. ":[{{fullurl:Foo|oldid=123}} Foo]") result in an article with this
+// revision.
+func bookPageArticle(line string) *config.Article {
+	if match := bookPageArticleRegex.FindStringSubmatch(line); match != nil {
+		return &config.Article{Title: strings.ReplaceAll(match[1], "_", " ")}
+	}
+
+	match := bookPagePinnedRevisionRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+
+	article := &config.Article{Title: strings.ReplaceAll(match[1], "_", " ")}
+	if oldIdMatch := bookPageOldIdRegex.FindStringSubmatch(match[2]); oldIdMatch != nil {
+		// The regex only matches digits, so the only possible error is an overflow, which is no valid revision anyway.
+		revision, err := strconv.Atoi(oldIdMatch[1])
+		if err == nil {
+			article.Revision = revision
+		}
+	}
+	return article
+}
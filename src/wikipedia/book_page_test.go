@@ -0,0 +1,94 @@
+package wikipedia
+
+import (
+	"testing"
+	"wiki2book/config"
+	"wiki2book/test"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseBookPage(t *testing.T) {
+	// Arrange
+	wikitext := `{{saved book
+ |title=Planets
+ |cover-color=#000000
+}}
+<!-- Some comment -->
+== The planets ==
+=== Our solar system ===
+:[[Solar System]]
+;Inner planets
+:[[Mercury (planet)|Mercury]]
+:[[Venus]]
+<!--:[[Earth]]-->
+;Empty chapter
+;Outer planets
+:[[Jupiter]]
+:[{{fullurl:Saturn|oldid=123456}} Saturn]
+:[[Neptune_(planet)]]
+
+[[Category:Books about planets]]`
+
+	// Act
+	project := ParseBookPage("Book:Planets", wikitext)
+
+	// Assert
+	test.AssertEqual(t, "The planets", project.Metadata.Title)
+	test.AssertEqual(t, config.NewArticles("Solar System"), project.Articles)
+	test.AssertEqual(t, []config.Chapter{
+		{Title: "Inner planets", Articles: config.NewArticles("Mercury (planet)", "Venus")},
+		{Title: "Outer planets", Articles: []config.Article{{Title: "Jupiter"}, {Title: "Saturn", Revision: 123456}, {Title: "Neptune (planet)"}}},
+	}, project.Chapters)
+}
+
+func TestParseBookPage_pinnedRevision(t *testing.T) {
+	// Arrange
+	wikitext := `:[{{fullurl:Mercury_(planet)|oldid=123456}} Mercury]
+:[{{fullurl:Venus|action=view&oldid=654321}} Venus]
+:[{{fullurl:Earth|action=view}} Earth]`
+
+	// Act
+	project := ParseBookPage("Book:Planets", wikitext)
+
+	// Assert
+	test.AssertEqual(t, []config.Article{
+		{Title: "Mercury (planet)", Revision: 123456},
+		{Title: "Venus", Revision: 654321},
+		{Title: "Earth"},
+	}, project.Articles)
+}
+
+func TestParseBookPage_titleFromPageTitle(t *testing.T) {
+	test.AssertEqual(t, "Planets", ParseBookPage("Book:Planets", ":[[Venus]]").Metadata.Title)
+	test.AssertEqual(t, "Planets", ParseBookPage("Wikipedia:Books/Planets", ":[[Venus]]").Metadata.Title)
+}
+
+func TestGetBookPageProject(t *testing.T) {
+	// Arrange
+	articleSource := NewMockArticleSource()
+	articleSource.GetArticleFunc = func(title string) (*WikiArticleDto, error) {
+		switch title {
+		case "Book:Planets":
+			return &WikiArticleDto{Parse: WikiParseArticleDto{Title: title, Wikitext: WikiWildcardTextDto{Content: ";Planets\n:[[Venus]]"}}}, nil
+		case "Book:Empty":
+			return &WikiArticleDto{Parse: WikiParseArticleDto{Title: title, Wikitext: WikiWildcardTextDto{Content: "== Empty =="}}}, nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	// Act
+	project, err := GetBookPageProject(articleSource, "Book:Planets")
+	emptyProject, emptyErr := GetBookPageProject(articleSource, "Book:Empty")
+	missingProject, missingErr := GetBookPageProject(articleSource, "Book:Missing")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []string{"Venus"}, project.AllArticles())
+
+	test.AssertNotNil(t, emptyErr)
+	test.AssertNil(t, emptyProject)
+
+	test.AssertNotNil(t, missingErr)
+	test.AssertNil(t, missingProject)
+}
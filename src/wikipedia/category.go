@@ -0,0 +1,122 @@
+package wikipedia
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"wiki2book/config"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+// ArticlesOfCategories returns the titles of all articles within the given categories and their subcategories (up to
+// the depth of each category) matching the include and exclude filters. The articles of each category are sorted
+// alphabetically and appear in the order of the given categories. Articles are only contained once in the result.
+func ArticlesOfCategories(wikipediaService WikipediaService, categories []config.CategorySource) ([]string, error) {
+	var articles []string
+
+	for _, category := range categories {
+		categoryArticles, err := articlesOfCategory(wikipediaService, category)
+		if err != nil {
+			return nil, err
+		}
+
+		sigolo.Debugf("Found %d articles in category '%s' with depth %d", len(categoryArticles), category.Name, category.Depth)
+		articles = append(articles, categoryArticles...)
+	}
+
+	return util.RemoveDuplicates(articles), nil
+}
+
+func articlesOfCategory(wikipediaService WikipediaService, category config.CategorySource) ([]string, error) {
+	includeRegexes, err := compileRegexes(category.Include)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid include expression of category '%s'", category.Name)
+	}
+	excludeRegexes, err := compileRegexes(category.Exclude)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid exclude expression of category '%s'", category.Name)
+	}
+
+	var articles []string
+
+	// Breadth-first search through the category tree. Categories might contain each other, which is why visited
+	// categories are remembered.
+	visitedCategories := map[string]bool{}
+	currentCategories := []string{categoryTitle(category.Name)}
+	for depth := 0; depth <= category.Depth && len(currentCategories) > 0; depth++ {
+		var nextCategories []string
+
+		for _, currentCategory := range currentCategories {
+			if visitedCategories[currentCategory] {
+				continue
+			}
+			visitedCategories[currentCategory] = true
+
+			categoryArticles, subcategories, err := wikipediaService.GetCategoryMembers(currentCategory)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, article := range categoryArticles {
+				if titleMatchesFilters(article, includeRegexes, excludeRegexes) {
+					articles = append(articles, article)
+				}
+			}
+			nextCategories = append(nextCategories, subcategories...)
+		}
+
+		currentCategories = nextCategories
+	}
+
+	articles = util.RemoveDuplicates(articles)
+	sort.Strings(articles)
+
+	return articles, nil
+}
+
+// categoryTitle adds the category prefix to the given name unless it already has one of the configured category
+// prefixes.
+func categoryTitle(name string) string {
+	name = strings.TrimSpace(strings.ReplaceAll(name, "_", " "))
+	prefix, _, hasPrefix := strings.Cut(name, ":")
+	if hasPrefix && util.Contains(config.Current.CategoryPrefixes, strings.ToLower(prefix)) {
+		return name
+	}
+	return "Category:" + name
+}
+
+func titleMatchesFilters(title string, includeRegexes []*regexp.Regexp, excludeRegexes []*regexp.Regexp) bool {
+	isIncluded := len(includeRegexes) == 0
+	for _, includeRegex := range includeRegexes {
+		if includeRegex.MatchString(title) {
+			isIncluded = true
+			break
+		}
+	}
+	if !isIncluded {
+		return false
+	}
+
+	for _, excludeRegex := range excludeRegexes {
+		if excludeRegex.MatchString(title) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compileRegexes(expressions []string) ([]*regexp.Regexp, error) {
+	var regexes []*regexp.Regexp
+	for _, expression := range expressions {
+		regex, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to compile regular expression '%s'", expression)
+		}
+		regexes = append(regexes, regex)
+	}
+	return regexes, nil
+}
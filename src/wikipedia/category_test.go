@@ -0,0 +1,62 @@
+package wikipedia
+
+import (
+	"testing"
+	"wiki2book/config"
+	"wiki2book/test"
+)
+
+func TestArticlesOfCategories(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+
+	var requestedCategories []string
+	members := map[string][][]string{
+		"Category:Planet":            {{"Venus", "Earth", "Mars"}, {"Category:Dwarf planet", "Category:Planet"}},
+		"Category:Dwarf planet":      {{"Pluto", "Ceres", "Earth"}, {"Category:Plutoid"}},
+		"Category:Plutoid":           {{"Eris"}, {}},
+		"category:Planetary systems": {{"Solar System", "Mars"}, {}},
+	}
+
+	wikipediaService := NewMockWikipediaService()
+	wikipediaService.GetCategoryMembersFunc = func(category string) ([]string, []string, error) {
+		requestedCategories = append(requestedCategories, category)
+		return members[category][0], members[category][1], nil
+	}
+
+	categories := []config.CategorySource{
+		{Name: "Planet", Depth: 1, Exclude: []string{"^Ear"}},
+		{Name: "category:Planetary_systems", Include: []string{"System$", "^Mars$"}},
+	}
+
+	// Act
+	articles, err := ArticlesOfCategories(wikipediaService, categories)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, []string{"Category:Planet", "Category:Dwarf planet", "category:Planetary systems"}, requestedCategories)
+	test.AssertEqual(t, []string{"Ceres", "Mars", "Pluto", "Venus", "Solar System"}, articles)
+}
+
+func TestArticlesOfCategories_invalidExpression(t *testing.T) {
+	// Arrange
+	config.Current = config.NewDefaultConfig()
+	categories := []config.CategorySource{{Name: "Planet", Include: []string{"("}}}
+
+	// Act
+	articles, err := ArticlesOfCategories(NewMockWikipediaService(), categories)
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertNil(t, articles)
+}
+
+func TestCategoryTitle(t *testing.T) {
+	config.Current = config.NewDefaultConfig()
+	config.Current.CategoryPrefixes = []string{"category", "kategorie"}
+
+	test.AssertEqual(t, "Category:Planet", categoryTitle("Planet"))
+	test.AssertEqual(t, "Category:Dwarf planet", categoryTitle(" Dwarf_planet "))
+	test.AssertEqual(t, "Kategorie:Planet", categoryTitle("Kategorie:Planet"))
+	test.AssertEqual(t, "Category:Star Wars: Episode I", categoryTitle("Star Wars: Episode I"))
+}
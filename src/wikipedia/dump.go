@@ -0,0 +1,468 @@
+package wikipedia
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"wiki2book/cache"
+	"wiki2book/util"
+
+	"github.com/hauke96/sigolo/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	dumpIndexHeader = "wiki2book-dump-index-v1"
+	// Maximum number of redirects followed when looking up an article. MediaWiki itself doesn't follow double redirects
+	// but some care is needed to not end up in a loop of broken redirects.
+	maxDumpRedirectHops = 5
+	dumpScanBufferSize  = 1024 * 1024
+)
+
+var (
+	// A bzip2 stream starts with "BZh" and the block size ("1" to "9"), which is directly followed by the magic number
+	// of the first block. Multistream dumps consist of many such streams with about 100 pages each.
+	bzip2StreamHeaderLength = 4
+	bzip2BlockMagic         = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+)
+
+type dumpPageDto struct {
+	Title      string          `xml:"title"`
+	Redirect   dumpRedirectDto `xml:"redirect"`
+	RevisionId int             `xml:"revision>id"`
+	Text       string          `xml:"revision>text"`
+}
+
+// dumpPageIndexDto only contains the parts of a page needed for the index, so that the decoder skips the text.
+type dumpPageIndexDto struct {
+	Title    string          `xml:"title"`
+	Redirect dumpRedirectDto `xml:"redirect"`
+}
+
+type dumpRedirectDto struct {
+	Title string `xml:"title,attr"`
+}
+
+// dumpIndexEntry is the location of a page within the dump. The stream offset is the position of the bzip2 stream
+// within the compressed dump file, which contains the beginning of the page.
+type dumpIndexEntry struct {
+	streamOffset int64
+	redirect     string
+}
+
+// DumpArticleSource reads articles from a bzip2 compressed multistream MediaWiki XML dump (e.g.
+// "pages-articles-multistream.xml.bz2"). An index
+// of all pages is created once per dump file and stored in the cache, so that subsequent runs can directly jump to the
+// right location within the dump.
+type DumpArticleSource struct {
+	dumpFile string
+	index    map[string]dumpIndexEntry
+}
+
+func NewDumpArticleSource(dumpFile string) (*DumpArticleSource, error) {
+	index, err := loadOrCreateDumpIndex(dumpFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DumpArticleSource{
+		dumpFile: dumpFile,
+		index:    index,
+	}, nil
+}
+
+// GetArticle reads the article with the given title from the dump. Redirects are resolved, the title of the actual
+// article is therefore the title of the redirect target, just as it's the case for articles from the API.
+func (s *DumpArticleSource) GetArticle(title string) (*WikiArticleDto, error) {
+	resolvedTitle, entry, err := s.resolveRedirect(title)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.readPage(resolvedTitle, entry.streamOffset)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read article '%s' from dump '%s'", resolvedTitle, s.dumpFile)
+	}
+
+	return &WikiArticleDto{
+		Parse: WikiParseArticleDto{
+			Title:         page.Title,
+			RevisionId:    page.RevisionId,
+			Wikitext:      WikiWildcardTextDto{Content: page.Text},
+			OriginalTitle: title,
+		},
+	}, nil
+}
+
+// GetArticleRevision returns the article, if the dump contains the requested revision. A dump only contains one
+// revision of each article, so older or newer revisions are not available.
+func (s *DumpArticleSource) GetArticleRevision(title string, revision int) (*WikiArticleDto, error) {
+	article, err := s.GetArticle(title)
+	if err != nil {
+		return nil, err
+	}
+	if article.Parse.RevisionId != revision {
+		return nil, errors.Errorf("Revision %d of article '%s' not available in dump '%s', which contains revision %d", revision, title, s.dumpFile, article.Parse.RevisionId)
+	}
+	return article, nil
+}
+
+func (s *DumpArticleSource) GetRevisionAtDate(title string, date string) (int, error) {
+	return 0, errors.Errorf("Unable to determine revision of article '%s' at %s: Revisions at a date are not supported for dumps", title, date)
+}
+
+// ResolveRedirects looks up the redirect targets of the given titles in the index of the dump. Titles unknown to the
+// dump are not part of the returned map, just as titles that are no redirects.
+func (s *DumpArticleSource) ResolveRedirects(titles []string) (map[string]string, error) {
+	redirects := map[string]string{}
+	for _, title := range util.RemoveDuplicates(titles) {
+		resolvedTitle, _, err := s.resolveRedirect(title)
+		if err != nil {
+			// Links to broken redirects are just no redirects, which shouldn't prevent the book from being created.
+			sigolo.Debugf("Unable to resolve redirect of '%s': %s", title, err.Error())
+			continue
+		}
+		if resolvedTitle != normalizeTitle(title) {
+			redirects[title] = resolvedTitle
+		}
+	}
+	return redirects, nil
+}
+
+// resolveRedirect follows the redirects of the given title within the dump. The normalized title of the actual article
+// and its index entry are returned.
+func (s *DumpArticleSource) resolveRedirect(title string) (string, dumpIndexEntry, error) {
+	resolvedTitle := normalizeTitle(title)
+	entry, found := s.index[resolvedTitle]
+	for i := 0; found && entry.redirect != ""; i++ {
+		if i == maxDumpRedirectHops {
+			return "", dumpIndexEntry{}, errors.Errorf("Too many redirects when resolving article '%s' in dump '%s'", title, s.dumpFile)
+		}
+		sigolo.Tracef("Article '%s' in dump redirects to '%s'", resolvedTitle, entry.redirect)
+		resolvedTitle = normalizeTitle(entry.redirect)
+		entry, found = s.index[resolvedTitle]
+	}
+	if !found {
+		return "", dumpIndexEntry{}, errors.Errorf("Article '%s' not found in dump '%s'", resolvedTitle, s.dumpFile)
+	}
+	return resolvedTitle, entry, nil
+}
+
+// readPage decompresses the dump starting at the given stream until the page with the given title is found.
+func (s *DumpArticleSource) readPage(title string, streamOffset int64) (*dumpPageDto, error) {
+	file, err := os.Open(s.dumpFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open dump file '%s'", s.dumpFile)
+	}
+	defer file.Close()
+
+	_, err = file.Seek(streamOffset, io.SeekStart)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to go to offset %d in dump file '%s'", streamOffset, s.dumpFile)
+	}
+
+	// The bzip2 reader continues with the next stream when one ends, so a page spanning multiple streams is no problem.
+	decoder := xml.NewDecoder(bzip2.NewReader(bufio.NewReader(file)))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.Errorf("Reached end of dump without finding page '%s'", title)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse dump")
+		}
+
+		startElement, isStartElement := token.(xml.StartElement)
+		if !isStartElement || startElement.Name.Local != "page" {
+			continue
+		}
+
+		page := &dumpPageDto{}
+		err = decoder.DecodeElement(page, &startElement)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse page from dump")
+		}
+		if normalizeTitle(page.Title) == title {
+			return page, nil
+		}
+	}
+}
+
+// loadOrCreateDumpIndex loads the index of the given dump from the cache. The index is created when it doesn't exist
+// yet. The name of the index file depends on the path, size and modification time of the dump, so that a new dump
+// gets a new index.
+func loadOrCreateDumpIndex(dumpFile string) (map[string]dumpIndexEntry, error) {
+	indexFileName, err := dumpIndexFileName(dumpFile)
+	if err != nil {
+		return nil, err
+	}
+
+	indexFilePath, indexExists, err := cache.GetFile(cache.DumpIndexCacheDirName, indexFileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to determine if index of dump file '%s' exists", dumpFile)
+	}
+
+	if indexExists {
+		sigolo.Debugf("Use existing index '%s' of dump file '%s'", indexFilePath, dumpFile)
+		indexContent, err := util.CurrentFilesystem.ReadFile(indexFilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read index file '%s' of dump file '%s'", indexFilePath, dumpFile)
+		}
+		return parseDumpIndex(string(indexContent))
+	}
+
+	sigolo.Infof("Create index of dump file '%s'. This may take a while but is only done once.", dumpFile)
+	index, err := createDumpIndex(dumpFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to create index of dump file '%s'", dumpFile)
+	}
+	sigolo.Infof("Created index with %d pages of dump file '%s'", len(index), dumpFile)
+
+	_, err = cache.CacheToFile(cache.DumpIndexCacheDirName, indexFileName, strings.NewReader(serializeDumpIndex(index)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to cache index of dump file '%s'", dumpFile)
+	}
+
+	return index, nil
+}
+
+func dumpIndexFileName(dumpFile string) (string, error) {
+	dumpFileStat, err := os.Stat(dumpFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to get file stats of dump file '%s'", dumpFile)
+	}
+	return util.Hash(fmt.Sprintf("%s|%d|%d", dumpFile, dumpFileStat.Size(), dumpFileStat.ModTime().UnixNano())) + ".tsv", nil
+}
+
+// createDumpIndex decompresses the whole dump once and determines for each page the bzip2 stream it starts in. Only
+// multistream dumps are supported, since reading a page from a single stream dump would mean decompressing everything
+// in front of it.
+func createDumpIndex(dumpFile string) (map[string]dumpIndexEntry, error) {
+	streamOffsets, err := findBzip2StreamOffsets(dumpFile)
+	if err != nil {
+		return nil, err
+	}
+	sigolo.Debugf("Found %d bzip2 streams in dump file '%s'", len(streamOffsets), dumpFile)
+	if len(streamOffsets) == 1 {
+		return nil, errors.Errorf("Dump file '%s' consists of only one bzip2 stream. Only multistream dumps (e.g. \"dewiki-latest-pages-articles-multistream.xml.bz2\") are supported.", dumpFile)
+	}
+
+	file, err := os.Open(dumpFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open dump file '%s'", dumpFile)
+	}
+	defer file.Close()
+
+	fileStat, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to get file stats of dump file '%s'", dumpFile)
+	}
+
+	streamReader := &dumpStreamReader{
+		file:          file,
+		fileSize:      fileStat.Size(),
+		streamOffsets: streamOffsets,
+	}
+	decoder := xml.NewDecoder(streamReader)
+
+	index := map[string]dumpIndexEntry{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse dump")
+		}
+
+		startElement, isStartElement := token.(xml.StartElement)
+		if !isStartElement || startElement.Name.Local != "page" {
+			continue
+		}
+
+		// The offset is right behind the start tag, the tag itself is therefore within the stream of the last byte.
+		streamOffset := streamReader.streamOffsetOf(decoder.InputOffset() - 1)
+
+		page := &dumpPageIndexDto{}
+		err = decoder.DecodeElement(page, &startElement)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse page from dump")
+		}
+
+		index[normalizeTitle(page.Title)] = dumpIndexEntry{
+			streamOffset: streamOffset,
+			redirect:     stripSectionFromTitle(page.Redirect.Title),
+		}
+	}
+
+	return index, nil
+}
+
+// findBzip2StreamOffsets returns the offsets of all bzip2 streams within the given file. Normal dumps consist of only
+// one stream, multistream dumps of many.
+func findBzip2StreamOffsets(dumpFile string) ([]int64, error) {
+	file, err := os.Open(dumpFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to open dump file '%s'", dumpFile)
+	}
+	defer file.Close()
+
+	signatureLength := bzip2StreamHeaderLength + len(bzip2BlockMagic)
+	var streamOffsets []int64
+	var bufferOffset int64
+	buffer := make([]byte, 0, dumpScanBufferSize+signatureLength)
+	chunk := make([]byte, dumpScanBufferSize)
+	for {
+		n, readErr := io.ReadFull(file, chunk)
+		buffer = append(buffer, chunk[:n]...)
+
+		for i := 0; i+signatureLength <= len(buffer); i++ {
+			if buffer[i] == 'B' && bytes.HasPrefix(buffer[i:], []byte("BZh")) && buffer[i+3] >= '1' && buffer[i+3] <= '9' && bytes.Equal(buffer[i+bzip2StreamHeaderLength:i+signatureLength], bzip2BlockMagic) {
+				streamOffsets = append(streamOffsets, bufferOffset+int64(i))
+			}
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, errors.Wrapf(readErr, "Unable to read dump file '%s'", dumpFile)
+		}
+
+		// Keep the end of the buffer, since a signature might span two chunks.
+		keep := min(len(buffer), signatureLength-1)
+		bufferOffset += int64(len(buffer) - keep)
+		buffer = append(buffer[:0], buffer[len(buffer)-keep:]...)
+	}
+
+	if len(streamOffsets) == 0 {
+		return nil, errors.Errorf("File '%s' is not a bzip2 compressed file", dumpFile)
+	}
+
+	return streamOffsets, nil
+}
+
+// dumpStreamReader reads the decompressed content of all bzip2 streams one after another. It remembers at which
+// position of the decompressed content each stream starts.
+type dumpStreamReader struct {
+	file          *os.File
+	fileSize      int64
+	streamOffsets []int64
+
+	currentStream       int
+	currentReader       io.Reader
+	decompressedOffsets []int64
+	decompressedBytes   int64
+}
+
+func (r *dumpStreamReader) Read(p []byte) (int, error) {
+	for {
+		if r.currentReader == nil {
+			if r.currentStream >= len(r.streamOffsets) {
+				return 0, io.EOF
+			}
+
+			streamStart := r.streamOffsets[r.currentStream]
+			streamEnd := r.fileSize
+			if r.currentStream+1 < len(r.streamOffsets) {
+				streamEnd = r.streamOffsets[r.currentStream+1]
+			}
+			r.currentReader = bzip2.NewReader(bufio.NewReader(io.NewSectionReader(r.file, streamStart, streamEnd-streamStart)))
+			r.decompressedOffsets = append(r.decompressedOffsets, r.decompressedBytes)
+		}
+
+		n, err := r.currentReader.Read(p)
+		r.decompressedBytes += int64(n)
+		if err == io.EOF {
+			r.currentReader = nil
+			r.currentStream++
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+// streamOffsetOf returns the offset of the compressed stream containing the given position of the decompressed
+// content. The position must already have been read.
+func (r *dumpStreamReader) streamOffsetOf(decompressedPosition int64) int64 {
+	streamIndex := sort.Search(len(r.decompressedOffsets), func(i int) bool {
+		return r.decompressedOffsets[i] > decompressedPosition
+	}) - 1
+	return r.streamOffsets[max(streamIndex, 0)]
+}
+
+// serializeDumpIndex turns the index into lines of tab separated title, stream offset and redirect target. Titles never
+// contain tabs or line breaks.
+func serializeDumpIndex(index map[string]dumpIndexEntry) string {
+	titles := make([]string, 0, len(index))
+	for title := range index {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	builder := strings.Builder{}
+	builder.WriteString(dumpIndexHeader + "\n")
+	for _, title := range titles {
+		entry := index[title]
+		builder.WriteString(fmt.Sprintf("%s\t%d\t%s\n", title, entry.streamOffset, entry.redirect))
+	}
+	return builder.String()
+}
+
+func parseDumpIndex(content string) (map[string]dumpIndexEntry, error) {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if lines[0] != dumpIndexHeader {
+		return nil, errors.Errorf("Unsupported dump index format '%s'", lines[0])
+	}
+
+	index := make(map[string]dumpIndexEntry, len(lines)-1)
+	for i, line := range lines[1:] {
+		columns := strings.Split(line, "\t")
+		if len(columns) != 3 {
+			return nil, errors.Errorf("Invalid line %d in dump index: Expected 3 columns but found %d", i+2, len(columns))
+		}
+
+		streamOffset, err := strconv.ParseInt(columns[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid stream offset in line %d of dump index", i+2)
+		}
+
+		index[columns[0]] = dumpIndexEntry{
+			streamOffset: streamOffset,
+			redirect:     columns[2],
+		}
+	}
+
+	return index, nil
+}
+
+// normalizeTitle turns the title into the form used in dumps: Underscores are spaces, no surrounding or repeated
+// whitespace and the first character is upper case.
+func normalizeTitle(title string) string {
+	title = strings.ReplaceAll(title, "_", " ")
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return title
+	}
+
+	firstRune, size := utf8.DecodeRuneInString(title)
+	return string(unicode.ToUpper(firstRune)) + title[size:]
+}
+
+// stripSectionFromTitle removes the section of redirects to a section like "Foo#Bar".
+func stripSectionFromTitle(title string) string {
+	title, _, _ = strings.Cut(title, "#")
+	return title
+}
@@ -0,0 +1,201 @@
+package wikipedia
+
+import (
+	"os"
+	"testing"
+	"wiki2book/cache"
+	"wiki2book/config"
+	"wiki2book/test"
+	"wiki2book/util"
+)
+
+const testMultistreamDumpFile = "../test/dump/dump-multistream.xml.bz2"
+const testSingleStreamDumpFile = "../test/dump/dump.xml.bz2"
+
+func prepareDumpTest(t *testing.T) {
+	util.CurrentFilesystem = &util.OsFilesystem{}
+	config.Current = config.NewDefaultConfig()
+	config.Current.CacheDir = t.TempDir()
+	test.AssertNil(t, os.MkdirAll(cache.GetTempPath(), os.ModePerm))
+}
+
+func TestFindBzip2StreamOffsets(t *testing.T) {
+	// Act
+	multistreamOffsets, multistreamErr := findBzip2StreamOffsets(testMultistreamDumpFile)
+	singleStreamOffsets, singleStreamErr := findBzip2StreamOffsets(testSingleStreamDumpFile)
+
+	// Assert
+	test.AssertNil(t, multistreamErr)
+	test.AssertEqual(t, 4, len(multistreamOffsets))
+	test.AssertEqual(t, int64(0), multistreamOffsets[0])
+
+	test.AssertNil(t, singleStreamErr)
+	test.AssertEqual(t, []int64{0}, singleStreamOffsets)
+}
+
+func TestCreateDumpIndex(t *testing.T) {
+	// Arrange
+	streamOffsets, err := findBzip2StreamOffsets(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+
+	// Act
+	index, err := createDumpIndex(testMultistreamDumpFile)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, map[string]dumpIndexEntry{
+		"Main article":        {streamOffset: streamOffsets[1]},
+		"Foo":                 {streamOffset: streamOffsets[1], redirect: "Main article"},
+		"Second article":      {streamOffset: streamOffsets[2]},
+		"Redirect to section": {streamOffset: streamOffsets[2], redirect: "Second article"},
+	}, index)
+}
+
+func TestSerializeAndParseDumpIndex(t *testing.T) {
+	index := map[string]dumpIndexEntry{
+		"Foo": {streamOffset: 123, redirect: "Bar"},
+		"Bar": {streamOffset: 42},
+	}
+
+	serializedIndex := serializeDumpIndex(index)
+	test.AssertEqual(t, "wiki2book-dump-index-v1\nBar\t42\t\nFoo\t123\tBar\n", serializedIndex)
+
+	parsedIndex, err := parseDumpIndex(serializedIndex)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, index, parsedIndex)
+
+	_, err = parseDumpIndex("some-other-format\n")
+	test.AssertNotNil(t, err)
+}
+
+func TestDumpArticleSource_GetArticle(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+
+	articleSource, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+
+	// Act
+	article, err := articleSource.GetArticle("second_article")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, &WikiArticleDto{
+		Parse: WikiParseArticleDto{
+			Title:         "Second article",
+			Wikitext:      WikiWildcardTextDto{Content: "== Heading ==\nSecond text."},
+			OriginalTitle: "second_article",
+		},
+	}, article)
+}
+
+func TestNewDumpArticleSource_singleStreamDump(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+
+	// Act
+	articleSource, err := NewDumpArticleSource(testSingleStreamDumpFile)
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertNil(t, articleSource)
+	indexFileName, _ := dumpIndexFileName(testSingleStreamDumpFile)
+	_, indexExists, _ := cache.GetFile(cache.DumpIndexCacheDirName, indexFileName)
+	test.AssertFalse(t, indexExists)
+}
+
+func TestDumpArticleSource_GetArticle_redirect(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+	articleSource, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+
+	// Act
+	article, err := articleSource.GetArticle("Foo")
+	sectionArticle, sectionErr := articleSource.GetArticle("Redirect to section")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "Main article", article.Parse.Title)
+	test.AssertEqual(t, "Foo", article.Parse.OriginalTitle)
+	test.AssertEqual(t, "Some '''bold''' text & a [[Second article|link]].", article.Parse.Wikitext.Content)
+
+	test.AssertNil(t, sectionErr)
+	test.AssertEqual(t, "Second article", sectionArticle.Parse.Title)
+}
+
+func TestDumpArticleSource_GetArticle_notFound(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+	articleSource, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+
+	// Act
+	article, err := articleSource.GetArticle("Bar")
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertNil(t, article)
+}
+
+func TestDumpArticleSource_ResolveRedirects(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+	articleSource, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+
+	// Act
+	redirects, err := articleSource.ResolveRedirects([]string{"foo", "Redirect_to_section", "Main article", "Bar"})
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, map[string]string{
+		"foo":                 "Main article",
+		"Redirect_to_section": "Second article",
+	}, redirects)
+}
+
+func TestDumpArticleSource_GetArticleRevision(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+	articleSource, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+	article, err := articleSource.GetArticle("Main article")
+	test.AssertNil(t, err)
+
+	// Act
+	sameRevisionArticle, sameRevisionErr := articleSource.GetArticleRevision("Main article", article.Parse.RevisionId)
+	otherRevisionArticle, otherRevisionErr := articleSource.GetArticleRevision("Main article", article.Parse.RevisionId+1)
+	_, dateErr := articleSource.GetRevisionAtDate("Main article", "2024-01-01")
+
+	// Assert
+	test.AssertNil(t, sameRevisionErr)
+	test.AssertEqual(t, article, sameRevisionArticle)
+	test.AssertNotNil(t, otherRevisionErr)
+	test.AssertNil(t, otherRevisionArticle)
+	test.AssertNotNil(t, dateErr)
+}
+
+func TestNewDumpArticleSource_usesCachedIndex(t *testing.T) {
+	// Arrange
+	prepareDumpTest(t)
+	_, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+
+	// Add a redirect to the cached index, which is not part of the dump, to see that the index is not created again.
+	indexFileName, err := dumpIndexFileName(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+	indexFilePath := cache.GetFilePathInCache(cache.DumpIndexCacheDirName, indexFileName)
+	indexContent, err := os.ReadFile(indexFilePath)
+	test.AssertNil(t, err)
+	test.AssertNil(t, os.WriteFile(indexFilePath, append(indexContent, []byte("Bar\t0\tSecond article\n")...), 0644))
+
+	// Act
+	articleSource, err := NewDumpArticleSource(testMultistreamDumpFile)
+	test.AssertNil(t, err)
+	article, err := articleSource.GetArticle("Bar")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "Second article", article.Parse.Title)
+}
@@ -1,15 +1,14 @@
 package wikipedia
 
 import (
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
+	"time"
 	"wiki2book/cache"
 	"wiki2book/config"
 	ownHttp "wiki2book/http"
@@ -25,8 +24,9 @@ type WikiArticleDto struct {
 }
 
 type WikiParseArticleDto struct {
-	Title    string              `json:"title"`
-	Wikitext WikiWildcardTextDto `json:"wikitext"`
+	Title      string              `json:"title"`
+	RevisionId int                 `json:"revid"`
+	Wikitext   WikiWildcardTextDto `json:"wikitext"`
 
 	OriginalTitle string // Not set by Wikipedia but by wiki2book to remember the original title in case of redirects.
 }
@@ -43,13 +43,104 @@ type WikitextDto struct {
 	Content string `json:"wikitext"`
 }
 
+type WikiQueryRedirectsDto struct {
+	Query WikiRedirectsDto `json:"query"`
+}
+
+type WikiRedirectsDto struct {
+	Normalized []WikiTitleMappingDto `json:"normalized"`
+	Redirects  []WikiTitleMappingDto `json:"redirects"`
+}
+
+type WikiQueryImageUrlsDto struct {
+	Query WikiImageUrlsDto `json:"query"`
+}
+
+type WikiImageUrlsDto struct {
+	Normalized []WikiTitleMappingDto           `json:"normalized"`
+	Redirects  []WikiTitleMappingDto           `json:"redirects"`
+	Pages      map[string]WikiImageInfoPageDto `json:"pages"`
+}
+
+type WikiTitleMappingDto struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type WikiQueryRevisionsDto struct {
+	Query WikiRevisionsPagesDto `json:"query"`
+}
+
+type WikiRevisionsPagesDto struct {
+	Pages map[string]WikiRevisionsPageDto `json:"pages"`
+}
+
+type WikiRevisionsPageDto struct {
+	Title     string            `json:"title"`
+	Missing   *string           `json:"missing"`
+	Revisions []WikiRevisionDto `json:"revisions"`
+}
+
+type WikiRevisionDto struct {
+	RevisionId int    `json:"revid"`
+	Timestamp  string `json:"timestamp"`
+}
+
+type WikiQueryCategoryMembersDto struct {
+	Continue WikiCategoryMembersContinueDto `json:"continue"`
+	Query    WikiCategoryMembersDto         `json:"query"`
+}
+
+type WikiCategoryMembersContinueDto struct {
+	CmContinue string `json:"cmcontinue"`
+}
+
+type WikiCategoryMembersDto struct {
+	CategoryMembers []WikiCategoryMemberDto `json:"categorymembers"`
+}
+
+type WikiCategoryMemberDto struct {
+	Namespace int    `json:"ns"`
+	Title     string `json:"title"`
+}
+
+// The MediaWiki API allows up to 50 titles per query.
+const maxTitlesPerQuery = 50
+
+// Namespace IDs of MediaWiki, which are the same for all instances.
+const (
+	namespaceArticle  = 0
+	namespaceCategory = 14
+)
+
 type WikipediaService interface {
 	DownloadArticle(host string, title string) (*WikiArticleDto, error)
+	// DownloadArticleRevision downloads the given revision of the article. Redirects are not resolved, since a
+	// revision always belongs to one specific page.
+	DownloadArticleRevision(host string, title string, revision int) (*WikiArticleDto, error)
+	// GetRevisionAtDate returns the ID of the latest revision of the article at the end of the given date (format
+	// "2006-01-02", UTC). Redirects are resolved.
+	GetRevisionAtDate(host string, title string, date string) (int, error)
 	DownloadImages(images []string) error
 	EvaluateTemplate(template string, cacheFile string) (string, error)
 	// RenderMath takes the math string and turns it into an image. The absolute paths of the SVG and PNG images are
 	// returned. In case of an error, these paths are empty.
 	RenderMath(mathString string) (string, string, error)
+	// ResolveRedirects returns a map from the given article titles to the titles of the articles they redirect to.
+	// Titles that are not a redirect are not part of the map.
+	ResolveRedirects(titles []string) (map[string]string, error)
+	// GetCategoryMembers returns the titles of all articles and subcategories (with their prefix) of the given
+	// category.
+	GetCategoryMembers(category string) ([]string, []string, error)
+	// GetArticleContributors returns the names of all registered contributors and the number of anonymous
+	// contributors of the given article.
+	GetArticleContributors(host string, title string) (*ArticleContributors, error)
+	// GetTextLicense returns the license under which the articles of the given Wikipedia instance are published.
+	GetTextLicense(host string) (*License, error)
+	// GetImageMetadata returns author, license and source of the given image according to its file description page.
+	GetImageMetadata(image string) (*ImageMetadata, error)
+	// GetImagesMetadata works like GetImageMetadata for multiple images. Unknown images are not part of the result.
+	GetImagesMetadata(images []string) (map[string]*ImageMetadata, error)
 }
 
 type DefaultWikipediaService struct {
@@ -60,6 +151,11 @@ type DefaultWikipediaService struct {
 	wikipediaMathRestApi       string
 	imageProcessingService     image.ImageProcessingService
 	httpService                ownHttp.HttpService
+
+	// imageMetadata contains the metadata of all images resolved so far (s. resolveImageUrls). The keys are the titles
+	// of the file description pages (e.g. "File:Foo.jpg").
+	imageMetadata      map[string]*ImageMetadata
+	imageMetadataMutex sync.Mutex
 }
 
 func NewWikipediaService(wikipediaInstance string, wikipediaHost string, wikipediaImageInstances []string, wikipediaImageHost string, wikipediaMathRestApi string, imageProcessingService image.ImageProcessingService, httpClient ownHttp.HttpService) *DefaultWikipediaService {
@@ -71,20 +167,94 @@ func NewWikipediaService(wikipediaInstance string, wikipediaHost string, wikiped
 		wikipediaMathRestApi:       wikipediaMathRestApi,
 		imageProcessingService:     imageProcessingService,
 		httpService:                httpClient,
+		imageMetadata:              map[string]*ImageMetadata{},
 	}
 }
 
 func (w *DefaultWikipediaService) DownloadArticle(host string, title string) (*WikiArticleDto, error) {
 	titleWithoutWhitespaces := strings.ReplaceAll(title, " ", "_")
 	escapedTitle := url.QueryEscape(titleWithoutWhitespaces)
-	urlString := fmt.Sprintf("https://%s/w/api.php?action=parse&prop=wikitext&redirects=true&format=json&page=%s", host, escapedTitle)
+	urlString := fmt.Sprintf("https://%s/w/api.php?action=parse&prop=wikitext%%7Crevid&redirects=true&format=json&page=%s", host, escapedTitle)
 
 	cachedFile := titleWithoutWhitespaces + ".json"
-	cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cachedFile)
+
+	// An outdated cached article is only downloaded again when there's a newer revision, which is much cheaper to
+	// determine than parsing the whole article again.
+	revisionCheck := ownHttp.RevisionCheck{
+		LatestRevisionUrl: fmt.Sprintf("https://%s/w/api.php?action=query&prop=revisions&rvprop=ids&redirects=true&format=json&titles=%s", host, escapedTitle),
+		LatestRevision:    latestRevisionOfQuery,
+		RevisionOf:        revisionOfArticle,
+	}
+	cachedFilePath, _, err := w.httpService.DownloadAndCacheWithRevisionCheck(urlString, cache.ArticleCacheDirName, cachedFile, revisionCheck)
 	if err != nil {
 		return nil, errors.Wrapf(err, "Unable to download article %s", title)
 	}
 
+	return w.readArticle(title, cachedFilePath)
+}
+
+// latestRevisionOfQuery returns the revision of the given response of a revision query for a single article.
+func latestRevisionOfQuery(content []byte) (int, error) {
+	queryDto := &WikiQueryRevisionsDto{}
+	err := json.Unmarshal(content, queryDto)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error parsing JSON of revisions")
+	}
+
+	for _, page := range queryDto.Query.Pages {
+		if page.Missing == nil && len(page.Revisions) > 0 {
+			return page.Revisions[0].RevisionId, nil
+		}
+	}
+
+	return 0, errors.New("Response contains no revision")
+}
+
+// revisionOfArticle returns the revision of the given response of a parse request for an article.
+func revisionOfArticle(content []byte) (int, error) {
+	wikiArticleDto := &WikiArticleDto{}
+	err := json.Unmarshal(content, wikiArticleDto)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error parsing JSON of article")
+	}
+
+	if wikiArticleDto.Parse.RevisionId == 0 {
+		return 0, errors.New("Response contains no revision")
+	}
+	return wikiArticleDto.Parse.RevisionId, nil
+}
+
+func (w *DefaultWikipediaService) DownloadArticleRevision(host string, title string, revision int) (*WikiArticleDto, error) {
+	urlString := fmt.Sprintf("https://%s/w/api.php?action=parse&prop=wikitext%%7Crevid&format=json&oldid=%d", host, revision)
+
+	// Revisions never change, so the cached file of a revision has the same content as a new download. Nevertheless,
+	// it's removed from the cache when it's outdated or evicted, just like all other cached files.
+	cachedFile := fmt.Sprintf("%s@%d.json", strings.ReplaceAll(title, " ", "_"), revision)
+	cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cachedFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to download revision %d of article %s", revision, title)
+	}
+
+	wikiArticleDto, err := w.readArticle(title, cachedFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read revision %d of article %s", revision, title)
+	}
+
+	return wikiArticleDto, nil
+}
+
+// ArticleUrl returns the URL to the latest revision of the article on the given host (e.g. "en.wikipedia.org").
+func ArticleUrl(host string, title string) string {
+	return fmt.Sprintf("https://%s/wiki/%s", host, url.PathEscape(strings.ReplaceAll(title, " ", "_")))
+}
+
+// ArticleRevisionUrl returns the URL to the given revision of the article on the given host (e.g. "en.wikipedia.org").
+func ArticleRevisionUrl(host string, title string, revision int) string {
+	return fmt.Sprintf("https://%s/w/index.php?title=%s&oldid=%d", host, url.QueryEscape(strings.ReplaceAll(title, " ", "_")), revision)
+}
+
+// readArticle reads the cached response of a parse request for the given article.
+func (w *DefaultWikipediaService) readArticle(title string, cachedFilePath string) (*WikiArticleDto, error) {
 	cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
 	if err != nil {
 		return nil, errors.Wrap(err, "Unable to read body bytes")
@@ -103,51 +273,227 @@ func (w *DefaultWikipediaService) DownloadArticle(host string, title string) (*W
 	return wikiArticleDto, nil
 }
 
-// DownloadImages tries to download the given images from a couple of sources (wikipedia/wikimedia instances). The
-// downloaded images will be in the output folder. Some images might be redirects, so the redirect will be resolved,
-// that's why the article cache folder is needed as well.
+func (w *DefaultWikipediaService) GetRevisionAtDate(host string, title string, date string) (int, error) {
+	parsedDate, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Invalid date '%s' for article %s, expected format is YYYY-MM-DD", date, title)
+	}
+	endOfDay := parsedDate.Add(24*time.Hour - time.Second).Format(time.RFC3339)
+
+	sigolo.Debugf("Get revision of article %s at %s", title, endOfDay)
+	urlString := fmt.Sprintf("https://%s/w/api.php?action=query&prop=revisions&rvprop=ids%%7Ctimestamp&rvlimit=1&rvdir=older&redirects=true&format=json&rvstart=%s&titles=%s", host, url.QueryEscape(endOfDay), url.QueryEscape(title))
+	cacheFile := "revision-" + util.Hash(host+"|"+title+"|"+date) + ".json"
+	cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cacheFile)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to get revision of article %s at %s", title, date)
+	}
+
+	cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Unable to read cached revision file '%s'", cachedFilePath)
+	}
+
+	queryDto := &WikiQueryRevisionsDto{}
+	err = json.Unmarshal(cachedResponseBytes, queryDto)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Error parsing JSON of revisions from file '%s'", cachedFilePath)
+	}
+
+	for _, page := range queryDto.Query.Pages {
+		if page.Missing == nil && len(page.Revisions) > 0 {
+			return page.Revisions[0].RevisionId, nil
+		}
+	}
+
+	return 0, errors.Errorf("Article %s has no revision at or before %s", title, date)
+}
+
+// DownloadImages downloads and post-processes the given images concurrently using the configured number of image worker
+// threads. The URLs of all images are resolved beforehand with batched requests to the image article hosts. All images
+// are processed, even when some of them fail. The error of the first failed image (in the order of the given images) is
+// returned.
 func (w *DefaultWikipediaService) DownloadImages(images []string) error {
+	// The same image might be used multiple times, even with different prefixes. Processing them concurrently would
+	// lead to concurrent writes to the same file.
+	images = uniqueImages(images)
+	if len(images) == 0 {
+		return nil
+	}
 	sigolo.Debugf("Downloading images or loading them from cache:\n%s", strings.Join(images, "\n"))
+
+	imageUrls, err := w.resolveImageUrls(images)
+	if err != nil {
+		return err
+	}
+
+	// The workers don't log anything on their own, since the sigolo package functions aren't safe for concurrent use.
 	for _, image := range images {
-		sigolo.Debugf("Download image %s", image)
+		sigolo.Debugf("Download image '%s' from '%s'", image, imageUrls[image])
+	}
+
+	downloadErrors := make([]error, len(images))
+	imageIndexChan := make(chan int)
+
+	numberOfThreads := max(min(config.Current.ImageWorkerThreads, len(images)), 1)
+	threadPoolWaitGroup := &sync.WaitGroup{}
+	threadPoolWaitGroup.Add(numberOfThreads)
+	for i := 0; i < numberOfThreads; i++ {
+		go func() {
+			defer threadPoolWaitGroup.Done()
+			for imageIndex := range imageIndexChan {
+				downloadErrors[imageIndex] = w.downloadAndProcessImage(images[imageIndex], imageUrls[images[imageIndex]])
+			}
+		}()
+	}
+
+	for i := range images {
+		imageIndexChan <- i
+	}
+	close(imageIndexChan)
+	threadPoolWaitGroup.Wait()
 
-		downloadErr := w.downloadImageUsingAllSources(image)
+	var firstDownloadErr error
+	for i, downloadErr := range downloadErrors {
 		if downloadErr != nil {
-			return downloadErr
+			sigolo.Errorf("Could not download image %s: %s", images[i], downloadErr.Error())
+			if firstDownloadErr == nil {
+				firstDownloadErr = downloadErr
+			}
 		}
 	}
-	return nil
+	return firstDownloadErr
+}
+
+// uniqueImages removes all images referring to the same file as a previous image, e.g. "File:Foo.jpg" and
+// "Datei:Foo.jpg".
+func uniqueImages(images []string) []string {
+	var result []string
+	knownImageNames := map[string]bool{}
+	for _, image := range images {
+		_, imageName, _ := strings.Cut(image, ":")
+		if !knownImageNames[imageName] {
+			knownImageNames[imageName] = true
+			result = append(result, image)
+		}
+	}
+	return result
 }
 
-func (w *DefaultWikipediaService) downloadImageUsingAllSources(image string) error {
-	var downloadErr error
+// imageTitle returns the title of the file description page of the given image (e.g. "File:Foo.jpg" for
+// "Datei:Foo.jpg"). Only the prefix is removed, so file names with colons stay intact.
+func imageTitle(image string) string {
+	// The prefix might be localized (e.g. "Datei:"), but "File:" is understood by all Wikipedia instances.
+	_, imageName, _ := strings.Cut(image, ":")
+	return "File:" + imageName
+}
 
-	for i, articleHost := range w.wikipediaImageArticleHosts {
-		var outputFilepath string
-		var freshlyDownloaded bool
-		isLastSource := i == len(w.wikipediaImageArticleHosts)-1
-		outputFilepath, freshlyDownloaded, downloadErr = w.downloadImage(articleHost, image)
-		if downloadErr != nil {
-			if isLastSource {
-				// We tried every single image source and couldn't find the image.
-				sigolo.Errorf("Could not downloading image %s from any image article source. Error of last image source: %s", image, downloadErr.Error())
-			} else {
-				// This image is not available at the current source. Maybe one of the following sources hold the
-				// image. Therefore, this is not a real error that needs to be handled.
-				sigolo.Debugf("Could not downloading image %s from source %s.%s: %s", image, articleHost, w.wikipediaHost, downloadErr.Error())
+// resolveImageUrls determines the URLs of the actual image files of the given images (e.g. "File:Foo.jpg"). The image
+// article hosts are used in the given order, each host is only asked for images unknown to the previous hosts.
+// Redirects are resolved. Images unknown to all hosts are not part of the returned map. The metadata of the images is
+// requested as well and kept for GetImageMetadata, so that image credits and attributions need no further requests.
+func (w *DefaultWikipediaService) resolveImageUrls(images []string) (map[string]string, error) {
+	imageUrls := map[string]string{}
+
+	for _, host := range w.wikipediaImageArticleHosts {
+		var unresolvedImages []string
+		for _, image := range images {
+			if _, ok := imageUrls[image]; !ok {
+				unresolvedImages = append(unresolvedImages, image)
 			}
-			continue
+		}
+		if len(unresolvedImages) == 0 {
+			break
 		}
 
-		err := w.postProcessImage(outputFilepath, freshlyDownloaded)
-		if err != nil {
-			return err
+		for i := 0; i < len(unresolvedImages); i += maxTitlesPerQuery {
+			batchImageUrls, err := w.resolveImageUrlBatch(host, unresolvedImages[i:min(i+maxTitlesPerQuery, len(unresolvedImages))])
+			if err != nil {
+				return nil, err
+			}
+			for image, imageUrl := range batchImageUrls {
+				imageUrls[image] = imageUrl
+			}
 		}
+	}
 
-		break
+	return imageUrls, nil
+}
+
+// resolveImageUrlBatch determines the URLs and metadata of the given images with one single request to the given host.
+func (w *DefaultWikipediaService) resolveImageUrlBatch(host string, images []string) (map[string]string, error) {
+	titles := make([]string, len(images))
+	for i, image := range images {
+		titles[i] = imageTitle(image)
+	}
+	titleBatch := strings.Join(titles, "|")
+	sigolo.Debugf("Resolve URLs of images %s from %s", util.TruncString(titleBatch), host)
+
+	urlString := fmt.Sprintf("https://%s/w/api.php?action=query&prop=imageinfo&iiprop=url%%7Cextmetadata&redirects=true&format=json&titles=%s", host, url.QueryEscape(titleBatch))
+	cacheFile := "imageinfos-" + util.Hash(host+"|"+titleBatch) + ".json"
+	cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cacheFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to resolve URLs of images %s", util.TruncString(titleBatch))
+	}
+
+	cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to read cached image URL file '%s'", cachedFilePath)
+	}
+
+	queryDto := &WikiQueryImageUrlsDto{}
+	err = json.Unmarshal(cachedResponseBytes, queryDto)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error parsing JSON of image URLs from file '%s'", cachedFilePath)
+	}
+
+	titleMappings := map[string]string{}
+	for _, mapping := range append(queryDto.Query.Normalized, queryDto.Query.Redirects...) {
+		titleMappings[mapping.From] = mapping.To
+	}
+
+	imageInfosByTitle := map[string]WikiImageInfoDto{}
+	for _, page := range queryDto.Query.Pages {
+		if len(page.ImageInfo) > 0 && page.ImageInfo[0].Url != "" {
+			imageInfosByTitle[page.Title] = page.ImageInfo[0]
+		}
+	}
+
+	imageUrls := map[string]string{}
+	for i, title := range titles {
+		// The title is first normalized (e.g. "File:foo.jpg" to "File:Foo.jpg") and the normalized title might be a
+		// redirect to the actual image.
+		if normalizedTitle, ok := titleMappings[title]; ok {
+			title = normalizedTitle
+		}
+		if redirectTarget, ok := titleMappings[title]; ok {
+			title = redirectTarget
+		}
+
+		imageInfo, ok := imageInfosByTitle[title]
+		if !ok {
+			sigolo.Debugf("Image %s not found on %s", titles[i], host)
+			continue
+		}
+		imageUrls[images[i]] = imageInfo.Url
+		w.addImageMetadata(newImageMetadata(titles[i], imageInfo))
+	}
+
+	return imageUrls, nil
+}
+
+// downloadAndProcessImage downloads the given image from the given URL, which was determined by resolveImageUrls, and
+// post-processes it. An empty URL means that the image is unknown.
+func (w *DefaultWikipediaService) downloadAndProcessImage(image string, imageUrl string) error {
+	if imageUrl == "" {
+		return errors.Errorf("Image %s not found on any image article host %v", image, w.wikipediaImageArticleHosts)
+	}
+
+	outputFilepath, freshlyDownloaded, err := w.downloadImage(image, imageUrl)
+	if err != nil {
+		return err
 	}
 
-	return downloadErr
+	return w.postProcessImage(outputFilepath, freshlyDownloaded)
 }
 
 func (w *DefaultWikipediaService) postProcessImage(outputFilepath string, freshlyDownloaded bool) error {
@@ -171,6 +517,8 @@ func (w *DefaultWikipediaService) postProcessImage(outputFilepath string, freshl
 				return err
 			}
 
+			registerFileInCache(outputPngFilepath)
+
 			// We pretend this is a fresh download, because the PNG is indeed fresh
 			freshlyDownloaded = true
 		}
@@ -185,51 +533,32 @@ func (w *DefaultWikipediaService) postProcessImage(outputFilepath string, freshl
 		if err != nil {
 			return err
 		}
+		registerFileInCache(outputFilepath)
 	}
 
 	return nil
 }
 
-// downloadImage downloads the given image (e.g. "File:foo.jpg") to the given folder and returns the filepath as first
-// return value. When the file already exists, then the second value is false, otherwise true (for fresh downloads or
-// in case of errors). Whenever an error is returned, the article cache folder is needed as some files might be
-// redirects and such a redirect counts as article.
-func (w *DefaultWikipediaService) downloadImage(imageArticleHost string, imageNameWithPrefix string) (string, bool, error) {
-	// TODO handle colons in file names
-	imageName := "File:" + strings.Split(imageNameWithPrefix, ":")[1]
-	sigolo.Debugf("Download article file for image '%s' from '%s'", imageName, imageArticleHost)
-	imageArticle, err := w.DownloadArticle(imageArticleHost, imageName)
+// registerFileInCache updates the cache index for files changed by external tools. Errors are only logged, since an
+// inaccurate cache index doesn't affect the book.
+func registerFileInCache(filePath string) {
+	err := cache.RegisterFile(filePath)
 	if err != nil {
-		return "", true, err
+		sigolo.Warnf("Unable to update cache index: %s", err.Error())
 	}
+}
 
-	// Replace spaces with underscore because wikimedia doesn't know spaces in file names:
-
-	originalImageNameWithPrefix := imageArticle.Parse.OriginalTitle
-	originalImageName := strings.Split(originalImageNameWithPrefix, ":")[1]
-	originalImageName = strings.ReplaceAll(originalImageName, " ", "_")
-
-	actualImageNameWithPrefix := imageArticle.Parse.Title
-	actualImageName := strings.Split(actualImageNameWithPrefix, ":")[1]
-	actualImageName = strings.ReplaceAll(actualImageName, " ", "_")
-
-	md5sum := fmt.Sprintf("%x", md5.Sum([]byte(actualImageName)))
-	sigolo.Debugf("Download actual image '%s' from Wikimedia instance '%s'", actualImageName, imageArticleHost)
-	sigolo.Tracef("  Original name: %s", originalImageName)
-	sigolo.Tracef("  Actual image name (after possible redirects): %s", actualImageNameWithPrefix)
-	sigolo.Tracef("  MD5 of redirected image name: %s", md5sum)
+// downloadImage downloads the given image (e.g. "File:foo.jpg") from the given URL into the image cache folder and
+// returns the filepath as first return value. When the file already exists, then the second value is false, otherwise
+// true (for fresh downloads or in case of errors).
+func (w *DefaultWikipediaService) downloadImage(imageNameWithPrefix string, imageUrl string) (string, bool, error) {
+	originalImageName := imageCacheFileName(imageNameWithPrefix)
 
-	// In case the host ist a wiki host with subdomain (i.e. "de.wikipedia.org"), we use the subdomain as the instance
-	// path segment below. Image URLs are e.g. "upload.wikimedia.org/wikipedia/de/..." where the "de" is the instance,
-	// which should be used when the image article has been located at "de.wikipedia.org".
-	isWikiDomainWithSubdomain, err := regexp.MatchString(".+\\.wiki.+\\..+", imageArticleHost)
-	wikiInstancePathSegment := ""
-	if isWikiDomainWithSubdomain {
-		wikiInstancePathSegment = strings.SplitN(imageArticleHost, ".", 2)[0]
+	imageUrl, err := w.withImageHost(imageUrl)
+	if err != nil {
+		return "", true, err
 	}
 
-	imageUrl := fmt.Sprintf("https://%s/wikipedia/%s/%c/%c%c/%s", w.wikipediaImageHost, wikiInstancePathSegment, md5sum[0], md5sum[0], md5sum[1], url.QueryEscape(actualImageName))
-
 	cachedFilePath, freshlyDownloaded, err := w.httpService.DownloadAndCache(imageUrl, cache.ImageCacheDirName, originalImageName)
 	if err != nil {
 		return "", freshlyDownloaded, err
@@ -240,11 +569,51 @@ func (w *DefaultWikipediaService) downloadImage(imageArticleHost string, imageNa
 		if err != nil {
 			sigolo.Errorf("Unable to make size of SVG '%s' absolute. This error will be ignored, since false errors exist for the XML parsing of SVGs. Error: %+v", cachedFilePath, err)
 		}
+		registerFileInCache(cachedFilePath)
 	}
 
 	return cachedFilePath, freshlyDownloaded, nil
 }
 
+// imageCacheFileName returns the name of the cached file of the given image (e.g. "File:foo.jpg").
+func imageCacheFileName(imageNameWithPrefix string) string {
+	// The file is stored under the requested name, even when this is a redirect to a different image, because the
+	// requested name is used in the article.
+	// Replace spaces with underscore because wikimedia doesn't know spaces in file names:
+	_, imageName, _ := strings.Cut(imageNameWithPrefix, ":")
+	return strings.ReplaceAll(imageName, " ", "_")
+}
+
+// MarkImagesAccessed marks the cached files of the given images (e.g. "File:foo.jpg") as accessed, including PNG files
+// converted from them, without downloading or processing them. This is needed for images used by reused HTML files, so
+// that they aren't evicted from the cache by other processes while this process uses them.
+func MarkImagesAccessed(images []string) {
+	for _, image := range uniqueImages(images) {
+		imageFileName := imageCacheFileName(image)
+		for _, fileName := range []string{imageFileName, util.GetPngPathForFile(imageFileName)} {
+			err := cache.MarkAccessed(cache.ImageCacheDirName, fileName)
+			if err != nil {
+				sigolo.Warnf("Unable to mark image '%s' as accessed in cache: %s", fileName, err.Error())
+			}
+		}
+	}
+}
+
+// withImageHost replaces the host of the given image URL by the configured image host. The URL is returned unchanged
+// when no image host is configured.
+func (w *DefaultWikipediaService) withImageHost(imageUrl string) (string, error) {
+	if w.wikipediaImageHost == "" {
+		return imageUrl, nil
+	}
+
+	parsedUrl, err := url.Parse(imageUrl)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to parse image URL '%s'", imageUrl)
+	}
+	parsedUrl.Host = w.wikipediaImageHost
+	return parsedUrl.String(), nil
+}
+
 func (w *DefaultWikipediaService) EvaluateTemplate(template string, cacheFile string) (string, error) {
 	sigolo.Debugf("Evaluate template %s (hash/filename: %s)", util.TruncString(template), cacheFile)
 
@@ -268,6 +637,104 @@ func (w *DefaultWikipediaService) EvaluateTemplate(template string, cacheFile st
 	return evaluatedTemplate.ExpandTemplate.Content, nil
 }
 
+func (w *DefaultWikipediaService) ResolveRedirects(titles []string) (map[string]string, error) {
+	var titlesToResolve []string
+	for _, title := range util.RemoveDuplicates(titles) {
+		// Titles with "|" are invalid and would break the query, since it's the separator of the titles.
+		if strings.TrimSpace(title) != "" && !strings.Contains(title, "|") {
+			titlesToResolve = append(titlesToResolve, title)
+		}
+	}
+
+	redirects := map[string]string{}
+	for i := 0; i < len(titlesToResolve); i += maxTitlesPerQuery {
+		titleBatch := strings.Join(titlesToResolve[i:min(i+maxTitlesPerQuery, len(titlesToResolve))], "|")
+		sigolo.Debugf("Resolve redirects of articles %s", util.TruncString(titleBatch))
+
+		urlString := fmt.Sprintf("https://%s.%s/w/api.php?action=query&redirects=true&format=json&titles=%s", w.wikipediaInstance, w.wikipediaHost, url.QueryEscape(titleBatch))
+		cacheFile := "redirects-" + util.Hash(titleBatch) + ".json"
+		cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cacheFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to resolve redirects of articles %s", util.TruncString(titleBatch))
+		}
+
+		cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to read cached redirect file '%s'", cachedFilePath)
+		}
+
+		queryDto := &WikiQueryRedirectsDto{}
+		err = json.Unmarshal(cachedResponseBytes, queryDto)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error parsing JSON of redirects from file '%s'", cachedFilePath)
+		}
+
+		// The redirects refer to the normalized titles (e.g. "Foo bar" instead of "foo_bar"), but the caller wants
+		// to know the redirect target of the title it passed to this function.
+		originalTitles := map[string]string{}
+		for _, normalization := range queryDto.Query.Normalized {
+			originalTitles[normalization.To] = normalization.From
+		}
+		for _, redirect := range queryDto.Query.Redirects {
+			originalTitle, isNormalized := originalTitles[redirect.From]
+			if !isNormalized {
+				originalTitle = redirect.From
+			}
+			redirects[originalTitle] = redirect.To
+		}
+	}
+
+	return redirects, nil
+}
+
+func (w *DefaultWikipediaService) GetCategoryMembers(category string) ([]string, []string, error) {
+	var articles []string
+	var subcategories []string
+
+	continueToken := ""
+	for {
+		sigolo.Debugf("Get members of category %s (continue token: '%s')", category, continueToken)
+
+		urlString := fmt.Sprintf("https://%s.%s/w/api.php?action=query&list=categorymembers&cmtype=page%%7Csubcat&cmnamespace=%d%%7C%d&cmlimit=max&format=json&cmtitle=%s", w.wikipediaInstance, w.wikipediaHost, namespaceArticle, namespaceCategory, url.QueryEscape(category))
+		if continueToken != "" {
+			urlString += "&cmcontinue=" + url.QueryEscape(continueToken)
+		}
+
+		cacheFile := "category-" + util.Hash(category+"|"+continueToken) + ".json"
+		cachedFilePath, _, err := w.httpService.DownloadAndCache(urlString, cache.ArticleCacheDirName, cacheFile)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Unable to get members of category %s", category)
+		}
+
+		cachedResponseBytes, err := util.CurrentFilesystem.ReadFile(cachedFilePath)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Unable to read cached category file '%s'", cachedFilePath)
+		}
+
+		queryDto := &WikiQueryCategoryMembersDto{}
+		err = json.Unmarshal(cachedResponseBytes, queryDto)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Error parsing JSON of category members from file '%s'", cachedFilePath)
+		}
+
+		for _, member := range queryDto.Query.CategoryMembers {
+			switch member.Namespace {
+			case namespaceArticle:
+				articles = append(articles, member.Title)
+			case namespaceCategory:
+				subcategories = append(subcategories, member.Title)
+			}
+		}
+
+		continueToken = queryDto.Continue.CmContinue
+		if continueToken == "" {
+			break
+		}
+	}
+
+	return articles, subcategories, nil
+}
+
 func (w *DefaultWikipediaService) RenderMath(mathString string) (string, string, error) {
 	sigolo.Debugf("Render math %s", util.TruncString(mathString))
 	sigolo.Tracef("  Complete math text: %s", mathString)
@@ -300,6 +767,7 @@ func (w *DefaultWikipediaService) RenderMath(mathString string) (string, string,
 		if err != nil {
 			return "", "", err
 		}
+		registerFileInCache(cachedPngFile)
 		return cachedSvgFile, cachedPngFile, nil
 	}
 
@@ -315,51 +783,25 @@ func (w *DefaultWikipediaService) getMathResource(mathString string) (string, er
 	// caching on the Wikimedia servers.
 	requestData := "q=" + url.QueryEscape(fmt.Sprintf(`{\displaystyle %s}`, mathString))
 
-	// If file exists -> ignore
 	filename := util.Hash(mathString)
-	outputFilepath, fileIsCached, err := cache.GetFile(cache.MathCacheDirName, filename)
-	if fileIsCached {
-		mathSvgFilenameBytes, err := util.CurrentFilesystem.ReadFile(outputFilepath)
-		mathSvgFilename := string(mathSvgFilenameBytes)
-		if err != nil {
-			return "", errors.Wrapf(err, "Unable to read cache file %s for math string %s", outputFilepath, util.TruncString(mathString))
-		}
-		sigolo.Debugf("File %s does already exist. Skip.", outputFilepath)
-		return mathSvgFilename, nil
-	}
-
-	response, err := w.httpService.PostFormEncoded(urlString, requestData)
-
-	responseBodyText := ""
-	if response != nil {
-		responseBodyReader := response.Body
-		if responseBodyReader != nil {
-			defer responseBodyReader.Close()
-		}
-		responseBodyText = util.ReaderToString(response.Body)
-	}
-
+	outputFilepath, _, err := w.httpService.PostFormEncodedAndCache(urlString, requestData, cache.MathCacheDirName, filename, mathResourceLocation)
 	if err != nil {
-		return "", errors.Wrapf(err, "Response body for math '%s' on URL %s : %s", mathString, urlString, responseBodyText)
+		return "", errors.Wrapf(err, "Unable to get math resource for math string %s", util.TruncString(mathString))
 	}
 
-	if response == nil {
-		return "", errors.Errorf("No error but empty response returned for math '%s' on URL %s", mathString, urlString)
+	mathSvgFilenameBytes, err := util.CurrentFilesystem.ReadFile(outputFilepath)
+	if err != nil {
+		return "", errors.Wrapf(err, "Unable to read cache file %s for math string %s", outputFilepath, util.TruncString(mathString))
 	}
 
-	if response.StatusCode != http.StatusOK {
-		return "", errors.Errorf("Rendering math failed with status code %d for math '%s' on URL %s with body: %s", response.StatusCode, mathString, urlString, responseBodyText)
-	}
+	return string(mathSvgFilenameBytes), nil
+}
 
+// mathResourceLocation returns the SVG filename from the location header of the response of the math check API.
+func mathResourceLocation(response *http.Response) (string, error) {
 	locationHeader := response.Header.Get(ownHttp.HeaderXResourceLocation)
 	if locationHeader == "" {
-		return "", errors.Errorf("Unable to get location header for math '%s' on URL %s with body: %s", mathString, urlString, responseBodyText)
-	}
-
-	_, err = cache.CacheToFile(cache.MathCacheDirName, filename, io.NopCloser(strings.NewReader(locationHeader)))
-	if err != nil {
-		return "", errors.Wrapf(err, "Unable to cache math resource for math string \"%s\" to %s", util.TruncString(mathString), outputFilepath)
+		return "", errors.Errorf("Unable to get location header from response of math check with body: %s", util.ReaderToString(response.Body))
 	}
-
 	return locationHeader, nil
 }
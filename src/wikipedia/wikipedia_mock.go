@@ -1,25 +1,60 @@
 package wikipedia
 
 type MockWikipediaService struct {
-	DownloadArticleFunc  func(host string, title string) (*WikiArticleDto, error)
-	DownloadImagesFunc   func(images []string) error
-	EvaluateTemplateFunc func(template string, cacheFile string) (string, error)
-	RenderMathFunc       func(mathString string) (string, string, error)
+	DownloadArticleFunc         func(host string, title string) (*WikiArticleDto, error)
+	DownloadArticleRevisionFunc func(host string, title string, revision int) (*WikiArticleDto, error)
+	GetRevisionAtDateFunc       func(host string, title string, date string) (int, error)
+	DownloadImagesFunc          func(images []string) error
+	EvaluateTemplateFunc        func(template string, cacheFile string) (string, error)
+	RenderMathFunc              func(mathString string) (string, string, error)
+	ResolveRedirectsFunc        func(titles []string) (map[string]string, error)
+	GetCategoryMembersFunc      func(category string) ([]string, []string, error)
+	GetArticleContributorsFunc  func(host string, title string) (*ArticleContributors, error)
+	GetTextLicenseFunc          func(host string) (*License, error)
+	GetImageMetadataFunc        func(image string) (*ImageMetadata, error)
+	GetImagesMetadataFunc       func(images []string) (map[string]*ImageMetadata, error)
 }
 
 func NewMockWikipediaService() *MockWikipediaService {
-	return &MockWikipediaService{
-		DownloadArticleFunc:  func(host string, title string) (*WikiArticleDto, error) { return nil, nil },
-		DownloadImagesFunc:   func(images []string) error { return nil },
-		EvaluateTemplateFunc: func(template string, cacheFile string) (string, error) { return "", nil },
-		RenderMathFunc:       func(mathString string) (string, string, error) { return "", "", nil },
+	mock := &MockWikipediaService{
+		DownloadArticleFunc:         func(host string, title string) (*WikiArticleDto, error) { return nil, nil },
+		DownloadArticleRevisionFunc: func(host string, title string, revision int) (*WikiArticleDto, error) { return nil, nil },
+		GetRevisionAtDateFunc:       func(host string, title string, date string) (int, error) { return 0, nil },
+		DownloadImagesFunc:          func(images []string) error { return nil },
+		EvaluateTemplateFunc:        func(template string, cacheFile string) (string, error) { return "", nil },
+		RenderMathFunc:              func(mathString string) (string, string, error) { return "", "", nil },
+		ResolveRedirectsFunc:        func(titles []string) (map[string]string, error) { return map[string]string{}, nil },
+		GetCategoryMembersFunc:      func(category string) ([]string, []string, error) { return nil, nil, nil },
+		GetArticleContributorsFunc:  func(host string, title string) (*ArticleContributors, error) { return &ArticleContributors{}, nil },
+		GetTextLicenseFunc:          func(host string) (*License, error) { return &License{}, nil },
+		GetImageMetadataFunc:        func(image string) (*ImageMetadata, error) { return &ImageMetadata{Title: image}, nil },
 	}
+	// Uses GetImageMetadataFunc by default, so that tests only need to mock the metadata of single images.
+	mock.GetImagesMetadataFunc = func(images []string) (map[string]*ImageMetadata, error) {
+		imagesMetadata := map[string]*ImageMetadata{}
+		for _, image := range images {
+			metadata, err := mock.GetImageMetadataFunc(image)
+			if err == nil {
+				imagesMetadata[image] = metadata
+			}
+		}
+		return imagesMetadata, nil
+	}
+	return mock
 }
 
 func (m *MockWikipediaService) DownloadArticle(host string, title string) (*WikiArticleDto, error) {
 	return m.DownloadArticleFunc(host, title)
 }
 
+func (m *MockWikipediaService) DownloadArticleRevision(host string, title string, revision int) (*WikiArticleDto, error) {
+	return m.DownloadArticleRevisionFunc(host, title, revision)
+}
+
+func (m *MockWikipediaService) GetRevisionAtDate(host string, title string, date string) (int, error) {
+	return m.GetRevisionAtDateFunc(host, title, date)
+}
+
 func (m *MockWikipediaService) DownloadImages(images []string) error {
 	return m.DownloadImagesFunc(images)
 }
@@ -31,3 +66,27 @@ func (m *MockWikipediaService) EvaluateTemplate(template string, cacheFile strin
 func (m *MockWikipediaService) RenderMath(mathString string) (string, string, error) {
 	return m.RenderMathFunc(mathString)
 }
+
+func (m *MockWikipediaService) ResolveRedirects(titles []string) (map[string]string, error) {
+	return m.ResolveRedirectsFunc(titles)
+}
+
+func (m *MockWikipediaService) GetCategoryMembers(category string) ([]string, []string, error) {
+	return m.GetCategoryMembersFunc(category)
+}
+
+func (m *MockWikipediaService) GetArticleContributors(host string, title string) (*ArticleContributors, error) {
+	return m.GetArticleContributorsFunc(host, title)
+}
+
+func (m *MockWikipediaService) GetTextLicense(host string) (*License, error) {
+	return m.GetTextLicenseFunc(host)
+}
+
+func (m *MockWikipediaService) GetImageMetadata(image string) (*ImageMetadata, error) {
+	return m.GetImageMetadataFunc(image)
+}
+
+func (m *MockWikipediaService) GetImagesMetadata(images []string) (map[string]*ImageMetadata, error) {
+	return m.GetImagesMetadataFunc(images)
+}
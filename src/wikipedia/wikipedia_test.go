@@ -3,13 +3,16 @@ package wikipedia
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	netHttp "net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"wiki2book/cache"
 	"wiki2book/config"
 	"wiki2book/http"
 	"wiki2book/image"
@@ -239,42 +242,170 @@ func TestPostProcessImage_noFreshDownload_withPdfToPng_alreadyExistingPng(t *tes
 	test.AssertEqual(t, 0, imageProcessingServiceMock.ConvertToPngCalls)
 }
 
-func TestDownladImage(t *testing.T) {
-	cachedArticleFilepath := filepath.Join(test.TestCacheFolder, "Foo.jpg.json")
-	err := os.WriteFile(cachedArticleFilepath, []byte(`{"parse":{"title":"File:Foo.jpg","pageid":80546,"redirects":[],"wikitext":{"*":""}}}`), 0600)
-	sigolo.FatalCheck(err)
-
+func TestDownloadImage(t *testing.T) {
 	cachedImageFilepath := filepath.Join(test.TestCacheFolder, "File:foo.jpg")
-	err = os.WriteFile(cachedImageFilepath, []byte(`foobar`), 0600)
+	err := os.WriteFile(cachedImageFilepath, []byte(`foobar`), 0600)
 	sigolo.FatalCheck(err)
 
-	requestedArticleUrl := ""
 	requestedImageUrl := ""
+	requestedFilename := ""
 
 	mockHttpClient := http.NewMockHttpService(
 		func(url string, cacheFolder string, filename string) (string, bool, error) {
-			if strings.Contains(url, "api.php") {
-				requestedArticleUrl = url
-				return cachedArticleFilepath, true, nil
-			} else if strings.Contains(url, "upload") {
-				requestedImageUrl = url
-				return cachedImageFilepath, true, nil
-			}
-
-			return "", false, errors.New("no mock behavior for url " + url)
+			requestedImageUrl = url
+			requestedFilename = filename
+			return cachedImageFilepath, true, nil
 		},
 		nil,
 	)
 	imageProcessingServiceMock := image.NewMockImageProcessingService()
-	wikipediaService := NewWikipediaService("", "", []string{}, "upload.wikimedia.org", "", imageProcessingServiceMock, mockHttpClient)
+	wikipediaService := NewWikipediaService("", "", []string{}, "my-image-server.com", "", imageProcessingServiceMock, mockHttpClient)
 
-	downloadImage, freshlyDownloaded, err := wikipediaService.downloadImage("en.wikipedia.org", "File:foo.jpg")
+	downloadImage, freshlyDownloaded, err := wikipediaService.downloadImage("Datei:foo bar: baz.jpg", "https://upload.wikimedia.org/wikipedia/commons/a/ab/Foo_bar%3A_baz.jpg")
 
 	test.AssertNil(t, err)
 	test.AssertTrue(t, freshlyDownloaded)
 	test.AssertEqual(t, cachedImageFilepath, downloadImage)
-	test.AssertEqual(t, "https://en.wikipedia.org/w/api.php?action=parse&prop=wikitext&redirects=true&format=json&page=File%3Afoo.jpg", requestedArticleUrl)
-	test.AssertEqual(t, "https://upload.wikimedia.org/wikipedia/en/0/06/Foo.jpg", requestedImageUrl)
+	test.AssertEqual(t, "https://my-image-server.com/wikipedia/commons/a/ab/Foo_bar%3A_baz.jpg", requestedImageUrl)
+	test.AssertEqual(t, "foo_bar:_baz.jpg", requestedFilename)
+}
+
+func TestResolveImageUrls(t *testing.T) {
+	// Arrange
+	var images []string
+	for i := 0; i < 51; i++ {
+		images = append(images, fmt.Sprintf("File:Image %d.jpg", i))
+	}
+	images = append(images, "Datei:foo: bar.jpg", "File:Redirect.jpg")
+
+	var requestedUrls []string
+	responses := []string{
+		`{"query":{"pages":{"1":{"title":"File:Image 0.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/commons/0/01/Image_0.jpg"}]},"-1":{"title":"File:Image 1.jpg","missing":""}}}}`,
+		`{"query":{"normalized":[{"from":"File:foo: bar.jpg","to":"File:Foo: bar.jpg"}],"redirects":[{"from":"File:Redirect.jpg","to":"File:Target.jpg"}],"pages":{"2":{"title":"File:Foo: bar.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/commons/f/fb/Foo%3A_bar.jpg"}]},"3":{"title":"File:Target.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/commons/7/7a/Target.jpg"}]}}}}`,
+		`{"query":{"pages":{"4":{"title":"File:Image 1.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/en/1/11/Image_1.jpg"}]}}}}`,
+	}
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) { return []byte(responses[len(requestedUrls)-1]), nil }
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrls = append(requestedUrls, url)
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("", "", []string{"commons.wikimedia.org", "en.wikipedia.org"}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	imageUrls, err := wikipediaService.resolveImageUrls(images)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 3, len(requestedUrls))
+	test.AssertTrue(t, strings.HasPrefix(requestedUrls[0], "https://commons.wikimedia.org/w/api.php?action=query&prop=imageinfo&iiprop=url%7Cextmetadata&redirects=true&format=json&titles=File%3AImage+0.jpg%7CFile%3AImage+1.jpg%7C"))
+	test.AssertEqual(t, "https://commons.wikimedia.org/w/api.php?action=query&prop=imageinfo&iiprop=url%7Cextmetadata&redirects=true&format=json&titles=File%3AImage+50.jpg%7CFile%3Afoo%3A+bar.jpg%7CFile%3ARedirect.jpg", requestedUrls[1])
+	test.AssertTrue(t, strings.HasPrefix(requestedUrls[2], "https://en.wikipedia.org/w/api.php?action=query&prop=imageinfo&iiprop=url%7Cextmetadata&redirects=true&format=json&titles=File%3AImage+1.jpg%7CFile%3AImage+2.jpg%7C"))
+	test.AssertMapEqual(t, map[string]string{
+		"File:Image 0.jpg":   "https://upload.wikimedia.org/wikipedia/commons/0/01/Image_0.jpg",
+		"File:Image 1.jpg":   "https://upload.wikimedia.org/wikipedia/en/1/11/Image_1.jpg",
+		"Datei:foo: bar.jpg": "https://upload.wikimedia.org/wikipedia/commons/f/fb/Foo%3A_bar.jpg",
+		"File:Redirect.jpg":  "https://upload.wikimedia.org/wikipedia/commons/7/7a/Target.jpg",
+	}, imageUrls)
+}
+
+func TestDownloadImages(t *testing.T) {
+	// Arrange
+	config.Current.ImageWorkerThreads = 3
+	defer func() { config.Current.ImageWorkerThreads = config.NewDefaultConfig().ImageWorkerThreads }()
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"query":{"pages":{
+			"1":{"title":"File:Foo.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/commons/1/11/Foo.jpg"}]},
+			"2":{"title":"File:Broken.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/commons/2/22/Broken.jpg"}]},
+			"3":{"title":"File:Bar.jpg","imageinfo":[{"url":"https://upload.wikimedia.org/wikipedia/commons/3/33/Bar.jpg"}]}
+		}}}`), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	// Every image download waits until all three worker threads are downloading an image.
+	imageMutex := &sync.Mutex{}
+	var requestedImageUrls []string
+	imageUrlRequests := 0
+	allThreadsDownloading := make(chan bool)
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			if !strings.Contains(url, "upload") {
+				imageUrlRequests++
+				return filepath.Join(test.TestCacheFolder, filename), false, nil
+			}
+
+			imageMutex.Lock()
+			requestedImageUrls = append(requestedImageUrls, url)
+			if len(requestedImageUrls) == 3 {
+				close(allThreadsDownloading)
+			}
+			imageMutex.Unlock()
+
+			select {
+			case <-allThreadsDownloading:
+			case <-time.After(5 * time.Second):
+				return "", false, errors.New("images are not downloaded concurrently")
+			}
+
+			if strings.Contains(url, "Broken.jpg") {
+				return "", false, errors.New("broken image")
+			}
+			return filepath.Join(test.TestCacheFolder, util.Hash(filename)), false, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("", "", []string{"commons.wikimedia.org"}, "upload.wikimedia.org", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	err := wikipediaService.DownloadImages([]string{"File:Foo.jpg", "File:Broken.jpg", "Datei:Foo.jpg", "File:Bar.jpg"})
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertEqual(t, "broken image", err.Error())
+	test.AssertEqual(t, 1, imageUrlRequests)
+	test.AssertEqual(t, 3, len(requestedImageUrls))
+}
+
+func TestDownloadImages_unknownImage(t *testing.T) {
+	// Arrange
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"query":{"pages":{"-1":{"title":"File:Foo.jpg","missing":""}}}}`), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	imageDownloads := 0
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			if strings.Contains(url, "upload") {
+				imageDownloads++
+			}
+			return filepath.Join(test.TestCacheFolder, filename), false, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("", "", []string{"commons.wikimedia.org"}, "upload.wikimedia.org", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	err := wikipediaService.DownloadImages([]string{"File:Foo.jpg"})
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertEqual(t, "Image File:Foo.jpg not found on any image article host [commons.wikimedia.org]", err.Error())
+	test.AssertEqual(t, 0, imageDownloads)
+}
+
+func TestUniqueImages(t *testing.T) {
+	test.AssertEqual(t, []string{"File:Foo.jpg", "File:Bar.jpg"}, uniqueImages([]string{"File:Foo.jpg", "File:Bar.jpg", "Datei:Foo.jpg", "File:Bar.jpg"}))
+	test.AssertEqual(t, 0, len(uniqueImages([]string{})))
 }
 
 func TestEvaluateTemplate_newTemplate(t *testing.T) {
@@ -305,71 +436,239 @@ func TestEvaluateTemplate_newTemplate(t *testing.T) {
 	// Evaluate content
 	content, err := wikipediaService.EvaluateTemplate("{{Hauptartikel|Sternentstehung}}", key)
 	test.AssertNil(t, err)
-	test.AssertEqual(t, 1, mockHttpService.DownloadAndCacheCounter)
-	test.AssertEqual(t, 0, mockHttpService.PostFormEncodedCounter)
+	test.AssertEqual(t, int32(1), mockHttpService.DownloadAndCacheCounter.Load())
+	test.AssertEqual(t, int32(0), mockHttpService.PostFormEncodedCounter.Load())
 	test.AssertEqual(t, expectedTemplateContent, content)
 }
 
-func TestGetMathResource_withoutCachedFile(t *testing.T) {
+func TestGetMathResource(t *testing.T) {
 	mathString := "x = 42"
+	filename := util.Hash(mathString)
 
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) { return []byte("some-svg-filename"), nil }
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(nil, nil)
+	mockHttpService.PostFormEncodedAndCacheFunc = func(url string, requestData string, cacheFolder string, cacheFilename string, responseContent func(response *netHttp.Response) (string, error)) (string, bool, error) {
+		test.AssertEqual(t, "https://math/check/tex", url)
+		test.AssertEqual(t, cache.MathCacheDirName, cacheFolder)
+		test.AssertEqual(t, filename, cacheFilename)
+		return "cache/math/" + filename, true, nil
+	}
+	imageProcessingServiceMock := image.NewMockImageProcessingService()
+	wikipediaService := NewWikipediaService("", "", []string{}, "", "https://math", imageProcessingServiceMock, mockHttpService)
+
+	locationHeader, err := wikipediaService.getMathResource(mathString)
+
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "some-svg-filename", locationHeader)
+	test.AssertEqual(t, int32(0), mockHttpService.DownloadAndCacheCounter.Load())
+	test.AssertEqual(t, int32(0), mockHttpService.PostFormEncodedCounter.Load())
+	test.AssertEqual(t, int32(1), mockHttpService.PostFormEncodedAndCacheCounter.Load())
+}
+
+func TestMathResourceLocation(t *testing.T) {
 	header := netHttp.Header{}
-	header.Set("x-resource-location", "some-svg-content")
+	header.Set("x-resource-location", "some-svg-filename")
+	response := &netHttp.Response{Header: header, Body: io.NopCloser(strings.NewReader(""))}
+	responseWithoutHeader := &netHttp.Response{Header: netHttp.Header{}, Body: io.NopCloser(strings.NewReader("some error"))}
+
+	location, err := mathResourceLocation(response)
+	_, errWithoutHeader := mathResourceLocation(responseWithoutHeader)
 
-	mockFile := util.NewMockFile("mock file")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "some-svg-filename", location)
+	test.AssertNotNil(t, errWithoutHeader)
+}
+
+func TestResolveRedirects(t *testing.T) {
+	// Arrange
+	var titles []string
+	for i := 0; i < 55; i++ {
+		titles = append(titles, fmt.Sprintf("Article %d", i))
+	}
+	titles = append(titles, "sun", "Article 0", "", "Foo|Bar")
+
+	var requestedUrls []string
+	responses := []string{
+		`{"query":{"redirects":[{"from":"Article 1","to":"Foo"}],"pages":{}}}`,
+		`{"query":{"normalized":[{"from":"sun","to":"Sun"}],"redirects":[{"from":"Sun","to":"Sonne"}],"pages":{}}}`,
+	}
 
 	fsMock := util.NewDefaultMockFilesystem()
-	fsMock.CreateTempFunc = func(dir, pattern string) (util.FileLike, error) { return mockFile, nil }
-	fsMock.StatFunc = func(name string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) { return []byte(responses[len(requestedUrls)-1]), nil }
 	util.CurrentFilesystem = fsMock
 
 	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrls = append(requestedUrls, url)
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
 		nil,
-		func(url, contentType string) (resp *netHttp.Response, err error) {
-			return &netHttp.Response{
-				Body:       io.NopCloser(bytes.NewReader([]byte(mathString))),
-				StatusCode: netHttp.StatusOK,
-				Header:     header,
-			}, nil
+	)
+	wikipediaService := NewWikipediaService("de", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	redirects, err := wikipediaService.ResolveRedirects(titles)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 2, len(requestedUrls))
+	test.AssertTrue(t, strings.HasPrefix(requestedUrls[0], "https://de.wikipedia.org/w/api.php?action=query&redirects=true&format=json&titles=Article+0%7CArticle+1%7C"))
+	test.AssertEqual(t, "https://de.wikipedia.org/w/api.php?action=query&redirects=true&format=json&titles=Article+50%7CArticle+51%7CArticle+52%7CArticle+53%7CArticle+54%7Csun", requestedUrls[1])
+	test.AssertMapEqual(t, map[string]string{
+		"Article 1": "Foo",
+		"sun":       "Sonne",
+	}, redirects)
+}
+
+func TestGetCategoryMembers(t *testing.T) {
+	// Arrange
+	var requestedUrls []string
+	responses := []string{
+		`{"continue":{"cmcontinue":"page|4d415253|123","continue":"-||"},"query":{"categorymembers":[{"pageid":1,"ns":0,"title":"Earth"},{"pageid":2,"ns":14,"title":"Category:Dwarf planets"}]}}`,
+		`{"batchcomplete":"","query":{"categorymembers":[{"pageid":3,"ns":0,"title":"Mars"},{"pageid":4,"ns":10,"title":"Template:Planets"}]}}`,
+	}
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) { return []byte(responses[len(requestedUrls)-1]), nil }
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrls = append(requestedUrls, url)
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
 		},
+		nil,
 	)
-	imageProcessingServiceMock := image.NewMockImageProcessingService()
-	wikipediaService := NewWikipediaService("", "", []string{}, "", "", imageProcessingServiceMock, mockHttpService)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
 
-	locationHeader, err := wikipediaService.getMathResource(mathString)
+	// Act
+	articles, subcategories, err := wikipediaService.GetCategoryMembers("Category:Planets")
 
+	// Assert
 	test.AssertNil(t, err)
-	test.AssertEqual(t, string(mockFile.WrittenBytes), locationHeader)
-	test.AssertEqual(t, 0, mockHttpService.DownloadAndCacheCounter)
-	test.AssertEqual(t, 1, mockHttpService.PostFormEncodedCounter)
+	test.AssertEqual(t, []string{
+		"https://en.wikipedia.org/w/api.php?action=query&list=categorymembers&cmtype=page%7Csubcat&cmnamespace=0%7C14&cmlimit=max&format=json&cmtitle=Category%3APlanets",
+		"https://en.wikipedia.org/w/api.php?action=query&list=categorymembers&cmtype=page%7Csubcat&cmnamespace=0%7C14&cmlimit=max&format=json&cmtitle=Category%3APlanets&cmcontinue=page%7C4d415253%7C123",
+	}, requestedUrls)
+	test.AssertEqual(t, []string{"Earth", "Mars"}, articles)
+	test.AssertEqual(t, []string{"Category:Dwarf planets"}, subcategories)
 }
 
-func TestGetMathResource_withCachedFile(t *testing.T) {
-	mathString := "x = 42"
-	filename := util.Hash(mathString)
+func TestDownloadArticleRevision(t *testing.T) {
+	// Arrange
+	requestedUrl := ""
+	requestedFile := ""
 
 	fsMock := util.NewDefaultMockFilesystem()
-	fsMock.ReadFileFunc = func(name string) ([]byte, error) { return []byte(filename), nil }
-	fsMock.StatFunc = func(name string) (os.FileInfo, error) { return util.NewMockFileInfoWithTime("file", time.Now()), nil }
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"parse":{"title":"Earth","pageid":9228,"revid":1234,"wikitext":{"*":"Old text"}}}`), nil
+	}
 	util.CurrentFilesystem = fsMock
 
-	mockHttpService := http.NewMockHttpService(nil, nil)
-	mockHttpService.PostFormEncodedFunc = func(url, contentType string) (resp *netHttp.Response, err error) {
-		return &netHttp.Response{
-			StatusCode: netHttp.StatusOK,
-			Header: netHttp.Header{
-				"X-Resource-Location": {"some-value"},
-			},
-		}, nil
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrl = url
+			requestedFile = filename
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	article, err := wikipediaService.DownloadArticleRevision("en.wikipedia.org", "Earth", 1234)
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, "https://en.wikipedia.org/w/api.php?action=parse&prop=wikitext%7Crevid&format=json&oldid=1234", requestedUrl)
+	test.AssertEqual(t, "Earth@1234.json", requestedFile)
+	test.AssertEqual(t, 1234, article.Parse.RevisionId)
+	test.AssertEqual(t, "Old text", article.Parse.Wikitext.Content)
+	test.AssertEqual(t, "Earth", article.Parse.OriginalTitle)
+}
+
+func TestGetRevisionAtDate(t *testing.T) {
+	// Arrange
+	requestedUrl := ""
+
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"batchcomplete":"","query":{"pages":{"9228":{"pageid":9228,"ns":0,"title":"Earth","revisions":[{"revid":1234,"parentid":1233,"timestamp":"2024-01-01T12:00:00Z"}]}}}}`), nil
 	}
-	imageProcessingServiceMock := image.NewMockImageProcessingService()
-	wikipediaService := NewWikipediaService("", "", []string{}, "", "", imageProcessingServiceMock, mockHttpService)
+	util.CurrentFilesystem = fsMock
 
-	locationHeader, err := wikipediaService.getMathResource(mathString)
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			requestedUrl = url
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	revision, err := wikipediaService.GetRevisionAtDate("en.wikipedia.org", "Earth", "2024-01-01")
+	_, invalidDateErr := wikipediaService.GetRevisionAtDate("en.wikipedia.org", "Earth", "01.01.2024")
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 1234, revision)
+	test.AssertEqual(t, "https://en.wikipedia.org/w/api.php?action=query&prop=revisions&rvprop=ids%7Ctimestamp&rvlimit=1&rvdir=older&redirects=true&format=json&rvstart=2024-01-01T23%3A59%3A59Z&titles=Earth", requestedUrl)
+	test.AssertNotNil(t, invalidDateErr)
+}
+
+func TestGetRevisionAtDate_missingArticle(t *testing.T) {
+	// Arrange
+	fsMock := util.NewDefaultMockFilesystem()
+	fsMock.ReadFileFunc = func(name string) ([]byte, error) {
+		return []byte(`{"batchcomplete":"","query":{"pages":{"-1":{"ns":0,"title":"Foobar","missing":""}}}}`), nil
+	}
+	util.CurrentFilesystem = fsMock
+
+	mockHttpService := http.NewMockHttpService(
+		func(url string, cacheFolder string, filename string) (string, bool, error) {
+			return filepath.Join(test.TestCacheFolder, filename), true, nil
+		},
+		nil,
+	)
+	wikipediaService := NewWikipediaService("en", "wikipedia.org", []string{}, "", "", image.NewMockImageProcessingService(), mockHttpService)
+
+	// Act
+	revision, err := wikipediaService.GetRevisionAtDate("en.wikipedia.org", "Foobar", "2024-01-01")
+
+	// Assert
+	test.AssertNotNil(t, err)
+	test.AssertEqual(t, 0, revision)
+}
+
+func TestLatestRevisionOfQuery(t *testing.T) {
+	// Arrange
+	content := []byte(`{"batchcomplete":"","query":{"pages":{"9228":{"pageid":9228,"ns":0,"title":"Earth","revisions":[{"revid":1234,"parentid":1233}]}}}}`)
+	missingContent := []byte(`{"batchcomplete":"","query":{"pages":{"-1":{"ns":0,"title":"Foobar","missing":""}}}}`)
+
+	// Act
+	revision, err := latestRevisionOfQuery(content)
+	_, missingErr := latestRevisionOfQuery(missingContent)
 
+	// Assert
 	test.AssertNil(t, err)
-	test.AssertEqual(t, filename, locationHeader)
+	test.AssertEqual(t, 1234, revision)
+	test.AssertNotNil(t, missingErr)
+}
 
-	test.AssertEqual(t, 0, mockHttpService.DownloadAndCacheCounter)
-	test.AssertEqual(t, 0, mockHttpService.PostFormEncodedCounter)
+func TestRevisionOfArticle(t *testing.T) {
+	// Arrange
+	content := []byte(`{"parse":{"title":"Earth","pageid":9228,"revid":1234,"wikitext":{"*":"foo"}}}`)
+
+	// Act
+	revision, err := revisionOfArticle(content)
+	_, invalidErr := revisionOfArticle([]byte(`{"error":{"code":"missingtitle"}}`))
+
+	// Assert
+	test.AssertNil(t, err)
+	test.AssertEqual(t, 1234, revision)
+	test.AssertNotNil(t, invalidErr)
 }